@@ -55,7 +55,7 @@ func GitRepo(ctx context.Context, repo *types.Repo) (gitserver.Repo, error) {
 	if result.Repo == nil {
 		return gitserver.Repo{Name: repo.Name}, repoupdater.ErrNotFound
 	}
-	return gitserver.Repo{Name: result.Repo.Name, URL: result.Repo.VCS.URL}, nil
+	return gitserver.Repo{Name: result.Repo.Name, URL: result.Repo.VCS.URL, CloneOptions: result.Repo.VCS.CloneOptions}, nil
 }
 
 func quickGitserverRepo(ctx context.Context, repo api.RepoName, serviceType string) (*gitserver.Repo, error) {
@@ -21,3 +21,9 @@ func (symbols) ListTags(ctx context.Context, args search.SymbolsParameters) ([]p
 	}
 	return result.Symbols, err
 }
+
+// SearchAggregated searches the symbols of many repositories in the aggregated
+// index of the symbols service.
+func (symbols) SearchAggregated(ctx context.Context, repos []protocol.RepoCommit, args search.SymbolsParameters) (*protocol.AggregatedSearchResult, error) {
+	return symbolsclient.DefaultClient.SearchAggregated(ctx, repos, args)
+}
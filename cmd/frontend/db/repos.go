@@ -117,6 +117,49 @@ func (s *repos) GetByIDs(ctx context.Context, ids ...api.RepoID) ([]*types.Repo,
 	return s.getReposBySQL(ctx, true, q)
 }
 
+// GetStars returns the number of stars of the given repositories on their
+// code host, as recorded in their metadata by repo-updater. Repositories
+// without a star count are omitted.
+//
+// 🚨 SECURITY: This method does NOT enforce repository permissions. It must
+// only be called with the IDs of repositories the current user can access.
+func (s *repos) GetStars(ctx context.Context, ids ...api.RepoID) (map[api.RepoID]int, error) {
+	if Mocks.Repos.GetStars != nil {
+		return Mocks.Repos.GetStars(ctx, ids...)
+	}
+
+	stars := make(map[api.RepoID]int, len(ids))
+	if len(ids) == 0 {
+		return stars, nil
+	}
+
+	items := make([]*sqlf.Query, len(ids))
+	for i := range ids {
+		items[i] = sqlf.Sprintf("%d", ids[i])
+	}
+	q := sqlf.Sprintf(
+		"SELECT id, (metadata->>'StargazerCount')::int FROM repo WHERE deleted_at IS NULL AND id IN (%s) AND metadata->>'StargazerCount' IS NOT NULL",
+		sqlf.Join(items, ","),
+	)
+	rows, err := dbconn.Global.QueryContext(ctx, q.Query(sqlf.PostgresBindVar), q.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id    api.RepoID
+			count int
+		)
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, err
+		}
+		stars[id] = count
+	}
+	return stars, rows.Err()
+}
+
 func (s *repos) Count(ctx context.Context, opt ReposListOptions) (int, error) {
 	if Mocks.Repos.Count != nil {
 		return Mocks.Repos.Count(ctx, opt)
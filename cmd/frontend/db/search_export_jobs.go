@@ -0,0 +1,313 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/keegancsmith/sqlf"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+	"github.com/sourcegraph/sourcegraph/internal/db/dbconn"
+	"github.com/sourcegraph/sourcegraph/internal/db/dbutil"
+)
+
+// searchExportJobs stores search export jobs and the per-repository
+// checkpoints of their progress.
+type searchExportJobs struct{}
+
+type searchExportJobNotFoundError struct {
+	id int64
+}
+
+func (e searchExportJobNotFoundError) Error() string {
+	return fmt.Sprintf("search export job not found: %v", e.id)
+}
+
+func (e searchExportJobNotFoundError) NotFound() bool {
+	return true
+}
+
+// Create creates a queued search export job.
+func (s *searchExportJobs) Create(ctx context.Context, job *types.SearchExportJob) (*types.SearchExportJob, error) {
+	if Mocks.SearchExportJobs.Create != nil {
+		return Mocks.SearchExportJobs.Create(ctx, job)
+	}
+
+	var id int64
+	err := dbconn.Global.QueryRowContext(ctx,
+		"INSERT INTO search_export_jobs(user_id, query, pattern_type, format) VALUES($1, $2, $3, $4) RETURNING id",
+		job.UserID, job.Query, job.PatternType, job.Format,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, id)
+}
+
+const searchExportJobColumns = `
+	j.id, j.user_id, j.query, j.pattern_type, j.format, j.state, j.failure_message,
+	j.created_at, j.started_at, j.finished_at, j.heartbeat_at, j.attempt,
+	p.total, p.completed, p.errored, p.match_count
+FROM search_export_jobs j
+LEFT JOIN LATERAL (
+	SELECT
+		COUNT(*) AS total,
+		COUNT(*) FILTER (WHERE r.state = 'completed') AS completed,
+		COUNT(*) FILTER (WHERE r.state = 'errored') AS errored,
+		COALESCE(SUM(r.match_count), 0) AS match_count
+	FROM search_export_job_repos r WHERE r.job_id = j.id
+) p ON true
+`
+
+func (*searchExportJobs) getBySQL(ctx context.Context, query *sqlf.Query) ([]*types.SearchExportJob, error) {
+	q := sqlf.Sprintf("SELECT "+searchExportJobColumns+"%s", query)
+	rows, err := dbconn.Global.QueryContext(ctx, q.Query(sqlf.PostgresBindVar), q.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*types.SearchExportJob
+	for rows.Next() {
+		var j types.SearchExportJob
+		if err := rows.Scan(
+			&j.ID, &j.UserID, &j.Query, &j.PatternType, &j.Format, &j.State, &j.FailureMessage,
+			&j.CreatedAt, &j.StartedAt, &j.FinishedAt, &j.HeartbeatAt, &j.Attempt,
+			&j.ReposTotal, &j.ReposCompleted, &j.ReposErrored, &j.MatchCount,
+		); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &j)
+	}
+	return jobs, rows.Err()
+}
+
+// GetByID returns the search export job with the given ID.
+//
+// 🚨 SECURITY: This method does NOT verify the user's identity. It is the
+// callers responsibility to ensure only the creator of the job or a site
+// admin can access it.
+func (s *searchExportJobs) GetByID(ctx context.Context, id int64) (*types.SearchExportJob, error) {
+	if Mocks.SearchExportJobs.GetByID != nil {
+		return Mocks.SearchExportJobs.GetByID(ctx, id)
+	}
+
+	jobs, err := s.getBySQL(ctx, sqlf.Sprintf("WHERE j.id=%d", id))
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, searchExportJobNotFoundError{id: id}
+	}
+	return jobs[0], nil
+}
+
+// ListByUserID returns the search export jobs created by the user, most
+// recent first.
+func (s *searchExportJobs) ListByUserID(ctx context.Context, userID int32) ([]*types.SearchExportJob, error) {
+	if Mocks.SearchExportJobs.ListByUserID != nil {
+		return Mocks.SearchExportJobs.ListByUserID(ctx, userID)
+	}
+	return s.getBySQL(ctx, sqlf.Sprintf("WHERE j.user_id=%d ORDER BY j.id DESC", userID))
+}
+
+// Cancel cancels a queued or processing job. A worker processing the job
+// stops after its current repository.
+func (*searchExportJobs) Cancel(ctx context.Context, id int64) error {
+	res, err := dbconn.Global.ExecContext(ctx,
+		"UPDATE search_export_jobs SET state='canceled', finished_at=now() WHERE id=$1 AND state IN ('queued', 'processing')",
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return searchExportJobNotFoundError{id: id}
+	}
+	return nil
+}
+
+// Dequeue marks the oldest queued job as processing and returns it. Jobs
+// whose worker has not sent a heartbeat for longer than staleAfter (e.g.
+// because the frontend restarted) are dequeued again, so that their
+// processing resumes. Every dequeue starts a new attempt of the job, and
+// only the worker of the latest attempt can record heartbeats and results.
+// It returns nil if there is no job to process.
+func (s *searchExportJobs) Dequeue(ctx context.Context, staleAfter time.Duration) (*types.SearchExportJob, error) {
+	q := sqlf.Sprintf(`
+UPDATE search_export_jobs SET
+	state='processing',
+	started_at=COALESCE(started_at, now()),
+	heartbeat_at=now(),
+	attempt=attempt+1
+WHERE id = (
+	SELECT id FROM search_export_jobs
+	WHERE state='queued' OR (state='processing' AND heartbeat_at < now() - %s * interval '1 second')
+	ORDER BY id ASC
+	FOR UPDATE SKIP LOCKED LIMIT 1
+)
+RETURNING id`, int(staleAfter/time.Second))
+
+	var id int64
+	err := dbconn.Global.QueryRowContext(ctx, q.Query(sqlf.PostgresBindVar), q.Args()...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, id)
+}
+
+// Heartbeat records that the worker of the given attempt is still
+// processing the job. It returns false if the job is no longer processed by
+// that attempt, e.g. because it was canceled or dequeued again by another
+// worker.
+func (*searchExportJobs) Heartbeat(ctx context.Context, id int64, attempt int32) (bool, error) {
+	res, err := dbconn.Global.ExecContext(ctx,
+		"UPDATE search_export_jobs SET heartbeat_at=now() WHERE id=$1 AND attempt=$2 AND state='processing'",
+		id, attempt,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// Finish marks a job processed by the given attempt as completed or
+// errored.
+func (*searchExportJobs) Finish(ctx context.Context, id int64, attempt int32, state string, failureMessage *string) error {
+	_, err := dbconn.Global.ExecContext(ctx,
+		"UPDATE search_export_jobs SET state=$3, failure_message=$4, finished_at=now() WHERE id=$1 AND attempt=$2 AND state='processing'",
+		id, attempt, state, failureMessage,
+	)
+	return err
+}
+
+// AddRepos adds the repositories to search to a job. Repositories that were
+// already added are ignored.
+func (*searchExportJobs) AddRepos(ctx context.Context, jobID int64, repos []*types.Repo) error {
+	const batchSize = 1000
+	return dbutil.Transaction(ctx, dbconn.Global, func(tx *sql.Tx) error {
+		for len(repos) > 0 {
+			batch := repos
+			if len(batch) > batchSize {
+				batch = batch[:batchSize]
+			}
+			repos = repos[len(batch):]
+
+			values := make([]*sqlf.Query, 0, len(batch))
+			for _, repo := range batch {
+				values = append(values, sqlf.Sprintf("(%s, %s, %s)", jobID, repo.ID, repo.Name))
+			}
+			q := sqlf.Sprintf(
+				"INSERT INTO search_export_job_repos(job_id, repo_id, repo_name) VALUES %s ON CONFLICT DO NOTHING",
+				sqlf.Join(values, ","),
+			)
+			if _, err := tx.ExecContext(ctx, q.Query(sqlf.PostgresBindVar), q.Args()...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SearchExportJobReposListOptions specifies the options for listing the
+// repositories of a search export job.
+type SearchExportJobReposListOptions struct {
+	// State, if non-empty, only lists repositories in this state.
+	State string
+	// Limit is the maximum number of repositories to list, or 0 for all.
+	Limit int
+}
+
+// ListRepos lists the repositories of a job in order of their ID.
+func (*searchExportJobs) ListRepos(ctx context.Context, jobID int64, opt SearchExportJobReposListOptions) ([]*types.SearchExportJobRepo, error) {
+	if Mocks.SearchExportJobs.ListRepos != nil {
+		return Mocks.SearchExportJobs.ListRepos(ctx, jobID, opt)
+	}
+
+	conds := []*sqlf.Query{sqlf.Sprintf("job_id=%d", jobID)}
+	if opt.State != "" {
+		conds = append(conds, sqlf.Sprintf("state=%s", opt.State))
+	}
+	limit := &sqlf.Query{}
+	if opt.Limit > 0 {
+		limit = sqlf.Sprintf("LIMIT %d", opt.Limit)
+	}
+	q := sqlf.Sprintf(
+		"SELECT job_id, repo_id, repo_name, state, match_count, output, error, finished_at FROM search_export_job_repos WHERE (%s) ORDER BY repo_id ASC %s",
+		sqlf.Join(conds, ") AND ("), limit,
+	)
+	rows, err := dbconn.Global.QueryContext(ctx, q.Query(sqlf.PostgresBindVar), q.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var repos []*types.SearchExportJobRepo
+	for rows.Next() {
+		var r types.SearchExportJobRepo
+		if err := rows.Scan(&r.JobID, &r.RepoID, &r.RepoName, &r.State, &r.MatchCount, &r.Output, &r.Error, &r.FinishedAt); err != nil {
+			return nil, err
+		}
+		repos = append(repos, &r)
+	}
+	return repos, rows.Err()
+}
+
+// FinishRepo records the results of searching a repository of a job, which
+// is either completed or errored. It returns false without recording them if
+// the job is no longer processed by the given attempt.
+func (*searchExportJobs) FinishRepo(ctx context.Context, attempt int32, r *types.SearchExportJobRepo) (bool, error) {
+	res, err := dbconn.Global.ExecContext(ctx, `
+UPDATE search_export_job_repos SET state=$4, match_count=$5, output=$6, error=$7, finished_at=now()
+WHERE job_id=$1 AND repo_id=$2 AND EXISTS (
+	SELECT 1 FROM search_export_jobs WHERE id=$1 AND attempt=$3 AND state='processing'
+)`,
+		r.JobID, r.RepoID, attempt, r.State, r.MatchCount, r.Output, r.Error,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// WriteRepoOutputs writes the output of every repository of a job to w, in
+// order of the repository IDs. The outputs are read from a single query one
+// row at a time, so that they are not all held in memory.
+func (*searchExportJobs) WriteRepoOutputs(ctx context.Context, jobID int64, w io.Writer) error {
+	if Mocks.SearchExportJobs.WriteRepoOutputs != nil {
+		return Mocks.SearchExportJobs.WriteRepoOutputs(ctx, jobID, w)
+	}
+
+	rows, err := dbconn.Global.QueryContext(ctx,
+		"SELECT output FROM search_export_job_repos WHERE job_id=$1 ORDER BY repo_id ASC",
+		jobID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		// RawBytes refers to the row buffer of the driver instead of a copy
+		// of the output, and is only valid until the next call to Next.
+		var output sql.RawBytes
+		if err := rows.Scan(&output); err != nil {
+			return err
+		}
+		if _, err := w.Write(output); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,16 @@
+package db
+
+import (
+	"context"
+	"io"
+
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+)
+
+type MockSearchExportJobs struct {
+	Create           func(ctx context.Context, job *types.SearchExportJob) (*types.SearchExportJob, error)
+	GetByID          func(ctx context.Context, id int64) (*types.SearchExportJob, error)
+	ListByUserID     func(ctx context.Context, userID int32) ([]*types.SearchExportJob, error)
+	ListRepos        func(ctx context.Context, jobID int64, opt SearchExportJobReposListOptions) ([]*types.SearchExportJobRepo, error)
+	WriteRepoOutputs func(ctx context.Context, jobID int64, w io.Writer) error
+}
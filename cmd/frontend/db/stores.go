@@ -13,6 +13,7 @@ var (
 	Orgs                      = &orgs{}
 	OrgMembers                = &orgMembers{}
 	SavedSearches             = &savedSearches{}
+	SearchExportJobs          = &searchExportJobs{}
 	Settings                  = &settings{}
 	Users                     = &users{}
 	UserEmails                = &userEmails{}
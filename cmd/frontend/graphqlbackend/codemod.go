@@ -2,6 +2,7 @@ package graphqlbackend
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -38,6 +39,10 @@ type args struct {
 	rewriteTemplate   string
 	includeFileFilter string
 	excludeFileFilter string
+
+	// strict reports malformed, too long or truncated replacer output as an
+	// error instead of skipping it, so that no rewritten file goes missing.
+	strict bool
 }
 
 // codemodResultResolver is a resolver for the GraphQL type `CodemodResult`
@@ -120,27 +125,36 @@ func validateQuery(q query.QueryInfo) (*args, error) {
 		rewriteTemplate = replacementValues[0]
 	}
 
+	includeFileFilter, excludeFileFilter, err := codemodFileFilters(q)
+	if err != nil {
+		return nil, err
+	}
+
+	return &args{matchTemplate: matchTemplate, rewriteTemplate: rewriteTemplate, includeFileFilter: includeFileFilter, excludeFileFilter: excludeFileFilter}, nil
+}
+
+// codemodFileFilters returns the file extension to rewrite and the directory
+// to exclude from the file: and -file: filters of q.
+func codemodFileFilters(q query.QueryInfo) (includeFileFilterText, excludeFileFilterText string, err error) {
 	includeFileFilter, excludeFileFilter := q.RegexpPatterns(query.FieldFile)
-	var includeFileFilterText string
 	if len(includeFileFilter) > 0 {
 		includeFileFilterText = includeFileFilter[0]
 		// only file names or files with extensions in the following characterset are allowed
 		IsAlphanumericWithPeriod := lazyregexp.New(`^[a-zA-Z0-9_.]+$`).MatchString
 		if !IsAlphanumericWithPeriod(includeFileFilterText) {
-			return nil, errors.New("the 'file:' filter cannot contain regex when using the 'replace:' filter currently. Only alphanumeric characters or '.'")
+			return "", "", errors.New("the 'file:' filter cannot contain regex when using the 'replace:' filter currently. Only alphanumeric characters or '.'")
 		}
 	}
 
-	var excludeFileFilterText string
 	if len(excludeFileFilter) > 0 {
 		excludeFileFilterText = excludeFileFilter[0]
 		IsAlphanumericWithPeriod := lazyregexp.New(`^[a-zA-Z_.]+$`).MatchString
 		if !IsAlphanumericWithPeriod(includeFileFilterText) {
-			return nil, errors.New("the '-file:' filter cannot contain regex when using the 'replace:' filter currently. Only alphanumeric characters or '.'")
+			return "", "", errors.New("the '-file:' filter cannot contain regex when using the 'replace:' filter currently. Only alphanumeric characters or '.'")
 		}
 	}
 
-	return &args{matchTemplate, rewriteTemplate, includeFileFilterText, excludeFileFilterText}, nil
+	return includeFileFilterText, excludeFileFilterText, nil
 }
 
 // Calls the codemod backend replacer service for a set of repository revisions.
@@ -302,6 +316,14 @@ func callCodemodInRepo(ctx context.Context, repoRevs *search.RepositoryRevisions
 			continue
 		}
 		if err := json.Unmarshal(b, &raw); err != nil {
+			if args.strict && len(bytes.TrimSpace(b)) > 0 {
+				// The replacer writes its own timeout as a plain text
+				// line after the 200 header.
+				if len(b) > 100 {
+					b = b[:100]
+				}
+				return nil, errors.Wrapf(err, "invalid replacer output %q", b)
+			}
 			// skip on other decode errors (including e.g., empty
 			// responses if dependencies are not installed)
 			continue
@@ -323,6 +345,12 @@ func callCodemodInRepo(ctx context.Context, repoRevs *search.RepositoryRevisions
 			matches: matches,
 		})
 	}
+	if err := scanner.Err(); err != nil && args.strict {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, errors.Wrap(err, "reading replacer output")
+	}
 
 	return results, nil
 }
@@ -0,0 +1,278 @@
+package graphqlbackend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-diff/diff"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/goroutine"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/conf"
+	"github.com/sourcegraph/sourcegraph/internal/search"
+	"github.com/sourcegraph/sourcegraph/internal/search/query"
+	"github.com/sourcegraph/sourcegraph/internal/vcs/git"
+)
+
+// maxConcurrentRewritePreviews is the maximum number of repositories that a
+// structural rewrite preview rewrites concurrently.
+const maxConcurrentRewritePreviews = 10
+
+func (r *schemaResolver) PreviewStructuralRewrite(ctx context.Context, previewArgs *struct {
+	MatchTemplate   string
+	RewriteTemplate string
+	ScopeQuery      string
+}) (*structuralRewritePreviewResolver, error) {
+	if !conf.StructuralSearchEnabled() {
+		return nil, errors.New("Structural search is disabled in the site configuration.")
+	}
+	if previewArgs.MatchTemplate == "" {
+		return nil, errors.New("the match template must be non-empty")
+	}
+
+	patternType := "literal"
+	impl, err := NewSearchImplementer(&SearchArgs{Version: "V2", PatternType: &patternType, Query: previewArgs.ScopeQuery})
+	if err != nil {
+		return nil, err
+	}
+	sr, ok := impl.(*searchResolver)
+	if !ok {
+		// Invalid queries are reported as alerts.
+		if alert, ok := impl.(*searchAlert); ok {
+			return nil, fmt.Errorf("%s: %s", alert.title, alert.description)
+		}
+		return nil, errors.New("unsupported scope query")
+	}
+	for _, v := range sr.query.Values(query.FieldDefault) {
+		if (v.String != nil && *v.String != "") || v.Regexp != nil {
+			return nil, errors.New("the scope query must not contain a search pattern, use the match template instead")
+		}
+	}
+
+	includeFileFilter, excludeFileFilter, err := codemodFileFilters(sr.query)
+	if err != nil {
+		return nil, err
+	}
+	cmodArgs := &args{
+		matchTemplate:     previewArgs.MatchTemplate,
+		rewriteTemplate:   previewArgs.RewriteTemplate,
+		includeFileFilter: includeFileFilter,
+		excludeFileFilter: excludeFileFilter,
+		strict:            true,
+	}
+
+	repoRevs, missingRepoRevs, overLimit, err := sr.resolveRepositories(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if overLimit {
+		return nil, fmt.Errorf("the scope query matches more than %d repositories, use repo: to rewrite fewer repositories", maxReposToSearch())
+	}
+
+	repos := previewStructuralRewrite(ctx, repoRevs, cmodArgs)
+	for _, repoRev := range missingRepoRevs {
+		repos = append(repos, &repositoryRewritePreviewResolver{
+			repo: &RepositoryResolver{repo: repoRev.Repo},
+			err:  fmt.Errorf("revision %q not found", repoRev.RevSpecs()[0]),
+		})
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].repo.repo.Name < repos[j].repo.repo.Name })
+
+	diffStat := &DiffStat{}
+	for _, repo := range repos {
+		diffStat.AddStat(repo.stat)
+	}
+	return &structuralRewritePreviewResolver{repos: repos, diffStat: diffStat}, nil
+}
+
+// previewStructuralRewrite runs the replacer in each repository. It returns
+// the previews of the repositories that the rewrite changes or could not
+// rewrite.
+func previewStructuralRewrite(ctx context.Context, repoRevs []*search.RepositoryRevisions, args *args) []*repositoryRewritePreviewResolver {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		sem   = make(chan struct{}, maxConcurrentRewritePreviews)
+		repos []*repositoryRewritePreviewResolver
+	)
+	for _, repoRev := range repoRevs {
+		wg.Add(1)
+		repoRev := repoRev // shadow variable so it doesn't change while goroutine is running
+		goroutine.Go(func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			repo, err := previewStructuralRewriteInRepo(ctx, repoRev, args)
+			if err != nil {
+				repo = &repositoryRewritePreviewResolver{
+					repo: &RepositoryResolver{repo: repoRev.Repo},
+					err:  err,
+				}
+			}
+			if repo == nil {
+				return
+			}
+			mu.Lock()
+			repos = append(repos, repo)
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	return repos
+}
+
+// previewStructuralRewriteInRepo returns the preview of the rewrite of a
+// single repository, or nil if the rewrite does not change it.
+func previewStructuralRewriteInRepo(ctx context.Context, repoRev *search.RepositoryRevisions, args *args) (*repositoryRewritePreviewResolver, error) {
+	results, err := callCodemodInRepo(ctx, repoRev, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	repo := &repositoryRewritePreviewResolver{repo: &RepositoryResolver{repo: repoRev.Repo}}
+	commit := api.CommitID(results[0].commit.oid)
+	repo.baseRevision = &commit
+
+	baseRef, err := rewriteBaseRef(ctx, repoRev, commit)
+	if err != nil {
+		return nil, err
+	}
+	if baseRef != "" {
+		repo.baseRef = &baseRef
+	}
+
+	for _, result := range results {
+		file, err := newFileRewritePreview(result.path, result.diff)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid diff of %s", result.path)
+		}
+		repo.files = append(repo.files, file)
+	}
+	sort.Slice(repo.files, func(i, j int) bool { return repo.files[i].path < repo.files[j].path })
+
+	var patch strings.Builder
+	for _, file := range repo.files {
+		patch.WriteString(file.diff)
+		repo.stat.Added += file.stat.Added
+		repo.stat.Changed += file.stat.Changed
+		repo.stat.Deleted += file.stat.Deleted
+	}
+	repo.patch = patch.String()
+	return repo, nil
+}
+
+// rewriteBaseRef returns the ref of the rewritten revision of repoRev. A
+// commit ID or an empty revision refers to the default branch. It returns ""
+// if the repository has no default branch.
+func rewriteBaseRef(ctx context.Context, repoRev *search.RepositoryRevisions, commit api.CommitID) (string, error) {
+	rev := repoRev.Revs[0].RevSpec
+	if rev != "" && rev != "HEAD" && rev != string(commit) {
+		return git.EnsureRefPrefix(rev), nil
+	}
+
+	refBytes, _, exitCode, err := git.ExecSafe(ctx, repoRev.GitserverRepo(), []string{"symbolic-ref", "HEAD"})
+	if err != nil {
+		return "", err
+	}
+	if exitCode != 0 {
+		return "", nil
+	}
+	return string(bytes.TrimSpace(refBytes)), nil
+}
+
+// newFileRewritePreview returns the preview of the rewrite of a file from the
+// diff returned by the replacer. The diff headers are replaced with git diff
+// headers without filename prefixes, as campaign patches require.
+func newFileRewritePreview(path, rawDiff string) (*fileRewritePreviewResolver, error) {
+	i := strings.Index(rawDiff, "@@")
+	if i < 0 {
+		return nil, errors.Errorf("diff does not contain expected @@: %q", rawDiff)
+	}
+	d := fmt.Sprintf("diff --git %s %s\n--- %s\n+++ %s\n%s", path, path, path, path, rawDiff[i:])
+	if !strings.HasSuffix(d, "\n") {
+		d += "\n"
+	}
+
+	fileDiff, err := diff.ParseFileDiff([]byte(d))
+	if err != nil {
+		return nil, err
+	}
+	return &fileRewritePreviewResolver{
+		path: path,
+		diff: d,
+		stat: fileDiff.Stat(),
+	}, nil
+}
+
+// structuralRewritePreviewResolver is a resolver for the GraphQL type
+// `StructuralRewritePreview`.
+type structuralRewritePreviewResolver struct {
+	repos    []*repositoryRewritePreviewResolver
+	diffStat *DiffStat
+}
+
+func (r *structuralRewritePreviewResolver) Repositories() []*repositoryRewritePreviewResolver {
+	return r.repos
+}
+
+func (r *structuralRewritePreviewResolver) DiffStat() *DiffStat { return r.diffStat }
+
+// repositoryRewritePreviewResolver is a resolver for the GraphQL type
+// `RepositoryRewritePreview`.
+type repositoryRewritePreviewResolver struct {
+	repo         *RepositoryResolver
+	baseRevision *api.CommitID
+	baseRef      *string
+	files        []*fileRewritePreviewResolver
+	patch        string
+	stat         diff.Stat
+	err          error
+}
+
+func (r *repositoryRewritePreviewResolver) Repository() *RepositoryResolver { return r.repo }
+
+func (r *repositoryRewritePreviewResolver) BaseRevision() *string {
+	if r.baseRevision == nil {
+		return nil
+	}
+	s := string(*r.baseRevision)
+	return &s
+}
+
+func (r *repositoryRewritePreviewResolver) BaseRef() *string { return r.baseRef }
+
+func (r *repositoryRewritePreviewResolver) Files() []*fileRewritePreviewResolver { return r.files }
+
+func (r *repositoryRewritePreviewResolver) Patch() string { return r.patch }
+
+func (r *repositoryRewritePreviewResolver) DiffStat() *DiffStat { return NewDiffStat(r.stat) }
+
+func (r *repositoryRewritePreviewResolver) Error() *string {
+	if r.err == nil {
+		return nil
+	}
+	s := r.err.Error()
+	return &s
+}
+
+// fileRewritePreviewResolver is a resolver for the GraphQL type
+// `FileRewritePreview`.
+type fileRewritePreviewResolver struct {
+	path string
+	diff string
+	stat diff.Stat
+}
+
+func (r *fileRewritePreviewResolver) Path() string { return r.path }
+
+func (r *fileRewritePreviewResolver) Diff() string { return r.diff }
+
+func (r *fileRewritePreviewResolver) DiffStat() *DiffStat { return NewDiffStat(r.stat) }
@@ -1,10 +1,24 @@
 package graphqlbackend
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/go-diff/diff"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/conf"
+	"github.com/sourcegraph/sourcegraph/internal/search"
 	"github.com/sourcegraph/sourcegraph/internal/search/query"
+	"github.com/sourcegraph/sourcegraph/internal/vcs/git"
+	"github.com/sourcegraph/sourcegraph/schema"
 )
 
 func TestCodemod_validateArgsNoRegex(t *testing.T) {
@@ -39,3 +53,135 @@ func TestCodemod_resolver(t *testing.T) {
 		t.Fatalf("Expected error %q", err)
 	}
 }
+
+func TestPreviewStructuralRewrite(t *testing.T) {
+	conf.Mock(&conf.Unified{SiteConfiguration: schema.SiteConfiguration{ExperimentalFeatures: &schema.ExperimentalFeatures{}}})
+	defer conf.Mock(nil)
+
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		return api.CommitID(strings.Repeat("c", 40)), nil
+	}
+	git.Mocks.ExecSafe = func(params []string) (stdout, stderr []byte, exitCode int, err error) {
+		if want := []string{"symbolic-ref", "HEAD"}; !reflect.DeepEqual(params, want) {
+			t.Errorf("got params %q, want %q", params, want)
+		}
+		return []byte("refs/heads/master\n"), nil, 0, nil
+	}
+	defer git.ResetMocks()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("matchtemplate") != "foo(:[x])" || q.Get("rewritetemplate") != "bar(:[x])" || q.Get("fileextension") != ".go" {
+			t.Errorf("unexpected query %v", q)
+		}
+		switch q.Get("repo") {
+		case "a", "b":
+			fmt.Fprintln(w, `{"uri":"y.go","diff":"--- y.go\n+++ y.go\n@@ -1,1 +1,1 @@\n-foo(1)\n+bar(1)"}`)
+			fmt.Fprintln(w, `{"uri":"x.go","diff":"--- x.go\n+++ x.go\n@@ -1,2 +1,2 @@\n a\n-foo(2)\n+bar(2)"}`)
+		case "c":
+			// No changes.
+		case "f":
+			// The replacer timed out after it wrote the 200 header.
+			fmt.Fprintln(w, `{"uri":"y.go","diff":"--- y.go\n+++ y.go\n@@ -1,1 +1,1 @@\n-foo(1)\n+bar(1)"}`)
+			fmt.Fprintln(w, "Deadline hit")
+		case "g":
+			fmt.Fprintln(w, `{"uri":"y.go","diff":"--- y.go\n+++ y.go\n@@ -1,1 +1,1 @@\n-foo(1)\n+bar(1)"}`)
+			fmt.Fprintf(w, `{"uri":"x.go","diff":"%s"}`+"\n", strings.Repeat("x", 10*bufio.MaxScanTokenSize))
+		default:
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	defaultReplacerURL := ReplacerURL
+	ReplacerURL = server.URL
+	defer func() { ReplacerURL = defaultReplacerURL }()
+
+	repoRevs := func(name, rev string) *search.RepositoryRevisions {
+		return &search.RepositoryRevisions{
+			Repo: &types.Repo{Name: api.RepoName(name)},
+			Revs: []search.RevisionSpecifier{{RevSpec: rev}},
+		}
+	}
+	mockResolveRepositories = func(effectiveRepoFieldValues []string) (repoRevisions, missingRepoRevisions []*search.RepositoryRevisions, overLimit bool, err error) {
+		return []*search.RepositoryRevisions{repoRevs("d", ""), repoRevs("c", ""), repoRevs("f", ""), repoRevs("g", ""), repoRevs("b", "feature"), repoRevs("a", "")},
+			[]*search.RepositoryRevisions{repoRevs("e", "missing")}, false, nil
+	}
+	defer func() { mockResolveRepositories = nil }()
+
+	preview, err := (&schemaResolver{}).PreviewStructuralRewrite(context.Background(), &struct {
+		MatchTemplate   string
+		RewriteTemplate string
+		ScopeQuery      string
+	}{
+		MatchTemplate:   "foo(:[x])",
+		RewriteTemplate: "bar(:[x])",
+		ScopeQuery:      "repo:. file:.go",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type repoPreview struct {
+		Name, BaseRevision, BaseRef, Patch, Error string
+		Changed                                   int32
+	}
+	deref := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	var got []repoPreview
+	for _, r := range preview.Repositories() {
+		got = append(got, repoPreview{
+			Name:         r.Repository().Name(),
+			BaseRevision: deref(r.BaseRevision()),
+			BaseRef:      deref(r.BaseRef()),
+			Patch:        r.Patch(),
+			Error:        deref(r.Error()),
+			Changed:      r.DiffStat().Changed(),
+		})
+	}
+	patch := "diff --git x.go x.go\n--- x.go\n+++ x.go\n@@ -1,2 +1,2 @@\n a\n-foo(2)\n+bar(2)\n" +
+		"diff --git y.go y.go\n--- y.go\n+++ y.go\n@@ -1,1 +1,1 @@\n-foo(1)\n+bar(1)\n"
+	want := []repoPreview{
+		{Name: "a", BaseRevision: strings.Repeat("c", 40), BaseRef: "refs/heads/master", Patch: patch, Changed: 2},
+		{Name: "b", BaseRevision: strings.Repeat("c", 40), BaseRef: "refs/heads/feature", Patch: patch, Changed: 2},
+		{Name: "d", Error: "boom\n"},
+		{Name: "e", Error: `revision "missing" not found`},
+		{Name: "f", Error: `invalid replacer output "Deadline hit": invalid character 'D' looking for beginning of value`},
+		{Name: "g", Error: "reading replacer output: bufio.Scanner: token too long"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+	if changed := preview.DiffStat().Changed(); changed != 4 {
+		t.Errorf("got %d total changed lines, want 4", changed)
+	}
+
+	// The patches are valid campaign patches.
+	fileDiffs, err := diff.ParseMultiFileDiff([]byte(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileDiffs) != 2 || fileDiffs[0].OrigName != "x.go" || fileDiffs[1].NewName != "y.go" {
+		t.Errorf("unexpected file diffs %+v", fileDiffs)
+	}
+}
+
+func TestPreviewStructuralRewrite_scopeQueryPattern(t *testing.T) {
+	conf.Mock(&conf.Unified{SiteConfiguration: schema.SiteConfiguration{ExperimentalFeatures: &schema.ExperimentalFeatures{}}})
+	defer conf.Mock(nil)
+
+	_, err := (&schemaResolver{}).PreviewStructuralRewrite(context.Background(), &struct {
+		MatchTemplate   string
+		RewriteTemplate string
+		ScopeQuery      string
+	}{
+		MatchTemplate: "foo",
+		ScopeQuery:    "repo:a foo",
+	})
+	if err == nil || !strings.Contains(err.Error(), "must not contain a search pattern") {
+		t.Errorf("got error %v, want scope query pattern error", err)
+	}
+}
@@ -397,6 +397,35 @@ type Mutation {
     ): SavedSearch!
     # Deletes a saved search
     deleteSavedSearch(id: ID!): EmptyResponse
+    # Creates a search export job, which runs a search query on every repository it matches in the
+    # background and stores all of its matches in a downloadable file. Unlike interactive searches, an
+    # export is not limited by the result limit (count:) or the timeout of a search. The job is owned by
+    # the current user, and searches with their permissions.
+    createSearchExportJob(
+        # The search query.
+        query: String!
+        # The pattern type of the query, if it is not specified in the query with the patternType: field.
+        patternType: SearchPatternType
+        # The format of the result file.
+        format: SearchExportFormat!
+    ): SearchExportJob!
+    # Cancels a queued or processing search export job. Only the creator of the job and site admins
+    # may cancel it.
+    cancelSearchExportJob(id: ID!): EmptyResponse
+    # (experimental) Previews a structural rewrite of the repositories that a search query matches. It
+    # runs the rewrite on each repository and returns the changes as unified diffs, without changing
+    # any repository. The patches of the result can be passed to createPatchSetFromPatches to create a
+    # campaign from the rewrite.
+    previewStructuralRewrite(
+        # The structural search pattern to match, as in the replace: search query field.
+        matchTemplate: String!
+        # The template to rewrite the matches with.
+        rewriteTemplate: String!
+        # A search query that selects the repositories (and revisions) to rewrite, with repo: and
+        # related filters. It must not contain a search pattern. The file: and -file: filters restrict
+        # the rewrite to files with an extension and exclude a directory, as with replace:.
+        scopeQuery: String!
+    ): StructuralRewritePreview!
 
     # (experimental) The LSIF API may change substantially in the near future as we
     # continue to adjust it for our use cases. Changes will not be documented in the
@@ -1348,8 +1377,20 @@ type Query {
         # how many results to return per page. It must be in the range of 0-5000.
         first: Int
     ): Search
+    # Parses and validates a search query without running it. It returns the parse tree of the query, and
+    # diagnostics with suggested fixes for problems with the query, so that clients can highlight and fix
+    # queries before they are run.
+    parseSearchQuery(
+        # The search query (such as "foo" or "repo:myrepo foo").
+        query: String!
+        # The search pattern type, if it is not specified in the query string using the patternType: field.
+        # Defaults to literal.
+        patternType: SearchPatternType
+    ): SearchQueryAnalysis!
     # All saved searches configured for the current user, merged from all configurations.
     savedSearches: [SavedSearch!]!
+    # The search export jobs created by the current user, most recent first.
+    searchExportJobs: [SearchExportJob!]!
     # All repository groups for the current user, merged from all configurations.
     repoGroups: [RepoGroup!]!
     # The current site.
@@ -1408,6 +1449,119 @@ enum SearchPatternType {
     structural
 }
 
+# The format of the result file of a search export job.
+enum SearchExportFormat {
+    # Comma-separated values with a header row. The columns are repository, commit, path, lineNumber,
+    # preview, symbol and symbolKind.
+    CSV
+    # One JSON object per line, with the same fields as the CSV columns.
+    JSONL
+}
+
+# The state of a search export job.
+enum SearchExportJobState {
+    # The job is waiting for a worker.
+    QUEUED
+    # A worker is searching the repositories of the job.
+    PROCESSING
+    # All repositories were searched. Errors in individual repositories do not fail the job, they are
+    # reported in SearchExportJob.errors.
+    COMPLETED
+    # The job failed, e.g. because its query is invalid.
+    ERRORED
+    # The job was canceled.
+    CANCELED
+}
+
+# A search export job runs a search query on every repository it matches in the background and stores
+# all of its matches in a downloadable file. Its progress is checkpointed per repository, so that the job
+# resumes where it left off when the server restarts.
+type SearchExportJob implements Node {
+    # The unique ID of the job.
+    id: ID!
+    # The search query.
+    query: String!
+    # The pattern type of the query.
+    patternType: SearchPatternType!
+    # The format of the result file.
+    format: SearchExportFormat!
+    # The state of the job.
+    state: SearchExportJobState!
+    # The reason why the job errored.
+    failureMessage: String
+    # The user who created the job.
+    creator: User
+    # When the job was created.
+    createdAt: DateTime!
+    # When a worker started to process the job.
+    startedAt: DateTime
+    # When the job completed, errored or was canceled.
+    finishedAt: DateTime
+    # The number of repositories the query matches. It is 0 until a worker has resolved them.
+    repositoriesTotal: Int!
+    # The number of repositories that were searched successfully.
+    repositoriesCompleted: Int!
+    # The number of repositories that could not be searched completely.
+    repositoriesErrored: Int!
+    # The number of matches found so far.
+    matchCount: Int!
+    # The URL to download the result file from. It is null until the job completed.
+    downloadURL: String
+    # The repositories that could not be searched completely, with the reason why. The result file
+    # contains the matches that were found in them.
+    errors(
+        # Returns the first n errors.
+        first: Int = 100
+    ): [SearchExportRepositoryError!]!
+}
+
+# A repository which a search export job could not search completely.
+type SearchExportRepositoryError {
+    # The name of the repository.
+    repository: String!
+    # The reason why the repository could not be searched completely.
+    message: String!
+}
+
+# The preview of a structural rewrite of many repositories.
+type StructuralRewritePreview {
+    # The repositories that the rewrite changes or could not rewrite, ordered by name. Repositories
+    # without changes are omitted.
+    repositories: [RepositoryRewritePreview!]!
+    # The total diff stat of the changes in all repositories.
+    diffStat: DiffStat!
+}
+
+# The preview of a structural rewrite of a single repository.
+type RepositoryRewritePreview {
+    # The repository.
+    repository: Repository!
+    # The commit that was rewritten. It is null if the revision could not be resolved.
+    baseRevision: String
+    # The reference to the rewritten commit, such as "refs/heads/master". It is the default branch
+    # if the scope query does not specify a revision or specifies a commit ID.
+    baseRef: String
+    # The changed files, ordered by path.
+    files: [FileRewritePreview!]!
+    # The changes to all files as a unified diff without filename prefixes, which can be passed as
+    # PatchInput.patch.
+    patch: String!
+    # The diff stat of the changes.
+    diffStat: DiffStat!
+    # The reason why the repository could not be rewritten, if it failed.
+    error: String
+}
+
+# The changes of a structural rewrite to a single file.
+type FileRewritePreview {
+    # The path of the file.
+    path: String!
+    # The changes to the file as a unified diff without filename prefixes.
+    diff: String!
+    # The diff stat of the changes.
+    diffStat: DiffStat!
+}
+
 # Configuration details for the browser extension, editor extensions, etc.
 type ClientConfigurationDetails {
     # The list of phabricator/gitlab/bitbucket/etc instance URLs that specifies which pages the content script will be injected into.
@@ -1432,6 +1586,50 @@ type Search {
     # cached and thus quicker to query. Useful for e.g. querying sparkline
     # data.
     stats: SearchResultsStats!
+    # (experimental) The number of matches of the search grouped by the given mode.
+    # Unlike results, the search is run until all matches are found (up to an
+    # internal limit) or the maximum timeout is reached.
+    aggregations(
+        # How matches are grouped.
+        mode: SearchAggregationMode!
+        # Returns the first n buckets with the highest counts.
+        limit: Int = 10
+    ): SearchAggregation!
+}
+
+# A way to group the matches of a search.
+enum SearchAggregationMode {
+    # Group matches by repository.
+    REPO
+    # Group matches by file path. The label of a bucket is the repository name and
+    # the file path joined by "/".
+    PATH
+    # Group commits by author. It requires a type:commit or type:diff query.
+    AUTHOR
+    # Group matches by the value of the first capturing group of the regexp
+    # search pattern.
+    CAPTURE_GROUP
+}
+
+# The number of matches of a search grouped by a SearchAggregationMode.
+type SearchAggregation {
+    # The buckets with the highest counts, in descending order of count.
+    buckets: [SearchAggregationBucket!]!
+    # The number of buckets omitted because of the limit argument.
+    otherBucketsCount: Int!
+    # Whether the counts are approximate, because the search hit a limit (at most
+    # 5000 results are aggregated) or timed out, because some repositories could
+    # not be searched, or, for CAPTURE_GROUP, because the line matches of a file
+    # were truncated.
+    approximate: Boolean!
+}
+
+# A group of matches of a search.
+type SearchAggregationBucket {
+    # The value the matches are grouped by, e.g. a repository name.
+    label: String!
+    # The number of matches in this group.
+    count: Int!
 }
 
 # Predefined suggestions for search filters when backfill.
@@ -1635,6 +1833,57 @@ type SearchQueryDescription {
     query: String!
 }
 
+# The result of parsing and validating a search query without running it.
+type SearchQueryAnalysis {
+    # The parse tree of the query as parsed by the parser that a search would use, or null if the query
+    # cannot be parsed. The ordinary parser returns a list of parameters, and the and/or query parser
+    # a tree of operators. Each node is a JSON object. Parameters like repo:foo or search patterns have the form
+    # {"type": "parameter", "field": "repo", "value": "foo", "negated": false, "quoted": false, "range": ...},
+    # where the field of a search pattern is "". Operators have the form
+    # {"type": "operator", "kind": "and", "operands": [...], "range": ...}, where kind is one of and, or,
+    # not or concat. Ranges have the same form as SearchQueryRange.
+    parseTree: JSONValue
+    # The problems with the query. A query with a diagnostic of severity ERROR cannot be run.
+    diagnostics: [SearchQueryDiagnostic!]!
+}
+
+# A problem with a search query.
+type SearchQueryDiagnostic {
+    # The severity of the problem.
+    severity: SearchQueryDiagnosticSeverity!
+    # A description of the problem.
+    message: String!
+    # The range of the query that the problem applies to.
+    range: SearchQueryRange!
+    # Suggested fixes for the problem.
+    fixes: [SearchQueryFix!]!
+}
+
+# The severity of a problem with a search query.
+enum SearchQueryDiagnosticSeverity {
+    # The query cannot be run.
+    ERROR
+    # The query can be run, but may not do what was intended.
+    WARNING
+}
+
+# A range of characters in a search query.
+type SearchQueryRange {
+    # The offset of the first character of the range, counted in Unicode code points from the start of the
+    # query.
+    start: Int!
+    # The offset of the character after the range.
+    end: Int!
+}
+
+# A suggested fix for a problem with a search query.
+type SearchQueryFix {
+    # A description of the fix.
+    description: String!
+    # The query with the fix applied.
+    query: String!
+}
+
 # A group of repositories.
 type RepoGroup {
     # The name.
@@ -2899,6 +3148,10 @@ type FileMatch {
     symbols: [Symbol!]!
     # The line matches.
     lineMatches: [LineMatch!]!
+    # The matches of a search pattern that can match a newline, such as "foo\nbar" or "(?s)foo.*bar",
+    # with the full range of each match. The lines of the same matches are in lineMatches. It is empty
+    # for other patterns, and for results of indexed search.
+    multilineMatches: [MultilineMatch!]!
     # Whether or not the limit was hit.
     limitHit: Boolean!
 }
@@ -2913,6 +3166,21 @@ type LineMatch {
     offsetAndLengths: [[Int!]!]!
     # Whether or not the limit was hit.
     limitHit: Boolean!
+    # The lines before the matched line, nearest last. It is empty unless the search query has a
+    # context: field, such as context:2, which sets the number of lines before and after the match.
+    contextBefore: [String!]!
+    # The lines after the matched line, nearest first. It is empty unless the search query has a
+    # context: field.
+    contextAfter: [String!]!
+}
+
+# A match of a search pattern that may span several lines.
+type MultilineMatch {
+    # The lines of the match, from the first line to the last line of the match.
+    preview: String!
+    # The range of the match. The first line of the preview is the start line of the range. The
+    # character offsets are measured in characters (not bytes).
+    range: Range!
 }
 
 # A hunk.
@@ -4706,6 +4974,41 @@ type ProductSubscriptionEvent {
 type CloningProgress {
     # The message of this status message
     message: String!
+    # The progress of the clones that are running on gitserver, ordered by
+    # repository name.
+    repositories: [RepositoryCloneProgress!]!
+    # The sum of the download rates of the clones that are running, in bytes
+    # per second.
+    bytesPerSecond: Float!
+    # The estimated number of seconds until the current phase of every clone
+    # that is running finishes, or null if it is unknown. It does not include
+    # the later phases of the clones, nor the clones that have not started, so
+    # it is not the time until all the repositories are cloned.
+    phaseEta: Int
+}
+
+# FOR INTERNAL USE ONLY: The progress of a clone that is running on gitserver.
+type RepositoryCloneProgress {
+    # The name of the repository.
+    name: String!
+    # The phase of the clone: "starting", "counting", "compressing",
+    # "receiving", "resolving" or "done".
+    phase: String!
+    # The completion percentage of the phase.
+    percent: Int!
+    # The number of objects processed in the phase.
+    objects: Float!
+    # The total number of objects to process in the phase.
+    totalObjects: Float!
+    # The number of bytes received so far.
+    receivedBytes: Float!
+    # The download rate of the clone, in bytes per second.
+    bytesPerSecond: Float!
+    # When the clone started.
+    startedAt: DateTime!
+    # The estimated number of seconds until the current phase finishes, or
+    # null if it is unknown. The later phases are not included.
+    phaseEta: Int
 }
 
 # FOR INTERNAL USE ONLY: A status message produced when repositories could not
@@ -57,6 +57,10 @@ type SearchArgs struct {
 	Query       string
 	After       *string
 	First       *int32
+
+	// Stream, if non-nil, receives the results of the search incrementally
+	// as each backend produces them. It is not exposed via GraphQL.
+	Stream chan<- SearchEvent
 }
 
 type SearchImplementer interface {
@@ -64,6 +68,8 @@ type SearchImplementer interface {
 	Suggestions(context.Context, *searchSuggestionsArgs) ([]*searchSuggestionResolver, error)
 	//lint:ignore U1000 is used by graphql via reflection
 	Stats(context.Context) (*searchResultsStats, error)
+	//lint:ignore U1000 is used by graphql via reflection
+	Aggregations(context.Context, *searchAggregationsArgs) (*searchAggregationResolver, error)
 }
 
 // NewSearchImplementer returns a SearchImplementer that provides search results and suggestions.
@@ -88,14 +94,18 @@ func NewSearchImplementer(args *SearchArgs) (SearchImplementer, error) {
 	}
 
 	var queryInfo query.QueryInfo
-	if conf.AndOrQueryEnabled() && searchType != query.SearchTypeLiteral && query.ContainsAndOrKeyword(args.Query) {
-		// To process the input as an and/or query, the flag must be enabled, not be a
-		// literal search, and must contain either an 'and' or 'or' expression.
+	if conf.AndOrQueryEnabled() && query.ContainsAndOrKeyword(args.Query) {
+		// To process the input as an and/or query, the flag must be enabled,
+		// and the query must contain an 'and', 'or' or 'not' expression.
 		// Else, fallback to the older existing parser.
 		queryInfo, err = query.ProcessAndOr(args.Query)
 		if err != nil {
 			return alertForQuery(args.Query, err), nil
 		}
+		if searchType == query.SearchTypeLiteral {
+			andOrQuery := queryInfo.(*query.AndOrQuery)
+			andOrQuery.Query = query.EscapePatterns(andOrQuery.Query)
+		}
 	} else {
 		queryInfo, err = query.Process(queryString, searchType)
 		if err != nil {
@@ -120,14 +130,17 @@ func NewSearchImplementer(args *SearchArgs) (SearchImplementer, error) {
 		}
 	}
 
-	return &searchResolver{
+	r := &searchResolver{
 		query:         queryInfo,
 		originalQuery: args.Query,
 		pagination:    pagination,
 		patternType:   searchType,
 		zoekt:         search.Indexed(),
 		searcherURLs:  search.SearcherURLs(),
-	}, nil
+		stream:        args.Stream,
+	}
+	r.streamSelect = newResultSelector(queryInfo, int(r.resultLimit()))
+	return r, nil
 }
 
 func (r *schemaResolver) Search(args *SearchArgs) (SearchImplementer, error) {
@@ -247,6 +260,25 @@ type searchResolver struct {
 
 	zoekt        *searchbackend.Zoekt
 	searcherURLs *endpoint.Map
+
+	// stream, if non-nil, receives results as they are found. See
+	// SearchArgs.Stream.
+	stream chan<- SearchEvent
+
+	// streamSelect projects streamed results for select: queries. It
+	// remembers the results sent so far, so that they are only sent once.
+	streamSelect *resultSelector
+
+	// exhaustiveLimit, if positive, overrides the result limit of the query
+	// (count:) and selects the maximum timeout, to find as many results as
+	// possible. It is used for aggregations and search exports.
+	exhaustiveLimit int32
+
+	// ranking is set while Results searches for the candidates of a query
+	// with a sort: field. It makes maxResults return more results than the
+	// limit, so that the best results are picked among more than just the
+	// first ones found. Results truncates them to the limit after ranking.
+	ranking bool
 }
 
 // rawQuery returns the original query string input.
@@ -263,13 +295,46 @@ func (r *searchResolver) countIsSet() bool {
 const defaultMaxSearchResults = 30
 const maxSearchResultsPerPaginatedRequest = 5000
 
+// rankingCandidatesFactor is how many times the limit of a query with a sort:
+// field are searched for as ranking candidates, up to maxRankingCandidates.
+const rankingCandidatesFactor = 4
+const maxRankingCandidates = 1000
+
+// selectCandidatesFactor is how many times the limit of a select:repo or
+// select:file query are searched for, up to maxSelectCandidates, since several
+// results project onto the same repository or file.
+const selectCandidatesFactor = 10
+const maxSelectCandidates = maxSearchResultsPerPaginatedRequest
+
 func (r *searchResolver) maxResults() int32 {
+	limit := r.resultLimit()
+	if path := query.Select(r.query); path != nil && selectsFewerResults(*path) && limit < maxSelectCandidates {
+		if limit > maxSelectCandidates/selectCandidatesFactor {
+			limit = maxSelectCandidates
+		} else {
+			limit *= selectCandidatesFactor
+		}
+	}
+	if r.ranking && limit < maxRankingCandidates {
+		if limit > maxRankingCandidates/rankingCandidatesFactor {
+			return maxRankingCandidates
+		}
+		return limit * rankingCandidatesFactor
+	}
+	return limit
+}
+
+// resultLimit returns the number of results requested by the query.
+func (r *searchResolver) resultLimit() int32 {
 	if r.pagination != nil {
 		// Paginated search requests always consume an entire result set for a
 		// given repository, so we do not want any limit here. See
 		// search_pagination.go for details on why this is necessary .
 		return math.MaxInt32
 	}
+	if r.exhaustiveLimit > 0 {
+		return r.exhaustiveLimit
+	}
 	count, _ := r.query.StringValues(query.FieldCount)
 	if len(count) > 0 {
 		n, _ := strconv.Atoi(count[0])
@@ -376,15 +441,41 @@ func (r *searchResolver) resolveRepositories(ctx context.Context, effectiveRepoF
 		}
 	}
 
+	op, err := r.resolveRepoOp(ctx, effectiveRepoFieldValues)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	tr.LazyPrintf("resolveRepositories - start")
+	repoRevs, missingRepoRevs, overLimit, err = resolveRepositories(ctx, op)
+	tr.LazyPrintf("resolveRepositories - done")
+	if effectiveRepoFieldValues == nil {
+		r.repoRevs = repoRevs
+		r.missingRepoRevs = missingRepoRevs
+		r.repoOverLimit = overLimit
+		r.repoErr = err
+	}
+	return repoRevs, missingRepoRevs, overLimit, err
+}
+
+// resolveRepoOp returns the options to resolve the repositories searched by
+// the query. If effectiveRepoFieldValues is non-nil, it replaces the repo:
+// values of the query.
+func (r *searchResolver) resolveRepoOp(ctx context.Context, effectiveRepoFieldValues []string) (resolveRepoOp, error) {
 	repoFilters, minusRepoFilters := r.query.RegexpPatterns(query.FieldRepo)
 	if effectiveRepoFieldValues != nil {
 		repoFilters = effectiveRepoFieldValues
 	}
+	// Predicates like repo:has.file(...) are not patterns of repository
+	// names.
+	repoFilters = query.OmitPredicates(query.FieldRepo, repoFilters)
+	minusRepoFilters = query.OmitPredicates(query.FieldRepo, minusRepoFilters)
+	repoHasFile, minusRepoHasFile := query.Predicates(r.query, query.FieldRepo)
 	repoGroupFilters, _ := r.query.StringValues(query.FieldRepoGroup)
 
 	settings, err := decodedViewerFinalSettings(ctx)
 	if err != nil {
-		return nil, nil, false, err
+		return resolveRepoOp{}, err
 	}
 	var settingForks, settingArchived bool
 	if v := settings.SearchIncludeForks; v != nil {
@@ -417,8 +508,7 @@ func (r *searchResolver) resolveRepositories(ctx context.Context, effectiveRepoF
 
 	commitAfter, _ := r.query.StringValue(query.FieldRepoHasCommitAfter)
 
-	tr.LazyPrintf("resolveRepositories - start")
-	repoRevs, missingRepoRevs, overLimit, err = resolveRepositories(ctx, resolveRepoOp{
+	return resolveRepoOp{
 		repoFilters:      repoFilters,
 		minusRepoFilters: minusRepoFilters,
 		repoGroupFilters: repoGroupFilters,
@@ -429,15 +519,9 @@ func (r *searchResolver) resolveRepositories(ctx context.Context, effectiveRepoF
 		onlyPrivate:      visibility == query.Private,
 		onlyPublic:       visibility == query.Public,
 		commitAfter:      commitAfter,
-	})
-	tr.LazyPrintf("resolveRepositories - done")
-	if effectiveRepoFieldValues == nil {
-		r.repoRevs = repoRevs
-		r.missingRepoRevs = missingRepoRevs
-		r.repoOverLimit = overLimit
-		r.repoErr = err
-	}
-	return repoRevs, missingRepoRevs, overLimit, err
+		repoHasFile:      repoHasFile,
+		minusRepoHasFile: minusRepoHasFile,
+	}, nil
 }
 
 // a patternRevspec maps an include pattern to a list of revisions
@@ -544,6 +628,15 @@ type resolveRepoOp struct {
 	commitAfter      string
 	onlyPrivate      bool
 	onlyPublic       bool
+
+	// repoHasFile and minusRepoHasFile are the repo:has.file(...) and
+	// -repo:has.file(...) predicates.
+	repoHasFile      []query.FilePredicate
+	minusRepoHasFile []query.FilePredicate
+
+	// limit, if positive, overrides the maximum number of repositories to
+	// resolve (maxReposToSearch).
+	limit int
 }
 
 func resolveRepositories(ctx context.Context, op resolveRepoOp) (repoRevisions, missingRepoRevisions []*search.RepositoryRevisions, overLimit bool, err error) {
@@ -562,6 +655,9 @@ func resolveRepositories(ctx context.Context, op resolveRepoOp) (repoRevisions,
 	excludePatterns := op.minusRepoFilters
 
 	maxRepoListSize := maxReposToSearch()
+	if op.limit > 0 {
+		maxRepoListSize = op.limit
+	}
 
 	// If any repo groups are specified, take the intersection of the repo
 	// groups and the set of repos specified with repo:. (If none are specified
@@ -695,6 +791,12 @@ func resolveRepositories(ctx context.Context, op resolveRepoOp) (repoRevisions,
 		repoRevisions, err = filterRepoHasCommitAfter(ctx, repoRevisions, op.commitAfter)
 	}
 
+	if err == nil && (len(op.repoHasFile) > 0 || len(op.minusRepoHasFile) > 0) {
+		tr.LazyPrintf("filter repo:has.file - start")
+		repoRevisions, err = filterRepoHasFile(ctx, repoRevisions, op.repoHasFile, op.minusRepoHasFile)
+		tr.LazyPrintf("filter repo:has.file - done")
+	}
+
 	return repoRevisions, missingRepoRevisions, overLimit, err
 }
 
@@ -0,0 +1,209 @@
+package graphqlbackend
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/sourcegraph/sourcegraph/internal/search/query"
+)
+
+// maxAggregationSearchResults is the result limit of the search run for
+// aggregations, which replaces the limit of the query (count:).
+const maxAggregationSearchResults = maxSearchResultsPerPaginatedRequest
+
+// Modes of the SearchAggregationMode GraphQL enum.
+const (
+	aggregationModeRepo         = "REPO"
+	aggregationModePath         = "PATH"
+	aggregationModeAuthor       = "AUTHOR"
+	aggregationModeCaptureGroup = "CAPTURE_GROUP"
+)
+
+type searchAggregationsArgs struct {
+	Mode  string
+	Limit int32
+}
+
+func (r *searchResolver) Aggregations(ctx context.Context, args *searchAggregationsArgs) (*searchAggregationResolver, error) {
+	if args.Limit < 0 {
+		return nil, fmt.Errorf("limit must be non-negative, got %d", args.Limit)
+	}
+
+	var captureRe *regexp.Regexp
+	switch args.Mode {
+	case aggregationModeRepo, aggregationModePath:
+	case aggregationModeAuthor:
+		types, _ := r.query.StringValues(query.FieldType)
+		var ok bool
+		for _, t := range types {
+			ok = ok || t == "commit" || t == "diff"
+		}
+		if !ok {
+			return nil, fmt.Errorf("the %s aggregation requires a query with type:commit or type:diff", args.Mode)
+		}
+	case aggregationModeCaptureGroup:
+		var err error
+		captureRe, err = r.captureGroupRegexp()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown aggregation mode %q", args.Mode)
+	}
+
+	// Aggregations count all matches, so we search with a high result limit
+	// and the maximum timeout. The resolver is not shared with Results,
+	// since it caches state about the search.
+	exhaustive := &searchResolver{
+		query:           r.query,
+		originalQuery:   r.originalQuery,
+		patternType:     r.patternType,
+		zoekt:           r.zoekt,
+		searcherURLs:    r.searcherURLs,
+		exhaustiveLimit: maxAggregationSearchResults,
+	}
+	rr, err := exhaustive.Results(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, truncated := aggregateResults(rr.SearchResults, args.Mode, captureRe)
+	approximate := rr.approximate() || aggregationLimitHit(rr) || truncated
+	return newSearchAggregationResolver(counts, int(args.Limit), approximate), nil
+}
+
+// captureGroupRegexp returns the regexp of the search pattern, which must
+// have at least one capturing group.
+func (r *searchResolver) captureGroupRegexp() (*regexp.Regexp, error) {
+	if r.patternType != query.SearchTypeRegex {
+		return nil, fmt.Errorf("the %s aggregation requires a regexp search pattern", aggregationModeCaptureGroup)
+	}
+	p, err := r.getPatternInfo(nil)
+	if err != nil {
+		return nil, err
+	}
+	pattern := p.Pattern
+	if !p.IsCaseSensitive {
+		pattern = "(?i:" + pattern + ")"
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if re.NumSubexp() == 0 {
+		return nil, fmt.Errorf("the %s aggregation requires a search pattern with a capturing group, e.g. (\\w+)", aggregationModeCaptureGroup)
+	}
+	return re, nil
+}
+
+// approximate returns true if sr may not contain all results of the search.
+func (sr *SearchResultsResolver) approximate() bool {
+	return sr.LimitHit() || len(sr.timedout) > 0 || len(sr.cloning) > 0 || len(sr.missing) > 0
+}
+
+// aggregationLimitHit returns true if the search for an aggregation stopped
+// at maxAggregationSearchResults, so that there may be more results than rr
+// contains.
+func aggregationLimitHit(rr *SearchResultsResolver) bool {
+	return len(rr.SearchResults) >= maxAggregationSearchResults
+}
+
+// aggregateResults counts the matches in results by the label of their group
+// in the given mode. captureRe is only used by the CAPTURE_GROUP mode.
+//
+// truncated is true if the counts miss matches of results. The CAPTURE_GROUP
+// mode counts the line matches of file matches, which the backends truncate
+// per file.
+func aggregateResults(results []SearchResultResolver, mode string, captureRe *regexp.Regexp) (counts map[string]int32, truncated bool) {
+	counts = map[string]int32{}
+	for _, result := range results {
+		switch mode {
+		case aggregationModeRepo:
+			if repo, ok := result.ToRepository(); ok {
+				counts[repo.Name()] += result.resultCount()
+			} else if fm, ok := result.ToFileMatch(); ok {
+				counts[string(fm.Repo.Name)] += result.resultCount()
+			} else if c, ok := result.ToCommitSearchResult(); ok {
+				counts[c.commit.Repository().Name()] += result.resultCount()
+			}
+
+		case aggregationModePath:
+			if fm, ok := result.ToFileMatch(); ok {
+				counts[string(fm.Repo.Name)+"/"+fm.JPath] += result.resultCount()
+			}
+
+		case aggregationModeAuthor:
+			if c, ok := result.ToCommitSearchResult(); ok {
+				if person := c.commit.author.person; person != nil {
+					counts[fmt.Sprintf("%s <%s>", person.name, person.email)] += result.resultCount()
+				}
+			}
+
+		case aggregationModeCaptureGroup:
+			fm, ok := result.ToFileMatch()
+			if !ok {
+				continue
+			}
+			truncated = truncated || fm.JLimitHit
+			for _, lm := range fm.JLineMatches {
+				for _, m := range captureRe.FindAllStringSubmatch(lm.JPreview, -1) {
+					if m[1] != "" {
+						counts[m[1]]++
+					}
+				}
+			}
+		}
+	}
+	return counts, truncated
+}
+
+type searchAggregationResolver struct {
+	buckets           []*searchAggregationBucketResolver
+	otherBucketsCount int32
+	approximate       bool
+}
+
+// newSearchAggregationResolver returns the first limit buckets of counts in
+// descending order of count.
+func newSearchAggregationResolver(counts map[string]int32, limit int, approximate bool) *searchAggregationResolver {
+	buckets := make([]*searchAggregationBucketResolver, 0, len(counts))
+	for label, count := range counts {
+		buckets = append(buckets, &searchAggregationBucketResolver{label: label, count: count})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].count != buckets[j].count {
+			return buckets[i].count > buckets[j].count
+		}
+		return buckets[i].label < buckets[j].label
+	})
+
+	var other int32
+	if len(buckets) > limit {
+		other = int32(len(buckets) - limit)
+		buckets = buckets[:limit]
+	}
+	return &searchAggregationResolver{
+		buckets:           buckets,
+		otherBucketsCount: other,
+		approximate:       approximate,
+	}
+}
+
+func (r *searchAggregationResolver) Buckets() []*searchAggregationBucketResolver {
+	return r.buckets
+}
+
+func (r *searchAggregationResolver) OtherBucketsCount() int32 { return r.otherBucketsCount }
+
+func (r *searchAggregationResolver) Approximate() bool { return r.approximate }
+
+type searchAggregationBucketResolver struct {
+	label string
+	count int32
+}
+
+func (r *searchAggregationBucketResolver) Label() string { return r.label }
+
+func (r *searchAggregationBucketResolver) Count() int32 { return r.count }
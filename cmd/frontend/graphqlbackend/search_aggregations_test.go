@@ -0,0 +1,121 @@
+package graphqlbackend
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+)
+
+func TestAggregateResults(t *testing.T) {
+	repoA := &types.Repo{ID: 1, Name: "a"}
+	repoB := &types.Repo{ID: 2, Name: "b"}
+	commit := func(repo *types.Repo, name, email string) SearchResultResolver {
+		return &commitSearchResultResolver{commit: &GitCommitResolver{
+			repo:   &RepositoryResolver{repo: repo},
+			oid:    "c",
+			author: signatureResolver{person: &personResolver{name: name, email: email}},
+		}}
+	}
+	results := []SearchResultResolver{
+		&FileMatchResolver{JPath: "x", Repo: repoA, JLineMatches: []*lineMatch{
+			{JPreview: "foo(bar) foo(baz)"},
+			{JPreview: "foo(bar)"},
+		}, MatchCount: 2},
+		&FileMatchResolver{JPath: "y", Repo: repoA, JLineMatches: []*lineMatch{
+			{JPreview: "foo(qux)"},
+		}, MatchCount: 1},
+		&FileMatchResolver{JPath: "x", Repo: repoB, JLineMatches: []*lineMatch{
+			{JPreview: "foo(bar)"},
+		}, MatchCount: 1},
+		&RepositoryResolver{repo: repoB},
+		commit(repoA, "Alice", "alice@example.com"),
+		commit(repoB, "Alice", "alice@example.com"),
+		commit(repoB, "Bob", "bob@example.com"),
+	}
+
+	tests := []struct {
+		mode string
+		want map[string]int32
+	}{
+		{
+			mode: aggregationModeRepo,
+			want: map[string]int32{"a": 4, "b": 4},
+		},
+		{
+			mode: aggregationModePath,
+			want: map[string]int32{"a/x": 2, "a/y": 1, "b/x": 1},
+		},
+		{
+			mode: aggregationModeAuthor,
+			want: map[string]int32{"Alice <alice@example.com>": 2, "Bob <bob@example.com>": 1},
+		},
+		{
+			mode: aggregationModeCaptureGroup,
+			want: map[string]int32{"bar": 3, "baz": 1, "qux": 1},
+		},
+	}
+	captureRe := regexp.MustCompile(`foo\((\w+)\)`)
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got, truncated := aggregateResults(results, tt.mode, captureRe)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if truncated {
+				t.Error("expected complete counts")
+			}
+		})
+	}
+}
+
+func TestAggregateResults_truncated(t *testing.T) {
+	repo := &types.Repo{ID: 1, Name: "a"}
+	results := []SearchResultResolver{
+		&FileMatchResolver{JPath: "x", Repo: repo, JLineMatches: []*lineMatch{
+			{JPreview: "foo(bar)"},
+		}, MatchCount: 1},
+		&FileMatchResolver{JPath: "y", Repo: repo, JLineMatches: []*lineMatch{
+			{JPreview: "foo(baz)"},
+		}, MatchCount: 1, JLimitHit: true},
+	}
+	captureRe := regexp.MustCompile(`foo\((\w+)\)`)
+
+	// Line matches are only truncated for CAPTURE_GROUP, which counts them.
+	if _, truncated := aggregateResults(results, aggregationModeRepo, captureRe); truncated {
+		t.Errorf("expected %s counts to be complete", aggregationModeRepo)
+	}
+	if _, truncated := aggregateResults(results, aggregationModeCaptureGroup, captureRe); !truncated {
+		t.Errorf("expected %s counts to be truncated", aggregationModeCaptureGroup)
+	}
+}
+
+func TestAggregationLimitHit(t *testing.T) {
+	results := make([]SearchResultResolver, maxAggregationSearchResults)
+	if !aggregationLimitHit(&SearchResultsResolver{SearchResults: results}) {
+		t.Error("expected the limit to be hit at maxAggregationSearchResults results")
+	}
+	if aggregationLimitHit(&SearchResultsResolver{SearchResults: results[1:]}) {
+		t.Error("expected the limit not to be hit below maxAggregationSearchResults results")
+	}
+}
+
+func TestNewSearchAggregationResolver(t *testing.T) {
+	counts := map[string]int32{"a": 1, "b": 3, "c": 3, "d": 2}
+	r := newSearchAggregationResolver(counts, 3, true)
+
+	var got []string
+	for _, b := range r.Buckets() {
+		got = append(got, b.Label())
+	}
+	if want := []string{"b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got buckets %v, want %v", got, want)
+	}
+	if got := r.OtherBucketsCount(); got != 1 {
+		t.Errorf("got otherBucketsCount %d, want 1", got)
+	}
+	if !r.Approximate() {
+		t.Error("got approximate false, want true")
+	}
+}
@@ -113,6 +113,14 @@ func alertForStalePermissions() *searchAlert {
 	}
 }
 
+func alertForRepoHasFileLimit() *searchAlert {
+	return &searchAlert{
+		prometheusType: "repo_has_file_limit",
+		title:          "Too many files match repo:has.file(...)",
+		description:    fmt.Sprintf("More than %d files match a repo:has.file(...) predicate, so the repositories containing a matching file cannot all be found. Use a more specific path: or content: argument, or add repo: filters.", maxPredicateFileMatches),
+	}
+}
+
 func alertForQuotesInQueryInLiteralMode(p syntax.ParseTree) *searchAlert {
 	return &searchAlert{
 		prometheusType: "no_results__suggest_quotes",
@@ -137,6 +145,8 @@ func reposExist(ctx context.Context, options resolveRepoOp) bool {
 
 func (r *searchResolver) alertForNoResolvedRepos(ctx context.Context) *searchAlert {
 	repoFilters, minusRepoFilters := r.query.RegexpPatterns(query.FieldRepo)
+	repoFilters = query.OmitPredicates(query.FieldRepo, repoFilters)
+	minusRepoFilters = query.OmitPredicates(query.FieldRepo, minusRepoFilters)
 	repoGroupFilters, _ := r.query.StringValues(query.FieldRepoGroup)
 	fork, _ := r.query.StringValue(query.FieldFork)
 	onlyForks, noForks := fork == "only", fork == "no"
@@ -605,3 +615,7 @@ func (searchAlert) Suggestions(context.Context, *searchSuggestionsArgs) ([]*sear
 	return nil, nil
 }
 func (searchAlert) Stats(context.Context) (*searchResultsStats, error) { return nil, nil }
+
+func (a searchAlert) Aggregations(context.Context, *searchAggregationsArgs) (*searchAggregationResolver, error) {
+	return nil, fmt.Errorf("%s: %s", a.title, a.description)
+}
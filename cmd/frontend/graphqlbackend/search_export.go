@@ -0,0 +1,161 @@
+package graphqlbackend
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+)
+
+const (
+	// maxSearchExportRepos is the maximum number of repositories a search
+	// export can search. It replaces maxReposToSearch, which is meant for
+	// interactive searches.
+	maxSearchExportRepos = 100000
+
+	// maxSearchExportResultsPerRepo is the result limit of a search export in
+	// a single repository. It replaces the limit of the query (count:).
+	maxSearchExportResultsPerRepo = 100000
+)
+
+// SearchExportMatch is a single match of a search export, e.g. a line of a
+// file or a commit. Fields which do not apply to the match are empty.
+type SearchExportMatch struct {
+	Repository string `json:"repository"`
+	Commit     string `json:"commit,omitempty"`
+	Path       string `json:"path,omitempty"`
+	LineNumber int32  `json:"lineNumber,omitempty"` // 1-based
+	Preview    string `json:"preview,omitempty"`    // the matching line, or the subject of a commit
+	Symbol     string `json:"symbol,omitempty"`
+	SymbolKind string `json:"symbolKind,omitempty"`
+}
+
+// newSearchExportResolver returns a resolver for the search of a search
+// export, which is not limited by the result limit of the query.
+func newSearchExportResolver(args *SearchArgs) (*searchResolver, error) {
+	impl, err := NewSearchImplementer(args)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := impl.(*searchResolver)
+	if !ok {
+		// Invalid queries are reported as alerts.
+		if alert, ok := impl.(*searchAlert); ok {
+			return nil, fmt.Errorf("%s: %s", alert.title, alert.description)
+		}
+		return nil, errors.New("unsupported search query")
+	}
+	r.exhaustiveLimit = maxSearchExportResultsPerRepo
+	return r, nil
+}
+
+// ValidateSearchExportQuery returns an error if args cannot be run by a
+// search export.
+func ValidateSearchExportQuery(args *SearchArgs) error {
+	_, err := newSearchExportResolver(args)
+	return err
+}
+
+// SearchExportRepositories returns the repositories that a search export of
+// args searches. Unlike interactive searches, the number of repositories is
+// not limited by maxReposToSearch.
+func SearchExportRepositories(ctx context.Context, args *SearchArgs) ([]*types.Repo, error) {
+	r, err := newSearchExportResolver(args)
+	if err != nil {
+		return nil, err
+	}
+	op, err := r.resolveRepoOp(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	op.limit = maxSearchExportRepos
+	repoRevs, missingRepoRevs, overLimit, err := resolveRepositories(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+	if overLimit {
+		return nil, fmt.Errorf("the query matches more than %d repositories, use repo: to search fewer repositories", maxSearchExportRepos)
+	}
+
+	// Repositories with missing revisions are included, so that they are
+	// reported as errors by SearchExportRepository.
+	repos := make([]*types.Repo, 0, len(repoRevs)+len(missingRepoRevs))
+	for _, revs := range append(repoRevs, missingRepoRevs...) {
+		repos = append(repos, revs.Repo)
+	}
+	return repos, nil
+}
+
+// SearchExportRepository runs the search of a search export of args in the
+// single repository repo.
+func SearchExportRepository(ctx context.Context, args *SearchArgs, repo *types.Repo) (*SearchResultsResolver, error) {
+	r, err := newSearchExportResolver(args)
+	if err != nil {
+		return nil, err
+	}
+	op, err := r.resolveRepoOp(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	op.repoFilters = append(append([]string{}, op.repoFilters...), "^"+regexp.QuoteMeta(string(repo.Name))+"$")
+
+	// Resolve the repository up front. The resolver caches it, so the search
+	// does not resolve the repositories of the query again.
+	repoRevs, missingRepoRevs, overLimit, err := resolveRepositories(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+	r.repoRevs, r.missingRepoRevs, r.repoOverLimit = repoRevs, missingRepoRevs, overLimit
+	return r.Results(ctx)
+}
+
+// SearchExportMatches returns the matches of results, in the order of the
+// results.
+func SearchExportMatches(ctx context.Context, results []SearchResultResolver) ([]SearchExportMatch, error) {
+	var matches []SearchExportMatch
+	for _, result := range results {
+		switch r := result.(type) {
+		case *RepositoryResolver:
+			matches = append(matches, SearchExportMatch{Repository: r.Name()})
+
+		case *FileMatchResolver:
+			file := SearchExportMatch{
+				Repository: string(r.Repo.Name),
+				Commit:     string(r.CommitID),
+				Path:       r.JPath,
+			}
+			if len(r.JLineMatches) == 0 && len(r.symbols) == 0 {
+				// A path match.
+				matches = append(matches, file)
+			}
+			for _, lm := range r.JLineMatches {
+				m := file
+				m.LineNumber = lm.JLineNumber + 1
+				m.Preview = lm.JPreview
+				matches = append(matches, m)
+			}
+			for _, sym := range r.symbols {
+				m := file
+				m.LineNumber = int32(sym.symbol.Line)
+				m.Symbol = sym.symbol.Name
+				m.SymbolKind = strings.ToLower(symbolLSPKind(sym.symbol).String())
+				matches = append(matches, m)
+			}
+
+		case *commitSearchResultResolver:
+			subject, err := r.commit.Subject(ctx)
+			if err != nil {
+				return nil, err
+			}
+			matches = append(matches, SearchExportMatch{
+				Repository: r.commit.Repository().Name(),
+				Commit:     string(r.commit.OID()),
+				Preview:    subject,
+			})
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,197 @@
+package graphqlbackend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/backend"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/db"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+	"github.com/sourcegraph/sourcegraph/internal/errcode"
+	"github.com/sourcegraph/sourcegraph/internal/search/query"
+)
+
+type searchExportJobResolver struct {
+	job *types.SearchExportJob
+}
+
+func marshalSearchExportJobID(id int64) graphql.ID {
+	return relay.MarshalID("SearchExportJob", id)
+}
+
+func unmarshalSearchExportJobID(id graphql.ID) (jobID int64, err error) {
+	err = relay.UnmarshalSpec(id, &jobID)
+	return
+}
+
+func searchExportJobByID(ctx context.Context, id graphql.ID) (*searchExportJobResolver, error) {
+	jobID, err := unmarshalSearchExportJobID(id)
+	if err != nil {
+		return nil, err
+	}
+	job, err := db.SearchExportJobs.GetByID(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	// 🚨 SECURITY: Only the creator of the job and site admins may access it.
+	if err := backend.CheckSiteAdminOrSameUser(ctx, job.UserID); err != nil {
+		return nil, err
+	}
+	return &searchExportJobResolver{job: job}, nil
+}
+
+func (r *searchExportJobResolver) ID() graphql.ID { return marshalSearchExportJobID(r.job.ID) }
+
+func (r *searchExportJobResolver) Query() string { return r.job.Query }
+
+func (r *searchExportJobResolver) PatternType() string { return r.job.PatternType }
+
+func (r *searchExportJobResolver) Format() string { return strings.ToUpper(r.job.Format) }
+
+func (r *searchExportJobResolver) State() string { return strings.ToUpper(r.job.State) }
+
+func (r *searchExportJobResolver) FailureMessage() *string { return r.job.FailureMessage }
+
+func (r *searchExportJobResolver) Creator(ctx context.Context) (*UserResolver, error) {
+	user, err := UserByIDInt32(ctx, r.job.UserID)
+	if err != nil && errcode.IsNotFound(err) {
+		// The user was deleted.
+		return nil, nil
+	}
+	return user, err
+}
+
+func (r *searchExportJobResolver) CreatedAt() DateTime { return DateTime{Time: r.job.CreatedAt} }
+
+func (r *searchExportJobResolver) StartedAt() *DateTime { return DateTimeOrNil(r.job.StartedAt) }
+
+func (r *searchExportJobResolver) FinishedAt() *DateTime { return DateTimeOrNil(r.job.FinishedAt) }
+
+func (r *searchExportJobResolver) RepositoriesTotal() int32 { return r.job.ReposTotal }
+
+func (r *searchExportJobResolver) RepositoriesCompleted() int32 { return r.job.ReposCompleted }
+
+func (r *searchExportJobResolver) RepositoriesErrored() int32 { return r.job.ReposErrored }
+
+func (r *searchExportJobResolver) MatchCount() int32 { return r.job.MatchCount }
+
+func (r *searchExportJobResolver) DownloadURL() *string {
+	if r.job.State != types.SearchExportStateCompleted {
+		return nil
+	}
+	url := fmt.Sprintf("/.api/search/export/%d", r.job.ID)
+	return &url
+}
+
+func (r *searchExportJobResolver) Errors(ctx context.Context, args *struct{ First int32 }) ([]*searchExportRepositoryErrorResolver, error) {
+	repos, err := db.SearchExportJobs.ListRepos(ctx, r.job.ID, db.SearchExportJobReposListOptions{
+		State: types.SearchExportStateErrored,
+		Limit: int(args.First),
+	})
+	if err != nil {
+		return nil, err
+	}
+	errs := make([]*searchExportRepositoryErrorResolver, 0, len(repos))
+	for _, repo := range repos {
+		var message string
+		if repo.Error != nil {
+			message = *repo.Error
+		}
+		errs = append(errs, &searchExportRepositoryErrorResolver{repository: repo.RepoName, message: message})
+	}
+	return errs, nil
+}
+
+type searchExportRepositoryErrorResolver struct {
+	repository string
+	message    string
+}
+
+func (r *searchExportRepositoryErrorResolver) Repository() string { return r.repository }
+
+func (r *searchExportRepositoryErrorResolver) Message() string { return r.message }
+
+func (r *schemaResolver) SearchExportJobs(ctx context.Context) ([]*searchExportJobResolver, error) {
+	currentUser, err := CurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if currentUser == nil {
+		return nil, errors.New("no current user")
+	}
+	jobs, err := db.SearchExportJobs.ListByUserID(ctx, currentUser.DatabaseID())
+	if err != nil {
+		return nil, err
+	}
+	resolvers := make([]*searchExportJobResolver, 0, len(jobs))
+	for _, job := range jobs {
+		resolvers = append(resolvers, &searchExportJobResolver{job: job})
+	}
+	return resolvers, nil
+}
+
+func (r *schemaResolver) CreateSearchExportJob(ctx context.Context, args *struct {
+	Query       string
+	PatternType *string
+	Format      string
+}) (*searchExportJobResolver, error) {
+	currentUser, err := CurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if currentUser == nil {
+		return nil, errors.New("no current user")
+	}
+
+	// Store the pattern type the query is run with, since the default
+	// pattern type may change between versions.
+	searchType, err := detectSearchType("V2", args.PatternType, args.Query)
+	if err != nil {
+		return nil, err
+	}
+	patternType := searchTypeString(searchType)
+	if err := ValidateSearchExportQuery(&SearchArgs{Version: "V2", PatternType: &patternType, Query: args.Query}); err != nil {
+		return nil, err
+	}
+
+	job, err := db.SearchExportJobs.Create(ctx, &types.SearchExportJob{
+		UserID:      currentUser.DatabaseID(),
+		Query:       args.Query,
+		PatternType: patternType,
+		Format:      strings.ToLower(args.Format),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &searchExportJobResolver{job: job}, nil
+}
+
+func (r *schemaResolver) CancelSearchExportJob(ctx context.Context, args *struct {
+	ID graphql.ID
+}) (*EmptyResponse, error) {
+	// 🚨 SECURITY: searchExportJobByID checks that the current user may
+	// access the job.
+	job, err := searchExportJobByID(ctx, args.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.SearchExportJobs.Cancel(ctx, job.job.ID); err != nil {
+		return nil, err
+	}
+	return &EmptyResponse{}, nil
+}
+
+// searchTypeString returns the SearchPatternType enum value of t.
+func searchTypeString(t query.SearchType) string {
+	switch t {
+	case query.SearchTypeLiteral:
+		return "literal"
+	case query.SearchTypeStructural:
+		return "structural"
+	}
+	return "regexp"
+}
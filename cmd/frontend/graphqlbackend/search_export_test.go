@@ -0,0 +1,48 @@
+package graphqlbackend
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/vcs/git"
+)
+
+func TestSearchExportMatches(t *testing.T) {
+	repo := &types.Repo{ID: 1, Name: "r"}
+	repoResolver := &RepositoryResolver{repo: repo}
+	results := []SearchResultResolver{
+		repoResolver,
+		&FileMatchResolver{JPath: "a.go", Repo: repo, CommitID: "c1", JLineMatches: []*lineMatch{
+			{JPreview: "foo", JLineNumber: 0},
+			{JPreview: "bar foo", JLineNumber: 9},
+		}},
+		&FileMatchResolver{JPath: "b.go", Repo: repo, CommitID: "c1"},
+		&FileMatchResolver{JPath: "c.go", Repo: repo, CommitID: "c1", symbols: []*searchSymbolResult{
+			{symbol: protocol.Symbol{Name: "Foo", Kind: "func", Line: 3}},
+		}},
+		&commitSearchResultResolver{commit: toGitCommitResolver(repoResolver, &git.Commit{
+			ID:      api.CommitID("c2"),
+			Message: "Fix foo\n\nDetails",
+		})},
+	}
+
+	matches, err := SearchExportMatches(context.Background(), results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SearchExportMatch{
+		{Repository: "r"},
+		{Repository: "r", Commit: "c1", Path: "a.go", LineNumber: 1, Preview: "foo"},
+		{Repository: "r", Commit: "c1", Path: "a.go", LineNumber: 10, Preview: "bar foo"},
+		{Repository: "r", Commit: "c1", Path: "b.go"},
+		{Repository: "r", Commit: "c1", Path: "c.go", LineNumber: 3, Symbol: "Foo", SymbolKind: "function"},
+		{Repository: "r", Commit: "c2", Preview: "Fix foo"},
+	}
+	if !reflect.DeepEqual(matches, want) {
+		t.Errorf("got %+v, want %+v", matches, want)
+	}
+}
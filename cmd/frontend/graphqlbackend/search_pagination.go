@@ -16,6 +16,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/search"
+	"github.com/sourcegraph/sourcegraph/internal/search/query"
 	"github.com/sourcegraph/sourcegraph/internal/trace"
 )
 
@@ -161,7 +162,13 @@ func (r *searchResolver) paginatedResults(ctx context.Context) (result *SearchRe
 		return nil, err
 	}
 
-	resultTypes := r.determineResultTypes(args, "")
+	// Paginated search only supports file content results. For select:
+	// queries without a type: field, those are the results we project.
+	var forceOnlyResultType string
+	if typeValues, _ := r.query.StringValues(query.FieldType); len(typeValues) == 0 && query.Select(r.query) != nil {
+		forceOnlyResultType = "file"
+	}
+	resultTypes := r.determineResultTypes(args, forceOnlyResultType)
 	tr.LazyPrintf("resultTypes: %v", resultTypes)
 
 	if len(resultTypes) != 1 || resultTypes[0] != "file" {
@@ -275,6 +282,10 @@ func paginatedSearchFilesInRepos(ctx context.Context, args *search.TextParameter
 		for _, r := range fileResults {
 			results = append(results, r)
 		}
+		// Results are projected per batch, before they are sliced into
+		// pages, so that cursors count selected results. Each repository
+		// is searched in a single batch, so no result is selected twice.
+		results = newResultSelector(args.Query, 0).apply(results)
 		return results, fileCommon, nil
 	})
 }
@@ -0,0 +1,210 @@
+package graphqlbackend
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/search"
+	"github.com/sourcegraph/sourcegraph/internal/search/query"
+)
+
+// maxContainsIncludePaths is the maximum number of files matching
+// file:contains(...) predicates for which the search is restricted to the
+// paths of the files. With more files, the results are only filtered.
+const maxContainsIncludePaths = 500
+
+// maxPredicateFileMatches is the maximum number of files matching a predicate
+// that are searched for. With more files, the results of the query are
+// incomplete.
+const maxPredicateFileMatches = 10000
+
+// errRepoHasFileLimitHit is returned when a repo:has.file(...) predicate
+// matches more than maxPredicateFileMatches files, in which case it is not
+// known which repositories contain a matching file.
+var errRepoHasFileLimitHit = errors.New("repo:has.file(...) matches too many files")
+
+// searchFilePredicate returns the files of repos matching the predicate p:
+// files whose path matches p.Path and whose content matches p.Content. If
+// patternInfo is non-nil, the files also match its include and exclude
+// patterns. Files are searched with indexed and unindexed search like any
+// text search, up to maxPredicateFileMatches files. limitHit is true if there
+// may be more.
+func searchFilePredicate(ctx context.Context, repos []*search.RepositoryRevisions, p query.FilePredicate, patternInfo *search.TextPatternInfo) (matches []*FileMatchResolver, limitHit bool, err error) {
+	info := &search.TextPatternInfo{
+		IsRegExp:                     true,
+		Pattern:                      p.Content,
+		FileMatchLimit:               maxPredicateFileMatches,
+		PathPatternsAreRegExps:       true,
+		PathPatternsAreCaseSensitive: false,
+		PatternMatchesContent:        true,
+		PatternMatchesPath:           p.Content == "",
+	}
+	if patternInfo != nil {
+		info.IsCaseSensitive = patternInfo.IsCaseSensitive
+		info.IncludePatterns = append(info.IncludePatterns, patternInfo.IncludePatterns...)
+		info.ExcludePattern = patternInfo.ExcludePattern
+		info.PathPatternsAreCaseSensitive = patternInfo.PathPatternsAreCaseSensitive
+	}
+	if p.Path != "" {
+		info.IncludePatterns = append(info.IncludePatterns, p.Path)
+	}
+
+	matches, common, err := searchFilesInRepos(ctx, &search.TextParameters{
+		PatternInfo:     info,
+		Repos:           repos,
+		Query:           predicateQuery(info),
+		UseFullDeadline: true,
+		Zoekt:           search.Indexed(),
+		SearcherURLs:    search.SearcherURLs(),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	limitHit = len(matches) >= maxPredicateFileMatches || common != nil && common.limitHit
+	return matches, limitHit, nil
+}
+
+// predicateQuery returns the query of the search for the files matching a
+// predicate, which info describes.
+func predicateQuery(info *search.TextPatternInfo) query.QueryInfo {
+	var nodes []query.Node
+	for _, p := range info.IncludePatterns {
+		nodes = append(nodes, query.Parameter{Field: query.FieldFile, Value: p})
+	}
+	if info.ExcludePattern != "" {
+		nodes = append(nodes, query.Parameter{Field: query.FieldFile, Value: info.ExcludePattern, Negated: true})
+	}
+	if info.IsCaseSensitive {
+		nodes = append(nodes, query.Parameter{Field: query.FieldCase, Value: "yes"})
+	}
+	if info.Pattern != "" {
+		nodes = append(nodes, query.Parameter{Value: info.Pattern})
+	}
+	return query.AndOrQuery{Query: nodes}
+}
+
+// filterRepoHasFile returns the repositories of repos which contain a file
+// matching each of predicates, and no file matching any of negated. These are
+// the repo:has.file(...) and -repo:has.file(...) predicates of a query.
+func filterRepoHasFile(ctx context.Context, repos []*search.RepositoryRevisions, predicates, negated []query.FilePredicate) ([]*search.RepositoryRevisions, error) {
+	filter := func(p query.FilePredicate, want bool) error {
+		matches, limitHit, err := searchFilePredicate(ctx, repos, p, nil)
+		if err != nil {
+			return err
+		}
+		if limitHit {
+			return errRepoHasFileLimitHit
+		}
+		hasFile := make(map[api.RepoID]bool, len(matches))
+		for _, m := range matches {
+			hasFile[m.Repo.ID] = true
+		}
+		filtered := repos[:0:0]
+		for _, r := range repos {
+			if hasFile[r.Repo.ID] == want {
+				filtered = append(filtered, r)
+			}
+		}
+		repos = filtered
+		return nil
+	}
+
+	for _, p := range predicates {
+		if len(repos) == 0 {
+			break
+		}
+		if err := filter(p, true); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range negated {
+		if len(repos) == 0 {
+			break
+		}
+		if err := filter(p, false); err != nil {
+			return nil, err
+		}
+	}
+	return repos, nil
+}
+
+// repoFile identifies a file matched by a search.
+type repoFile struct {
+	repo api.RepoID
+	path string
+}
+
+// searchFilesContaining searches only the files which match the
+// file:contains(...) predicates of a query. The files matching the
+// predicates are found first, and the search is then restricted to them. The
+// results are incomplete (limitHit) if a predicate matches too many files.
+func searchFilesContaining(ctx context.Context, args *search.TextParameters, predicates []query.FilePredicate) ([]*FileMatchResolver, *searchResultsCommon, error) {
+	var (
+		files             map[repoFile]bool
+		predicateLimitHit bool
+	)
+	repos := args.Repos
+	for _, p := range predicates {
+		matches, limitHit, err := searchFilePredicate(ctx, repos, p, args.PatternInfo)
+		if err != nil {
+			return nil, nil, err
+		}
+		predicateLimitHit = predicateLimitHit || limitHit
+		matching := make(map[repoFile]bool, len(matches))
+		for _, m := range matches {
+			key := repoFile{repo: m.Repo.ID, path: m.JPath}
+			if files == nil || files[key] {
+				matching[key] = true
+			}
+		}
+		files = matching
+
+		inFiles := make(map[api.RepoID]bool)
+		for key := range files {
+			inFiles[key.repo] = true
+		}
+		filtered := repos[:0:0]
+		for _, r := range repos {
+			if inFiles[r.Repo.ID] {
+				filtered = append(filtered, r)
+			}
+		}
+		repos = filtered
+	}
+	if len(repos) == 0 {
+		return nil, &searchResultsCommon{limitHit: predicateLimitHit, partial: make(map[api.RepoName]struct{})}, nil
+	}
+
+	newArgs := *args
+	newArgs.Repos = repos
+	if len(files) <= maxContainsIncludePaths && args.PatternInfo.PathPatternsAreRegExps {
+		// Only search the matching paths. The same path may match in one
+		// repository and not in another, so the results are still filtered
+		// below.
+		paths := make([]string, 0, len(files))
+		for key := range files {
+			paths = append(paths, regexp.QuoteMeta(key.path))
+		}
+		sort.Strings(paths)
+		patternInfo := *args.PatternInfo
+		patternInfo.IncludePatterns = append(append([]string{}, patternInfo.IncludePatterns...), "^("+strings.Join(paths, "|")+")$")
+		newArgs.PatternInfo = &patternInfo
+	}
+
+	results, common, err := doSearchFilesInRepos(ctx, &newArgs)
+	if err != nil {
+		return nil, nil, err
+	}
+	filtered := results[:0]
+	for _, fm := range results {
+		if files[repoFile{repo: fm.Repo.ID, path: fm.JPath}] {
+			filtered = append(filtered, fm)
+		}
+	}
+	common.limitHit = common.limitHit || predicateLimitHit
+	return filtered, common, nil
+}
@@ -0,0 +1,111 @@
+package graphqlbackend
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/search"
+	"github.com/sourcegraph/sourcegraph/internal/search/query"
+)
+
+func TestFilterRepoHasFile(t *testing.T) {
+	defer func() { mockSearchFilesInRepos = nil }()
+
+	var repos []*search.RepositoryRevisions
+	for id, name := range []api.RepoName{"a", "b", "c"} {
+		repos = append(repos, &search.RepositoryRevisions{Repo: &types.Repo{ID: api.RepoID(id + 1), Name: name}})
+	}
+	// a and b have a go.mod file requiring foo, b and c have a vendor
+	// directory.
+	mockSearchFilesInRepos = func(args *search.TextParameters) ([]*FileMatchResolver, *searchResultsCommon, error) {
+		var names []api.RepoName
+		switch {
+		case args.PatternInfo.Pattern == "foo" && reflect.DeepEqual(args.PatternInfo.IncludePatterns, []string{"go.mod"}):
+			names = []api.RepoName{"a", "b"}
+		case args.PatternInfo.Pattern == "" && reflect.DeepEqual(args.PatternInfo.IncludePatterns, []string{"vendor/"}):
+			names = []api.RepoName{"b", "c"}
+		default:
+			t.Fatalf("unexpected search %+v", args.PatternInfo)
+		}
+		var matches []*FileMatchResolver
+		for _, r := range args.Repos {
+			for _, name := range names {
+				if r.Repo.Name == name {
+					matches = append(matches, &FileMatchResolver{Repo: r.Repo})
+				}
+			}
+		}
+		return matches, &searchResultsCommon{}, nil
+	}
+
+	repoNames := func(repos []*search.RepositoryRevisions) []api.RepoName {
+		var names []api.RepoName
+		for _, r := range repos {
+			names = append(names, r.Repo.Name)
+		}
+		return names
+	}
+
+	hasFoo := query.FilePredicate{Path: "go.mod", Content: "foo"}
+	hasVendor := query.FilePredicate{Path: "vendor/"}
+	tests := []struct {
+		name                string
+		predicates, negated []query.FilePredicate
+		want                []api.RepoName
+	}{
+		{name: "include", predicates: []query.FilePredicate{hasFoo}, want: []api.RepoName{"a", "b"}},
+		{name: "exclude", negated: []query.FilePredicate{hasVendor}, want: []api.RepoName{"a"}},
+		{name: "include and exclude", predicates: []query.FilePredicate{hasVendor}, negated: []query.FilePredicate{hasFoo}, want: []api.RepoName{"c"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := filterRepoHasFile(context.Background(), repos, test.predicates, test.negated)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(repoNames(got), test.want) {
+				t.Errorf("got %v, want %v", repoNames(got), test.want)
+			}
+		})
+	}
+}
+
+func TestFilterRepoHasFile_limitHit(t *testing.T) {
+	defer func() { mockSearchFilesInRepos = nil }()
+	mockSearchFilesInRepos = func(args *search.TextParameters) ([]*FileMatchResolver, *searchResultsCommon, error) {
+		if args.PatternInfo.FileMatchLimit != maxPredicateFileMatches {
+			t.Errorf("got file match limit %d, want %d", args.PatternInfo.FileMatchLimit, maxPredicateFileMatches)
+		}
+		return nil, &searchResultsCommon{limitHit: true}, nil
+	}
+
+	repos := []*search.RepositoryRevisions{{Repo: &types.Repo{ID: 1, Name: "a"}}}
+	_, err := filterRepoHasFile(context.Background(), repos, []query.FilePredicate{{Path: "go.mod"}}, nil)
+	if err != errRepoHasFileLimitHit {
+		t.Errorf("got error %v, want %v", err, errRepoHasFileLimitHit)
+	}
+}
+
+func TestPredicateQuery(t *testing.T) {
+	q := predicateQuery(&search.TextPatternInfo{
+		Pattern:         "foo",
+		IsCaseSensitive: true,
+		IncludePatterns: []string{`\.go$`, "go.mod"},
+		ExcludePattern:  "vendor/",
+	})
+
+	var got []string
+	for _, node := range q.(query.AndOrQuery).Query {
+		got = append(got, node.String())
+	}
+	want := []string{`"file:\\.go$"`, `"file:go.mod"`, `"-file:vendor/"`, `"case:yes"`, `"foo"`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got query %v, want %v", got, want)
+	}
+	if predicates, _ := query.Predicates(q, query.FieldFile); len(predicates) > 0 {
+		t.Errorf("got predicates %v, want none", predicates)
+	}
+}
@@ -0,0 +1,344 @@
+package graphqlbackend
+
+import (
+	"fmt"
+	rxsyntax "regexp/syntax"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sourcegraph/sourcegraph/internal/conf"
+	"github.com/sourcegraph/sourcegraph/internal/search/query"
+	"github.com/sourcegraph/sourcegraph/internal/search/query/syntax"
+	querytypes "github.com/sourcegraph/sourcegraph/internal/search/query/types"
+)
+
+const (
+	severityError   = "ERROR"
+	severityWarning = "WARNING"
+)
+
+var patternTypes = map[string]query.SearchType{
+	"literal":    query.SearchTypeLiteral,
+	"regexp":     query.SearchTypeRegex,
+	"structural": query.SearchTypeStructural,
+}
+
+type parseSearchQueryArgs struct {
+	Query       string
+	PatternType *string
+}
+
+// ParseSearchQuery parses and validates a query in the same way as a search,
+// without running it. Diagnostics are reported for the parser that the search
+// would use: the and/or parser if it is enabled and the query contains
+// operators, or the ordinary parser otherwise.
+func (r *schemaResolver) ParseSearchQuery(args *parseSearchQueryArgs) (*searchQueryAnalysisResolver, error) {
+	searchType, err := detectSearchType("V2", args.PatternType, args.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &searchQueryAnalysisResolver{query: args.Query}
+	nodes, diagnostics := query.Diagnose(args.Query)
+	if conf.AndOrQueryEnabled() && query.ContainsAndOrKeyword(args.Query) {
+		if nodes != nil {
+			a.parseTree = parseTreeJSON(args.Query, nodes)
+		}
+		for _, d := range diagnostics {
+			a.addDiagnostic(severityError, d.Message, d.Range, nil)
+		}
+	} else {
+		a.addOrdinaryQueryDiagnostics(searchType)
+	}
+	a.addPatternTypeDiagnostics(nodes, args.PatternType)
+	return a, nil
+}
+
+// addOrdinaryQueryDiagnostics sets the parse tree of the query processed by
+// the ordinary parser, and adds a diagnostic for its first error, since the
+// ordinary parser stops at the first error.
+func (a *searchQueryAnalysisResolver) addOrdinaryQueryDiagnostics(searchType query.SearchType) {
+	queryString := a.query
+	if searchType == query.SearchTypeLiteral {
+		queryString = query.ConvertToLiteral(a.query)
+	}
+
+	// Positions are only known for the input query. Literal queries are
+	// quoted before they are parsed, so their nodes and errors apply to the
+	// whole query.
+	whole := query.Range{Start: 0, End: len(a.query)}
+	at := func(pos int) query.Range {
+		if searchType == query.SearchTypeLiteral || pos < 0 || pos > len(a.query) {
+			return whole
+		}
+		return query.Range{Start: pos, End: len(a.query)}
+	}
+
+	if parseTree, err := syntax.Parse(queryString); err == nil {
+		a.parseTree = ordinaryParseTreeJSON(a.query, parseTree, func(expr *syntax.Expr) query.Range {
+			if searchType == query.SearchTypeLiteral {
+				return whole
+			}
+			return exprRange(a.query, expr)
+		})
+	}
+
+	_, err := query.Process(queryString, searchType)
+	if err == nil {
+		return
+	}
+	switch e := err.(type) {
+	case *syntax.ParseError:
+		a.addDiagnostic(severityError, e.Msg, at(e.Pos), quotingFixes(queryString))
+	case *querytypes.TypeError:
+		var fixes []*searchQueryFixResolver
+		if _, ok := e.Err.(*rxsyntax.Error); ok {
+			fixes = quotingFixes(queryString)
+		}
+		// Type errors apply to a single parameter, which ends at the next
+		// whitespace.
+		rng := at(e.Pos)
+		if rng != whole {
+			if i := strings.IndexAny(a.query[rng.Start:], " \t\n"); i >= 0 {
+				rng.End = rng.Start + i
+			}
+		}
+		a.addDiagnostic(severityError, e.Err.Error(), rng, fixes)
+	default:
+		a.addDiagnostic(severityError, err.Error(), whole, nil)
+	}
+}
+
+// addPatternTypeDiagnostics adds diagnostics for patterntype: fields that
+// are not valid, or that override the pattern type of the request.
+func (a *searchQueryAnalysisResolver) addPatternTypeDiagnostics(nodes []query.Node, requested *string) {
+	query.Visit(nodes, func(node query.Node) {
+		parameter, ok := node.(query.Parameter)
+		if !ok || strings.ToLower(parameter.Field) != query.FieldPatternType {
+			return
+		}
+		value := strings.ToLower(parameter.Value)
+		if _, ok := patternTypes[value]; !ok {
+			var fixes []*searchQueryFixResolver
+			for _, patternType := range []string{"literal", "regexp", "structural"} {
+				fixes = append(fixes, &searchQueryFixResolver{
+					description: fmt.Sprintf("Use patterntype:%s", patternType),
+					query:       a.query[:parameter.Range.Start] + "patterntype:" + patternType + a.query[parameter.Range.End:],
+				})
+			}
+			a.addDiagnostic(severityError, fmt.Sprintf("unknown pattern type %q, expected literal, regexp or structural", parameter.Value), parameter.Range, fixes)
+			return
+		}
+		if requested != nil && *requested != value {
+			a.addDiagnostic(severityWarning, fmt.Sprintf("patterntype:%s overrides the %s pattern type of the search", value, *requested), parameter.Range, []*searchQueryFixResolver{{
+				description: fmt.Sprintf("Remove patterntype:%s", value),
+				query:       removeRange(a.query, parameter.Range),
+			}})
+		}
+	})
+}
+
+// quotingFixes returns fixes which quote the query, like the proposed
+// queries of an alert for a query that cannot be parsed.
+func quotingFixes(queryString string) []*searchQueryFixResolver {
+	var fixes []*searchQueryFixResolver
+	for _, q := range proposedQuotedQueries(queryString) {
+		fixes = append(fixes, &searchQueryFixResolver{description: capFirst(q.description), query: q.Query()})
+	}
+	return fixes
+}
+
+// removeRange removes the range rng of bytes from q, and the whitespace
+// around it.
+func removeRange(q string, rng query.Range) string {
+	before := strings.TrimRight(q[:rng.Start], " \t\n")
+	after := strings.TrimLeft(q[rng.End:], " \t\n")
+	if before != "" && after != "" {
+		return before + " " + after
+	}
+	return before + after
+}
+
+// parseTreeJSON returns nodes as JSON values, with the ranges of nodes in
+// characters. The range of an operator spans its operands, and the range of
+// a not-expression also its not keyword.
+func parseTreeJSON(q string, nodes []query.Node) []interface{} {
+	var toJSON func(node query.Node) (map[string]interface{}, query.Range)
+	toJSON = func(node query.Node) (map[string]interface{}, query.Range) {
+		switch n := node.(type) {
+		case query.Parameter:
+			return map[string]interface{}{
+				"type":    "parameter",
+				"field":   n.Field,
+				"value":   n.Value,
+				"negated": n.Negated,
+				"quoted":  n.Quoted,
+				"range":   characterRange(q, n.Range).toJSON(),
+			}, n.Range
+		case query.Operator:
+			operands := make([]interface{}, 0, len(n.Operands))
+			var rng query.Range
+			for i, operand := range n.Operands {
+				value, operandRange := toJSON(operand)
+				operands = append(operands, value)
+				if i == 0 || operandRange.Start < rng.Start {
+					rng.Start = operandRange.Start
+				}
+				if operandRange.End > rng.End {
+					rng.End = operandRange.End
+				}
+			}
+			if n.Kind == query.Not && n.Range.End > n.Range.Start {
+				rng = n.Range
+			}
+			return map[string]interface{}{
+				"type":     "operator",
+				"kind":     operatorKindName(n),
+				"operands": operands,
+				"range":    characterRange(q, rng).toJSON(),
+			}, rng
+		}
+		return nil, query.Range{}
+	}
+
+	tree := make([]interface{}, 0, len(nodes))
+	for _, node := range nodes {
+		value, _ := toJSON(node)
+		tree = append(tree, value)
+	}
+	return tree
+}
+
+// ordinaryParseTreeJSON returns the expressions of the ordinary parser as a
+// list of parameter nodes of the same form as parseTreeJSON, with the ranges
+// returned by rangeOf.
+func ordinaryParseTreeJSON(q string, parseTree syntax.ParseTree, rangeOf func(*syntax.Expr) query.Range) []interface{} {
+	tree := make([]interface{}, 0, len(parseTree))
+	for _, expr := range parseTree {
+		value := expr.Value
+		quoted := expr.ValueType == syntax.TokenQuoted
+		if quoted {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+		}
+		tree = append(tree, map[string]interface{}{
+			"type":    "parameter",
+			"field":   expr.Field,
+			"value":   value,
+			"negated": expr.Not,
+			"quoted":  quoted,
+			"range":   characterRange(q, rangeOf(expr)).toJSON(),
+		})
+	}
+	return tree
+}
+
+// exprRange returns the range of bytes of expr in the query q it was parsed
+// from, including the - prefix of a negated expression.
+func exprRange(q string, expr *syntax.Expr) query.Range {
+	rng := query.Range{Start: expr.Pos, End: expr.Pos + len(expr.Value)}
+	if expr.Field != "" {
+		rng.End += len(expr.Field) + len(":")
+	}
+	if expr.Not && rng.Start > 0 && q[rng.Start-1] == '-' {
+		rng.Start--
+	}
+	if rng.End > len(q) {
+		rng.End = len(q)
+	}
+	return rng
+}
+
+func operatorKindName(operator query.Operator) string {
+	switch operator.Kind {
+	case query.And:
+		return "and"
+	case query.Or:
+		return "or"
+	case query.Not:
+		return "not"
+	}
+	return "concat"
+}
+
+// characterRange converts a range of bytes in q to a range of characters.
+func characterRange(q string, rng query.Range) *searchQueryRangeResolver {
+	offset := func(i int) int32 {
+		if i > len(q) {
+			i = len(q)
+		}
+		return int32(utf8.RuneCountInString(q[:i]))
+	}
+	return &searchQueryRangeResolver{start: offset(rng.Start), end: offset(rng.End)}
+}
+
+type searchQueryAnalysisResolver struct {
+	query       string
+	parseTree   []interface{}
+	diagnostics []*searchQueryDiagnosticResolver
+}
+
+func (a *searchQueryAnalysisResolver) addDiagnostic(severity, message string, rng query.Range, fixes []*searchQueryFixResolver) {
+	a.diagnostics = append(a.diagnostics, &searchQueryDiagnosticResolver{
+		severity: severity,
+		message:  message,
+		rng:      characterRange(a.query, rng),
+		fixes:    fixes,
+	})
+}
+
+func (a *searchQueryAnalysisResolver) ParseTree() *JSONValue {
+	if a.parseTree == nil {
+		return nil
+	}
+	return &JSONValue{a.parseTree}
+}
+
+func (a *searchQueryAnalysisResolver) Diagnostics() []*searchQueryDiagnosticResolver {
+	if a.diagnostics == nil {
+		return []*searchQueryDiagnosticResolver{}
+	}
+	return a.diagnostics
+}
+
+type searchQueryDiagnosticResolver struct {
+	severity string
+	message  string
+	rng      *searchQueryRangeResolver
+	fixes    []*searchQueryFixResolver
+}
+
+func (d *searchQueryDiagnosticResolver) Severity() string { return d.severity }
+func (d *searchQueryDiagnosticResolver) Message() string  { return d.message }
+func (d *searchQueryDiagnosticResolver) Range() *searchQueryRangeResolver {
+	return d.rng
+}
+
+func (d *searchQueryDiagnosticResolver) Fixes() []*searchQueryFixResolver {
+	if d.fixes == nil {
+		return []*searchQueryFixResolver{}
+	}
+	return d.fixes
+}
+
+type searchQueryRangeResolver struct {
+	start, end int32
+}
+
+func (r *searchQueryRangeResolver) Start() int32 { return r.start }
+func (r *searchQueryRangeResolver) End() int32   { return r.end }
+
+// toJSON returns the range as a JSON value of the parse tree.
+func (r *searchQueryRangeResolver) toJSON() map[string]int32 {
+	return map[string]int32{"start": r.start, "end": r.end}
+}
+
+type searchQueryFixResolver struct {
+	description string
+	query       string
+}
+
+func (f *searchQueryFixResolver) Description() string { return f.description }
+func (f *searchQueryFixResolver) Query() string       { return f.query }
@@ -0,0 +1,162 @@
+package graphqlbackend
+
+import (
+	"testing"
+
+	"github.com/graph-gophers/graphql-go/gqltesting"
+	"github.com/sourcegraph/sourcegraph/internal/conf"
+	"github.com/sourcegraph/sourcegraph/schema"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	resetMocks()
+	gqltesting.RunTests(t, []*gqltesting.Test{
+		{
+			Schema: mustParseGraphQLSchema(t),
+			Query: `
+				{
+					parseSearchQuery(query: "repo:föo bar patterntype:regexp", patternType: literal) {
+						parseTree
+						diagnostics {
+							severity
+							message
+							range { start end }
+							fixes { description query }
+						}
+					}
+				}
+			`,
+			ExpectedResult: `
+				{
+					"parseSearchQuery": {
+						"parseTree": [
+							{"type": "parameter", "field": "repo", "value": "föo", "negated": false, "quoted": false, "range": {"start": 0, "end": 8}},
+							{"type": "parameter", "field": "", "value": "bar", "negated": false, "quoted": false, "range": {"start": 9, "end": 12}},
+							{"type": "parameter", "field": "patterntype", "value": "regexp", "negated": false, "quoted": false, "range": {"start": 13, "end": 31}}
+						],
+						"diagnostics": [
+							{
+								"severity": "WARNING",
+								"message": "patterntype:regexp overrides the literal pattern type of the search",
+								"range": {"start": 13, "end": 31},
+								"fixes": [
+									{"description": "Remove patterntype:regexp", "query": "repo:föo bar"}
+								]
+							}
+						]
+					}
+				}
+			`,
+		},
+		{
+			Schema: mustParseGraphQLSchema(t),
+			Query: `
+				{
+					parseSearchQuery(query: "repo:a ) b", patternType: regexp) {
+						diagnostics {
+							severity
+							message
+							range { start end }
+							fixes { description query }
+						}
+					}
+				}
+			`,
+			ExpectedResult: `
+				{
+					"parseSearchQuery": {
+						"diagnostics": [
+							{
+								"severity": "ERROR",
+								"message": "error parsing regexp: unexpected ): ` + "`)`" + `",
+								"range": {"start": 7, "end": 8},
+								"fixes": [
+									{"description": "Treat the errored parts as literals", "query": "repo:a \")\" b patternType:regexp"},
+									{"description": "Treat the whole query as a literal", "query": "\"repo:a ) b\" patternType:regexp"}
+								]
+							}
+						]
+					}
+				}
+			`,
+		},
+		{
+			Schema: mustParseGraphQLSchema(t),
+			Query: `
+				{
+					parseSearchQuery(query: "-file:ö \"a b\"", patternType: regexp) {
+						parseTree
+					}
+				}
+			`,
+			ExpectedResult: `
+				{
+					"parseSearchQuery": {
+						"parseTree": [
+							{"type": "parameter", "field": "file", "value": "ö", "negated": true, "quoted": false, "range": {"start": 0, "end": 7}},
+							{"type": "parameter", "field": "", "value": "a b", "negated": false, "quoted": true, "range": {"start": 8, "end": 13}}
+						]
+					}
+				}
+			`,
+		},
+	})
+}
+
+func TestParseSearchQuery_andOr(t *testing.T) {
+	resetMocks()
+	conf.Mock(&conf.Unified{SiteConfiguration: schema.SiteConfiguration{
+		ExperimentalFeatures: &schema.ExperimentalFeatures{AndOrQuery: "enabled"},
+	}})
+	defer conf.Mock(nil)
+
+	gqltesting.RunTests(t, []*gqltesting.Test{
+		{
+			Schema: mustParseGraphQLSchema(t),
+			Query: `
+				{
+					parseSearchQuery(query: "count:many a and not b", patternType: regexp) {
+						parseTree
+						diagnostics {
+							severity
+							message
+							range { start end }
+						}
+					}
+				}
+			`,
+			ExpectedResult: `
+				{
+					"parseSearchQuery": {
+						"parseTree": [
+							{
+								"type": "operator",
+								"kind": "and",
+								"operands": [
+									{"type": "parameter", "field": "count", "value": "many", "negated": false, "quoted": false, "range": {"start": 0, "end": 10}},
+									{"type": "parameter", "field": "", "value": "a", "negated": false, "quoted": false, "range": {"start": 11, "end": 12}},
+									{
+										"type": "operator",
+										"kind": "not",
+										"operands": [
+											{"type": "parameter", "field": "", "value": "b", "negated": false, "quoted": false, "range": {"start": 21, "end": 22}}
+										],
+										"range": {"start": 17, "end": 22}
+									}
+								],
+								"range": {"start": 0, "end": 22}
+							}
+						],
+						"diagnostics": [
+							{
+								"severity": "ERROR",
+								"message": "field count has value many, many is not a number",
+								"range": {"start": 0, "end": 10}
+							}
+						]
+					}
+				}
+			`,
+		},
+	})
+}
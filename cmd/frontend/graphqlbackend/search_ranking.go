@@ -0,0 +1,369 @@
+package graphqlbackend
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/neelance/parallel"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/backend"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/db"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/goroutine"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/lazyregexp"
+	"github.com/sourcegraph/sourcegraph/internal/search"
+	"github.com/sourcegraph/sourcegraph/internal/search/query"
+	"github.com/sourcegraph/sourcegraph/internal/vcs/git"
+)
+
+const (
+	// rankingTimeout bounds the time spent looking up the signals used to
+	// rank results. Signals that are not found in time are ignored.
+	rankingTimeout = 2 * time.Second
+
+	// maxRankingLookups is the maximum number of symbol or commit lookups
+	// made to rank the results of a search.
+	maxRankingLookups = 100
+
+	// maxSymbolLookupFragments is the maximum number of distinct matched
+	// fragments of a file that are looked up as symbol definitions.
+	maxSymbolLookupFragments = 50
+)
+
+// penalizedPath matches paths of tests, vendored dependencies and generated
+// files, which are rarely what a search is looking for.
+var penalizedPath = lazyregexp.New(`(^|/)(vendor|node_modules|third_party|testdata|__tests__|__mocks__|tests?|specs?)/|(_test|_spec|\.test|\.spec|\.min|\.pb)\.[^/]+$`)
+
+// rankSignals are the signals used to rank a result by relevance.
+type rankSignals struct {
+	zoektScore       float64 // the score zoekt assigned to the file, or 0 if it is not indexed
+	symbolDefinition bool    // whether a match is on the definition of a symbol
+	pathDepth        int     // the number of directories in the path of the file
+	penalized        bool    // whether the path matches penalizedPath
+	stars            int     // the number of stars of the repository
+}
+
+// score returns the relevance score of a result. maxZoektScore is the
+// highest zoekt score of the results being ranked, which is used to normalize
+// the zoekt scores of indexed results to the same range as the other signals.
+func (s rankSignals) score(maxZoektScore float64) float64 {
+	// Results of unindexed search have no zoekt score, so they get a neutral
+	// score instead.
+	score := 0.5
+	if s.zoektScore > 0 && maxZoektScore > 0 {
+		score = s.zoektScore / maxZoektScore
+	}
+	if s.symbolDefinition {
+		score++
+	}
+	score -= 0.1 * math.Min(float64(s.pathDepth), 5)
+	if s.penalized {
+		score--
+	}
+	// 10,000 stars are worth as much as a symbol definition.
+	score += math.Min(math.Log10(1+float64(s.stars))/4, 1)
+	return score
+}
+
+// rankResults sorts results in the order requested by the sort: field of the
+// query. Results are already sorted by repository and path, which is the
+// default order.
+func (r *searchResolver) rankResults(ctx context.Context, results []SearchResultResolver) []SearchResultResolver {
+	if r.pagination != nil {
+		// Cursors depend on the default order.
+		return results
+	}
+
+	switch query.Sort(r.query) {
+	case query.SortRelevance:
+		ctx, cancel := context.WithTimeout(ctx, rankingTimeout)
+		defer cancel()
+		sortByRelevance(results, collectRankSignals(ctx, results))
+	case query.SortPath:
+		sortByPath(results)
+	case query.SortRecent:
+		ctx, cancel := context.WithTimeout(ctx, rankingTimeout)
+		defer cancel()
+		sortByRecency(results, lastCommitDates(ctx, results))
+	}
+	return results
+}
+
+// sortByRelevance sorts results by the score of their signals, highest
+// first. signals[i] are the signals of results[i].
+func sortByRelevance(results []SearchResultResolver, signals []rankSignals) {
+	var maxZoektScore float64
+	for _, s := range signals {
+		maxZoektScore = math.Max(maxZoektScore, s.zoektScore)
+	}
+	scores := make([]float64, len(results))
+	for i, s := range signals {
+		scores[i] = s.score(maxZoektScore)
+	}
+	sort.Stable(byKey{results: results, keys: scores})
+}
+
+// sortByPath sorts results by file path, and then by repository. Results
+// without a path come first.
+func sortByPath(results []SearchResultResolver) {
+	sort.SliceStable(results, func(i, j int) bool {
+		irepo, ipath := results[i].searchResultURIs()
+		jrepo, jpath := results[j].searchResultURIs()
+		if ipath == jpath {
+			return irepo < jrepo
+		}
+		return ipath < jpath
+	})
+}
+
+// sortByRecency sorts results by the date of their last commit, most recent
+// first. dates[i] is the date of results[i], or the zero time if it is
+// unknown.
+func sortByRecency(results []SearchResultResolver, dates []time.Time) {
+	keys := make([]float64, len(dates))
+	for i, d := range dates {
+		if !d.IsZero() {
+			keys[i] = float64(d.Unix())
+		} else {
+			keys[i] = math.Inf(-1)
+		}
+	}
+	sort.Stable(byKey{results: results, keys: keys})
+}
+
+// byKey sorts results by their key, highest first. Results with the same
+// key keep their order.
+type byKey struct {
+	results []SearchResultResolver
+	keys    []float64
+}
+
+func (s byKey) Len() int           { return len(s.results) }
+func (s byKey) Less(i, j int) bool { return s.keys[i] > s.keys[j] }
+func (s byKey) Swap(i, j int) {
+	s.results[i], s.results[j] = s.results[j], s.results[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// resultRepo returns the repository of a result.
+func resultRepo(result SearchResultResolver) api.RepoID {
+	switch m := result.(type) {
+	case *FileMatchResolver:
+		return m.Repo.ID
+	case *RepositoryResolver:
+		return m.repo.ID
+	case *commitSearchResultResolver:
+		return m.commit.repo.repo.ID
+	}
+	return 0
+}
+
+// collectRankSignals returns the signals of each result. Signals which
+// require looking up symbols or repository metadata are best effort.
+func collectRankSignals(ctx context.Context, results []SearchResultResolver) []rankSignals {
+	signals := make([]rankSignals, len(results))
+	for i, result := range results {
+		if fm, ok := result.(*FileMatchResolver); ok {
+			signals[i].zoektScore = fm.zoektScore
+			signals[i].pathDepth = strings.Count(fm.JPath, "/")
+			signals[i].penalized = penalizedPath.MatchString(fm.JPath)
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	goroutine.Go(func() {
+		defer wg.Done()
+		repoIDs := make([]api.RepoID, 0, len(results))
+		seen := make(map[api.RepoID]struct{}, len(results))
+		for _, result := range results {
+			if id := resultRepo(result); id != 0 {
+				if _, ok := seen[id]; !ok {
+					seen[id] = struct{}{}
+					repoIDs = append(repoIDs, id)
+				}
+			}
+		}
+		// The repositories of the results are accessible by the current user.
+		stars, err := db.Repos.GetStars(ctx, repoIDs...)
+		if err != nil {
+			log15.Warn("search ranking: failed to get repository stars", "error", err)
+			return
+		}
+		for i, result := range results {
+			signals[i].stars = stars[resultRepo(result)]
+		}
+	})
+	var definitions map[*FileMatchResolver]bool
+	goroutine.Go(func() {
+		defer wg.Done()
+		definitions = findSymbolDefinitions(ctx, results)
+	})
+	wg.Wait()
+
+	for i, result := range results {
+		if fm, ok := result.(*FileMatchResolver); ok {
+			signals[i].symbolDefinition = definitions[fm]
+		}
+	}
+	return signals
+}
+
+// findSymbolDefinitions returns the file matches with a line match on the
+// definition of a symbol. It asks the symbols service for the symbols named
+// like the matches in the files of each repository and commit.
+func findSymbolDefinitions(ctx context.Context, results []SearchResultResolver) map[*FileMatchResolver]bool {
+	type repoCommit struct {
+		repo   api.RepoName
+		commit api.CommitID
+	}
+	var (
+		keys   []repoCommit
+		groups = map[repoCommit][]*FileMatchResolver{}
+	)
+	for _, result := range results {
+		fm, ok := result.(*FileMatchResolver)
+		if !ok || len(fm.JLineMatches) == 0 {
+			continue
+		}
+		key := repoCommit{repo: fm.Repo.Name, commit: fm.CommitID}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], fm)
+	}
+	if len(keys) > maxRankingLookups {
+		keys = keys[:maxRankingLookups]
+	}
+
+	var (
+		mu          sync.Mutex
+		definitions = map[*FileMatchResolver]bool{}
+		run         = parallel.NewRun(8)
+	)
+	for _, key := range keys {
+		key := key
+		files := groups[key]
+		fragments := matchedFragments(files)
+		if len(fragments) == 0 {
+			continue
+		}
+		paths := make([]string, len(files))
+		for i, fm := range files {
+			paths[i] = regexp.QuoteMeta(fm.JPath)
+		}
+
+		run.Acquire()
+		goroutine.Go(func() {
+			defer run.Release()
+			symbols, err := backend.Symbols.ListTags(ctx, search.SymbolsParameters{
+				Repo:            key.repo,
+				CommitID:        key.commit,
+				Query:           "^(" + strings.Join(fragments, "|") + ")$",
+				IsRegExp:        true,
+				IsCaseSensitive: true,
+				IncludePatterns: []string{"^(" + strings.Join(paths, "|") + ")$"},
+			})
+			if err != nil {
+				if ctx.Err() == nil {
+					log15.Warn("search ranking: failed to list symbols", "repo", key.repo, "error", err)
+				}
+				return
+			}
+
+			// Symbols are defined at 1-based line numbers.
+			defined := make(map[string]map[int32]bool, len(files))
+			for _, s := range symbols {
+				if defined[s.Path] == nil {
+					defined[s.Path] = map[int32]bool{}
+				}
+				defined[s.Path][int32(s.Line)-1] = true
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, fm := range files {
+				for _, lm := range fm.JLineMatches {
+					if defined[fm.JPath][lm.JLineNumber] {
+						definitions[fm] = true
+						break
+					}
+				}
+			}
+		})
+	}
+	run.Wait()
+	return definitions
+}
+
+// matchedFragments returns the distinct matched text of the line matches of
+// files, quoted for use in a regexp.
+func matchedFragments(files []*FileMatchResolver) []string {
+	var fragments []string
+	seen := map[string]struct{}{}
+	for _, fm := range files {
+		for _, lm := range fm.JLineMatches {
+			line := []rune(lm.JPreview)
+			for _, ol := range lm.JOffsetAndLengths {
+				start, end := int(ol[0]), int(ol[0]+ol[1])
+				if start < 0 || end > len(line) || start == end {
+					continue
+				}
+				fragment := regexp.QuoteMeta(string(line[start:end]))
+				if _, ok := seen[fragment]; ok {
+					continue
+				}
+				seen[fragment] = struct{}{}
+				fragments = append(fragments, fragment)
+				if len(fragments) == maxSymbolLookupFragments {
+					return fragments
+				}
+			}
+		}
+	}
+	return fragments
+}
+
+// lastCommitDates returns the date of the last commit of each result: the
+// last commit that changed the file of a file match, or the commit of a
+// commit result. The date of other results, and of file matches beyond
+// maxRankingLookups, is the zero time.
+func lastCommitDates(ctx context.Context, results []SearchResultResolver) []time.Time {
+	var (
+		dates   = make([]time.Time, len(results))
+		lookups = 0
+		run     = parallel.NewRun(8)
+	)
+	for i, result := range results {
+		i := i
+		switch m := result.(type) {
+		case *commitSearchResultResolver:
+			dates[i] = m.commit.author.date
+		case *FileMatchResolver:
+			lookups++
+			if lookups > maxRankingLookups {
+				continue
+			}
+			run.Acquire()
+			goroutine.Go(func() {
+				defer run.Release()
+				commits, err := git.Commits(ctx, gitserver.Repo{Name: m.Repo.Name}, git.CommitsOptions{
+					Range: string(m.CommitID),
+					N:     1,
+					Path:  m.JPath,
+				})
+				if err != nil || len(commits) == 0 {
+					return
+				}
+				dates[i] = commits[0].Author.Date
+			})
+		}
+	}
+	run.Wait()
+	return dates
+}
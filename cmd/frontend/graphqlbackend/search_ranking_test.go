@@ -0,0 +1,128 @@
+package graphqlbackend
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+	"github.com/sourcegraph/sourcegraph/internal/search/query"
+)
+
+func resultPaths(results []SearchResultResolver) []string {
+	paths := make([]string, len(results))
+	for i, r := range results {
+		repo, path := r.searchResultURIs()
+		paths[i] = repo + ":" + path
+	}
+	return paths
+}
+
+func TestSortByRelevance(t *testing.T) {
+	repo := &types.Repo{ID: 1, Name: "r"}
+	fm := func(path string) *FileMatchResolver { return &FileMatchResolver{JPath: path, Repo: repo} }
+	results := []SearchResultResolver{fm("a/b/c/d.go"), fm("a_test.go"), fm("b.go"), fm("c.go"), fm("d.go"), fm("e.go")}
+	signals := []rankSignals{
+		{pathDepth: 3},
+		{penalized: true},
+		{zoektScore: 10},
+		{zoektScore: 20},
+		{symbolDefinition: true},
+		{stars: 99999},
+	}
+
+	sortByRelevance(results, signals)
+	want := []string{"r:d.go", "r:e.go", "r:c.go", "r:b.go", "r:a/b/c/d.go", "r:a_test.go"}
+	if got := resultPaths(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSortByPath(t *testing.T) {
+	repoA := &types.Repo{ID: 1, Name: "a"}
+	repoB := &types.Repo{ID: 2, Name: "b"}
+	results := []SearchResultResolver{
+		&FileMatchResolver{JPath: "y", Repo: repoA},
+		&FileMatchResolver{JPath: "x", Repo: repoB},
+		&FileMatchResolver{JPath: "x", Repo: repoA},
+		&RepositoryResolver{repo: repoB},
+	}
+
+	sortByPath(results)
+	want := []string{"b:", "a:x", "b:x", "a:y"}
+	if got := resultPaths(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSortByRecency(t *testing.T) {
+	repo := &types.Repo{ID: 1, Name: "r"}
+	fm := func(path string) *FileMatchResolver { return &FileMatchResolver{JPath: path, Repo: repo} }
+	results := []SearchResultResolver{fm("a"), fm("b"), fm("c"), fm("d")}
+	now := time.Now()
+	dates := []time.Time{{}, now.Add(-time.Hour), now, {}}
+
+	sortByRecency(results, dates)
+	want := []string{"r:c", "r:b", "r:a", "r:d"}
+	if got := resultPaths(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPenalizedPath(t *testing.T) {
+	for path, want := range map[string]bool{
+		"main.go":                        false,
+		"cmd/latest/main.go":             false,
+		"contest.go":                     false,
+		"main_test.go":                   true,
+		"web/src/app.test.tsx":           true,
+		"vendor/github.com/foo/foo.go":   true,
+		"client/node_modules/x/index.js": true,
+		"internal/testdata/a.txt":        true,
+		"api/api.pb.go":                  true,
+		"test/e2e.sh":                    true,
+	} {
+		if got := penalizedPath.MatchString(path); got != want {
+			t.Errorf("%s: got %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestMatchedFragments(t *testing.T) {
+	files := []*FileMatchResolver{
+		{JLineMatches: []*lineMatch{
+			{JPreview: "func NewFoo() *Foo {", JOffsetAndLengths: [][2]int32{{5, 6}, {15, 3}}},
+		}},
+		{JLineMatches: []*lineMatch{
+			{JPreview: "x := NewFoo()", JOffsetAndLengths: [][2]int32{{5, 6}}},
+			{JPreview: "a.b", JOffsetAndLengths: [][2]int32{{0, 3}, {2, 5}}},
+		}},
+	}
+
+	want := []string{"NewFoo", "Foo", `a\.b`}
+	if got := matchedFragments(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMaxResults_ranking(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		want  int32
+	}{
+		{query: "foo", want: defaultMaxSearchResults},
+		{query: "foo sort:path", want: defaultMaxSearchResults * rankingCandidatesFactor},
+		{query: "foo sort:relevance count:100", want: 100 * rankingCandidatesFactor},
+		{query: "foo sort:relevance count:500", want: maxRankingCandidates},
+		{query: "foo sort:recent count:2000", want: 2000},
+	} {
+		q, err := query.ParseAndCheck(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &searchResolver{query: q, ranking: query.Sort(q) != query.SortRepo}
+		if got := r.maxResults(); got != test.want {
+			t.Errorf("%s: got %d, want %d", test.query, got, test.want)
+		}
+	}
+}
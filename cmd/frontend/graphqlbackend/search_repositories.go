@@ -39,6 +39,7 @@ func searchRepositories(ctx context.Context, args *search.TextParameters, limit
 		query.FieldCase:               {},
 		query.FieldRepoHasFile:        {},
 		query.FieldRepoHasCommitAfter: {},
+		query.FieldContext:            {},
 	}
 	// Don't return repo results if the search contains fields that aren't on the whitelist.
 	// Matching repositories based whether they contain files at a certain path (etc.) is not yet implemented.
@@ -57,6 +58,15 @@ func searchRepositories(ctx context.Context, args *search.TextParameters, limit
 	if err != nil {
 		return nil, nil, err
 	}
+	match := pattern.MatchString
+	if args.PatternInfo.PatternExpression != nil {
+		// The pattern is the union of the leaves of the expression, so the
+		// expression itself decides which repository names match.
+		match, err = args.PatternInfo.PatternExpression.Matcher(args.Query.IsCaseSensitive())
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 
 	// Filter args.Repos by matching their names against the query pattern.
 	common = &searchResultsCommon{}
@@ -64,7 +74,7 @@ func searchRepositories(ctx context.Context, args *search.TextParameters, limit
 	var repos []*search.RepositoryRevisions
 	for i, r := range args.Repos {
 		common.repos[i] = r.Repo
-		if pattern.MatchString(string(r.Repo.Name)) {
+		if match(string(r.Repo.Name)) {
 			repos = append(repos, r)
 		}
 	}
@@ -15,9 +15,9 @@ import (
 	"time"
 
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/authz"
-	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/inventory"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/usagestats"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+	"github.com/sourcegraph/sourcegraph/internal/inventory"
 	"github.com/src-d/enry/v2"
 
 	"github.com/hashicorp/go-multierror"
@@ -578,13 +578,18 @@ func (r *searchResolver) evaluateLeaf(ctx context.Context) (*SearchResultsResolv
 			// there is a next cursor, and more results may exist.
 			result.searchResultsCommon.limitHit = true
 		}
+		r.sendResolver(result)
 		return result, err
 	}
 
 	// If the request is a paginated one, we handle it separately. See
 	// paginatedResults for more details.
 	if r.pagination != nil {
-		return r.paginatedResults(ctx)
+		result, err := r.paginatedResults(ctx)
+		if err == nil {
+			r.sendResolver(result)
+		}
+		return result, err
 	}
 
 	rr, err := r.resultsWithTimeoutSuggestion(ctx)
@@ -686,6 +691,7 @@ func intersect(left, right *SearchResultsResolver) (*SearchResultsResolver, erro
 		}
 
 		ltmpFileMatch.JLineMatches = append(ltmpFileMatch.JLineMatches, rtmpFileMatch.JLineMatches...)
+		ltmpFileMatch.JMultilineMatches = append(ltmpFileMatch.JMultilineMatches, rtmpFileMatch.JMultilineMatches...)
 		merged = append(merged, ltmp)
 	}
 	left.SearchResults = merged
@@ -695,6 +701,32 @@ func intersect(left, right *SearchResultsResolver) (*SearchResultsResolver, erro
 	return left, nil
 }
 
+// difference returns the file matches of left that are in files without a
+// content match in right. It evaluates "left and not right".
+func difference(left, right *SearchResultsResolver) *SearchResultsResolver {
+	if left == nil || right == nil {
+		return left
+	}
+
+	rFileMatches := make(map[string]bool)
+	for _, r := range right.SearchResults {
+		if fileMatch, ok := r.ToFileMatch(); ok {
+			rFileMatches[fileMatch.uri] = true
+		}
+	}
+
+	var remaining []SearchResultResolver
+	for _, l := range left.SearchResults {
+		if fileMatch, ok := l.ToFileMatch(); ok && !rFileMatches[fileMatch.uri] {
+			remaining = append(remaining, l)
+		}
+	}
+	left.SearchResults = remaining
+	left.searchResultsCommon.update(right.searchResultsCommon)
+	left.searchResultsCommon.resultCount = int32(len(remaining))
+	return left
+}
+
 // evaluateAnd performs set intersection on result sets. It collects results for
 // all expressions that are ANDed together by searching for each subexpression
 // and then intersects those results that are in the same repo/file path. To
@@ -703,11 +735,27 @@ func intersect(left, right *SearchResultsResolver) (*SearchResultsResolver, erro
 // and likely yields fewer than N results). Thus, we perform a search of 2*N for
 // each expression, and if the intersection does not yield N results, and is not
 // exhaustive for every expression, we rerun the search by doubling count again.
+//
+// Operands negated by not are evaluated like the other operands, and the files
+// they match are removed from the intersection.
 func (r *searchResolver) evaluateAnd(ctx context.Context, scopeParameters []query.Node, operands []query.Node) (*SearchResultsResolver, error) {
 	if len(operands) == 0 {
 		return nil, nil
 	}
 
+	var positive, negated []query.Node
+	for _, operand := range operands {
+		if operator, ok := operand.(query.Operator); ok && operator.Kind == query.Not {
+			negated = append(negated, operator.Operands[0])
+		} else {
+			positive = append(positive, operand)
+		}
+	}
+	if len(positive) == 0 {
+		return nil, errNegatedOperands
+	}
+	operands = positive
+
 	var err error
 	var result *SearchResultsResolver
 	var new *SearchResultsResolver
@@ -758,6 +806,16 @@ func (r *searchResolver) evaluateAnd(ctx context.Context, scopeParameters []quer
 				result, err = intersect(result, new)
 			}
 		}
+		for _, term := range negated {
+			new, err = r.evaluatePatternExpression(ctx, scopeParameters, term)
+			if err != nil {
+				return nil, err
+			}
+			if new != nil {
+				exhausted = exhausted && !new.limitHit
+				result = difference(result, new)
+			}
+		}
 		if exhausted {
 			break
 		}
@@ -838,15 +896,79 @@ func (r *searchResolver) evaluateOperator(ctx context.Context, scopeParameters [
 	return result, nil
 }
 
+// errNegatedOperands is returned when a not-expression of a structural search
+// pattern is not an operand of an and-expression with a positive operand.
+var errNegatedOperands = errors.New("not is only supported as an operand of and in structural search, as in foo and not bar")
+
+// supportsNegation returns true if every not-expression in node is an operand
+// of an and-expression which also has an operand that is not negated. Only
+// these not-expressions can be evaluated by evaluateAnd.
+func supportsNegation(node query.Node) bool {
+	operator, ok := node.(query.Operator)
+	if !ok {
+		return true
+	}
+	if operator.Kind == query.Not {
+		return false
+	}
+	positive := false
+	for _, operand := range operator.Operands {
+		if negated, ok := operand.(query.Operator); ok && negated.Kind == query.Not && operator.Kind == query.And {
+			if !supportsNegation(negated.Operands[0]) {
+				return false
+			}
+			continue
+		}
+		if !supportsNegation(operand) {
+			return false
+		}
+		positive = true
+	}
+	return positive
+}
+
+// appendNode returns a new slice of nodes with node appended to nodes. Unlike
+// append, it never writes to the backing array of nodes, which is shared by
+// the operands of an expression.
+func appendNode(nodes []query.Node, node query.Node) []query.Node {
+	result := make([]query.Node, 0, len(nodes)+1)
+	result = append(result, nodes...)
+	return append(result, node)
+}
+
+// patternExpressionResultTypes are the result types that evaluate a pattern
+// expression in a single search: zoekt and searcher evaluate it per file for
+// content and path results, and searchRepositories per repository name.
+var patternExpressionResultTypes = map[string]bool{
+	"file": true,
+	"path": true,
+	"repo": true,
+}
+
+// supportsPatternExpression returns true if every result type requested by q
+// evaluates a pattern expression in a single search. Other result types
+// evaluate and/or expressions by combining the results of several searches.
+func supportsPatternExpression(q query.QueryInfo) bool {
+	for _, resultType := range queryResultTypes(q) {
+		if !patternExpressionResultTypes[resultType] {
+			return false
+		}
+	}
+	return true
+}
+
 // evaluatePatternExpression evaluates a search pattern containing and/or expressions.
 func (r *searchResolver) evaluatePatternExpression(ctx context.Context, scopeParameters []query.Node, node query.Node) (*SearchResultsResolver, error) {
 	switch term := node.(type) {
 	case query.Operator:
 		if term.Kind == query.And || term.Kind == query.Or {
 			return r.evaluateOperator(ctx, scopeParameters, term)
+		} else if term.Kind == query.Not {
+			// Files without a match cannot be searched for, so not is
+			// only evaluated as an operand of and. See evaluateAnd.
+			return nil, errNegatedOperands
 		} else if term.Kind == query.Concat {
-			q := append(scopeParameters, term)
-			r.query = query.AndOrQuery{Query: q}
+			r.query = query.AndOrQuery{Query: appendNode(scopeParameters, term)}
 			return r.evaluateLeaf(ctx)
 		}
 	case query.Parameter:
@@ -868,23 +990,73 @@ func (r *searchResolver) evaluate(ctx context.Context, q []query.Node) (*SearchR
 		r.query = query.AndOrQuery{Query: scopeParameters}
 		return r.evaluateLeaf(ctx)
 	}
+	if (r.patternType == query.SearchTypeRegex || r.patternType == query.SearchTypeLiteral) && supportsPatternExpression(query.AndOrQuery{Query: q}) {
+		// Regexp pattern expressions, and literal ones whose patterns are
+		// escaped regexps, are evaluated by zoekt and searcher in a single
+		// search. See getPatternInfo.
+		r.query = query.AndOrQuery{Query: appendNode(scopeParameters, pattern)}
+		return r.evaluateLeaf(ctx)
+	}
+	if !supportsNegation(pattern) {
+		return &SearchResultsResolver{alert: alertForQuery("", &query.ValidationError{Msg: errNegatedOperands.Error()})}, nil
+	}
+	// And/or expressions combine the results of several searches, so
+	// intermediate results cannot be streamed. Send the final result set
+	// instead.
+	stream := r.stream
+	r.stream = nil
 	result, err := r.evaluatePatternExpression(ctx, scopeParameters, pattern)
+	r.stream = stream
 	if err != nil {
 		return nil, err
 	}
 	sortResults(result.SearchResults)
+	r.sendResolver(result)
 	return result, nil
 }
 
 func (r *searchResolver) Results(ctx context.Context) (*SearchResultsResolver, error) {
+	sel := newResultSelector(r.query, int(r.resultLimit()))
+	ranked := r.pagination == nil && query.Sort(r.query) != query.SortRepo
+	limit := int(r.resultLimit())
+	stream := r.stream
+	if ranked {
+		// Results are ranked among more candidates than the limit, and their
+		// order is only known once all of them are found, so they cannot be
+		// streamed as they are found. The ranked results are sent instead.
+		r.stream = nil
+		r.ranking = r.exhaustiveLimit == 0
+	}
+	var rr *SearchResultsResolver
+	var err error
 	switch q := r.query.(type) {
 	case *query.OrdinaryQuery:
-		return r.evaluateLeaf(ctx)
+		rr, err = r.evaluateLeaf(ctx)
 	case *query.AndOrQuery:
-		return r.evaluate(ctx, q.Query)
+		rr, err = r.evaluate(ctx, q.Query)
+	default:
+		// Unreachable.
+		return nil, fmt.Errorf("unrecognized type %s in searchResolver Results", reflect.TypeOf(r.query).String())
 	}
-	// Unreachable.
-	return nil, fmt.Errorf("unrecognized type %s in searchResolver Results", reflect.TypeOf(r.query).String())
+	if rr != nil {
+		rr.SearchResults = sel.apply(rr.SearchResults)
+		if sel.hitLimit() {
+			rr.limitHit = true
+		}
+	}
+	if ranked {
+		overFetched := r.ranking
+		r.stream, r.ranking = stream, false
+		if rr != nil {
+			rr.SearchResults = r.rankResults(ctx, rr.SearchResults)
+			if overFetched && len(rr.SearchResults) > limit {
+				rr.SearchResults = rr.SearchResults[:limit]
+				rr.limitHit = true
+			}
+			r.sendResolver(rr)
+		}
+	}
+	return rr, err
 }
 
 // resultsWithTimeoutSuggestion calls doResults, and in case of deadline
@@ -1145,8 +1317,10 @@ func processSearchPattern(q query.QueryInfo, opts *getPatternInfoOptions) (strin
 func getPatternInfo(q query.QueryInfo, opts *getPatternInfoOptions) (*search.TextPatternInfo, error) {
 	pattern, isRegExp, isStructuralPat := processSearchPattern(q, opts)
 
-	// Handle file: and -file: filters.
+	// Handle file: and -file: filters. Predicates like file:contains(...)
+	// are handled by searchFilesInRepos.
 	includePatterns, excludePatterns := q.RegexpPatterns(query.FieldFile)
+	includePatterns = query.OmitPredicates(query.FieldFile, includePatterns)
 	filePatternsReposMustInclude, filePatternsReposMustExclude := q.RegexpPatterns(query.FieldRepoHasFile)
 
 	if opts.forceFileSearch {
@@ -1175,6 +1349,7 @@ func getPatternInfo(q query.QueryInfo, opts *getPatternInfoOptions) (*search.Tex
 		IsStructuralPat:              isStructuralPat,
 		IsCaseSensitive:              q.IsCaseSensitive(),
 		FileMatchLimit:               opts.fileMatchLimit,
+		ContextLines:                 int32(query.ContextLines(q)),
 		Pattern:                      pattern,
 		IncludePatterns:              includePatterns,
 		FilePatternsReposMustInclude: filePatternsReposMustInclude,
@@ -1187,9 +1362,81 @@ func getPatternInfo(q query.QueryInfo, opts *getPatternInfoOptions) (*search.Tex
 	if len(excludePatterns) > 0 {
 		patternInfo.ExcludePattern = unionRegExps(excludePatterns)
 	}
+	if expr := patternExpression(q, opts); expr != nil {
+		// Line matches are found with the union of all patterns. A
+		// union is a complete description of an or-expression, so only
+		// expressions containing "and" are passed on to the backends.
+		patternInfo.Pattern = unionRegExps(expr.Patterns())
+		if !isPatternUnion(expr) {
+			patternInfo.PatternExpression = expr
+		}
+	}
 	return patternInfo, nil
 }
 
+// patternExpression returns the search pattern of q as a pattern expression
+// if q is an and/or query whose search pattern contains and- or
+// or-operators. Otherwise it returns nil.
+func patternExpression(q query.QueryInfo, opts *getPatternInfoOptions) *search.PatternNode {
+	if opts.performStructuralSearch || opts.forceFileSearch {
+		return nil
+	}
+	var nodes []query.Node
+	switch q := q.(type) {
+	case query.AndOrQuery:
+		nodes = q.Query
+	case *query.AndOrQuery:
+		nodes = q.Query
+	default:
+		return nil
+	}
+	_, pattern, err := query.PartitionSearchPattern(nodes)
+	if err != nil {
+		return nil
+	}
+	if operator, ok := pattern.(query.Operator); !ok || operator.Kind == query.Concat {
+		return nil
+	}
+	return toPatternNode(pattern, opts)
+}
+
+// toPatternNode converts a pattern expression node to a search.PatternNode.
+// Leaves, and patterns concatenated by whitespace, are converted to regular
+// expressions in the same way as the pattern of an ordinary query.
+func toPatternNode(node query.Node, opts *getPatternInfoOptions) *search.PatternNode {
+	if operator, ok := node.(query.Operator); ok && operator.Kind != query.Concat {
+		n := &search.PatternNode{Op: search.PatternOpOr}
+		switch operator.Kind {
+		case query.And:
+			n.Op = search.PatternOpAnd
+		case query.Not:
+			n.Op = search.PatternOpNot
+		}
+		for _, operand := range operator.Operands {
+			n.Operands = append(n.Operands, toPatternNode(operand, opts))
+		}
+		return n
+	}
+	pattern, _, _ := processSearchPattern(query.AndOrQuery{Query: []query.Node{node}}, opts)
+	return &search.PatternNode{Pattern: pattern}
+}
+
+// isPatternUnion returns true if node only contains or-operators.
+func isPatternUnion(node *search.PatternNode) bool {
+	switch node.Op {
+	case "":
+		return true
+	case search.PatternOpOr:
+		for _, operand := range node.Operands {
+			if !isPatternUnion(operand) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
 // langIncludeExcludePatterns returns regexps for the include/exclude path patterns given the lang:
 // and -lang: filter values in a search query. For example, a query containing "lang:go" should
 // include files whose paths match /\.go$/.
@@ -1229,7 +1476,7 @@ var (
 
 func (r *searchResolver) searchTimeoutFieldSet() bool {
 	timeout, _ := r.query.StringValue(query.FieldTimeout)
-	return timeout != "" || r.countIsSet()
+	return timeout != "" || r.countIsSet() || r.exhaustiveLimit > 0
 }
 
 func (r *searchResolver) withTimeout(ctx context.Context) (context.Context, context.CancelFunc, error) {
@@ -1241,7 +1488,7 @@ func (r *searchResolver) withTimeout(ctx context.Context) (context.Context, cont
 		if err != nil {
 			return nil, nil, errors.WithMessage(err, `invalid "timeout:" value (examples: "timeout:2s", "timeout:200ms")`)
 		}
-	} else if r.countIsSet() {
+	} else if r.countIsSet() || r.exhaustiveLimit > 0 {
 		// If `count:` is set but `timeout:` is not explicitly set, use the max timeout
 		d = maxTimeout
 	}
@@ -1253,17 +1500,29 @@ func (r *searchResolver) withTimeout(ctx context.Context) (context.Context, cont
 	return ctx, cancel, nil
 }
 
+// queryResultTypes returns the types of results that q asks for.
+func queryResultTypes(q query.QueryInfo) []string {
+	if len(q.Values(query.FieldReplace)) > 0 {
+		return []string{"codemod"}
+	}
+	resultTypes, _ := q.StringValues(query.FieldType)
+	if len(resultTypes) == 0 {
+		if path := query.Select(q); path != nil {
+			resultTypes = selectResultTypes(*path)
+		}
+	}
+	if len(resultTypes) == 0 {
+		resultTypes = []string{"file", "path", "repo"}
+	}
+	return resultTypes
+}
+
 func (r *searchResolver) determineResultTypes(args search.TextParameters, forceOnlyResultType string) (resultTypes []string) {
 	// Determine which types of results to return.
 	if forceOnlyResultType != "" {
 		resultTypes = []string{forceOnlyResultType}
-	} else if len(r.query.Values(query.FieldReplace)) > 0 {
-		resultTypes = []string{"codemod"}
 	} else {
-		resultTypes, _ = r.query.StringValues(query.FieldType)
-		if len(resultTypes) == 0 {
-			resultTypes = []string{"file", "path", "repo"}
-		}
+		resultTypes = queryResultTypes(r.query)
 	}
 	for _, resultType := range resultTypes {
 		if resultType == "file" {
@@ -1283,6 +1542,10 @@ func (r *searchResolver) determineRepos(ctx context.Context, tr *trace.Trace, st
 			alert := alertForStalePermissions()
 			return nil, nil, &SearchResultsResolver{alert: alert, start: start}, nil
 		}
+		if err == errRepoHasFileLimitHit {
+			alert := alertForRepoHasFileLimit()
+			return nil, nil, &SearchResultsResolver{alert: alert, start: start}, nil
+		}
 		return nil, nil, nil, err
 	}
 
@@ -1395,6 +1658,14 @@ func (r *searchResolver) doResults(ctx context.Context, forceOnlyResultType stri
 
 	resultTypes := r.determineResultTypes(args, forceOnlyResultType)
 	tr.LazyPrintf("resultTypes: %v", resultTypes)
+	if p.PatternExpression != nil {
+		for _, resultType := range resultTypes {
+			if !patternExpressionResultTypes[resultType] {
+				alert := alertForQuery("", &query.ValidationError{Msg: fmt.Sprintf("and/or expressions are not supported for %s results", resultType)})
+				return &SearchResultsResolver{alert: alert, start: start}, nil
+			}
+		}
+	}
 
 	var (
 		requiredWg sync.WaitGroup
@@ -1462,6 +1733,7 @@ func (r *searchResolver) doResults(ctx context.Context, forceOnlyResultType stri
 					common.update(*repoCommon)
 					commonMu.Unlock()
 				}
+				r.sendResults(repoResults, repoCommon)
 			})
 		case "symbol":
 			wg := waitGroup(len(resultTypes) == 1)
@@ -1494,6 +1766,7 @@ func (r *searchResolver) doResults(ctx context.Context, forceOnlyResultType stri
 					common.update(*symbolsCommon)
 					commonMu.Unlock()
 				}
+				r.sendResults(fileMatchesToSearchResults(symbolFileMatches), symbolsCommon)
 			})
 		case "file", "path":
 			if searchedFileContentsOrPaths {
@@ -1537,6 +1810,7 @@ func (r *searchResolver) doResults(ctx context.Context, forceOnlyResultType stri
 						// merge line match results with an existing symbol result
 						m.JLimitHit = m.JLimitHit || r.JLimitHit
 						m.JLineMatches = r.JLineMatches
+						m.JMultilineMatches = r.JMultilineMatches
 					} else {
 						fileMatches[key] = r
 						resultsMu.Lock()
@@ -1550,6 +1824,7 @@ func (r *searchResolver) doResults(ctx context.Context, forceOnlyResultType stri
 					common.update(*fileCommon)
 					commonMu.Unlock()
 				}
+				r.sendResults(fileMatchesToSearchResults(fileResults), fileCommon)
 			})
 		case "diff":
 			wg := waitGroup(len(resultTypes) == 1)
@@ -1589,6 +1864,7 @@ func (r *searchResolver) doResults(ctx context.Context, forceOnlyResultType stri
 					common.update(*diffCommon)
 					commonMu.Unlock()
 				}
+				r.sendResults(diffResults, diffCommon)
 			})
 		case "commit":
 			wg := waitGroup(len(resultTypes) == 1)
@@ -1629,6 +1905,7 @@ func (r *searchResolver) doResults(ctx context.Context, forceOnlyResultType stri
 					common.update(*commitCommon)
 					commonMu.Unlock()
 				}
+				r.sendResults(commitResults, commitCommon)
 			})
 		case "codemod":
 			wg := waitGroup(true)
@@ -1653,6 +1930,7 @@ func (r *searchResolver) doResults(ctx context.Context, forceOnlyResultType stri
 					common.update(*codemodCommon)
 					commonMu.Unlock()
 				}
+				r.sendResults(codemodResults, codemodCommon)
 			})
 		}
 	}
@@ -616,6 +616,122 @@ func TestSearchResolver_getPatternInfo(t *testing.T) {
 	}
 }
 
+func TestSearchResolver_getPatternInfo_patternExpression(t *testing.T) {
+	tests := []struct {
+		query       string
+		wantPattern string
+		wantExpr    *search.PatternNode
+	}{
+		{
+			query:       "a or b",
+			wantPattern: "a|b",
+		},
+		{
+			query:       "a and b",
+			wantPattern: "a|b",
+			wantExpr: &search.PatternNode{
+				Op:       search.PatternOpAnd,
+				Operands: []*search.PatternNode{{Pattern: "a"}, {Pattern: "b"}},
+			},
+		},
+		{
+			query:       `a b and (c or d) case:yes`,
+			wantPattern: `(a).*?(b)|c|d`,
+			wantExpr: &search.PatternNode{
+				Op: search.PatternOpAnd,
+				Operands: []*search.PatternNode{
+					{Pattern: "(a).*?(b)"},
+					{Op: search.PatternOpOr, Operands: []*search.PatternNode{{Pattern: "c"}, {Pattern: "d"}}},
+				},
+			},
+		},
+		{
+			query:       "a and not (b or c)",
+			wantPattern: "a",
+			wantExpr: &search.PatternNode{
+				Op: search.PatternOpAnd,
+				Operands: []*search.PatternNode{
+					{Pattern: "a"},
+					{Op: search.PatternOpNot, Operands: []*search.PatternNode{
+						{Op: search.PatternOpOr, Operands: []*search.PatternNode{{Pattern: "b"}, {Pattern: "c"}}},
+					}},
+				},
+			},
+		},
+		{
+			query:       "(a and not b) or c",
+			wantPattern: "a|c",
+			wantExpr: &search.PatternNode{
+				Op: search.PatternOpOr,
+				Operands: []*search.PatternNode{
+					{Op: search.PatternOpAnd, Operands: []*search.PatternNode{
+						{Pattern: "a"},
+						{Op: search.PatternOpNot, Operands: []*search.PatternNode{{Pattern: "b"}}},
+					}},
+					{Pattern: "c"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := query.ProcessAndOr(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sr := searchResolver{query: q}
+			p, err := sr.getPatternInfo(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Pattern != tt.wantPattern {
+				t.Errorf("got pattern %q, want %q", p.Pattern, tt.wantPattern)
+			}
+			if !reflect.DeepEqual(p.PatternExpression, tt.wantExpr) {
+				t.Errorf("got expression %v, want %v", p.PatternExpression, tt.wantExpr)
+			}
+		})
+	}
+}
+
+func TestSupportsPatternExpression(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{query: "a and b", want: true},
+		{query: "a and b type:file", want: true},
+		{query: "a and b type:repo", want: true},
+		{query: "a and b type:commit", want: false},
+		{query: "a and b type:file type:symbol", want: false},
+		{query: "a and b select:symbol", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := query.ProcessAndOr(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := supportsPatternExpression(q); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendNode(t *testing.T) {
+	scope := make([]query.Node, 1, 2)
+	scope[0] = query.Parameter{Field: "repo", Value: "foo"}
+	a := appendNode(scope, query.Parameter{Value: "a"})
+	b := appendNode(scope, query.Parameter{Value: "b"})
+	if got := a[1].(query.Parameter).Value; got != "a" {
+		t.Errorf("appending to the same scope overwrote the first pattern with %q", got)
+	}
+	if got := b[1].(query.Parameter).Value; got != "b" {
+		t.Errorf("got pattern %q, want b", got)
+	}
+}
+
 func TestSearchResolver_DynamicFilters(t *testing.T) {
 	repo := &types.Repo{Name: "testRepo"}
 
@@ -1454,6 +1570,61 @@ func Test_SearchResultsResolver_ApproximateResultCount(t *testing.T) {
 	}
 }
 
+func TestDifference(t *testing.T) {
+	fm := func(path string) *FileMatchResolver { return &FileMatchResolver{uri: "git://r#" + path} }
+	left := &SearchResultsResolver{SearchResults: []SearchResultResolver{fm("a"), fm("b"), fm("c")}}
+	right := &SearchResultsResolver{SearchResults: []SearchResultResolver{fm("b"), fm("d")}}
+
+	got := difference(left, right)
+	var uris []string
+	for _, r := range got.SearchResults {
+		fileMatch, _ := r.ToFileMatch()
+		uris = append(uris, fileMatch.uri)
+	}
+	if want := []string{"git://r#a", "git://r#c"}; !reflect.DeepEqual(uris, want) {
+		t.Errorf("got %v, want %v", uris, want)
+	}
+	if got.searchResultsCommon.resultCount != 2 {
+		t.Errorf("got result count %d, want 2", got.searchResultsCommon.resultCount)
+	}
+}
+
+func TestSupportsNegation(t *testing.T) {
+	for input, want := range map[string]bool{
+		"a":                        true,
+		"a and not b":              true,
+		"a b not c":                true,
+		"a and not (b and not c)":  true,
+		"a or b and not c":         true,
+		"a or not b":               false,
+		"a and not (b or not c)":   false,
+		"(a and not b) or (not c)": false,
+	} {
+		// Queries which do not support negation are rejected by validation,
+		// so they are only parsed.
+		q, err := query.ParseAndOr(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, pattern, err := query.PartitionSearchPattern(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := supportsNegation(pattern); got != want {
+			t.Errorf("%s: got %v, want %v", input, got, want)
+		}
+	}
+
+	q, _ := query.ParseAndOr("a or not b")
+	got, err := (&searchResolver{patternType: query.SearchTypeStructural}).evaluate(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.alert == nil || got.alert.description != capFirst(errNegatedOperands.Error()) {
+		t.Fatalf("got alert %+v, want alert for negated operands", got.alert)
+	}
+}
+
 func TestSearchResolver_evaluateWarning(t *testing.T) {
 	q, _ := query.ProcessAndOr("file:foo or file:bar")
 	wantPrefix := "I'm having trouble understsanding that query."
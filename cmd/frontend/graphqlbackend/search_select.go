@@ -0,0 +1,169 @@
+package graphqlbackend
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/sourcegraph/sourcegraph/internal/search/query"
+)
+
+// resultSelector projects search results onto the result type of a select:
+// query, e.g. file matches onto the repositories containing them for
+// select:repo. Results that cannot be projected are dropped, and so are
+// results which project onto a value that was already returned. Once limit
+// distinct values have been returned, further values are dropped and the
+// selector reports that its limit was hit.
+//
+// A nil *resultSelector returns results unchanged. It is safe for concurrent
+// use, since streamed results are sent from several goroutines.
+type resultSelector struct {
+	path  query.SelectPath
+	limit int // 0 means no limit
+
+	mu       sync.Mutex
+	seen     map[string]struct{}
+	limitHit bool
+}
+
+// newResultSelector returns a resultSelector for the select: value of q, or
+// nil if q has none. A positive limit caps the number of values it returns.
+func newResultSelector(q query.QueryInfo, limit int) *resultSelector {
+	path := query.Select(q)
+	if path == nil {
+		return nil
+	}
+	return &resultSelector{path: *path, limit: limit, seen: map[string]struct{}{}}
+}
+
+// hitLimit reports whether values were dropped because the limit of s was
+// reached.
+func (s *resultSelector) hitLimit() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limitHit
+}
+
+// apply returns the projection of results that have not been returned by a
+// previous call.
+func (s *resultSelector) apply(results []SearchResultResolver) []SearchResultResolver {
+	if s == nil {
+		return results
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	selected := make([]SearchResultResolver, 0, len(results))
+	for _, result := range results {
+		key, projected := s.project(result)
+		if projected == nil {
+			continue
+		}
+		if _, ok := s.seen[key]; ok {
+			continue
+		}
+		if s.limit > 0 && len(s.seen) >= s.limit {
+			s.limitHit = true
+			continue
+		}
+		s.seen[key] = struct{}{}
+		selected = append(selected, projected)
+	}
+	return selected
+}
+
+// project returns the projection of result and a key which identifies it, or
+// a nil result if result cannot be projected.
+func (s *resultSelector) project(result SearchResultResolver) (string, SearchResultResolver) {
+	switch s.path.Type {
+	case query.SelectRepo:
+		var repo *RepositoryResolver
+		if r, ok := result.ToRepository(); ok {
+			repo = r
+		} else if fm, ok := result.ToFileMatch(); ok {
+			repo = fm.Repository()
+		} else if c, ok := result.ToCommitSearchResult(); ok {
+			repo = c.commit.Repository()
+		}
+		if repo == nil {
+			return "", nil
+		}
+		return repo.Name(), repo
+
+	case query.SelectFile:
+		fm, ok := result.ToFileMatch()
+		if !ok {
+			return "", nil
+		}
+		return fm.uri, &FileMatchResolver{
+			JPath:    fm.JPath,
+			uri:      fm.uri,
+			Repo:     fm.Repo,
+			CommitID: fm.CommitID,
+			InputRev: fm.InputRev,
+		}
+
+	case query.SelectSymbol:
+		fm, ok := result.ToFileMatch()
+		if !ok {
+			return "", nil
+		}
+		var symbols []*searchSymbolResult
+		for _, sym := range fm.symbols {
+			if s.path.Field == "" || strings.EqualFold(symbolLSPKind(sym.symbol).String(), s.path.Field) {
+				symbols = append(symbols, sym)
+			}
+		}
+		if len(symbols) == 0 {
+			return "", nil
+		}
+		return fm.uri, &FileMatchResolver{
+			JPath:    fm.JPath,
+			symbols:  symbols,
+			uri:      fm.uri,
+			Repo:     fm.Repo,
+			CommitID: fm.CommitID,
+			InputRev: fm.InputRev,
+		}
+
+	case query.SelectCommit:
+		c, ok := result.ToCommitSearchResult()
+		if !ok {
+			return "", nil
+		}
+		if s.path.Field == "author" {
+			// One commit per author. Commit search results are always
+			// created with their author already resolved.
+			if person := c.commit.author.person; person != nil {
+				return strings.ToLower(person.email), c
+			}
+			return "", nil
+		}
+		return c.commit.Repository().Name() + "@" + string(c.commit.OID()), c
+	}
+	return "", nil
+}
+
+// selectsFewerResults reports whether several search results can project onto
+// the same value of path, so that more results than the limit of the query
+// must be searched for to find limit values.
+func selectsFewerResults(path query.SelectPath) bool {
+	return path.Type == query.SelectRepo || path.Type == query.SelectFile
+}
+
+// selectResultTypes returns the result types to search for a select: query
+// without a type: field. Only types which can be projected onto the selected
+// type are searched.
+func selectResultTypes(path query.SelectPath) []string {
+	switch path.Type {
+	case query.SelectFile:
+		return []string{"file", "path"}
+	case query.SelectSymbol:
+		return []string{"symbol"}
+	case query.SelectCommit:
+		return []string{"commit"}
+	}
+	return nil
+}
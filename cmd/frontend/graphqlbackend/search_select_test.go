@@ -0,0 +1,161 @@
+package graphqlbackend
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+	"github.com/sourcegraph/sourcegraph/internal/search"
+	"github.com/sourcegraph/sourcegraph/internal/search/query"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+)
+
+func TestResultSelector(t *testing.T) {
+	repoA := &types.Repo{ID: 1, Name: "a"}
+	repoB := &types.Repo{ID: 2, Name: "b"}
+	results := []SearchResultResolver{
+		&FileMatchResolver{uri: "git://a#x", JPath: "x", Repo: repoA, JLineMatches: []*lineMatch{{JLineNumber: 1}}, MatchCount: 1},
+		&FileMatchResolver{uri: "git://a#y", JPath: "y", Repo: repoA, symbols: []*searchSymbolResult{
+			{symbol: protocol.Symbol{Name: "f", Kind: "function"}},
+			{symbol: protocol.Symbol{Name: "T", Kind: "type"}},
+		}},
+		&FileMatchResolver{uri: "git://b#x", JPath: "x", Repo: repoB, JLineMatches: []*lineMatch{{JLineNumber: 2}}, MatchCount: 1},
+		&RepositoryResolver{repo: repoB},
+	}
+
+	describe := func(results []SearchResultResolver) []string {
+		var got []string
+		for _, r := range results {
+			switch v := r.(type) {
+			case *RepositoryResolver:
+				got = append(got, "repo:"+v.Name())
+			case *FileMatchResolver:
+				s := "file:" + v.uri
+				for _, sym := range v.symbols {
+					s += " " + sym.symbol.Name
+				}
+				if len(v.JLineMatches) > 0 {
+					s += " +lines"
+				}
+				got = append(got, s)
+			}
+		}
+		return got
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{
+			query: "select:repo",
+			want:  []string{"repo:a", "repo:b"},
+		},
+		{
+			query: "select:file",
+			want:  []string{"file:git://a#x", "file:git://a#y", "file:git://b#x"},
+		},
+		{
+			query: "select:symbol",
+			want:  []string{"file:git://a#y f T"},
+		},
+		{
+			query: "select:symbol.function",
+			want:  []string{"file:git://a#y f"},
+		},
+		{
+			query: "select:commit",
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := query.ParseAndCheck(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sel := newResultSelector(q, 0)
+			got := describe(sel.apply(results))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			// Results that were already selected are not selected again.
+			if again := sel.apply(results); len(again) != 0 {
+				t.Errorf("got %v on second apply, want none", describe(again))
+			}
+		})
+	}
+
+	q, err := query.ParseAndCheck("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel := newResultSelector(q, 0); sel != nil {
+		t.Fatalf("got selector %+v for query without select:", sel)
+	}
+}
+
+func TestResultSelector_limit(t *testing.T) {
+	repoA := &types.Repo{ID: 1, Name: "a"}
+	repoB := &types.Repo{ID: 2, Name: "b"}
+	q, err := query.ParseAndCheck("select:repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel := newResultSelector(q, 1)
+	got := sel.apply([]SearchResultResolver{
+		&FileMatchResolver{uri: "git://a#x", JPath: "x", Repo: repoA},
+		&FileMatchResolver{uri: "git://a#y", JPath: "y", Repo: repoA},
+	})
+	if len(got) != 1 || sel.hitLimit() {
+		t.Fatalf("got %d results and limit hit %v, want 1 result within the limit", len(got), sel.hitLimit())
+	}
+	got = sel.apply([]SearchResultResolver{&FileMatchResolver{uri: "git://b#x", JPath: "x", Repo: repoB}})
+	if len(got) != 0 || !sel.hitLimit() {
+		t.Fatalf("got %d results and limit hit %v, want none beyond the limit", len(got), sel.hitLimit())
+	}
+}
+
+func TestMaxResults_select(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		want  int32
+	}{
+		{query: "foo select:repo", want: defaultMaxSearchResults * selectCandidatesFactor},
+		{query: "foo select:file count:100", want: 100 * selectCandidatesFactor},
+		{query: "foo select:repo count:1000", want: maxSelectCandidates},
+		{query: "foo select:symbol", want: defaultMaxSearchResults},
+	} {
+		q, err := query.ParseAndCheck(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &searchResolver{query: q}
+		if got := r.maxResults(); got != test.want {
+			t.Errorf("%s: got %d, want %d", test.query, got, test.want)
+		}
+	}
+}
+
+func TestSearchResolver_determineResultTypes_select(t *testing.T) {
+	tests := map[string][]string{
+		"foo select:repo":             {"file", "path", "repo"},
+		"foo select:file":             {"file", "path"},
+		"foo select:symbol.struct":    {"symbol"},
+		"foo select:commit.author":    {"commit"},
+		"foo select:repo type:commit": {"commit"},
+	}
+	for queryStr, want := range tests {
+		t.Run(queryStr, func(t *testing.T) {
+			q, err := query.ParseAndCheck(queryStr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := &searchResolver{query: q}
+			got := r.determineResultTypes(search.TextParameters{PatternInfo: &search.TextPatternInfo{}}, "")
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
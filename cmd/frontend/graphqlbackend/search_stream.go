@@ -0,0 +1,49 @@
+package graphqlbackend
+
+// SearchEvent is an incremental update to the results of a streaming search.
+// Results contains only the results found since the previous event, and the
+// embedded searchResultsCommon describes the repositories that were searched
+// (or could not be searched) to produce them.
+//
+// A file may be sent more than once when several backends (e.g. text and
+// symbol search) match it.
+type SearchEvent struct {
+	Results []SearchResultResolver
+	*searchResultsCommon
+}
+
+// sendResults sends results and common to the stream of r, if one is set.
+//
+// All events are sent before Results returns, so the receiver must keep
+// reading from the stream until then.
+func (r *searchResolver) sendResults(results []SearchResultResolver, common *searchResultsCommon) {
+	if r.stream == nil {
+		return
+	}
+	if common == nil {
+		common = &searchResultsCommon{}
+	}
+	results = r.streamSelect.apply(results)
+	r.stream <- SearchEvent{Results: results, searchResultsCommon: common}
+}
+
+// sendResolver sends all of the results in rr to the stream of r, if one is
+// set. It is used for search paths that can only produce a complete result
+// set, such as and/or queries and paginated search.
+func (r *searchResolver) sendResolver(rr *SearchResultsResolver) {
+	if rr == nil {
+		return
+	}
+	r.sendResults(rr.SearchResults, &rr.searchResultsCommon)
+}
+
+func fileMatchesToSearchResults(fms []*FileMatchResolver) []SearchResultResolver {
+	if len(fms) == 0 {
+		return nil
+	}
+	results := make([]SearchResultResolver, len(fms))
+	for i, fm := range fms {
+		results[i] = fm
+	}
+	return results
+}
@@ -0,0 +1,82 @@
+package graphqlbackend
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/db"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+	"github.com/sourcegraph/sourcegraph/internal/search"
+	"github.com/sourcegraph/sourcegraph/schema"
+)
+
+func TestSearchResults_Stream(t *testing.T) {
+	mockDecodedViewerFinalSettings = &schema.Settings{}
+	defer func() { mockDecodedViewerFinalSettings = nil }()
+
+	db.Mocks.Repos.List = func(_ context.Context, op db.ReposListOptions) ([]*types.Repo, error) {
+		return []*types.Repo{{ID: 1, Name: "repo"}}, nil
+	}
+	defer func() { db.Mocks = db.MockStores{} }()
+
+	mockSearchRepositories = func(args *search.TextParameters) ([]SearchResultResolver, *searchResultsCommon, error) {
+		return nil, &searchResultsCommon{repos: []*types.Repo{{ID: 1, Name: "repo"}}}, nil
+	}
+	defer func() { mockSearchRepositories = nil }()
+
+	mockSearchFilesInRepos = func(args *search.TextParameters) ([]*FileMatchResolver, *searchResultsCommon, error) {
+		repo := &types.Repo{ID: 1, Name: "repo"}
+		return []*FileMatchResolver{
+			{uri: "git://repo#a", JPath: "a", JLineMatches: []*lineMatch{{JLineNumber: 1}}, Repo: repo},
+			{uri: "git://repo#b", JPath: "b", JLineMatches: []*lineMatch{{JLineNumber: 2}}, Repo: repo},
+		}, &searchResultsCommon{repos: []*types.Repo{repo}, searched: []*types.Repo{repo}}, nil
+	}
+	defer func() { mockSearchFilesInRepos = nil }()
+
+	events := make(chan SearchEvent)
+	r, err := (&schemaResolver{}).Search(&SearchArgs{Query: "foo", Version: "V2", Stream: events})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan *SearchResultsResolver)
+	go func() {
+		results, err := r.Results(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		done <- results
+	}()
+
+	var streamed []string
+	var searched int
+	var results *SearchResultsResolver
+	for results == nil {
+		select {
+		case event := <-events:
+			for _, result := range event.Results {
+				if fm, ok := result.ToFileMatch(); ok {
+					streamed = append(streamed, fm.JPath)
+				}
+			}
+			searched += len(event.RepositoriesSearched())
+		case results = <-done:
+		}
+	}
+
+	var want []string
+	for _, result := range results.SearchResults {
+		if fm, ok := result.ToFileMatch(); ok {
+			want = append(want, fm.JPath)
+		}
+	}
+	sort.Strings(streamed)
+	if !reflect.DeepEqual(streamed, want) {
+		t.Errorf("got streamed results %v, want %v", streamed, want)
+	}
+	if searched != 1 {
+		t.Errorf("got %d searched repos, want 1", searched)
+	}
+}
@@ -98,12 +98,12 @@ func HandleFilePathPatterns(query *search.TextPatternInfo) (zoektquery.Q, error)
 	return zoektquery.NewAnd(and...), nil
 }
 
-func buildQuery(args *search.TextParameters, newRepoSet *zoektquery.RepoSet, filePathPatterns zoektquery.Q, shortcircuit bool) (zoektquery.Q, error) {
+func buildQuery(args *search.TextParameters, repos zoektquery.Q, filePathPatterns zoektquery.Q, shortcircuit bool) (zoektquery.Q, error) {
 	q, err := StructuralPatToRegexpQuery(args.PatternInfo.Pattern, shortcircuit)
 	if err != nil {
 		return nil, err
 	}
-	q = zoektquery.NewAnd(newRepoSet, filePathPatterns, q)
+	q = zoektquery.NewAnd(repos, filePathPatterns, q)
 	q = zoektquery.Simplify(q)
 	return q, nil
 }
@@ -162,9 +162,10 @@ func zoektSearchHEADOnlyFiles(ctx context.Context, args *search.TextParameters,
 	if err != nil {
 		return nil, false, nil, err
 	}
+	repoBranches := zoektRepoBranchesQuery(newRepoSet, repoMap)
 
 	t0 := time.Now()
-	q, err := buildQuery(args, newRepoSet, filePathPatterns, true)
+	q, err := buildQuery(args, repoBranches, filePathPatterns, true)
 	if err != nil {
 		return nil, false, nil, err
 	}
@@ -181,7 +182,7 @@ func zoektSearchHEADOnlyFiles(ctx context.Context, args *search.TextParameters,
 	// If the previous indexed search did not return a substantial number of matching file candidates or count was
 	// manually specified, run a more complete and expensive search.
 	if resp.FileCount < 10 || args.PatternInfo.FileMatchLimit != defaultMaxSearchResults {
-		q, err = buildQuery(args, newRepoSet, filePathPatterns, false)
+		q, err = buildQuery(args, repoBranches, filePathPatterns, false)
 		resp, err = args.Zoekt.Client.Search(ctx, q, &searchOpts)
 		if err != nil {
 			return nil, false, nil, err
@@ -224,22 +225,30 @@ func zoektSearchHEADOnlyFiles(ctx context.Context, args *search.TextParameters,
 	}
 
 	maxLineMatches := 25 + k
-	matches := make([]*FileMatchResolver, len(resp.Files))
-	for i, file := range resp.Files {
+	matches := make([]*FileMatchResolver, 0, len(resp.Files))
+	for _, file := range resp.Files {
+		repoRev := repoMap[api.RepoName(strings.ToLower(string(file.Repository)))]
+		_, branch, ok := zoektFileMatchRevision(repoRev, &file)
+		if !ok {
+			continue
+		}
+		uriRev := ""
+		if branch.Name != "HEAD" {
+			uriRev = branch.Name
+		}
 		fileLimitHit := false
 		if len(file.LineMatches) > maxLineMatches {
 			file.LineMatches = file.LineMatches[:maxLineMatches]
 			fileLimitHit = true
 			limitHit = true
 		}
-		repoRev := repoMap[api.RepoName(strings.ToLower(string(file.Repository)))]
-		matches[i] = &FileMatchResolver{
+		matches = append(matches, &FileMatchResolver{
 			JPath:     file.FileName,
 			JLimitHit: fileLimitHit,
-			uri:       fileMatchURI(repoRev.Repo.Name, "", file.FileName),
+			uri:       fileMatchURI(repoRev.Repo.Name, uriRev, file.FileName),
 			Repo:      repoRev.Repo,
-			CommitID:  repoRev.IndexedHEADCommit(),
-		}
+			CommitID:  branch.Commit,
+		})
 	}
 
 	return matches, limitHit, reposLimitHit, nil
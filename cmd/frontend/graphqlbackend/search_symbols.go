@@ -64,6 +64,11 @@ func searchSymbols(ctx context.Context, args *search.TextParameters, limit int)
 		return nil, nil, nil
 	}
 
+	filters, err := parseSymbolFilters(args.Query)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	ctx, cancelAll := context.WithCancel(ctx)
 	defer cancelAll()
 
@@ -160,7 +165,19 @@ func searchSymbols(ctx context.Context, args *search.TextParameters, limit int)
 	run.Acquire()
 	goroutine.Go(func() {
 		defer run.Release()
-		matches, limitHit, reposLimitHit, searchErr := zoektSearchHEAD(ctx, args, zoektRepos, true, time.Since)
+		// Indexed search does not support the symbol filters, so they are
+		// applied to its results. More files are requested than the limit,
+		// which is applied to the filtered files.
+		zoektArgs := args
+		if filters != nil {
+			patternInfo := *args.PatternInfo
+			patternInfo.FileMatchLimit = filteredSymbolsFileMatchLimit(patternInfo.FileMatchLimit)
+			argsCopy := *args
+			argsCopy.PatternInfo = &patternInfo
+			zoektArgs = &argsCopy
+		}
+		matches, limitHit, reposLimitHit, searchErr := zoektSearchHEAD(ctx, zoektArgs, zoektRepos, true, time.Since)
+		matches = filters.filterFileMatches(matches, args.PatternInfo.IsCaseSensitive)
 		mu.Lock()
 		defer mu.Unlock()
 		if ctx.Err() == nil {
@@ -183,6 +200,42 @@ func searchSymbols(ctx context.Context, args *search.TextParameters, limit int)
 		addMatches(matches)
 	})
 
+	addRepoResult := func(repoRevs *search.RepositoryRevisions, repoSymbols []*FileMatchResolver, repoErr error) {
+		if repoErr != nil {
+			tr.LogFields(otlog.String("repo", string(repoRevs.Repo.Name)), otlog.String("repoErr", repoErr.Error()), otlog.Bool("timeout", errcode.IsTimeout(repoErr)), otlog.Bool("temporary", errcode.IsTemporary(repoErr)))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		limitHit := symbolCount(res) > limit
+		repoErr = handleRepoSearchResult(common, repoRevs, limitHit, false, repoErr)
+		if repoErr != nil {
+			if ctx.Err() == nil || errors.Cause(repoErr) != ctx.Err() {
+				// Only record error if it's not directly caused by a context error.
+				run.Error(repoErr)
+			}
+		} else {
+			common.searched = append(common.searched, repoRevs.Repo)
+		}
+		if repoSymbols != nil {
+			addMatches(repoSymbols)
+		}
+	}
+
+	if conf.SymbolsAggregatedIndexEnabled() && len(searcherRepos) > 0 {
+		missing, aggregatedErr := searchSymbolsAggregated(ctx, searcherRepos, args.PatternInfo, filters, limit, addRepoResult)
+		if aggregatedErr != nil {
+			// Fall back to searching each repository, e.g. if the symbols
+			// service does not support aggregated searches yet.
+			tr.LogFields(otlog.String("aggregatedErr", aggregatedErr.Error()))
+			if ctx.Err() == nil {
+				log15.Warn("Aggregated symbol search failed, searching repositories one at a time.", "error", aggregatedErr)
+			}
+		} else {
+			tr.LogFields(otlog.Int("aggregated-repos", len(searcherRepos)-len(missing)))
+			searcherRepos = missing
+		}
+	}
+
 	for _, repoRevs := range searcherRepos {
 		repoRevs := repoRevs
 		if ctx.Err() != nil {
@@ -194,25 +247,8 @@ func searchSymbols(ctx context.Context, args *search.TextParameters, limit int)
 		run.Acquire()
 		goroutine.Go(func() {
 			defer run.Release()
-			repoSymbols, repoErr := searchSymbolsInRepo(ctx, repoRevs, args.PatternInfo, args.Query, limit)
-			if repoErr != nil {
-				tr.LogFields(otlog.String("repo", string(repoRevs.Repo.Name)), otlog.String("repoErr", repoErr.Error()), otlog.Bool("timeout", errcode.IsTimeout(repoErr)), otlog.Bool("temporary", errcode.IsTemporary(repoErr)))
-			}
-			mu.Lock()
-			defer mu.Unlock()
-			limitHit := symbolCount(res) > limit
-			repoErr = handleRepoSearchResult(common, repoRevs, limitHit, false, repoErr)
-			if repoErr != nil {
-				if ctx.Err() == nil || errors.Cause(repoErr) != ctx.Err() {
-					// Only record error if it's not directly caused by a context error.
-					run.Error(repoErr)
-				}
-			} else {
-				common.searched = append(common.searched, repoRevs.Repo)
-			}
-			if repoSymbols != nil {
-				addMatches(repoSymbols)
-			}
+			repoSymbols, repoErr := searchSymbolsInRepo(ctx, repoRevs, args.PatternInfo, filters, limit)
+			addRepoResult(repoRevs, repoSymbols, repoErr)
 		})
 	}
 	err = run.Wait()
@@ -251,7 +287,7 @@ func symbolCount(fmrs []*FileMatchResolver) int {
 	return nsym
 }
 
-func searchSymbolsInRepo(ctx context.Context, repoRevs *search.RepositoryRevisions, patternInfo *search.TextPatternInfo, query query.QueryInfo, limit int) (res []*FileMatchResolver, err error) {
+func searchSymbolsInRepo(ctx context.Context, repoRevs *search.RepositoryRevisions, patternInfo *search.TextPatternInfo, filters *symbolFilters, limit int) (res []*FileMatchResolver, err error) {
 	span, ctx := ot.StartSpanFromContext(ctx, "Search symbols in repo")
 	defer func() {
 		if err != nil {
@@ -278,8 +314,106 @@ func searchSymbolsInRepo(ctx context.Context, repoRevs *search.RepositoryRevisio
 		return nil, err
 	}
 
-	symbols, err := backend.Symbols.ListTags(ctx, search.SymbolsParameters{
-		Repo:            repoRevs.Repo.Name,
+	symbols, err := backend.Symbols.ListTags(ctx, symbolsParameters(repoRevs.Repo.Name, commitID, patternInfo, filters, limit))
+	return symbolsToFileMatches(repoRevs.Repo, commitID, inputRev, baseURI, symbols), err
+}
+
+// searchSymbolsAggregated searches the symbols of repos in the aggregated
+// index of the symbols service, and calls onResult with the matches or the
+// error of each repository that was searched. It returns the repositories
+// that are not in the aggregated index yet, which must be searched with
+// searchSymbolsInRepo. If it returns an error, onResult has not been called.
+func searchSymbolsAggregated(ctx context.Context, repos []*search.RepositoryRevisions, patternInfo *search.TextPatternInfo, filters *symbolFilters, limit int, onResult func(*search.RepositoryRevisions, []*FileMatchResolver, error)) (missing []*search.RepositoryRevisions, err error) {
+	span, ctx := ot.StartSpanFromContext(ctx, "Search symbols in aggregated index")
+	defer func() {
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(otlog.Error(err))
+		}
+		span.Finish()
+	}()
+	span.SetTag("repos", len(repos))
+
+	// Resolve the revision of each repository, like searchSymbolsInRepo.
+	type resolvedRepo struct {
+		repoRevs *search.RepositoryRevisions
+		inputRev string
+		commitID api.CommitID
+		err      error
+	}
+	resolved := make([]*resolvedRepo, 0, len(repos))
+	run := parallel.NewRun(conf.SearchSymbolsParallelism())
+	for _, repoRevs := range repos {
+		if len(repoRevs.RevSpecs()) == 0 {
+			continue
+		}
+		r := &resolvedRepo{repoRevs: repoRevs, inputRev: repoRevs.RevSpecs()[0]}
+		resolved = append(resolved, r)
+		run.Acquire()
+		goroutine.Go(func() {
+			defer run.Release()
+			r.commitID, r.err = git.ResolveRevision(ctx, r.repoRevs.GitserverRepo(), nil, r.inputRev, nil)
+		})
+	}
+	_ = run.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	var repoCommits []protocol.RepoCommit
+	byRepoCommit := make(map[protocol.RepoCommit]*resolvedRepo, len(resolved))
+	for _, r := range resolved {
+		if r.err == nil {
+			repoCommit := protocol.RepoCommit{Repo: r.repoRevs.Repo.Name, CommitID: r.commitID}
+			repoCommits = append(repoCommits, repoCommit)
+			byRepoCommit[repoCommit] = r
+		}
+	}
+
+	result := &protocol.AggregatedSearchResult{}
+	if len(repoCommits) > 0 {
+		result, err = backend.Symbols.SearchAggregated(ctx, repoCommits, symbolsParameters("", "", patternInfo, filters, limit))
+		if err != nil {
+			return nil, err
+		}
+	}
+	span.SetTag("missing", len(result.Missing))
+
+	isMissing := make(map[protocol.RepoCommit]bool, len(result.Missing))
+	for _, repoCommit := range result.Missing {
+		if r, ok := byRepoCommit[repoCommit]; ok && !isMissing[repoCommit] {
+			isMissing[repoCommit] = true
+			missing = append(missing, r.repoRevs)
+		}
+	}
+	symbolsByRepoCommit := make(map[protocol.RepoCommit][]protocol.Symbol, len(result.Symbols))
+	for _, repoSymbols := range result.Symbols {
+		symbolsByRepoCommit[repoSymbols.RepoCommit] = repoSymbols.Symbols
+	}
+
+	for _, r := range resolved {
+		if r.err != nil {
+			onResult(r.repoRevs, nil, r.err)
+			continue
+		}
+		repoCommit := protocol.RepoCommit{Repo: r.repoRevs.Repo.Name, CommitID: r.commitID}
+		if isMissing[repoCommit] {
+			continue
+		}
+		baseURI, err := gituri.Parse("git://" + string(r.repoRevs.Repo.Name) + "?" + url.QueryEscape(r.inputRev))
+		if err != nil {
+			onResult(r.repoRevs, nil, err)
+			continue
+		}
+		onResult(r.repoRevs, symbolsToFileMatches(r.repoRevs.Repo, r.commitID, r.inputRev, baseURI, symbolsByRepoCommit[repoCommit]), nil)
+	}
+	return missing, nil
+}
+
+// symbolsParameters returns the parameters of a symbol search of repo@commitID.
+func symbolsParameters(repo api.RepoName, commitID api.CommitID, patternInfo *search.TextPatternInfo, filters *symbolFilters, limit int) search.SymbolsParameters {
+	params := search.SymbolsParameters{
+		Repo:            repo,
 		CommitID:        commitID,
 		Query:           patternInfo.Pattern,
 		IsCaseSensitive: patternInfo.IsCaseSensitive,
@@ -288,12 +422,165 @@ func searchSymbolsInRepo(ctx context.Context, repoRevs *search.RepositoryRevisio
 		ExcludePattern:  patternInfo.ExcludePattern,
 		// Ask for limit + 1 so we can detect whether there are more results than the limit.
 		First: limit + 1,
-	})
+	}
+	if filters != nil {
+		for _, kind := range filters.kinds {
+			params.Kinds = append(params.Kinds, lspSymbolKindToCtagsKinds(kind)...)
+		}
+		for _, kind := range filters.excludeKinds {
+			params.ExcludeKinds = append(params.ExcludeKinds, lspSymbolKindToCtagsKinds(kind)...)
+		}
+		params.Parent = filters.parent
+		params.Exported = filters.exported
+	}
+	return params
+}
+
+// filteredSymbolsOverFetchFactor is how many times the file match limit of a
+// symbol search with filters is requested from indexed search, up to
+// maxFilteredSymbolsFileMatches files.
+const filteredSymbolsOverFetchFactor = 10
+const maxFilteredSymbolsFileMatches = 5000
+
+// filteredSymbolsFileMatchLimit returns the number of files requested from
+// indexed search for a symbol search with filters whose file match limit is
+// limit. Indexed search does not apply the filters, so many of its files may
+// have no matching symbols.
+func filteredSymbolsFileMatchLimit(limit int32) int32 {
+	if limit >= maxFilteredSymbolsFileMatches/filteredSymbolsOverFetchFactor {
+		if limit > maxFilteredSymbolsFileMatches {
+			return limit
+		}
+		return maxFilteredSymbolsFileMatches
+	}
+	return limit * filteredSymbolsOverFetchFactor
+}
+
+// symbolFilters are the symbolkind:, symbolparent: and exported: fields of a
+// symbol search. The symbols service applies them to the symbols it returns,
+// and filterFileMatches to the symbols returned by indexed search.
+type symbolFilters struct {
+	kinds        []lsp.SymbolKind
+	excludeKinds []lsp.SymbolKind
+	parent       string
+	exported     *bool
+}
+
+// parseSymbolFilters returns the symbol filters of q, or nil if q has none.
+func parseSymbolFilters(q query.QueryInfo) (*symbolFilters, error) {
+	var (
+		filters symbolFilters
+		err     error
+	)
+	kinds, excludeKinds := q.StringValues(query.FieldSymbolKind)
+	if filters.kinds, err = parseLSPSymbolKinds(kinds); err != nil {
+		return nil, err
+	}
+	if filters.excludeKinds, err = parseLSPSymbolKinds(excludeKinds); err != nil {
+		return nil, err
+	}
+	filters.parent, _ = q.StringValue(query.FieldSymbolParent)
+	if exported, _ := q.StringValue(query.FieldExported); exported != "" {
+		var b bool
+		switch parseYesNoOnly(exported) {
+		case Yes, True:
+			b = true
+		case No, False:
+			b = false
+		default:
+			return nil, fmt.Errorf("invalid exported:%q (valid values are: yes, no)", exported)
+		}
+		filters.exported = &b
+	}
+
+	if len(filters.kinds) == 0 && len(filters.excludeKinds) == 0 && filters.parent == "" && filters.exported == nil {
+		return nil, nil
+	}
+	return &filters, nil
+}
+
+// parseLSPSymbolKinds returns the LSP symbol kinds with the given names, such
+// as "function" or "class".
+func parseLSPSymbolKinds(names []string) ([]lsp.SymbolKind, error) {
+	var kinds []lsp.SymbolKind
+	for _, name := range names {
+		kind := lsp.SymbolKind(0)
+		for k := lsp.SKFile; k <= lsp.SKTypeParameter; k++ {
+			if strings.EqualFold(k.String(), name) {
+				kind = k
+				break
+			}
+		}
+		if kind == 0 {
+			return nil, fmt.Errorf("invalid symbolkind:%q (expected a symbol kind such as function or class)", name)
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+// match reports whether the symbol satisfies the filters.
+func (f *symbolFilters) match(symbol protocol.Symbol, isCaseSensitive bool) bool {
+	kind := symbolLSPKind(symbol)
+	containsKind := func(kinds []lsp.SymbolKind) bool {
+		for _, k := range kinds {
+			if k == kind {
+				return true
+			}
+		}
+		return false
+	}
+	if len(f.kinds) > 0 && !containsKind(f.kinds) {
+		return false
+	}
+	if containsKind(f.excludeKinds) {
+		return false
+	}
+	if f.parent != "" {
+		if isCaseSensitive && symbol.Parent != f.parent {
+			return false
+		}
+		if !strings.EqualFold(symbol.Parent, f.parent) {
+			return false
+		}
+	}
+	if f.exported != nil && symbol.Exported() != *f.exported {
+		return false
+	}
+	return true
+}
+
+// filterFileMatches removes the symbols that do not satisfy the filters from
+// matches, and the matches without symbols. The matches are requested with
+// filteredSymbolsFileMatchLimit, so that there are usually enough matching
+// symbols left for the limit of the search.
+func (f *symbolFilters) filterFileMatches(matches []*FileMatchResolver, isCaseSensitive bool) []*FileMatchResolver {
+	if f == nil {
+		return matches
+	}
+	filtered := matches[:0]
+	for _, fm := range matches {
+		symbols := fm.symbols[:0]
+		for _, sym := range fm.symbols {
+			if f.match(sym.symbol, isCaseSensitive) {
+				symbols = append(symbols, sym)
+			}
+		}
+		if len(symbols) > 0 {
+			fm.symbols = symbols
+			filtered = append(filtered, fm)
+		}
+	}
+	return filtered
+}
+
+// symbolsToFileMatches groups the symbols of repo@commitID by file.
+func symbolsToFileMatches(repo *types.Repo, commitID api.CommitID, inputRev string, baseURI *gituri.URI, symbols []protocol.Symbol) []*FileMatchResolver {
 	fileMatchesByURI := make(map[string]*FileMatchResolver)
 	fileMatches := make([]*FileMatchResolver, 0)
 	for _, symbol := range symbols {
 		commit := &GitCommitResolver{
-			repo:     &RepositoryResolver{repo: repoRevs.Repo},
+			repo:     &RepositoryResolver{repo: repo},
 			oid:      GitObjectID(commitID),
 			inputRev: &inputRev,
 			// NOTE: Not all fields are set, for performance.
@@ -321,7 +608,7 @@ func searchSymbolsInRepo(ctx context.Context, repoRevs *search.RepositoryRevisio
 			fileMatches = append(fileMatches, fileMatch)
 		}
 	}
-	return fileMatches, err
+	return fileMatches
 }
 
 // makeFileMatchURIFromSymbol makes a git://repo?rev#path URI from a symbol
@@ -357,62 +644,130 @@ func ctagsSymbolCharacter(s protocol.Symbol) int {
 	return 0
 }
 
-func ctagsKindToLSPSymbolKind(kind string) lsp.SymbolKind {
-	// Ctags kinds are determined by the parser and do not (in general) match LSP symbol kinds.
-	switch strings.ToLower(kind) {
-	case "file":
-		return lsp.SKFile
-	case "module":
-		return lsp.SKModule
-	case "namespace":
-		return lsp.SKNamespace
-	case "package", "packagename", "subprogspec":
-		return lsp.SKPackage
-	case "class", "type", "service", "typedef", "union", "section", "subtype", "component":
-		return lsp.SKClass
-	case "method", "methodspec":
+// ctagsKinds are the LSP symbol kinds of the lowercased ctags kinds. Ctags
+// kinds are determined by the parser and do not (in general) match LSP symbol
+// kinds.
+var ctagsKinds = map[string]lsp.SymbolKind{
+	"file": lsp.SKFile,
+
+	"module": lsp.SKModule,
+
+	"namespace": lsp.SKNamespace,
+
+	"package":     lsp.SKPackage,
+	"packagename": lsp.SKPackage,
+	"subprogspec": lsp.SKPackage,
+
+	"class":     lsp.SKClass,
+	"type":      lsp.SKClass,
+	"service":   lsp.SKClass,
+	"typedef":   lsp.SKClass,
+	"union":     lsp.SKClass,
+	"section":   lsp.SKClass,
+	"subtype":   lsp.SKClass,
+	"component": lsp.SKClass,
+
+	"method":     lsp.SKMethod,
+	"methodspec": lsp.SKMethod,
+
+	"property": lsp.SKProperty,
+
+	"field":       lsp.SKField,
+	"member":      lsp.SKField,
+	"anonmember":  lsp.SKField,
+	"recordfield": lsp.SKField,
+
+	"constructor": lsp.SKConstructor,
+
+	"enum":       lsp.SKEnum,
+	"enumerator": lsp.SKEnum,
+
+	"interface": lsp.SKInterface,
+
+	"function":        lsp.SKFunction,
+	"func":            lsp.SKFunction,
+	"subroutine":      lsp.SKFunction,
+	"macro":           lsp.SKFunction,
+	"subprogram":      lsp.SKFunction,
+	"procedure":       lsp.SKFunction,
+	"command":         lsp.SKFunction,
+	"singletonmethod": lsp.SKFunction,
+
+	"variable":    lsp.SKVariable,
+	"var":         lsp.SKVariable,
+	"functionvar": lsp.SKVariable,
+	"define":      lsp.SKVariable,
+	"alias":       lsp.SKVariable,
+	"val":         lsp.SKVariable,
+
+	"constant": lsp.SKConstant,
+	"const":    lsp.SKConstant,
+
+	"string":  lsp.SKString,
+	"message": lsp.SKString,
+	"heredoc": lsp.SKString,
+
+	"number": lsp.SKNumber,
+
+	"bool":    lsp.SKBoolean,
+	"boolean": lsp.SKBoolean,
+
+	"array": lsp.SKArray,
+
+	"object":  lsp.SKObject,
+	"literal": lsp.SKObject,
+	"map":     lsp.SKObject,
+
+	"key":      lsp.SKKey,
+	"label":    lsp.SKKey,
+	"target":   lsp.SKKey,
+	"selector": lsp.SKKey,
+	"id":       lsp.SKKey,
+	"tag":      lsp.SKKey,
+
+	"null": lsp.SKNull,
+
+	"enum member":  lsp.SKEnumMember,
+	"enumconstant": lsp.SKEnumMember,
+
+	"struct": lsp.SKStruct,
+
+	"event": lsp.SKEvent,
+
+	"operator": lsp.SKOperator,
+
+	"type parameter": lsp.SKTypeParameter,
+	"annotation":     lsp.SKTypeParameter,
+}
+
+// symbolLSPKind returns the LSP symbol kind of symbol. Universal-ctags, which
+// indexed search uses, emits Go methods with the kind func like functions, so
+// a Go func whose parent is its receiver type instead of its package is a
+// method.
+func symbolLSPKind(symbol protocol.Symbol) lsp.SymbolKind {
+	if strings.EqualFold(symbol.Language, "go") && strings.EqualFold(symbol.Kind, "func") && symbol.Parent != "" && !strings.EqualFold(symbol.ParentKind, "package") {
 		return lsp.SKMethod
-	case "property":
-		return lsp.SKProperty
-	case "field", "member", "anonmember", "recordfield":
-		return lsp.SKField
-	case "constructor":
-		return lsp.SKConstructor
-	case "enum", "enumerator":
-		return lsp.SKEnum
-	case "interface":
-		return lsp.SKInterface
-	case "function", "func", "subroutine", "macro", "subprogram", "procedure", "command", "singletonmethod":
-		return lsp.SKFunction
-	case "variable", "var", "functionvar", "define", "alias", "val":
-		return lsp.SKVariable
-	case "constant", "const":
-		return lsp.SKConstant
-	case "string", "message", "heredoc":
-		return lsp.SKString
-	case "number":
-		return lsp.SKNumber
-	case "bool", "boolean":
-		return lsp.SKBoolean
-	case "array":
-		return lsp.SKArray
-	case "object", "literal", "map":
-		return lsp.SKObject
-	case "key", "label", "target", "selector", "id", "tag":
-		return lsp.SKKey
-	case "null":
-		return lsp.SKNull
-	case "enum member", "enumconstant":
-		return lsp.SKEnumMember
-	case "struct":
-		return lsp.SKStruct
-	case "event":
-		return lsp.SKEvent
-	case "operator":
-		return lsp.SKOperator
-	case "type parameter", "annotation":
-		return lsp.SKTypeParameter
+	}
+	return ctagsKindToLSPSymbolKind(symbol.Kind)
+}
+
+func ctagsKindToLSPSymbolKind(kind string) lsp.SymbolKind {
+	if k, ok := ctagsKinds[strings.ToLower(kind)]; ok {
+		return k
 	}
 	log15.Debug("Unknown ctags kind", "kind", kind)
 	return 0
 }
+
+// lspSymbolKindToCtagsKinds returns the sorted lowercased ctags kinds of an LSP
+// symbol kind.
+func lspSymbolKindToCtagsKinds(kind lsp.SymbolKind) []string {
+	var kinds []string
+	for ctagsKind, k := range ctagsKinds {
+		if k == kind {
+			kinds = append(kinds, ctagsKind)
+		}
+	}
+	sort.Strings(kinds)
+	return kinds
+}
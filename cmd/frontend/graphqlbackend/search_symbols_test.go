@@ -1,14 +1,25 @@
 package graphqlbackend
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/gituri"
+	"github.com/sourcegraph/sourcegraph/internal/search"
+	"github.com/sourcegraph/sourcegraph/internal/search/query"
+	symbolsclient "github.com/sourcegraph/sourcegraph/internal/symbols"
 	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/vcs/git"
 )
@@ -257,3 +268,187 @@ func Test_limitingSymbolResults(t *testing.T) {
 		}
 	})
 }
+
+func TestSearchSymbolsAggregated(t *testing.T) {
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		if spec == "bad" {
+			return "", errors.New("bad revision")
+		}
+		return api.CommitID("c-" + spec), nil
+	}
+	defer git.ResetMocks()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search-aggregated" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+		var args protocol.AggregatedSearchArgs
+		if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+			t.Error(err)
+		}
+		if args.Args.Query != "foo" || args.Args.First != 11 {
+			t.Errorf("unexpected args %+v", args.Args)
+		}
+		_ = json.NewEncoder(w).Encode(protocol.AggregatedSearchResult{
+			Symbols: []protocol.RepoSymbols{{
+				RepoCommit: protocol.RepoCommit{Repo: "a", CommitID: "c-HEAD"},
+				Symbols:    []protocol.Symbol{{Name: "foo", Path: "x.go"}, {Name: "foobar", Path: "x.go"}},
+			}},
+			Missing: []protocol.RepoCommit{{Repo: "b", CommitID: "c-main"}},
+		})
+	}))
+	defer server.Close()
+	defaultClient := symbolsclient.DefaultClient
+	symbolsclient.DefaultClient = &symbolsclient.Client{URL: server.URL, HTTPClient: http.DefaultClient}
+	defer func() { symbolsclient.DefaultClient = defaultClient }()
+
+	repoRevs := func(name, rev string) *search.RepositoryRevisions {
+		return &search.RepositoryRevisions{
+			Repo: &types.Repo{Name: api.RepoName(name)},
+			Revs: []search.RevisionSpecifier{{RevSpec: rev}},
+		}
+	}
+	a, b, c := repoRevs("a", "HEAD"), repoRevs("b", "main"), repoRevs("c", "bad")
+
+	results := map[api.RepoName]string{}
+	missing, err := searchSymbolsAggregated(context.Background(), []*search.RepositoryRevisions{a, b, c}, &search.TextPatternInfo{Pattern: "foo"}, nil, 10, func(repoRevs *search.RepositoryRevisions, matches []*FileMatchResolver, err error) {
+		if err != nil {
+			results[repoRevs.Repo.Name] = err.Error()
+			return
+		}
+		var uris []string
+		for _, m := range matches {
+			uris = append(uris, fmt.Sprintf("%s (%d symbols)", m.uri, len(m.symbols)))
+		}
+		results[repoRevs.Repo.Name] = strings.Join(uris, ", ")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []*search.RepositoryRevisions{b}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("got missing %v, want %v", missing, want)
+	}
+	want := map[api.RepoName]string{
+		"a": "git://a?HEAD#x.go (2 symbols)",
+		"c": "bad revision",
+	}
+	if diff := cmp.Diff(want, results); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestSymbolFilters(t *testing.T) {
+	q, err := query.ProcessAndOr("type:symbol symbolkind:method -symbolkind:class symbolparent:Server exported:yes Handle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters, err := parseSymbolFilters(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := symbolsParameters("r", "c", &search.TextPatternInfo{Pattern: "Handle"}, filters, 10)
+	exported := true
+	want := search.SymbolsParameters{
+		Repo:         "r",
+		CommitID:     "c",
+		Query:        "Handle",
+		Kinds:        []string{"method", "methodspec"},
+		ExcludeKinds: []string{"class", "component", "section", "service", "subtype", "type", "typedef", "union"},
+		Parent:       "Server",
+		Exported:     &exported,
+		First:        11,
+	}
+	if diff := cmp.Diff(want, params); diff != "" {
+		t.Errorf("symbolsParameters mismatch (-want +got):\n%s", diff)
+	}
+
+	symbolResult := func(name, kind, parent string) *searchSymbolResult {
+		return &searchSymbolResult{symbol: protocol.Symbol{Name: name, Kind: kind, Parent: parent, Language: "Go"}}
+	}
+	matches := []*FileMatchResolver{
+		{JPath: "a.go", symbols: []*searchSymbolResult{
+			symbolResult("HandleA", "func", "Server"),
+			symbolResult("handleB", "func", "Server"),
+			symbolResult("HandleC", "func", "Client"),
+		}},
+		{JPath: "b.go", symbols: []*searchSymbolResult{
+			symbolResult("Handler", "type", "Server"),
+		}},
+		{JPath: "c.go", symbols: []*searchSymbolResult{
+			symbolResult("HandleD", "method", "server"),
+		}},
+	}
+	var got []string
+	for _, fm := range filters.filterFileMatches(matches, true) {
+		for _, sym := range fm.symbols {
+			got = append(got, fm.JPath+":"+sym.symbol.Name)
+		}
+	}
+	if want := []string{"a.go:HandleA"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	q, err = query.ProcessAndOr("type:symbol Handle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filters, err := parseSymbolFilters(q); err != nil || filters != nil {
+		t.Errorf("got filters %+v and error %v for a query without symbol filters", filters, err)
+	}
+}
+
+func TestSymbolFilters_goMethods(t *testing.T) {
+	q, err := query.ProcessAndOr("type:symbol symbolkind:method symbolparent:Server ^Handle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters, err := parseSymbolFilters(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The symbols service stores Go methods with the kind method.
+	params := symbolsParameters("r", "c", &search.TextPatternInfo{Pattern: "^Handle"}, filters, 10)
+	if want := []string{"method", "methodspec"}; !reflect.DeepEqual(params.Kinds, want) {
+		t.Errorf("got kinds %v, want %v", params.Kinds, want)
+	}
+
+	// Indexed search returns them with the kind func of universal-ctags.
+	symbol := func(name, kind, parent, parentKind string) *searchSymbolResult {
+		return &searchSymbolResult{symbol: protocol.Symbol{Name: name, Kind: kind, Parent: parent, ParentKind: parentKind, Language: "Go"}}
+	}
+	matches := []*FileMatchResolver{
+		{JPath: "a.go", symbols: []*searchSymbolResult{
+			symbol("HandleA", "func", "Server", "struct"),
+			symbol("HandleB", "func", "a", "package"),
+			symbol("HandleC", "method", "Server", "struct"),
+		}},
+	}
+	var got []string
+	for _, fm := range filters.filterFileMatches(matches, false) {
+		for _, sym := range fm.symbols {
+			got = append(got, sym.symbol.Name)
+		}
+	}
+	if want := []string{"HandleA", "HandleC"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := (&symbolResolver{symbol: matches[0].symbols[0].symbol}).Kind(); got != "METHOD" {
+		t.Errorf("got kind %s, want METHOD", got)
+	}
+}
+
+func TestFilteredSymbolsFileMatchLimit(t *testing.T) {
+	for limit, want := range map[int32]int32{
+		30:    300,
+		499:   4990,
+		500:   maxFilteredSymbolsFileMatches,
+		5000:  5000,
+		10000: 10000,
+	} {
+		if got := filteredSymbolsFileMatchLimit(limit); got != want {
+			t.Errorf("%d: got %d, want %d", limit, got, want)
+		}
+	}
+}
@@ -3,9 +3,18 @@ package graphqlbackend
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/inconshreveable/log15"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/backend"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/db"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/goroutine"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	gitserverprotocol "github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/repoupdater"
 	"github.com/sourcegraph/sourcegraph/internal/repoupdater/protocol"
 )
@@ -27,11 +36,105 @@ func (r *schemaResolver) StatusMessages(ctx context.Context) ([]*statusMessageRe
 		messages = append(messages, &statusMessageResolver{message: m})
 	}
 
+	// The progress of the clones that are running is attached to the cloning
+	// message. A gitserver that can't be reached shouldn't hide the other
+	// messages, so errors are only logged.
+	progress, err := listCloneProgress(ctx)
+	if err != nil {
+		log15.Warn("failed to list clone progress", "err", err)
+	}
+	if len(progress) > 0 {
+		var cloning *statusMessageResolver
+		for _, m := range messages {
+			if m.message.Cloning != nil {
+				cloning = m
+				break
+			}
+		}
+		if cloning == nil {
+			cloning = &statusMessageResolver{message: protocol.StatusMessage{
+				Cloning: &protocol.CloningProgress{
+					Message: fmt.Sprintf("Currently cloning %d repositories...", len(progress)),
+				},
+			}}
+			messages = append(messages, cloning)
+		}
+		cloning.cloneProgress = progress
+	}
+
 	return messages, nil
 }
 
+// cloneProgressTTL is how long the clone progress listed from gitserver is
+// reused. Status messages are polled by the browsers of all site admins, and
+// listing the clone progress sends a request to every gitserver.
+const cloneProgressTTL = 5 * time.Second
+
+// cloneProgressTimeout bounds a listing of the clone progress, which is not
+// canceled with the request that started it.
+const cloneProgressTimeout = 10 * time.Second
+
+var cloneProgressCache struct {
+	sync.Mutex
+	progress  map[api.RepoName]*gitserverprotocol.CloneProgress
+	err       error
+	fetchedAt time.Time
+
+	// listing is closed when the running listing finishes. It is nil if no
+	// listing is running.
+	listing chan struct{}
+}
+
+// listCloneProgress returns the progress of the clones that are running on
+// gitserver, listed at most once per cloneProgressTTL. Concurrent callers
+// wait for the same listing. If some gitservers could not be reached, it
+// returns the progress listed from the others together with the error, and
+// both are cached.
+func listCloneProgress(ctx context.Context) (map[api.RepoName]*gitserverprotocol.CloneProgress, error) {
+	cloneProgressCache.Lock()
+	if time.Since(cloneProgressCache.fetchedAt) < cloneProgressTTL {
+		defer cloneProgressCache.Unlock()
+		return cloneProgressCache.progress, cloneProgressCache.err
+	}
+	listing := cloneProgressCache.listing
+	if listing == nil {
+		listing = make(chan struct{})
+		cloneProgressCache.listing = listing
+		goroutine.Go(func() { refreshCloneProgress(listing) })
+	}
+	cloneProgressCache.Unlock()
+
+	select {
+	case <-listing:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	cloneProgressCache.Lock()
+	defer cloneProgressCache.Unlock()
+	return cloneProgressCache.progress, cloneProgressCache.err
+}
+
+// refreshCloneProgress lists the clone progress from gitserver into
+// cloneProgressCache and then closes listing.
+func refreshCloneProgress(listing chan struct{}) {
+	defer close(listing)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cloneProgressTimeout)
+	defer cancel()
+	progress, err := gitserver.DefaultClient.ListCloneProgress(ctx)
+
+	cloneProgressCache.Lock()
+	defer cloneProgressCache.Unlock()
+	cloneProgressCache.progress, cloneProgressCache.err, cloneProgressCache.fetchedAt = progress, err, time.Now()
+	cloneProgressCache.listing = nil
+}
+
 type statusMessageResolver struct {
 	message protocol.StatusMessage
+
+	// cloneProgress is the progress of the clones that are running, for
+	// cloning messages.
+	cloneProgress map[api.RepoName]*gitserverprotocol.CloneProgress
 }
 
 func (r *statusMessageResolver) ToCloningProgress() (*statusMessageResolver, bool) {
@@ -68,3 +171,67 @@ func (r *statusMessageResolver) ExternalService(ctx context.Context) (*externalS
 
 	return &externalServiceResolver{externalService: externalService}, nil
 }
+
+func (r *statusMessageResolver) Repositories() []*repositoryCloneProgressResolver {
+	resolvers := make([]*repositoryCloneProgressResolver, 0, len(r.cloneProgress))
+	for name, progress := range r.cloneProgress {
+		resolvers = append(resolvers, &repositoryCloneProgressResolver{name: name, progress: progress})
+	}
+	sort.Slice(resolvers, func(i, j int) bool { return resolvers[i].name < resolvers[j].name })
+	return resolvers
+}
+
+func (r *statusMessageResolver) BytesPerSecond() float64 {
+	var sum int64
+	for _, progress := range r.cloneProgress {
+		sum += progress.BytesPerSecond
+	}
+	return float64(sum)
+}
+
+// PhaseEta returns the longest ETA of the current phases of the clones, since
+// the clones run in parallel.
+func (r *statusMessageResolver) PhaseEta() *int32 {
+	var eta *int32
+	for _, progress := range r.cloneProgress {
+		if e := etaSeconds(progress); e != nil && (eta == nil || *e > *eta) {
+			eta = e
+		}
+	}
+	return eta
+}
+
+type repositoryCloneProgressResolver struct {
+	name     api.RepoName
+	progress *gitserverprotocol.CloneProgress
+}
+
+func (r *repositoryCloneProgressResolver) Name() string  { return string(r.name) }
+func (r *repositoryCloneProgressResolver) Phase() string { return r.progress.Phase }
+func (r *repositoryCloneProgressResolver) Percent() int32 {
+	return int32(r.progress.Percent)
+}
+func (r *repositoryCloneProgressResolver) Objects() float64 { return float64(r.progress.Objects) }
+func (r *repositoryCloneProgressResolver) TotalObjects() float64 {
+	return float64(r.progress.TotalObjects)
+}
+func (r *repositoryCloneProgressResolver) ReceivedBytes() float64 {
+	return float64(r.progress.ReceivedBytes)
+}
+func (r *repositoryCloneProgressResolver) BytesPerSecond() float64 {
+	return float64(r.progress.BytesPerSecond)
+}
+func (r *repositoryCloneProgressResolver) StartedAt() DateTime {
+	return DateTime{Time: r.progress.StartedAt}
+}
+func (r *repositoryCloneProgressResolver) PhaseEta() *int32 { return etaSeconds(r.progress) }
+
+// etaSeconds returns the ETA of the phase of a clone in seconds, or nil if it
+// is unknown.
+func etaSeconds(progress *gitserverprotocol.CloneProgress) *int32 {
+	if progress.ETA <= 0 {
+		return nil
+	}
+	eta := int32(progress.ETA.Seconds())
+	return &eta
+}
@@ -2,12 +2,18 @@ package graphqlbackend
 
 import (
 	"context"
+	"errors"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/graph-gophers/graphql-go/gqltesting"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/backend"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/db"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	gitserverprotocol "github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/repoupdater"
 	"github.com/sourcegraph/sourcegraph/internal/repoupdater/protocol"
 )
@@ -38,6 +44,12 @@ func TestStatusMessages(t *testing.T) {
 	`
 
 	resetMocks()
+	resetCloneProgressCache()
+	gitserver.MockListCloneProgress = func(context.Context) (map[api.RepoName]*gitserverprotocol.CloneProgress, error) {
+		return nil, nil
+	}
+	defer func() { gitserver.MockListCloneProgress = nil }()
+
 	t.Run("unauthenticated", func(t *testing.T) {
 		result, err := (&schemaResolver{}).StatusMessages(context.Background())
 		if want := backend.ErrNotAuthenticated; err != want {
@@ -151,4 +163,214 @@ func TestStatusMessages(t *testing.T) {
 			},
 		})
 	})
+
+	t.Run("clone progress", func(t *testing.T) {
+		db.Mocks.Users.GetByCurrentAuthUser = func(ctx context.Context) (*types.User, error) {
+			return &types.User{ID: 1, SiteAdmin: true}, nil
+		}
+		defer func() { db.Mocks.Users.GetByCurrentAuthUser = nil }()
+
+		repoupdater.MockStatusMessages = func(_ context.Context) (*protocol.StatusMessagesResponse, error) {
+			return &protocol.StatusMessagesResponse{Messages: []protocol.StatusMessage{}}, nil
+		}
+		defer func() { repoupdater.MockStatusMessages = nil }()
+
+		resetCloneProgressCache()
+		defer resetCloneProgressCache()
+		startedAt := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+		gitserver.MockListCloneProgress = func(context.Context) (map[api.RepoName]*gitserverprotocol.CloneProgress, error) {
+			return map[api.RepoName]*gitserverprotocol.CloneProgress{
+				"github.com/foo/b": {
+					Phase:          gitserverprotocol.ClonePhaseReceiving,
+					Percent:        40,
+					Objects:        400,
+					TotalObjects:   1000,
+					ReceivedBytes:  4096,
+					BytesPerSecond: 1024,
+					StartedAt:      startedAt,
+					ETA:            90 * time.Second,
+				},
+				"github.com/foo/a": {
+					Phase:     gitserverprotocol.ClonePhaseStarting,
+					StartedAt: startedAt,
+				},
+			}, nil
+		}
+
+		gqltesting.RunTests(t, []*gqltesting.Test{
+			{
+				Schema: mustParseGraphQLSchema(t),
+				Query: `
+					query StatusMessages {
+						statusMessages {
+							... on CloningProgress {
+								message
+								bytesPerSecond
+								phaseEta
+								repositories {
+									name
+									phase
+									percent
+									objects
+									totalObjects
+									receivedBytes
+									bytesPerSecond
+									startedAt
+									phaseEta
+								}
+							}
+						}
+					}
+				`,
+				ExpectedResult: `
+					{
+						"statusMessages": [
+							{
+								"message": "Currently cloning 2 repositories...",
+								"bytesPerSecond": 1024,
+								"phaseEta": 90,
+								"repositories": [
+									{
+										"name": "github.com/foo/a",
+										"phase": "starting",
+										"percent": 0,
+										"objects": 0,
+										"totalObjects": 0,
+										"receivedBytes": 0,
+										"bytesPerSecond": 0,
+										"startedAt": "2020-03-01T10:00:00Z",
+										"phaseEta": null
+									},
+									{
+										"name": "github.com/foo/b",
+										"phase": "receiving",
+										"percent": 40,
+										"objects": 400,
+										"totalObjects": 1000,
+										"receivedBytes": 4096,
+										"bytesPerSecond": 1024,
+										"startedAt": "2020-03-01T10:00:00Z",
+										"phaseEta": 90
+									}
+								]
+							}
+						]
+					}
+				`,
+			},
+		})
+	})
+}
+
+func TestListCloneProgress_cached(t *testing.T) {
+	resetCloneProgressCache()
+	defer resetCloneProgressCache()
+
+	calls := 0
+	gitserver.MockListCloneProgress = func(context.Context) (map[api.RepoName]*gitserverprotocol.CloneProgress, error) {
+		calls++
+		return map[api.RepoName]*gitserverprotocol.CloneProgress{
+			"github.com/foo/a": {Phase: gitserverprotocol.ClonePhaseStarting},
+		}, nil
+	}
+	defer func() { gitserver.MockListCloneProgress = nil }()
+
+	for i := 0; i < 3; i++ {
+		progress, err := listCloneProgress(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(progress) != 1 {
+			t.Fatalf("got %d clones, want 1", len(progress))
+		}
+	}
+	if calls != 1 {
+		t.Errorf("listed clone progress %d times, want 1", calls)
+	}
+
+	// Expire the cache.
+	cloneProgressCache.fetchedAt = time.Now().Add(-cloneProgressTTL)
+	if _, err := listCloneProgress(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("listed clone progress %d times after expiry, want 2", calls)
+	}
+}
+
+func TestListCloneProgress_partial(t *testing.T) {
+	resetCloneProgressCache()
+	defer resetCloneProgressCache()
+
+	calls := 0
+	gitserver.MockListCloneProgress = func(context.Context) (map[api.RepoName]*gitserverprotocol.CloneProgress, error) {
+		calls++
+		return map[api.RepoName]*gitserverprotocol.CloneProgress{
+			"github.com/foo/a": {Phase: gitserverprotocol.ClonePhaseStarting},
+		}, errors.New("gitserver-1 is unreachable")
+	}
+	defer func() { gitserver.MockListCloneProgress = nil }()
+
+	for i := 0; i < 2; i++ {
+		progress, err := listCloneProgress(context.Background())
+		if err == nil || err.Error() != "gitserver-1 is unreachable" {
+			t.Errorf("got error %v, want the error of the unreachable gitserver", err)
+		}
+		if len(progress) != 1 {
+			t.Errorf("got %d clones, want 1", len(progress))
+		}
+	}
+	if calls != 1 {
+		t.Errorf("listed clone progress %d times, want 1", calls)
+	}
+}
+
+func TestListCloneProgress_canceled(t *testing.T) {
+	resetCloneProgressCache()
+	defer resetCloneProgressCache()
+
+	var calls int32
+	release := make(chan struct{})
+	gitserver.MockListCloneProgress = func(ctx context.Context) (map[api.RepoName]*gitserverprotocol.CloneProgress, error) {
+		atomic.AddInt32(&calls, 1)
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("listing has no deadline")
+		}
+		<-release
+		return map[api.RepoName]*gitserverprotocol.CloneProgress{
+			"github.com/foo/a": {Phase: gitserverprotocol.ClonePhaseStarting},
+		}, ctx.Err()
+	}
+	defer func() { gitserver.MockListCloneProgress = nil }()
+
+	// A request that goes away stops waiting, but does not cancel the
+	// listing that other requests wait for.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := listCloneProgress(ctx); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		progress, err := listCloneProgress(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		if len(progress) != 1 {
+			t.Errorf("got %d clones, want 1", len(progress))
+		}
+	}()
+	close(release)
+	<-done
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("listed clone progress %d times, want 1", n)
+	}
+}
+
+func resetCloneProgressCache() {
+	cloneProgressCache.Lock()
+	defer cloneProgressCache.Unlock()
+	cloneProgressCache.progress, cloneProgressCache.err, cloneProgressCache.fetchedAt = nil, nil, time.Time{}
 }
@@ -254,7 +254,7 @@ func (r *symbolResolver) ContainerName() *string {
 }
 
 func (r *symbolResolver) Kind() string /* enum SymbolKind */ {
-	kind := ctagsKindToLSPSymbolKind(r.symbol.Kind)
+	kind := symbolLSPKind(r.symbol)
 	if kind == 0 {
 		return "UNKNOWN"
 	}
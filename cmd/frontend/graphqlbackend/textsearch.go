@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
 	"github.com/sourcegraph/sourcegraph/internal/conf"
 	"github.com/sourcegraph/sourcegraph/internal/metrics"
 	"github.com/sourcegraph/sourcegraph/internal/trace"
@@ -70,12 +71,17 @@ type FileMatchResolver struct {
 	MatchCount   int          // Number of matches. Different from len(JLineMatches), as multiple lines may correspond to one logical match.
 	symbols      []*searchSymbolResult
 	uri          string
+	zoektScore   float64 // the score zoekt assigned to an indexed result, used to rank results
 	Repo         *types.Repo
 	CommitID     api.CommitID
 	// InputRev is the Git revspec that the user originally requested to search. It is used to
 	// preserve the original revision specifier from the user instead of navigating them to the
 	// absolute commit ID when they select a result.
 	InputRev *string
+
+	// JMultilineMatches are the matches of patterns that can match a newline,
+	// which are only returned by searcher.
+	JMultilineMatches []*multilineMatch `json:"MultilineMatches"`
 }
 
 func (fm *FileMatchResolver) Equal(other *FileMatchResolver) bool {
@@ -129,6 +135,10 @@ func (fm *FileMatchResolver) LineMatches() []*lineMatch {
 	return fm.JLineMatches
 }
 
+func (fm *FileMatchResolver) MultilineMatches() []*multilineMatch {
+	return fm.JMultilineMatches
+}
+
 func (fm *FileMatchResolver) LimitHit() bool {
 	return fm.JLimitHit
 }
@@ -161,6 +171,9 @@ type lineMatch struct {
 	JOffsetAndLengths [][2]int32 `json:"OffsetAndLengths"`
 	JLineNumber       int32      `json:"LineNumber"`
 	JLimitHit         bool       `json:"LimitHit"`
+
+	JContextBefore []string `json:"ContextBefore"`
+	JContextAfter  []string `json:"ContextAfter"`
 }
 
 func (lm *lineMatch) Preview() string {
@@ -183,6 +196,46 @@ func (lm *lineMatch) LimitHit() bool {
 	return lm.JLimitHit
 }
 
+func (lm *lineMatch) ContextBefore() []string {
+	if lm.JContextBefore == nil {
+		return []string{}
+	}
+	return lm.JContextBefore
+}
+
+func (lm *lineMatch) ContextAfter() []string {
+	if lm.JContextAfter == nil {
+		return []string{}
+	}
+	return lm.JContextAfter
+}
+
+// multilineMatch is a match that may span several lines, as returned by
+// searcher.
+type multilineMatch struct {
+	JPreview string        `json:"Preview"`
+	JStart   matchLocation `json:"Start"`
+	JEnd     matchLocation `json:"End"`
+}
+
+// matchLocation is a position in a file. Both fields are 0-based, and the
+// column is measured in characters.
+type matchLocation struct {
+	Line   int `json:"Line"`
+	Column int `json:"Column"`
+}
+
+func (mm *multilineMatch) Preview() string {
+	return mm.JPreview
+}
+
+func (mm *multilineMatch) Range() *rangeResolver {
+	return &rangeResolver{lspRange: lsp.Range{
+		Start: lsp.Position{Line: mm.JStart.Line, Character: mm.JStart.Column},
+		End:   lsp.Position{Line: mm.JEnd.Line, Character: mm.JEnd.Column},
+	}}
+}
+
 var mockTextSearch func(ctx context.Context, repo gitserver.Repo, commit api.CommitID, p *search.TextPatternInfo, fetchTimeout time.Duration) (matches []*FileMatchResolver, limitHit bool, err error)
 
 // textSearch searches repo@commit with p.
@@ -216,7 +269,17 @@ func textSearch(ctx context.Context, searcherURLs *endpoint.Map, repo gitserver.
 		}
 		q.Set("Deadline", string(t))
 	}
+	if p.PatternExpression != nil {
+		b, err := json.Marshal(p.PatternExpression)
+		if err != nil {
+			return nil, false, err
+		}
+		q.Set("PatternExpression", string(b))
+	}
 	q.Set("FileMatchLimit", strconv.FormatInt(int64(p.FileMatchLimit), 10))
+	if p.ContextLines > 0 {
+		q.Set("ContextLines", strconv.FormatInt(int64(p.ContextLines), 10))
+	}
 	if p.IsRegExp {
 		q.Set("IsRegExp", "true")
 	}
@@ -461,6 +524,15 @@ func searchFilesInRepos(ctx context.Context, args *search.TextParameters) (res [
 		return mockSearchFilesInRepos(args)
 	}
 
+	if predicates, _ := query.Predicates(args.Query, query.FieldFile); len(predicates) > 0 {
+		return searchFilesContaining(ctx, args, predicates)
+	}
+	return doSearchFilesInRepos(ctx, args)
+}
+
+// doSearchFilesInRepos searches a set of repos for a pattern, ignoring the
+// file:contains(...) predicates of the query.
+func doSearchFilesInRepos(ctx context.Context, args *search.TextParameters) (res []*FileMatchResolver, common *searchResultsCommon, err error) {
 	tr, ctx := trace.New(ctx, "searchFilesInRepos", fmt.Sprintf("query: %s, numRepoRevs: %d", args.PatternInfo.Pattern, len(args.Repos)))
 	defer func() {
 		tr.SetError(err)
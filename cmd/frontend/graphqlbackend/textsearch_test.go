@@ -2,6 +2,7 @@ package graphqlbackend
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"regexp"
@@ -156,6 +157,24 @@ func TestQueryToZoektQuery(t *testing.T) {
 			},
 			Query: `f:test`,
 		},
+		{
+			Name: "pattern expression",
+			Pattern: &search.TextPatternInfo{
+				IsRegExp:        true,
+				IsCaseSensitive: false,
+				Pattern:         "foo|bar|baz",
+				PatternExpression: &search.PatternNode{
+					Op: search.PatternOpAnd,
+					Operands: []*search.PatternNode{
+						{Pattern: "foo"},
+						{Op: search.PatternOpOr, Operands: []*search.PatternNode{{Pattern: "bar"}, {Pattern: "baz"}}},
+						{Op: search.PatternOpNot, Operands: []*search.PatternNode{{Pattern: "qux"}}},
+					},
+				},
+				PathPatternsAreRegExps: true,
+			},
+			Query: `foo (bar or baz) -qux case:no`,
+		},
 	}
 	for _, tt := range cases {
 		t.Run(tt.Name, func(t *testing.T) {
@@ -925,6 +944,146 @@ func Test_zoektIndexedRepos(t *testing.T) {
 	}
 }
 
+func Test_zoektIndexedRepos_branches(t *testing.T) {
+	conf.Mock(&conf.Unified{SiteConfiguration: schema.SiteConfiguration{
+		SearchIndexBranches: map[string][]string{"foo/branches": {"release/*"}},
+	}})
+	defer conf.Mock(nil)
+
+	zoektRepoList := &zoekt.RepoList{
+		Repos: []*zoekt.RepoListEntry{{
+			Repository: zoekt.Repository{
+				Name: "foo/branches",
+				Branches: []zoekt.RepositoryBranch{
+					{Name: "HEAD", Version: "deadbeef"},
+					{Name: "release/1", Version: "cafe1"},
+					{Name: "release/2", Version: "cafe2"},
+					{Name: "feature", Version: "cafe3"},
+				},
+			},
+		}},
+	}
+	z := &searchbackend.Zoekt{Client: &fakeSearcher{repos: zoektRepoList}}
+
+	cases := []struct {
+		repo     string
+		branches []search.IndexedBranch // nil if unindexed
+	}{
+		{repo: "foo/branches", branches: []search.IndexedBranch{{Name: "HEAD", Commit: "deadbeef"}}},
+		{repo: "foo/branches@deadb", branches: []search.IndexedBranch{{Name: "HEAD", Commit: "deadbeef"}}},
+		{repo: "foo/branches@feature", branches: []search.IndexedBranch{{Name: "feature", Commit: "cafe3"}}},
+		{repo: "foo/branches@release/*", branches: []search.IndexedBranch{{Name: "release/1", Commit: "cafe1"}, {Name: "release/2", Commit: "cafe2"}}},
+		{repo: "foo/branches@*refs/heads/release/*:*!refs/heads/release/2", branches: []search.IndexedBranch{{Name: "release/1", Commit: "cafe1"}}},
+		{repo: "foo/branches@HEAD:release/*", branches: []search.IndexedBranch{{Name: "HEAD", Commit: "deadbeef"}, {Name: "release/1", Commit: "cafe1"}, {Name: "release/2", Commit: "cafe2"}}},
+		{repo: "foo/branches@feat*"},
+		{repo: "foo/branches@other"},
+		{repo: "foo/branches@cafe1"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.repo, func(t *testing.T) {
+			repos := makeRepositoryRevisions(tc.repo)
+			indexed, unindexed, err := zoektIndexedRepos(context.Background(), z, repos, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.branches == nil {
+				if len(indexed) != 0 || len(unindexed) != 1 {
+					t.Fatalf("got %d indexed, want repository to be unindexed", len(indexed))
+				}
+				return
+			}
+			if len(indexed) != 1 {
+				t.Fatalf("got %d unindexed, want repository to be indexed", len(unindexed))
+			}
+			if got := indexed[0].IndexedBranches(); !reflect.DeepEqual(got, tc.branches) {
+				t.Errorf("got branches %+v, want %+v", got, tc.branches)
+			}
+		})
+	}
+}
+
+func Test_zoektIndexedRepos_tooManyBranches(t *testing.T) {
+	conf.Mock(&conf.Unified{SiteConfiguration: schema.SiteConfiguration{
+		SearchIndexBranches: map[string][]string{"foo/branches": {"feature", "release/*"}},
+	}})
+	defer conf.Mock(nil)
+
+	branches := []zoekt.RepositoryBranch{{Name: "HEAD", Version: "deadbeef"}, {Name: "feature", Version: "cafe"}}
+	for i := len(branches); i < search.MaxIndexedBranches; i++ {
+		branches = append(branches, zoekt.RepositoryBranch{Name: fmt.Sprintf("release/%d", i), Version: "cafe"})
+	}
+	zoektRepoList := &zoekt.RepoList{
+		Repos: []*zoekt.RepoListEntry{{Repository: zoekt.Repository{Name: "foo/branches", Branches: branches}}},
+	}
+	z := &searchbackend.Zoekt{Client: &fakeSearcher{repos: zoektRepoList}}
+
+	// The branches matching the glob may not all be indexed, so the glob is
+	// searched without the index.
+	indexed, unindexed, err := zoektIndexedRepos(context.Background(), z, makeRepositoryRevisions("foo/branches@release/*"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexed) != 0 || len(unindexed) != 1 {
+		t.Errorf("got %d indexed and %d unindexed, want the glob to be unindexed", len(indexed), len(unindexed))
+	}
+
+	// Configured branches are searched with the index.
+	indexed, _, err = zoektIndexedRepos(context.Background(), z, makeRepositoryRevisions("foo/branches@feature"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexed) != 1 {
+		t.Errorf("got %d indexed, want the branch to be indexed", len(indexed))
+	}
+}
+
+func Test_zoektRepoBranchesQuery(t *testing.T) {
+	repos := makeRepositoryRevisions("foo/a", "foo/b@release/*")
+	repos[1].SetIndexedBranches([]search.IndexedBranch{{Name: "release/1"}, {Name: "release/2"}})
+	repoSet := &zoektquery.RepoSet{Set: map[string]bool{"foo/a": true, "foo/b": true}}
+	repoMap := map[api.RepoName]*search.RepositoryRevisions{"foo/a": repos[0], "foo/b": repos[1]}
+
+	want := `(or (reposet foo/a) (and (reposet foo/b) (or branch:"release/1" branch:"release/2")))`
+	if got := zoektRepoBranchesQuery(repoSet, repoMap).String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// Without indexed branches, the repository set is used as is.
+	delete(repoSet.Set, "foo/b")
+	if got := zoektRepoBranchesQuery(repoSet, repoMap); got != repoSet {
+		t.Errorf("got %s, want %s", got, repoSet)
+	}
+}
+
+func Test_zoektFileMatchRevision(t *testing.T) {
+	repos := makeRepositoryRevisions("foo/a@deadb", "foo/b@release/*")
+	repos[0].SetIndexedHEADCommit("deadbeef")
+	repos[1].SetIndexedBranches([]search.IndexedBranch{
+		{Name: "HEAD", Commit: "deadbeef"},
+		{Name: "release/1", Commit: "cafe1"},
+		{Name: "release/10", Commit: "cafe10"},
+	})
+
+	cases := []struct {
+		repoRev  *search.RepositoryRevisions
+		branches []string
+		inputRev string
+		branch   search.IndexedBranch
+		ok       bool
+	}{
+		{repoRev: repos[0], branches: []string{"HEAD"}, inputRev: "deadb", branch: search.IndexedBranch{Name: "HEAD", Commit: "deadbeef"}, ok: true},
+		{repoRev: repos[1], branches: []string{"HEAD", "release/1"}, inputRev: "", branch: search.IndexedBranch{Name: "HEAD", Commit: "deadbeef"}, ok: true},
+		{repoRev: repos[1], branches: []string{"release/10"}, inputRev: "release/10", branch: search.IndexedBranch{Name: "release/10", Commit: "cafe10"}, ok: true},
+		{repoRev: repos[1], branches: []string{"release/100"}},
+	}
+	for _, tc := range cases {
+		inputRev, branch, ok := zoektFileMatchRevision(tc.repoRev, &zoekt.FileMatch{Branches: tc.branches})
+		if inputRev != tc.inputRev || branch != tc.branch || ok != tc.ok {
+			t.Errorf("%s %v: got (%q, %+v, %v), want (%q, %+v, %v)", tc.repoRev.Repo.Name, tc.branches, inputRev, branch, ok, tc.inputRev, tc.branch, tc.ok)
+		}
+	}
+}
+
 func Benchmark_zoektIndexedRepos(b *testing.B) {
 	repoNames := []string{}
 	zoektRepos := []*zoekt.RepoListEntry{}
@@ -954,3 +1113,78 @@ func Benchmark_zoektIndexedRepos(b *testing.B) {
 		_, _, _ = zoektIndexedRepos(ctx, z, repos, nil)
 	}
 }
+
+func TestFileMatchResolver_multilineMatches(t *testing.T) {
+	// The file matches of searcher responses are decoded directly into
+	// FileMatchResolver.
+	b := []byte(`{"Path":"a.go","MultilineMatches":[{"Preview":"func a() {\n}","Start":{"Line":3,"Column":9},"End":{"Line":4,"Column":1}}]}`)
+	var fm FileMatchResolver
+	if err := json.Unmarshal(b, &fm); err != nil {
+		t.Fatal(err)
+	}
+
+	mms := fm.MultilineMatches()
+	if len(mms) != 1 {
+		t.Fatalf("got %d multiline matches, want 1", len(mms))
+	}
+	r := mms[0].Range()
+	got := [4]int32{r.Start().Line(), r.Start().Character(), r.End().Line(), r.End().Character()}
+	if want := [4]int32{3, 9, 4, 1}; got != want || mms[0].Preview() != "func a() {\n}" {
+		t.Errorf("got range %v and preview %q", got, mms[0].Preview())
+	}
+}
+
+func TestLineMatch_context(t *testing.T) {
+	b := []byte(`{"Path":"a.go","LineMatches":[{"Preview":"b","LineNumber":1,"ContextBefore":["a"],"ContextAfter":["c","d"]},{"Preview":"e","LineNumber":4}]}`)
+	var fm FileMatchResolver
+	if err := json.Unmarshal(b, &fm); err != nil {
+		t.Fatal(err)
+	}
+
+	lms := fm.LineMatches()
+	if len(lms) != 2 {
+		t.Fatalf("got %d line matches, want 2", len(lms))
+	}
+	if got, want := [][]string{lms[0].ContextBefore(), lms[0].ContextAfter()}, [][]string{{"a"}, {"c", "d"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got context %q, want %q", got, want)
+	}
+	if got, want := [][]string{lms[1].ContextBefore(), lms[1].ContextAfter()}, [][]string{{}, {}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got context %q, want %q", got, want)
+	}
+}
+
+func TestZoektContextLines(t *testing.T) {
+	content := []byte("a\nb\nc\nd\n")
+	cases := []struct {
+		lineNumber, n int
+		before, after []string
+	}{
+		{lineNumber: 0, n: 1, before: []string{}, after: []string{"b"}},
+		{lineNumber: 2, n: 2, before: []string{"a", "b"}, after: []string{"d"}},
+		{lineNumber: 3, n: 1, before: []string{"c"}, after: []string{}},
+		{lineNumber: 4, n: 1},
+	}
+	for _, c := range cases {
+		before, after := zoektContextLines(content, c.lineNumber, c.n)
+		if !reflect.DeepEqual(before, c.before) || !reflect.DeepEqual(after, c.after) {
+			t.Errorf("line %d, %d lines: got %q and %q, want %q and %q", c.lineNumber, c.n, before, after, c.before, c.after)
+		}
+	}
+}
+
+func TestZoektSearchOpts_contextLines(t *testing.T) {
+	if opts := zoektSearchOpts(1, &search.TextPatternInfo{}); opts.Whole {
+		t.Error("got Whole, want the whole content of files only with context lines")
+	}
+	opts := zoektSearchOpts(1, &search.TextPatternInfo{ContextLines: 2, FileMatchLimit: 30})
+	if !opts.Whole {
+		t.Error("got !Whole, want the whole content of files for context lines")
+	}
+	if got, want := opts.MaxDocDisplayCount, 31; got != want {
+		t.Errorf("got MaxDocDisplayCount %d, want %d", got, want)
+	}
+	opts = zoektSearchOpts(1, &search.TextPatternInfo{ContextLines: 2, FileMatchLimit: 5000})
+	if got, want := opts.MaxDocDisplayCount, maxZoektContextFiles; got != want {
+		t.Errorf("got MaxDocDisplayCount %d, want %d", got, want)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"math"
 	"net/url"
 	"regexp/syntax"
+	"sort"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -14,11 +15,13 @@ import (
 	zoektquery "github.com/google/zoekt/query"
 	"github.com/pkg/errors"
 	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/conf"
 	"github.com/sourcegraph/sourcegraph/internal/gituri"
 	"github.com/sourcegraph/sourcegraph/internal/search"
 	searchbackend "github.com/sourcegraph/sourcegraph/internal/search/backend"
 	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/trace"
+	"github.com/sourcegraph/sourcegraph/internal/vcs/git"
 )
 
 func zoektResultCountFactor(numRepos int, query *search.TextPatternInfo) int {
@@ -45,6 +48,10 @@ func zoektResultCountFactor(numRepos int, query *search.TextPatternInfo) int {
 	return k
 }
 
+// maxZoektContextFiles is the maximum number of files whose whole content is
+// returned by zoekt to add context lines to their line matches.
+const maxZoektContextFiles = 500
+
 func zoektSearchOpts(k int, query *search.TextPatternInfo) zoekt.SearchOptions {
 	searchOpts := zoekt.SearchOptions{
 		MaxWallTime:            defaultTimeout,
@@ -69,6 +76,20 @@ func zoektSearchOpts(k int, query *search.TextPatternInfo) zoekt.SearchOptions {
 		searchOpts.MaxWallTime *= time.Duration(3 * float64(query.FileMatchLimit) / float64(defaultMaxSearchResults))
 	}
 
+	// The version of zoekt we use cannot return the lines around a line
+	// match, so we ask for the whole content of matching files and extract
+	// them ourselves (see zoektContextLines). Whole files are much larger
+	// than line matches, so only the files that can be returned are asked
+	// for, plus one to tell whether the file match limit is hit, up to
+	// maxZoektContextFiles.
+	if query.ContextLines > 0 {
+		searchOpts.Whole = true
+		searchOpts.MaxDocDisplayCount = int(query.FileMatchLimit) + 1
+		if searchOpts.MaxDocDisplayCount > maxZoektContextFiles {
+			searchOpts.MaxDocDisplayCount = maxZoektContextFiles
+		}
+	}
+
 	return searchOpts
 }
 
@@ -139,7 +160,7 @@ func zoektSearchHEAD(ctx context.Context, args *search.TextParameters, repos []*
 	if err != nil {
 		return nil, false, nil, err
 	}
-	finalQuery = zoektquery.NewAnd(newRepoSet, queryExceptRepos)
+	finalQuery = zoektquery.NewAnd(zoektRepoBranchesQuery(newRepoSet, repoMap), queryExceptRepos)
 	tr.LazyPrintf("after repohasfile filters: nRepos=%d query=%v", len(newRepoSet.Set), finalQuery)
 
 	t0 := time.Now()
@@ -151,6 +172,11 @@ func zoektSearchHEAD(ctx context.Context, args *search.TextParameters, repos []*
 		return nil, false, nil, errNoResultsInTimeout
 	}
 	limitHit = resp.FilesSkipped+resp.ShardsSkipped > 0
+	if args.PatternInfo.ContextLines > 0 && len(resp.Files) >= searchOpts.MaxDocDisplayCount {
+		// Zoekt dropped the files beyond MaxDocDisplayCount, which is capped
+		// when context lines are requested.
+		limitHit = true
+	}
 	// Repositories that weren't fully evaluated because they hit the Zoekt or Sourcegraph file match limits.
 	reposLimitHit = make(map[string]struct{})
 	if limitHit {
@@ -191,16 +217,23 @@ func zoektSearchHEAD(ctx context.Context, args *search.TextParameters, repos []*
 		limitHit = true
 	}
 
-	matches := make([]*FileMatchResolver, len(resp.Files))
-	for i, file := range resp.Files {
+	matches := make([]*FileMatchResolver, 0, len(resp.Files))
+	for _, file := range resp.Files {
+		repoRev := repoMap[api.RepoName(strings.ToLower(string(file.Repository)))]
+		inputRev, branch, ok := zoektFileMatchRevision(repoRev, &file)
+		if !ok {
+			continue
+		}
+		uriRev := ""
+		if branch.Name != "HEAD" {
+			uriRev = branch.Name
+		}
 		fileLimitHit := false
 		if len(file.LineMatches) > maxLineMatches {
 			file.LineMatches = file.LineMatches[:maxLineMatches]
 			fileLimitHit = true
 			limitHit = true
 		}
-		repoRev := repoMap[api.RepoName(strings.ToLower(string(file.Repository)))]
-		inputRev := repoRev.RevSpecs()[0]
 		baseURI := &gituri.URI{URL: url.URL{Scheme: "git://", Host: string(repoRev.Repo.Name), RawQuery: "?" + url.QueryEscape(inputRev)}}
 		lines := make([]*lineMatch, 0, len(file.LineMatches))
 		symbols := []*searchSymbolResult{}
@@ -217,7 +250,7 @@ func zoektSearchHEAD(ctx context.Context, args *search.TextParameters, repos []*
 					if isSymbol && m.SymbolInfo != nil {
 						commit := &GitCommitResolver{
 							repo:     &RepositoryResolver{repo: repoRev.Repo},
-							oid:      GitObjectID(repoRev.IndexedHEADCommit()),
+							oid:      GitObjectID(branch.Commit),
 							inputRev: &inputRev,
 						}
 
@@ -229,6 +262,7 @@ func zoektSearchHEAD(ctx context.Context, args *search.TextParameters, repos []*
 								ParentKind: m.SymbolInfo.ParentKind,
 								Path:       file.FileName,
 								Line:       l.LineNumber,
+								Language:   file.Language,
 							},
 							lang:    strings.ToLower(file.Language),
 							baseURI: baseURI,
@@ -237,28 +271,124 @@ func zoektSearchHEAD(ctx context.Context, args *search.TextParameters, repos []*
 					}
 				}
 				if !isSymbol {
-					lines = append(lines, &lineMatch{
+					lm := &lineMatch{
 						JPreview:          string(l.Line),
 						JLineNumber:       int32(l.LineNumber - 1),
 						JOffsetAndLengths: offsets,
-					})
+					}
+					if n := int(args.PatternInfo.ContextLines); n > 0 && file.Content != nil {
+						lm.JContextBefore, lm.JContextAfter = zoektContextLines(file.Content, l.LineNumber-1, n)
+					}
+					lines = append(lines, lm)
 				}
 			}
 		}
-		matches[i] = &FileMatchResolver{
+		matches = append(matches, &FileMatchResolver{
 			JPath:        file.FileName,
 			JLineMatches: lines,
 			JLimitHit:    fileLimitHit,
-			uri:          fileMatchURI(repoRev.Repo.Name, "", file.FileName),
+			uri:          fileMatchURI(repoRev.Repo.Name, uriRev, file.FileName),
 			symbols:      symbols,
+			zoektScore:   file.Score,
 			Repo:         repoRev.Repo,
-			CommitID:     repoRev.IndexedHEADCommit(),
-		}
+			CommitID:     branch.Commit,
+		})
 	}
 
 	return matches, limitHit, reposLimitHit, nil
 }
 
+// zoektContextLines returns the n lines before and after the line with the
+// 0-based number lineNumber of content.
+func zoektContextLines(content []byte, lineNumber, n int) (before, after []string) {
+	// A trailing newline ends the last line rather than starting an empty
+	// one.
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if lineNumber < 0 || lineNumber >= len(lines) {
+		return nil, nil
+	}
+	start := lineNumber - n
+	if start < 0 {
+		start = 0
+	}
+	end := lineNumber + 1 + n
+	if end > len(lines) {
+		end = len(lines)
+	}
+	return lines[start:lineNumber], lines[lineNumber+1 : end]
+}
+
+// zoektRepoBranchesQuery returns a query matching the repositories in
+// repoSet. Repositories which index more than their default branch are
+// restricted to the branches being searched (see
+// RepositoryRevisions.IndexedBranches), so repoSet is returned as is if there
+// are none.
+func zoektRepoBranchesQuery(repoSet *zoektquery.RepoSet, repoMap map[api.RepoName]*search.RepositoryRevisions) zoektquery.Q {
+	var (
+		branchQueries []zoektquery.Q
+		others        = &zoektquery.RepoSet{Set: make(map[string]bool, len(repoSet.Set))}
+	)
+	for name := range repoSet.Set {
+		repoRev, ok := repoMap[api.RepoName(strings.ToLower(name))]
+		if !ok || len(repoRev.IndexedBranches()) == 0 {
+			others.Set[name] = true
+			continue
+		}
+		var branches []zoektquery.Q
+		for _, branch := range repoRev.IndexedBranches() {
+			branches = append(branches, &zoektquery.Branch{Pattern: branch.Name})
+		}
+		branchQueries = append(branchQueries, zoektquery.NewAnd(
+			&zoektquery.RepoSet{Set: map[string]bool{name: true}},
+			zoektquery.NewOr(branches...),
+		))
+	}
+	if len(branchQueries) == 0 {
+		return repoSet
+	}
+	sort.Slice(branchQueries, func(i, j int) bool { return branchQueries[i].String() < branchQueries[j].String() })
+	return zoektquery.NewOr(append([]zoektquery.Q{others}, branchQueries...)...)
+}
+
+// zoektFileMatchRevision returns the revision of repoRev that a file match
+// returned by Zoekt is reported at: the input revision and the indexed
+// branch. A file which is identical on several of the branches being searched
+// is returned once by Zoekt, and is reported at the first of them. It returns
+// false if the file is not on any of the branches being searched.
+func zoektFileMatchRevision(repoRev *search.RepositoryRevisions, file *zoekt.FileMatch) (inputRev string, branch search.IndexedBranch, ok bool) {
+	branches := repoRev.IndexedBranches()
+	if len(branches) == 0 {
+		if revs := repoRev.RevSpecs(); len(revs) > 0 {
+			inputRev = revs[0]
+		}
+		return inputRev, search.IndexedBranch{Name: "HEAD", Commit: repoRev.IndexedHEADCommit()}, true
+	}
+
+	// Branch queries match branch names by substring, so the branches of the
+	// file need to be checked.
+	onBranch := make(map[string]bool, len(file.Branches))
+	for _, name := range file.Branches {
+		onBranch[name] = true
+	}
+	for _, b := range branches {
+		if !onBranch[b.Name] {
+			continue
+		}
+		if b.Name == "HEAD" {
+			// Report results on the default branch at the revision that was
+			// asked for, e.g. "" or an abbreviated commit SHA.
+			for _, r := range repoRev.Revs {
+				if r.RevSpec != "" && (r.RevSpec == "HEAD" || strings.HasPrefix(string(b.Commit), r.RevSpec)) {
+					return r.RevSpec, b, true
+				}
+			}
+			return "", b, true
+		}
+		return b.Name, b, true
+	}
+	return "", search.IndexedBranch{}, false
+}
+
 // createNewRepoSetWithRepoHasFileInputs mutates repoSet such that it accounts
 // for the `repohasfile` and `-repohasfile` flags that may have been passed in
 // the query. As a convenience it returns the mutated RepoSet.
@@ -377,12 +507,46 @@ func fileRe(pattern string, queryIsCaseSensitive bool) (zoektquery.Q, error) {
 	return parseRe(pattern, true, queryIsCaseSensitive)
 }
 
+// patternExpressionToZoektQuery translates a pattern expression into an
+// equivalent zoekt query, so that zoekt evaluates it per file.
+func patternExpressionToZoektQuery(node *search.PatternNode, fileNameOnly, queryIsCaseSensitive bool) (zoektquery.Q, error) {
+	if node.Op == "" {
+		return parseRe(node.Pattern, fileNameOnly, queryIsCaseSensitive)
+	}
+	operands := make([]zoektquery.Q, 0, len(node.Operands))
+	for _, operand := range node.Operands {
+		q, err := patternExpressionToZoektQuery(operand, fileNameOnly, queryIsCaseSensitive)
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, q)
+	}
+	switch node.Op {
+	case search.PatternOpAnd:
+		return zoektquery.NewAnd(operands...), nil
+	case search.PatternOpOr:
+		return zoektquery.NewOr(operands...), nil
+	case search.PatternOpNot:
+		if len(operands) != 1 {
+			return nil, fmt.Errorf("not expression must have exactly one operand, got %d", len(operands))
+		}
+		return &zoektquery.Not{Child: operands[0]}, nil
+	}
+	return nil, fmt.Errorf("unknown pattern expression operator %q", node.Op)
+}
+
 func queryToZoektQuery(query *search.TextPatternInfo, isSymbol bool) (zoektquery.Q, error) {
 	var and []zoektquery.Q
 
 	var q zoektquery.Q
 	var err error
-	if query.IsRegExp {
+	if query.PatternExpression != nil {
+		fileNameOnly := query.PatternMatchesPath && !query.PatternMatchesContent
+		q, err = patternExpressionToZoektQuery(query.PatternExpression, fileNameOnly, query.IsCaseSensitive)
+		if err != nil {
+			return nil, err
+		}
+	} else if query.IsRegExp {
 		fileNameOnly := query.PatternMatchesPath && !query.PatternMatchesContent
 		q, err = parseRe(query.Pattern, fileNameOnly, query.IsCaseSensitive)
 		if err != nil {
@@ -455,7 +619,8 @@ func zoektSingleIndexedRepo(ctx context.Context, z *searchbackend.Zoekt, rev *se
 
 	ctx, cancel := context.WithTimeout(ctx, time.Second)
 	defer cancel()
-	if len(rev.RevSpecs()) >= 2 || len(rev.RevSpecs()) != len(rev.Revs) {
+	configured := conf.Get().SearchIndexBranches[string(rev.Repo.Name)]
+	if len(configured) == 0 && (len(rev.RevSpecs()) >= 2 || len(rev.RevSpecs()) != len(rev.Revs)) {
 		// Zoekt only indexes 1 rev per repository, so it will not have the full results for the
 		// query on repositories for which multiple revs are searched.
 		return indexed, append(unindexed, rev), nil
@@ -478,6 +643,15 @@ func zoektSingleIndexedRepo(ctx context.Context, z *searchbackend.Zoekt, rev *se
 		}
 	}
 
+	if len(configured) > 0 {
+		branches, ok := zoektIndexedBranches(rev, repo, configured)
+		if !ok {
+			return indexed, append(unindexed, rev), nil
+		}
+		rev.SetIndexedBranches(branches)
+		return append(indexed, rev), unindexed, nil
+	}
+
 	if len(rev.Revs) == 1 {
 		revSpecToSearch := rev.Revs[0].RevSpec
 		if len(revSpecToSearch) > 0 && len(revSpecToSearch) < 4 {
@@ -512,7 +686,7 @@ func zoektIndexedRepos(ctx context.Context, z *searchbackend.Zoekt, revs []*sear
 	}
 
 	// Return early if we don't need to querying zoekt
-	if count == 0 {
+	if count == 0 && len(conf.Get().SearchIndexBranches) == 0 {
 		return nil, revs, nil
 	}
 
@@ -527,7 +701,8 @@ func zoektIndexedRepos(ctx context.Context, z *searchbackend.Zoekt, revs []*sear
 	unindexed = make([]*search.RepositoryRevisions, 0, len(revs)-count)
 
 	for _, rev := range revs {
-		if len(rev.RevSpecs()) >= 2 || len(rev.RevSpecs()) != len(rev.Revs) {
+		configured := conf.Get().SearchIndexBranches[string(rev.Repo.Name)]
+		if len(configured) == 0 && (len(rev.RevSpecs()) >= 2 || len(rev.RevSpecs()) != len(rev.Revs)) {
 			// Zoekt only indexes 1 rev per repository, so it will not have the full results for the
 			// query on repositories for which multiple revs are searched.
 			unindexed = append(unindexed, rev)
@@ -547,8 +722,108 @@ func zoektIndexedRepos(ctx context.Context, z *searchbackend.Zoekt, revs []*sear
 			}
 		}
 
+		if len(configured) > 0 {
+			branches, ok := zoektIndexedBranches(rev, repo, configured)
+			if !ok {
+				unindexed = append(unindexed, rev)
+				continue
+			}
+			rev.SetIndexedBranches(branches)
+		}
+
 		indexed = append(indexed, rev)
 	}
 
 	return indexed, unindexed, nil
 }
+
+// zoektIndexedBranches returns the branches of the indexed repository repo
+// to search for rev. It is used for repositories which are configured to
+// index more than their default branch (see "search.index.branches" in the
+// site configuration), in which case configured are the configured branch
+// patterns. It returns false if Zoekt does not have the full results for rev,
+// e.g. because rev refers to an arbitrary commit, to a glob which is not
+// configured to be indexed, or to a glob of a repository with more matching
+// branches than Zoekt indexes.
+func zoektIndexedBranches(rev *search.RepositoryRevisions, repo *zoekt.Repository, configured []string) ([]search.IndexedBranch, bool) {
+	commits := make(map[string]api.CommitID, len(repo.Branches))
+	for _, branch := range repo.Branches {
+		commits[branch.Name] = api.CommitID(branch.Version)
+	}
+
+	var (
+		branches []search.IndexedBranch
+		seen     = map[string]bool{}
+		globs    []git.RefGlob
+		includes = false
+	)
+	add := func(name string) bool {
+		commit, ok := commits[name]
+		if !ok {
+			return false
+		}
+		if !seen[name] {
+			seen[name] = true
+			branches = append(branches, search.IndexedBranch{Name: name, Commit: commit})
+		}
+		return true
+	}
+	for _, r := range rev.Revs {
+		switch {
+		case r.RefGlob != "":
+			if !isConfiguredBranchGlob(r.RefGlob, configured) {
+				return nil, false
+			}
+			globs = append(globs, git.RefGlob{Include: r.RefGlob})
+			includes = true
+		case r.ExcludeRefGlob != "":
+			globs = append(globs, git.RefGlob{Exclude: r.ExcludeRefGlob})
+		case r.RevSpec == "" || r.RevSpec == "HEAD":
+			if !add("HEAD") {
+				return nil, false
+			}
+		case len(r.RevSpec) >= 4 && strings.HasPrefix(string(commits["HEAD"]), r.RevSpec):
+			// An abbreviated commit SHA of the indexed HEAD.
+			if !add("HEAD") {
+				return nil, false
+			}
+		default:
+			if !add(r.RevSpec) {
+				return nil, false
+			}
+		}
+	}
+
+	if includes {
+		if len(repo.Branches) >= search.MaxIndexedBranches {
+			// The branches matching the globs beyond the limit are not
+			// indexed, so Zoekt cannot have the full results.
+			return nil, false
+		}
+		compiled, err := git.CompileRefGlobs(globs)
+		if err != nil {
+			return nil, false
+		}
+		for _, branch := range repo.Branches {
+			if branch.Name != "HEAD" && compiled.Match("refs/heads/"+branch.Name) {
+				add(branch.Name)
+			}
+		}
+	}
+	if len(branches) == 0 {
+		return nil, false
+	}
+	return branches, true
+}
+
+// isConfiguredBranchGlob reports whether the ref glob is one of the
+// configured branch patterns, e.g. "refs/heads/release/*" for "release/*".
+// Only then are all the branches matching it indexed.
+func isConfiguredBranchGlob(glob string, configured []string) bool {
+	for _, pattern := range configured {
+		if strings.ContainsAny(pattern, "*?[") && glob == "refs/heads/"+pattern {
+			return true
+		}
+	}
+	return false
+}
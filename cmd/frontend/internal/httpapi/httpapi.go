@@ -62,6 +62,11 @@ func NewHandler(m *mux.Router, schema *graphql.Schema, githubWebhook, bitbucketS
 
 	m.Get(apirouter.GraphQL).Handler(trace.TraceRoute(handler(serveGraphQL(schema))))
 
+	// The search stream is not wrapped in jsonMiddleware, since it writes
+	// Server-Sent Events and cannot report errors once streaming has started.
+	m.Get(apirouter.SearchStream).Handler(trace.TraceRoute(http.HandlerFunc(serveSearchStream)))
+	m.Get(apirouter.SearchExport).Handler(trace.TraceRoute(handler(serveSearchExport)))
+
 	if lsifServerProxy != nil {
 		m.Get(apirouter.LSIFUpload).Handler(trace.TraceRoute(lsifServerProxy.UploadHandler))
 	} else {
@@ -7,7 +7,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/google/zoekt"
 	"github.com/gorilla/mux"
 	"github.com/inconshreveable/log15"
 	"github.com/pkg/errors"
@@ -20,6 +22,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/gitserver"
 	"github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/jsonc"
+	"github.com/sourcegraph/sourcegraph/internal/search"
 	"github.com/sourcegraph/sourcegraph/internal/txemail"
 	"github.com/sourcegraph/sourcegraph/internal/vcs/git"
 )
@@ -136,14 +139,28 @@ func serveConfiguration(w http.ResponseWriter, r *http.Request) error {
 // Additionally, it only cares about certain search specific settings so this
 // search specific endpoint is used rather than serving the entire site settings
 // from /.internal/configuration.
+//
+// If the optional "repo" parameter is set, the branches of the repository to
+// index are included. They are only set if the repository is configured to
+// index more than its default branch.
 func serveSearchConfiguration(w http.ResponseWriter, r *http.Request) error {
 	opts := struct {
 		LargeFiles []string
 		Symbols    bool
+		Branches   []zoekt.RepositoryBranch `json:",omitempty"`
 	}{
 		LargeFiles: conf.Get().SearchLargeFiles,
 		Symbols:    conf.SymbolIndexEnabled(),
 	}
+	if repo := r.FormValue("repo"); repo != "" {
+		if patterns := conf.Get().SearchIndexBranches[repo]; len(patterns) > 0 {
+			branches, err := resolveIndexedBranches(r.Context(), api.RepoName(repo), patterns)
+			if err != nil {
+				return errors.Wrap(err, "resolve branches")
+			}
+			opts.Branches = branches
+		}
+	}
 	err := json.NewEncoder(w).Encode(opts)
 	if err != nil {
 		return errors.Wrap(err, "encode")
@@ -151,6 +168,45 @@ func serveSearchConfiguration(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// resolveIndexedBranches returns the branches of repo to index: its default
+// branch, named HEAD, and the branches matching the configured patterns.
+func resolveIndexedBranches(ctx context.Context, repo api.RepoName, patterns []string) ([]zoekt.RepositoryBranch, error) {
+	gitserverRepo := gitserver.Repo{Name: repo}
+	head, err := git.ResolveRevision(ctx, gitserverRepo, nil, "HEAD", &git.ResolveRevisionOptions{NoEnsureRevision: true})
+	if err != nil {
+		return nil, err
+	}
+
+	globs := make([]git.RefGlob, len(patterns))
+	for i, pattern := range patterns {
+		globs[i] = git.RefGlob{Include: "refs/heads/" + pattern}
+	}
+	compiled, err := git.CompileRefGlobs(globs)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := git.ListRefs(ctx, gitserverRepo)
+	if err != nil {
+		return nil, err
+	}
+
+	branches := []zoekt.RepositoryBranch{{Name: "HEAD", Version: string(head)}}
+	for _, ref := range refs {
+		if !strings.HasPrefix(ref.Name, "refs/heads/") || !compiled.Match(ref.Name) {
+			continue
+		}
+		if len(branches) == search.MaxIndexedBranches {
+			log15.Warn("Too many branches to index, ignoring the rest. Searches of the branch patterns use unindexed search.", "repo", repo, "max", search.MaxIndexedBranches)
+			break
+		}
+		branches = append(branches, zoekt.RepositoryBranch{
+			Name:    strings.TrimPrefix(ref.Name, "refs/heads/"),
+			Version: string(ref.CommitID),
+		})
+	}
+	return branches, nil
+}
+
 type reposListServer struct {
 	// SourcegraphDotComMode is true if this instance of Sourcegraph is http://sourcegraph.com
 	SourcegraphDotComMode bool
@@ -0,0 +1,41 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/backend"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/db"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/searchexport"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+	"github.com/sourcegraph/sourcegraph/internal/errcode"
+)
+
+// serveSearchExport serves the result file of a completed search export job.
+func serveSearchExport(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return &errcode.HTTPErr{Status: http.StatusNotFound, Err: err}
+	}
+	job, err := db.SearchExportJobs.GetByID(r.Context(), id)
+	if err != nil {
+		return err
+	}
+	// 🚨 SECURITY: Only the creator of the job and site admins may download
+	// its results.
+	if err := backend.CheckSiteAdminOrSameUser(r.Context(), job.UserID); err != nil {
+		return err
+	}
+	if job.State != types.SearchExportStateCompleted {
+		return &errcode.HTTPErr{
+			Status: http.StatusConflict,
+			Err:    fmt.Errorf("search export job %d is %s, not completed", job.ID, job.State),
+		}
+	}
+
+	w.Header().Set("Content-Type", searchexport.ResultFileContentType(job))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", searchexport.ResultFileName(job)))
+	return searchexport.WriteResultFile(r.Context(), w, job)
+}
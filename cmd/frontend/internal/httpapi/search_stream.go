@@ -0,0 +1,370 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/inconshreveable/log15"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/graphqlbackend"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/goroutine"
+)
+
+// serveSearchStream streams the results of a search as Server-Sent Events
+// (https://html.spec.whatwg.org/multipage/server-sent-events.html). Results
+// are sent as each search backend finishes instead of once the whole search
+// is done.
+//
+// The request takes the query parameters "q" (the query), "v" (the search
+// version, defaults to V2) and "t" (the pattern type). It sends the following
+// events, each with a JSON payload:
+//
+//   - filematches, symbolmatches, commitmatches, repomatches: new results
+//   - progress: the repositories searched so far and whether a limit was hit
+//   - alert: an alert for the search, e.g. a timeout or an invalid query
+//   - error: an error which ended the search
+//   - done: sent last, after which the server closes the stream
+func serveSearchStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "http flushing not supported", http.StatusInternalServerError)
+		return
+	}
+
+	args, err := parseSearchStreamArgs(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events := make(chan graphqlbackend.SearchEvent)
+	args.Stream = events
+	search, err := graphqlbackend.NewSearchImplementer(args)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	ew := &eventWriter{w: w, flush: flusher.Flush}
+
+	type searchResult struct {
+		results *graphqlbackend.SearchResultsResolver
+		err     error
+	}
+	done := make(chan searchResult, 1)
+	ctx := r.Context()
+	goroutine.Go(func() {
+		results, err := search.Results(ctx)
+		done <- searchResult{results: results, err: err}
+	})
+
+	// All events are sent before Results returns, so we read events until the
+	// search is done. Once writing to the client fails (e.g. because it went
+	// away) we keep draining events so that the search can finish.
+	progress := newSearchProgress()
+	for {
+		select {
+		case event := <-events:
+			progress.update(event)
+			if ew.err != nil {
+				continue
+			}
+			writeSearchEvent(ctx, ew, event)
+			ew.event("progress", progress)
+
+		case res := <-done:
+			if ew.err != nil {
+				return
+			}
+			if res.err != nil {
+				ew.event("error", streamError{Message: res.err.Error()})
+			} else if res.results != nil {
+				if alert := res.results.Alert(); alert != nil {
+					a := streamAlert{Title: alert.Title()}
+					if d := alert.Description(); d != nil {
+						a.Description = *d
+					}
+					if pqs := alert.ProposedQueries(); pqs != nil {
+						for _, pq := range *pqs {
+							var description string
+							if d := pq.Description(); d != nil {
+								description = *d
+							}
+							a.ProposedQueries = append(a.ProposedQueries, streamProposedQuery{
+								Description: description,
+								Query:       pq.Query(),
+							})
+						}
+					}
+					ew.event("alert", a)
+				}
+				progress.LimitHit = progress.LimitHit || res.results.LimitHit()
+				ew.event("progress", progress)
+			}
+			ew.event("done", map[string]interface{}{})
+			if ew.err != nil {
+				log15.Debug("search stream: failed to write event", "error", ew.err)
+			}
+			return
+		}
+	}
+}
+
+func parseSearchStreamArgs(r *http.Request) (*graphqlbackend.SearchArgs, error) {
+	q := r.URL.Query()
+	args := &graphqlbackend.SearchArgs{
+		Query:   q.Get("q"),
+		Version: q.Get("v"),
+	}
+	if args.Query == "" {
+		return nil, fmt.Errorf("no query found")
+	}
+	if args.Version == "" {
+		args.Version = "V2"
+	}
+	if t := q.Get("t"); t != "" {
+		args.PatternType = &t
+	}
+	return args, nil
+}
+
+// eventWriter writes Server-Sent Events to w. After the first error, all
+// further writes are skipped and the error is available in err.
+type eventWriter struct {
+	w     io.Writer
+	flush func()
+	err   error
+}
+
+func (e *eventWriter) event(name string, data interface{}) {
+	if e.err != nil {
+		return
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		e.err = err
+		return
+	}
+	if _, err := fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", name, b); err != nil {
+		e.err = err
+		return
+	}
+	e.flush()
+}
+
+// writeSearchEvent writes the results in event to ew, grouped by result type.
+func writeSearchEvent(ctx context.Context, ew *eventWriter, event graphqlbackend.SearchEvent) {
+	var (
+		files   []streamFileMatch
+		symbols []streamSymbolMatch
+		commits []streamCommitMatch
+		repos   []streamRepoMatch
+	)
+	for _, result := range event.Results {
+		if fm, ok := result.ToFileMatch(); ok {
+			syms := fm.Symbols()
+			if len(syms) == 0 || len(fm.LineMatches()) > 0 {
+				files = append(files, toStreamFileMatch(fm))
+			}
+			if len(syms) > 0 {
+				sm := streamSymbolMatch{
+					Repository: string(fm.Repo.Name),
+					Commit:     string(fm.CommitID),
+					Path:       fm.JPath,
+					Symbols:    make([]streamSymbol, 0, len(syms)),
+				}
+				for _, sym := range syms {
+					url, err := sym.URL(ctx)
+					if err != nil {
+						log15.Warn("search stream: failed to resolve symbol URL", "symbol", sym.Name(), "error", err)
+					}
+					var containerName string
+					if c := sym.ContainerName(); c != nil {
+						containerName = *c
+					}
+					sm.Symbols = append(sm.Symbols, streamSymbol{
+						URL:           url,
+						Name:          sym.Name(),
+						ContainerName: containerName,
+						Kind:          sym.Kind(),
+					})
+				}
+				symbols = append(symbols, sm)
+			}
+		} else if repo, ok := result.ToRepository(); ok {
+			repos = append(repos, streamRepoMatch{Repository: repo.Name()})
+		} else if commit, ok := result.ToCommitSearchResult(); ok {
+			cm := streamCommitMatch{
+				Icon:   commit.Icon(),
+				Label:  commit.Label().Text(),
+				URL:    commit.URL(),
+				Detail: commit.Detail().Text(),
+			}
+			for _, m := range commit.Matches() {
+				cm.Content = m.Body().Text()
+				for _, h := range m.Highlights() {
+					cm.Ranges = append(cm.Ranges, [3]int32{h.Line(), h.Character(), h.Length()})
+				}
+			}
+			commits = append(commits, cm)
+		}
+	}
+
+	if len(files) > 0 {
+		ew.event("filematches", files)
+	}
+	if len(symbols) > 0 {
+		ew.event("symbolmatches", symbols)
+	}
+	if len(commits) > 0 {
+		ew.event("commitmatches", commits)
+	}
+	if len(repos) > 0 {
+		ew.event("repomatches", repos)
+	}
+}
+
+func toStreamFileMatch(fm *graphqlbackend.FileMatchResolver) streamFileMatch {
+	lineMatches := make([]streamLineMatch, 0, len(fm.LineMatches()))
+	for _, lm := range fm.LineMatches() {
+		offsetAndLengths := make([][2]int32, 0, len(lm.OffsetAndLengths()))
+		for _, ol := range lm.OffsetAndLengths() {
+			offsetAndLengths = append(offsetAndLengths, [2]int32{ol[0], ol[1]})
+		}
+		lineMatches = append(lineMatches, streamLineMatch{
+			Line:             lm.Preview(),
+			LineNumber:       lm.LineNumber(),
+			OffsetAndLengths: offsetAndLengths,
+		})
+	}
+	var version string
+	if fm.InputRev != nil {
+		version = *fm.InputRev
+	}
+	return streamFileMatch{
+		Repository:  string(fm.Repo.Name),
+		Commit:      string(fm.CommitID),
+		Version:     version,
+		Path:        fm.JPath,
+		LineMatches: lineMatches,
+		LimitHit:    fm.LimitHit(),
+	}
+}
+
+// searchProgress is the payload of the progress event. It accumulates the
+// repositories reported by every event of a search.
+type searchProgress struct {
+	RepositoriesCount int      `json:"repositoriesCount"`
+	Searched          int      `json:"searched"`
+	Indexed           int      `json:"indexed"`
+	Cloning           []string `json:"cloning"`
+	Missing           []string `json:"missing"`
+	Timedout          []string `json:"timedout"`
+	LimitHit          bool     `json:"limitHit"`
+
+	repos, searched, indexed, cloning, missing, timedout map[string]struct{}
+}
+
+func newSearchProgress() *searchProgress {
+	return &searchProgress{
+		Cloning:  []string{},
+		Missing:  []string{},
+		Timedout: []string{},
+		repos:    map[string]struct{}{},
+		searched: map[string]struct{}{},
+		indexed:  map[string]struct{}{},
+		cloning:  map[string]struct{}{},
+		missing:  map[string]struct{}{},
+		timedout: map[string]struct{}{},
+	}
+}
+
+func (p *searchProgress) update(event graphqlbackend.SearchEvent) {
+	add := func(seen map[string]struct{}, repos []*graphqlbackend.RepositoryResolver, names *[]string) {
+		for _, repo := range repos {
+			name := repo.Name()
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			if names != nil {
+				*names = append(*names, name)
+			}
+		}
+	}
+	add(p.repos, event.Repositories(), nil)
+	add(p.searched, event.RepositoriesSearched(), nil)
+	add(p.indexed, event.IndexedRepositoriesSearched(), nil)
+	add(p.cloning, event.Cloning(), &p.Cloning)
+	add(p.missing, event.Missing(), &p.Missing)
+	add(p.timedout, event.Timedout(), &p.Timedout)
+	p.RepositoriesCount = len(p.repos)
+	p.Searched = len(p.searched)
+	p.Indexed = len(p.indexed)
+	p.LimitHit = p.LimitHit || event.LimitHit()
+}
+
+type streamFileMatch struct {
+	Repository  string            `json:"repository"`
+	Commit      string            `json:"commit,omitempty"`
+	Version     string            `json:"version,omitempty"`
+	Path        string            `json:"path"`
+	LineMatches []streamLineMatch `json:"lineMatches"`
+	LimitHit    bool              `json:"limitHit"`
+}
+
+type streamLineMatch struct {
+	Line             string     `json:"line"`
+	LineNumber       int32      `json:"lineNumber"`
+	OffsetAndLengths [][2]int32 `json:"offsetAndLengths"`
+}
+
+type streamSymbolMatch struct {
+	Repository string         `json:"repository"`
+	Commit     string         `json:"commit,omitempty"`
+	Path       string         `json:"path"`
+	Symbols    []streamSymbol `json:"symbols"`
+}
+
+type streamSymbol struct {
+	URL           string `json:"url"`
+	Name          string `json:"name"`
+	ContainerName string `json:"containerName"`
+	Kind          string `json:"kind"`
+}
+
+type streamCommitMatch struct {
+	Icon    string `json:"icon"`
+	Label   string `json:"label"`
+	URL     string `json:"url"`
+	Detail  string `json:"detail"`
+	Content string `json:"content"`
+	// Ranges is a list of (line, character, length) highlights in Content.
+	Ranges [][3]int32 `json:"ranges"`
+}
+
+type streamRepoMatch struct {
+	Repository string `json:"repository"`
+}
+
+type streamAlert struct {
+	Title           string                `json:"title"`
+	Description     string                `json:"description,omitempty"`
+	ProposedQueries []streamProposedQuery `json:"proposedQueries"`
+}
+
+type streamProposedQuery struct {
+	Description string `json:"description,omitempty"`
+	Query       string `json:"query"`
+}
+
+type streamError struct {
+	Message string `json:"message"`
+}
@@ -0,0 +1,52 @@
+package httpapi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEventWriter(t *testing.T) {
+	var buf bytes.Buffer
+	flushed := 0
+	ew := &eventWriter{w: &buf, flush: func() { flushed++ }}
+
+	ew.event("progress", map[string]int{"searched": 2})
+	ew.event("done", map[string]interface{}{})
+	if ew.err != nil {
+		t.Fatal(ew.err)
+	}
+
+	want := "event: progress\ndata: {\"searched\":2}\n\nevent: done\ndata: {}\n\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if flushed != 2 {
+		t.Errorf("got %d flushes, want 2", flushed)
+	}
+}
+
+func TestParseSearchStreamArgs(t *testing.T) {
+	r := httptest.NewRequest("GET", "/search/stream?q=foo&t=regexp", nil)
+	args, err := parseSearchStreamArgs(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args.Query != "foo" || args.Version != "V2" || args.PatternType == nil || *args.PatternType != "regexp" {
+		t.Errorf("unexpected args %+v", args)
+	}
+
+	r = httptest.NewRequest("GET", "/search/stream", nil)
+	if _, err := parseSearchStreamArgs(r); err == nil {
+		t.Error("expected error for missing query")
+	}
+}
+
+func TestServeSearchStream_NoQuery(t *testing.T) {
+	w := httptest.NewRecorder()
+	serveSearchStream(w, httptest.NewRequest("GET", "/search/stream", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,80 @@
+package searchexport
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/db"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/graphqlbackend"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+)
+
+// csvHeader is the header row of CSV result files. Keep it in sync with the
+// fields of graphqlbackend.SearchExportMatch.
+var csvHeader = []string{"repository", "commit", "path", "lineNumber", "preview", "symbol", "symbolKind"}
+
+// writeMatches writes matches to w in the given format. The CSV header row
+// is not written, since the output of each repository is written
+// separately.
+func writeMatches(w io.Writer, format string, matches []graphqlbackend.SearchExportMatch) error {
+	switch format {
+	case types.SearchExportFormatCSV:
+		cw := csv.NewWriter(w)
+		for _, m := range matches {
+			var lineNumber string
+			if m.LineNumber > 0 {
+				lineNumber = strconv.Itoa(int(m.LineNumber))
+			}
+			if err := cw.Write([]string{m.Repository, m.Commit, m.Path, lineNumber, m.Preview, m.Symbol, m.SymbolKind}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+
+	case types.SearchExportFormatJSONL:
+		enc := json.NewEncoder(w)
+		for _, m := range matches {
+			if err := enc.Encode(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown search export format %q", format)
+}
+
+// WriteResultFile writes the result file of job to w. It consists of the
+// output of each repository of the job, in order of the repository IDs.
+func WriteResultFile(ctx context.Context, w io.Writer, job *types.SearchExportJob) error {
+	if job.Format == types.SearchExportFormatCSV {
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	}
+
+	return db.SearchExportJobs.WriteRepoOutputs(ctx, job.ID, w)
+}
+
+// ResultFileName returns the file name to download the result file of job
+// as.
+func ResultFileName(job *types.SearchExportJob) string {
+	return fmt.Sprintf("search-export-%d.%s", job.ID, job.Format)
+}
+
+// ResultFileContentType returns the MIME type of the result file of job.
+func ResultFileContentType(job *types.SearchExportJob) string {
+	if job.Format == types.SearchExportFormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
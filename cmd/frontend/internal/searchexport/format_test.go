@@ -0,0 +1,70 @@
+package searchexport
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/db"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/graphqlbackend"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+)
+
+func TestWriteMatches(t *testing.T) {
+	matches := []graphqlbackend.SearchExportMatch{
+		{Repository: "r", Commit: "c", Path: "a.go", LineNumber: 2, Preview: `x, "y"`},
+		{Repository: "r"},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: types.SearchExportFormatCSV,
+			want:   "r,c,a.go,2,\"x, \"\"y\"\"\",,\nr,,,,,,\n",
+		},
+		{
+			format: types.SearchExportFormatJSONL,
+			want:   `{"repository":"r","commit":"c","path":"a.go","lineNumber":2,"preview":"x, \"y\""}` + "\n" + `{"repository":"r"}` + "\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeMatches(&buf, test.format, matches); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	if err := writeMatches(&bytes.Buffer{}, "xml", matches); err == nil {
+		t.Error("got nil error for unknown format")
+	}
+}
+
+func TestWriteResultFile(t *testing.T) {
+	defer func() { db.Mocks = db.MockStores{} }()
+
+	db.Mocks.SearchExportJobs.WriteRepoOutputs = func(_ context.Context, jobID int64, w io.Writer) error {
+		if jobID != 1 {
+			t.Errorf("got job %d, want 1", jobID)
+		}
+		_, err := io.WriteString(w, "x\ny\n")
+		return err
+	}
+
+	var buf bytes.Buffer
+	job := &types.SearchExportJob{ID: 1, Format: types.SearchExportFormatCSV}
+	if err := WriteResultFile(context.Background(), &buf, job); err != nil {
+		t.Fatal(err)
+	}
+	want := "repository,commit,path,lineNumber,preview,symbol,symbolKind\nx\ny\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,225 @@
+// Package searchexport implements the background worker of search export
+// jobs, which run a search query on every repository it matches and store
+// all of its matches in a downloadable file.
+package searchexport
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/db"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/graphqlbackend"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+	"github.com/sourcegraph/sourcegraph/internal/actor"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+const (
+	// pollInterval is how often an idle worker checks for queued jobs.
+	pollInterval = 10 * time.Second
+
+	// heartbeatInterval is how often a worker records that it is still
+	// processing a job.
+	heartbeatInterval = 30 * time.Second
+
+	// staleAfter is how long after the last heartbeat a processing job is
+	// considered abandoned, e.g. because its frontend restarted. Another
+	// worker then resumes it.
+	staleAfter = 5 * time.Minute
+
+	// heartbeatTimeout is how long a worker keeps processing a job while it
+	// fails to record heartbeats. It stops before the job becomes stale, so
+	// that the job is never processed by two workers at once.
+	heartbeatTimeout = staleAfter - 2*heartbeatInterval
+
+	// reposPageSize is the number of pending repositories loaded at a time.
+	reposPageSize = 100
+)
+
+// StartWorker should be invoked only after the DB has been initialized. It
+// starts the background worker which processes search export jobs. Every
+// frontend instance runs a worker, and each job is processed by one worker
+// at a time.
+//
+// It should be invoked in a separate goroutine.
+func StartWorker() {
+	ctx := context.Background()
+	for {
+		job, err := db.SearchExportJobs.Dequeue(ctx, staleAfter)
+		if err != nil {
+			log15.Error("search export: failed to dequeue job", "error", err)
+			time.Sleep(pollInterval)
+			continue
+		}
+		if job == nil {
+			time.Sleep(pollInterval)
+			continue
+		}
+
+		log15.Info("search export: processing job", "id", job.ID)
+		if err := process(ctx, job); err != nil {
+			// The job stays processing and is resumed once it is stale.
+			log15.Error("search export: failed to process job", "id", job.ID, "error", err)
+		}
+	}
+}
+
+// process searches the repositories of job which have not been searched
+// yet. The result of each repository is stored once it has been searched,
+// so that processing resumes with the next repository after a restart.
+func process(ctx context.Context, job *types.SearchExportJob) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go heartbeat(ctx, cancel, job)
+
+	// 🚨 SECURITY: Search with the permissions of the creator of the job.
+	ctx = actor.WithActor(ctx, actor.FromUser(job.UserID))
+
+	args := &graphqlbackend.SearchArgs{
+		Version:     "V2",
+		PatternType: &job.PatternType,
+		Query:       job.Query,
+	}
+
+	if job.ReposTotal == 0 {
+		repos, err := graphqlbackend.SearchExportRepositories(ctx, args)
+		if err != nil {
+			message := err.Error()
+			return db.SearchExportJobs.Finish(ctx, job.ID, job.Attempt, types.SearchExportStateErrored, &message)
+		}
+		if err := db.SearchExportJobs.AddRepos(ctx, job.ID, repos); err != nil {
+			return errors.Wrap(err, "adding repositories")
+		}
+	}
+
+	for {
+		repos, err := db.SearchExportJobs.ListRepos(ctx, job.ID, db.SearchExportJobReposListOptions{
+			State: types.SearchExportStateQueued,
+			Limit: reposPageSize,
+		})
+		if err != nil {
+			return errors.Wrap(err, "listing repositories")
+		}
+		if len(repos) == 0 {
+			break
+		}
+		for _, repo := range repos {
+			result := searchRepo(ctx, args, job.Format, repo)
+			if ctx.Err() != nil {
+				// The job was canceled.
+				return nil
+			}
+			ok, err := db.SearchExportJobs.FinishRepo(ctx, job.Attempt, result)
+			if err != nil {
+				return errors.Wrap(err, "storing repository results")
+			}
+			if !ok {
+				log15.Info("search export: job is no longer processed by this worker, stopping", "id", job.ID)
+				return nil
+			}
+		}
+	}
+
+	log15.Info("search export: completed job", "id", job.ID)
+	return db.SearchExportJobs.Finish(ctx, job.ID, job.Attempt, types.SearchExportStateCompleted, nil)
+}
+
+// heartbeat periodically records that the job is being processed until ctx
+// is done. It calls cancel if the job is no longer processed by this attempt,
+// e.g. because it was canceled, or if no heartbeat could be recorded for
+// heartbeatTimeout, since another worker may then resume the job.
+func heartbeat(ctx context.Context, cancel context.CancelFunc, job *types.SearchExportJob) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ok, err := db.SearchExportJobs.Heartbeat(ctx, job.ID, job.Attempt)
+			if err != nil {
+				log15.Warn("search export: failed to record heartbeat", "id", job.ID, "error", err)
+				if time.Since(last) > heartbeatTimeout {
+					log15.Error("search export: heartbeats failed for too long, stopping", "id", job.ID)
+					cancel()
+					return
+				}
+				continue
+			}
+			if !ok {
+				log15.Info("search export: job is no longer processed by this worker, stopping", "id", job.ID)
+				cancel()
+				return
+			}
+			last = time.Now()
+		}
+	}
+}
+
+// searchRepo searches a single repository of a job. Failures are recorded
+// in the returned result, so that they are reported per repository instead
+// of failing the job.
+func searchRepo(ctx context.Context, args *graphqlbackend.SearchArgs, format string, repo *types.SearchExportJobRepo) *types.SearchExportJobRepo {
+	result := &types.SearchExportJobRepo{
+		JobID:    repo.JobID,
+		RepoID:   repo.RepoID,
+		RepoName: repo.RepoName,
+		State:    types.SearchExportStateCompleted,
+	}
+	fail := func(message string) *types.SearchExportJobRepo {
+		result.State = types.SearchExportStateErrored
+		result.Error = &message
+		return result
+	}
+
+	rr, err := graphqlbackend.SearchExportRepository(ctx, args, &types.Repo{
+		ID:   api.RepoID(repo.RepoID),
+		Name: api.RepoName(repo.RepoName),
+	})
+	if err != nil {
+		return fail(err.Error())
+	}
+	matches, err := graphqlbackend.SearchExportMatches(ctx, rr.Results())
+	if err != nil {
+		return fail(err.Error())
+	}
+	var buf bytes.Buffer
+	if err := writeMatches(&buf, format, matches); err != nil {
+		return fail(err.Error())
+	}
+	result.Output = buf.String()
+	result.MatchCount = int32(len(matches))
+
+	if message := incompleteReason(rr); message != "" {
+		// Keep the matches that were found.
+		return fail(message)
+	}
+	return result
+}
+
+// incompleteReason returns why the results of a repository may be
+// incomplete, or "" if they are complete.
+func incompleteReason(rr *graphqlbackend.SearchResultsResolver) string {
+	var reasons []string
+	if alert := rr.Alert(); alert != nil {
+		reasons = append(reasons, alert.Title())
+	}
+	if len(rr.Missing()) > 0 {
+		reasons = append(reasons, "the repository or revision does not exist")
+	}
+	if len(rr.Cloning()) > 0 {
+		reasons = append(reasons, "the repository is being cloned")
+	}
+	if len(rr.Timedout()) > 0 {
+		reasons = append(reasons, "the search timed out")
+	}
+	if rr.LimitHit() {
+		reasons = append(reasons, "the result limit was hit")
+	}
+	return strings.Join(reasons, "; ")
+}
@@ -0,0 +1,54 @@
+package types
+
+import "time"
+
+// Formats of the result file of a search export job.
+const (
+	SearchExportFormatCSV   = "csv"
+	SearchExportFormatJSONL = "jsonl"
+)
+
+// States of a search export job and of the repositories it searches.
+const (
+	SearchExportStateQueued     = "queued"
+	SearchExportStateProcessing = "processing" // jobs only
+	SearchExportStateCompleted  = "completed"
+	SearchExportStateErrored    = "errored"
+	SearchExportStateCanceled   = "canceled" // jobs only
+)
+
+// SearchExportJob is a background job which runs a search query on every
+// repository it matches and stores all results in a downloadable file.
+type SearchExportJob struct {
+	ID             int64
+	UserID         int32  // the user who created the job; the search runs with their permissions
+	Query          string // the search query
+	PatternType    string // the pattern type of the query (literal, regexp or structural)
+	Format         string // SearchExportFormatCSV or SearchExportFormatJSONL
+	State          string
+	FailureMessage *string // if non-nil, the reason why the job errored
+	CreatedAt      time.Time
+	StartedAt      *time.Time
+	FinishedAt     *time.Time
+	HeartbeatAt    *time.Time // updated periodically while a worker processes the job
+	Attempt        int32      // incremented every time a worker starts processing the job
+
+	// Progress, computed from the repositories of the job.
+	ReposTotal     int32
+	ReposCompleted int32
+	ReposErrored   int32
+	MatchCount     int32
+}
+
+// SearchExportJobRepo is the checkpoint of a search export job for one
+// repository.
+type SearchExportJobRepo struct {
+	JobID      int64
+	RepoID     int32
+	RepoName   string
+	State      string
+	MatchCount int32
+	Output     string  // the results in the format of the job
+	Error      *string // if non-nil, the reason why searching the repository failed
+	FinishedAt *time.Time
+}
@@ -2,6 +2,7 @@
 package main // import "github.com/sourcegraph/sourcegraph/cmd/gitserver"
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
@@ -19,6 +20,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/cmd/gitserver/server"
 	"github.com/sourcegraph/sourcegraph/internal/debugserver"
 	"github.com/sourcegraph/sourcegraph/internal/env"
+	"github.com/sourcegraph/sourcegraph/internal/objectstore"
 	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
 	"github.com/sourcegraph/sourcegraph/internal/tracer"
 )
@@ -28,6 +30,11 @@ var (
 	runRepoCleanup, _ = strconv.ParseBool(env.Get("SRC_RUN_REPO_CLEANUP", "", "Periodically remove inactive repositories."))
 	wantPctFree       = env.Get("SRC_REPOS_DESIRED_PERCENT_FREE", "10", "Target percentage of free space on disk.")
 	janitorInterval   = env.Get("SRC_REPOS_JANITOR_INTERVAL", "1m", "Interval between cleanup runs")
+	hostname          = env.Get("SRC_GITSERVER_ADDR", "", "Address of this gitserver in the list of gitserver addresses. If set, repositories that belong on other gitservers are copied to them and then removed.")
+	rebalanceInterval = env.Get("SRC_GITSERVER_REBALANCE_INTERVAL", "1m", "Interval between runs that copy repositories to the gitservers they belong on")
+	bundleStoreURL    = env.Get("SRC_GITSERVER_BUNDLE_STORE_URL", "", "URL of the store of repository backups, either s3://bucket/prefix?endpoint=...&region=... or file:///path/to/dir. If set, repositories are backed up as git bundles and restored from them when they are cloned.")
+	backupInterval    = env.Get("SRC_GITSERVER_BACKUP_INTERVAL", "24h", "Interval between backups of the repositories that changed")
+	bundleMaxAge      = env.Get("SRC_GITSERVER_BUNDLE_MAX_AGE", "720h", "Age after which the backups of repositories that no gitserver has anymore are deleted. Must be more than twice SRC_GITSERVER_BACKUP_INTERVAL. 0 keeps them until their repository is deleted.")
 )
 
 func main() {
@@ -50,6 +57,30 @@ func main() {
 		ReposDir:                reposDir,
 		DeleteStaleRepositories: runRepoCleanup,
 		DesiredPercentFree:      wantPctFree2,
+		Hostname:                hostname,
+	}
+	backupInterval2, err := time.ParseDuration(backupInterval)
+	if err != nil {
+		log.Fatalf("parsing $SRC_GITSERVER_BACKUP_INTERVAL: %v", err)
+	}
+	if bundleStoreURL != "" {
+		bundleStore, err := objectstore.NewObjectStore(bundleStoreURL, ".bundle")
+		if err != nil {
+			log.Fatalf("parsing $SRC_GITSERVER_BUNDLE_STORE_URL: %v", err)
+		}
+		gitserver.BundleStore = bundleStore
+		if gitserver.BundleMaxAge, err = time.ParseDuration(bundleMaxAge); err != nil {
+			log.Fatalf("parsing $SRC_GITSERVER_BUNDLE_MAX_AGE: %v", err)
+		}
+		// Backups are refreshed every BundleMaxAge/2, and a refresh can be up
+		// to a backup interval late.
+		if gitserver.BundleMaxAge != 0 && gitserver.BundleMaxAge <= 2*backupInterval2 {
+			log.Fatalf("$SRC_GITSERVER_BUNDLE_MAX_AGE (%s) must be more than twice $SRC_GITSERVER_BACKUP_INTERVAL (%s)", gitserver.BundleMaxAge, backupInterval2)
+		}
+	}
+	if err := server.CheckPartialCloneSupport(context.Background()); err != nil {
+		log15.Warn("git-server: partial clones are disabled, repositories are cloned with all their blobs", "error", err)
+		gitserver.DisablePartialClones = true
 	}
 	gitserver.RegisterMetrics()
 
@@ -77,6 +108,24 @@ func main() {
 		}
 	}()
 
+	rebalanceInterval2, err := time.ParseDuration(rebalanceInterval)
+	if err != nil {
+		log.Fatalf("parsing $SRC_GITSERVER_REBALANCE_INTERVAL: %v", err)
+	}
+	go func() {
+		for {
+			gitserver.Rebalance()
+			time.Sleep(rebalanceInterval2)
+		}
+	}()
+
+	go func() {
+		for {
+			gitserver.BackupRepos()
+			time.Sleep(backupInterval2)
+		}
+	}()
+
 	port := "3178"
 	host := ""
 	if env.InsecureDev {
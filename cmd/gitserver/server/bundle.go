@@ -0,0 +1,269 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/objectstore"
+)
+
+func init() {
+	prometheus.MustRegister(reposBackedUp)
+	prometheus.MustRegister(reposRestored)
+	prometheus.MustRegister(backupsDeleted)
+}
+
+var reposBackedUp = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "src",
+	Subsystem: "gitserver",
+	Name:      "repos_backed_up",
+	Help:      "number of git bundles of repos written to the bundle store",
+})
+
+var reposRestored = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "src",
+	Subsystem: "gitserver",
+	Name:      "repos_restored",
+	Help:      "number of repos cloned from their git bundle in the bundle store",
+})
+
+var backupsDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "src",
+	Subsystem: "gitserver",
+	Name:      "repo_backups_deleted",
+	Help:      "number of git bundles deleted from the bundle store because their repo was deleted or they expired",
+})
+
+// bundleKey returns the key of the backup of repo in the bundle store.
+func bundleKey(repo api.RepoName) string {
+	sum := sha256.Sum256([]byte(protocol.NormalizeRepo(repo)))
+	return hex.EncodeToString(sum[:])
+}
+
+// BackupRepos writes a git bundle of each repo in s.ReposDir whose refs
+// changed since its last backup to s.BundleStore. It replaces the previous
+// backup of the repo. Afterwards, it deletes the backups older than
+// s.BundleMaxAge, see backupRepo.
+func (s *Server) BackupRepos() {
+	if s.BundleStore == nil {
+		return
+	}
+	ctx, cancel := s.serverContext()
+	defer cancel()
+	client := s.gitServerClient()
+
+	err := bestEffortWalk(s.ReposDir, func(dir string, fi os.FileInfo) error {
+		if s.ignorePath(dir) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Look for $GIT_DIR
+		if !fi.IsDir() || fi.Name() != ".git" {
+			return nil
+		}
+
+		// Every replica of a repo has the same backup, so only the primary
+		// writes it.
+		if s.isReplicated(ctx, client) && client.AddrForRepo(ctx, s.name(GitDir(dir))) != s.Hostname {
+			return filepath.SkipDir
+		}
+
+		if err := s.backupRepo(ctx, GitDir(dir), false); err != nil {
+			log15.Error("failed to back up repo", "repo", dir, "error", err)
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		log15.Error("backup: error iterating over repositories", "error", err)
+		return
+	}
+
+	if s.BundleMaxAge > 0 {
+		stats, err := objectstore.EvictObjects(ctx, s.BundleStore, s.BundleMaxAge, 0)
+		if err != nil {
+			log15.Error("backup: failed to delete expired backups", "error", err)
+		}
+		backupsDeleted.Add(float64(stats.Evicted))
+	}
+}
+
+// backupRepo writes a git bundle of the repo at dir to s.BundleStore, unless
+// its refs did not change since its last backup and force is false. If
+// s.BundleMaxAge is set, the backup is rewritten when it is older than half
+// of it even if the refs did not change, so that only the backups of repos
+// that no gitserver has anymore expire.
+func (s *Server) backupRepo(ctx context.Context, dir GitDir, force bool) error {
+	// Partial and shallow clones lack objects that a bundle needs. They are
+	// cloned from the code host instead of being restored from a backup.
+	partial, err := loadCloneOptions(dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to load clone options")
+	}
+	if partial != nil {
+		if force {
+			return errors.New("partial and shallow clones are not backed up")
+		}
+		return nil
+	}
+
+	refHash, err := computeRefHash(dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to compute ref hash")
+	}
+	if !force {
+		last, err := gitConfigGet(dir, "sourcegraph.backupRefHash")
+		if err != nil {
+			return err
+		}
+		lastTime, err := gitConfigGet(dir, "sourcegraph.backupTime")
+		if err != nil {
+			return err
+		}
+		backupTime, _ := strconv.ParseInt(strings.TrimSpace(lastTime), 10, 64)
+		fresh := s.BundleMaxAge <= 0 || time.Since(time.Unix(backupTime, 0)) < s.BundleMaxAge/2
+		if strings.TrimSpace(last) == string(refHash) && fresh {
+			return nil
+		}
+	}
+
+	tmp, err := s.tempDir("bundle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	bundlePath := filepath.Join(tmp, "repo.bundle")
+
+	cmd := exec.CommandContext(ctx, "git", "bundle", "create", bundlePath, "--all")
+	cmd.Dir = string(dir)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		// There is nothing to back up in an empty repo.
+		if bytes.Contains(output, []byte("empty bundle")) {
+			return nil
+		}
+		return errors.Wrapf(err, "git bundle failed. Output: %s", string(output))
+	}
+
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := s.BundleStore.Put(ctx, bundleKey(s.name(dir)), f); err != nil {
+		return errors.Wrap(err, "failed to store git bundle")
+	}
+	reposBackedUp.Inc()
+
+	if err := gitConfigSet(dir, "sourcegraph.backupTime", strconv.FormatInt(time.Now().Unix(), 10)); err != nil {
+		return err
+	}
+	return gitConfigSet(dir, "sourcegraph.backupRefHash", string(refHash))
+}
+
+// deleteBackup deletes the backup of repo from s.BundleStore, if there is
+// one. It is called when the repo is deleted.
+func (s *Server) deleteBackup(ctx context.Context, repo api.RepoName) error {
+	if s.BundleStore == nil {
+		return nil
+	}
+	if err := s.BundleStore.Delete(ctx, bundleKey(repo)); err != nil {
+		return errors.Wrap(err, "failed to delete git bundle")
+	}
+	backupsDeleted.Inc()
+	return nil
+}
+
+// restoreBundle clones repo from its latest backup in s.BundleStore to
+// tmpPath, and then fetches the changes since the backup from url. It
+// returns false if there is no backup of repo.
+func (s *Server) restoreBundle(ctx context.Context, repo api.RepoName, url, tmpPath string) (bool, error) {
+	rc, err := s.BundleStore.Get(ctx, bundleKey(repo))
+	if err == objectstore.ErrObjectNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get git bundle")
+	}
+	defer rc.Close()
+
+	// tmpPath is in a temporary directory of its own.
+	bundlePath := filepath.Join(filepath.Dir(tmpPath), "repo.bundle")
+	defer os.Remove(bundlePath)
+	f, err := os.Create(bundlePath)
+	if err != nil {
+		return false, err
+	}
+	_, err = io.Copy(f, rc)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed to download git bundle")
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "clone", "--mirror", bundlePath, tmpPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return false, errors.Wrapf(err, "failed to clone git bundle. Output: %s", string(output))
+	}
+
+	cmd = exec.CommandContext(ctx, "git", "remote", "set-url", "origin", "--", url)
+	cmd.Dir = tmpPath
+	if _, err := runCommand(ctx, cmd); err != nil {
+		return false, errors.Wrap(err, "failed to set remote URL")
+	}
+
+	cmd, configRemoteOpts := fetchCmd(ctx, url, nil)
+	cmd.Dir = tmpPath
+	if output, err := runWith(ctx, cmd, configRemoteOpts, nil); err != nil {
+		return false, errors.Wrapf(err, "failed to fetch the changes since the backup. Output: %s", string(output))
+	}
+
+	log15.Info("restored repo from backup", "repo", repo)
+	reposRestored.Inc()
+	return true, nil
+}
+
+// handleRepoBackup backs up a repo to the bundle store now, regardless of
+// whether it changed since its last backup.
+func (s *Server) handleRepoBackup(w http.ResponseWriter, r *http.Request) {
+	var req protocol.RepoBackupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.BundleStore == nil {
+		http.Error(w, "no bundle store is configured", http.StatusNotImplemented)
+		return
+	}
+	dir := s.dir(req.Repo)
+	if !repoCloned(dir) {
+		http.Error(w, "repository not found", http.StatusNotFound)
+		return
+	}
+	if err := s.backupRepo(r.Context(), dir, true); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
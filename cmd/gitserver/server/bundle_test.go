@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/mutablelimiter"
+	"github.com/sourcegraph/sourcegraph/internal/objectstore"
+)
+
+// countingObjectStore counts the calls to Get and Put of an ObjectStore.
+type countingObjectStore struct {
+	objectstore.ObjectStore
+	gets, puts int
+}
+
+func (s *countingObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.gets++
+	return s.ObjectStore.Get(ctx, key)
+}
+
+func (s *countingObjectStore) Put(ctx context.Context, key string, r io.ReadSeeker) error {
+	s.puts++
+	return s.ObjectStore.Put(ctx, key, r)
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	remote, cleanup1 := tmpDir(t)
+	defer cleanup1()
+	git := func(dir string, arg ...string) string {
+		t.Helper()
+		c := exec.Command("git", arg...)
+		c.Dir = dir
+		c.Env = append(os.Environ(),
+			"GIT_COMMITTER_NAME=a",
+			"GIT_COMMITTER_EMAIL=a@a.com",
+			"GIT_AUTHOR_NAME=a",
+			"GIT_AUTHOR_EMAIL=a@a.com",
+		)
+		b, err := c.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s failed: %s\n%s", strings.Join(arg, " "), err, b)
+		}
+		return strings.TrimSpace(string(b))
+	}
+	git(remote, "init", ".")
+	git(remote, "commit", "--allow-empty", "-m", "first")
+
+	reposDir, cleanup2 := tmpDir(t)
+	defer cleanup2()
+	bundleDir, cleanup3 := tmpDir(t)
+	defer cleanup3()
+	bundleStore := &countingObjectStore{ObjectStore: &objectstore.DirObjectStore{Dir: bundleDir, Ext: ".bundle"}}
+	s := &Server{
+		ReposDir:         reposDir,
+		BundleStore:      bundleStore,
+		ctx:              context.Background(),
+		locker:           &RepositoryLocker{},
+		cloneLimiter:     mutablelimiter.New(1),
+		cloneableLimiter: mutablelimiter.New(1),
+	}
+
+	const repo = "example.com/foo/bar"
+	dir := s.dir(repo)
+	clone := func() {
+		t.Helper()
+		if _, err := s.cloneRepo(context.Background(), repo, remote, &cloneOptions{Block: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clone()
+	if bundleStore.gets != 1 {
+		t.Errorf("got %d bundle store gets, want 1", bundleStore.gets)
+	}
+
+	// Only repos that changed since their last backup are backed up.
+	s.BackupRepos()
+	s.BackupRepos()
+	if bundleStore.puts != 1 {
+		t.Fatalf("got %d bundle store puts, want 1", bundleStore.puts)
+	}
+
+	// A repo is restored from its backup, and then the changes since the
+	// backup are fetched from the remote.
+	git(remote, "commit", "--allow-empty", "-m", "second")
+	wantCommit := git(remote, "rev-parse", "HEAD")
+	if err := os.RemoveAll(filepath.Dir(string(dir))); err != nil {
+		t.Fatal(err)
+	}
+	clone()
+	if bundleStore.gets != 2 {
+		t.Errorf("got %d bundle store gets, want 2", bundleStore.gets)
+	}
+	if got := git(string(dir), "rev-parse", "HEAD"); got != wantCommit {
+		t.Errorf("got commit %s after restoring, want %s", got, wantCommit)
+	}
+	if got := git(string(dir), "config", "remote.origin.url"); got != remote {
+		t.Errorf("got remote URL %q after restoring, want %q", got, remote)
+	}
+
+	// A repo with a bad backup is cloned from the remote.
+	if err := bundleStore.Put(context.Background(), bundleKey(repo), strings.NewReader("not a bundle")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Dir(string(dir))); err != nil {
+		t.Fatal(err)
+	}
+	clone()
+	if got := git(string(dir), "rev-parse", "HEAD"); got != wantCommit {
+		t.Errorf("got commit %s after cloning, want %s", got, wantCommit)
+	}
+}
+
+func TestBackupRepos_retention(t *testing.T) {
+	remote, cleanup1 := tmpDir(t)
+	defer cleanup1()
+	for _, args := range [][]string{{"init", "."}, {"-c", "user.name=a", "-c", "user.email=a@a.com", "commit", "--allow-empty", "-m", "first"}} {
+		c := exec.Command("git", args...)
+		c.Dir = remote
+		if out, err := c.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %s\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	reposDir, cleanup2 := tmpDir(t)
+	defer cleanup2()
+	bundleDir, cleanup3 := tmpDir(t)
+	defer cleanup3()
+	dirStore := &objectstore.DirObjectStore{Dir: bundleDir, Ext: ".bundle"}
+	bundleStore := &countingObjectStore{ObjectStore: dirStore}
+	s := &Server{
+		ReposDir:         reposDir,
+		BundleStore:      bundleStore,
+		BundleMaxAge:     30 * 24 * time.Hour,
+		ctx:              context.Background(),
+		locker:           &RepositoryLocker{},
+		cloneLimiter:     mutablelimiter.New(1),
+		cloneableLimiter: mutablelimiter.New(1),
+	}
+
+	const repo = "example.com/foo/bar"
+	if _, err := s.cloneRepo(context.Background(), repo, remote, &cloneOptions{Block: true}); err != nil {
+		t.Fatal(err)
+	}
+	s.BackupRepos()
+	if bundleStore.puts != 1 {
+		t.Fatalf("got %d bundle store puts, want 1", bundleStore.puts)
+	}
+
+	// The backup of a repo that no gitserver has anymore expires, and the
+	// backup of a repo that did not change is rewritten before it expires.
+	const goneRepo = "example.com/foo/gone"
+	if err := bundleStore.Put(context.Background(), bundleKey(goneRepo), strings.NewReader("bundle")); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-s.BundleMaxAge - time.Hour)
+	for _, r := range []api.RepoName{repo, goneRepo} {
+		if err := os.Chtimes(filepath.Join(bundleDir, bundleKey(r)+".bundle"), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := gitConfigSet(s.dir(repo), "sourcegraph.backupTime", strconv.FormatInt(old.Unix(), 10)); err != nil {
+		t.Fatal(err)
+	}
+	s.BackupRepos()
+	if bundleStore.puts != 3 {
+		t.Errorf("got %d bundle store puts, want 3", bundleStore.puts)
+	}
+	objects, err := dirStore.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Key != bundleKey(repo) {
+		t.Errorf("got backups %+v, want only the backup of %s", objects, repo)
+	}
+
+	// Only the primary replica of a repo backs it up.
+	s.Hostname = "gitserver-1"
+	s.GitServerClient = &gitserver.Client{Addrs: func(context.Context) []string { return []string{"gitserver-0", "gitserver-1"} }}
+	if s.GitServerClient.AddrForRepo(context.Background(), repo) == s.Hostname {
+		s.Hostname = "gitserver-0"
+	}
+	if err := gitConfigSet(s.dir(repo), "sourcegraph.backupRefHash", ""); err != nil {
+		t.Fatal(err)
+	}
+	s.BackupRepos()
+	if bundleStore.puts != 3 {
+		t.Errorf("got %d bundle store puts on a secondary replica, want 3", bundleStore.puts)
+	}
+
+	// Deleting a repo deletes its backup.
+	if err := s.deleteRepo(context.Background(), repo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dirStore.Get(context.Background(), bundleKey(repo)); err != objectstore.ErrObjectNotFound {
+		t.Errorf("got error %v getting the backup of a deleted repo, want %v", err, objectstore.ErrObjectNotFound)
+	}
+}
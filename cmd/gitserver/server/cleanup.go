@@ -56,13 +56,17 @@ var reposRecloned = prometheus.NewCounter(prometheus.CounterOpts{
 // cleanupRepos walks the repos directory and performs maintenance tasks:
 //
 // 1. Remove corrupt repos.
-// 2. Remove stale lock files.
-// 3. Remove inactive repos on sourcegraph.com
-// 4. Reclone repos after a while. (simulate git gc)
+// 2. Remove repos that belong on other gitservers.
+// 3. Remove stale lock files.
+// 4. Remove inactive repos on sourcegraph.com
+// 5. Reclone repos after a while. (simulate git gc)
 func (s *Server) cleanupRepos() {
 	bCtx, bCancel := s.serverContext()
 	defer bCancel()
 
+	client := s.gitServerClient()
+	reconcileReplicas := s.isReplicated(bCtx, client)
+
 	maybeRemoveCorrupt := func(dir GitDir) (done bool, err error) {
 		// We treat repositories missing HEAD to be corrupt. Both our cloning
 		// and fetching ensure there is a HEAD file.
@@ -79,6 +83,37 @@ func (s *Server) cleanupRepos() {
 		return true, nil
 	}
 
+	// maybeRemoveMisplaced removes repos that this gitserver is not a replica
+	// of, for example after gitservers were added or the replication factor
+	// was lowered. A repo is only removed once one of its replicas has cloned
+	// it, so that it stays available. Rebalance copies the repo to the
+	// replicas, and repo updates are sent to every replica, which clone the
+	// repos they are missing.
+	maybeRemoveMisplaced := func(dir GitDir) (done bool, err error) {
+		if !reconcileReplicas {
+			return false, nil
+		}
+		repo := s.name(dir)
+		replicas := client.AddrsForRepo(bCtx, repo)
+		if containsString(replicas, s.Hostname) {
+			return false, nil
+		}
+
+		for _, addr := range replicas {
+			cloned, err := client.IsRepoClonedOn(bCtx, addr, repo)
+			if err != nil || !cloned {
+				continue
+			}
+			log15.Info("removing misplaced repo", "repo", repo, "replica", addr)
+			if err := s.removeRepoDirectory(dir); err != nil {
+				return true, err
+			}
+			reposRemoved.Inc()
+			return true, nil
+		}
+		return false, nil
+	}
+
 	ensureGitAttributes := func(dir GitDir) (done bool, err error) {
 		return false, setGitAttributes(dir)
 	}
@@ -129,7 +164,13 @@ func (s *Server) cleanupRepos() {
 			return false, errors.Wrap(err, "failed to get remote URL")
 		}
 
-		if _, err := s.cloneRepo(ctx, repo, remoteURL, &cloneOptions{Block: true, Overwrite: true}); err != nil {
+		// Keep cloning the repo the way it was cloned.
+		partial, err := loadCloneOptions(dir)
+		if err != nil {
+			return false, errors.Wrap(err, "failed to load clone options")
+		}
+
+		if _, err := s.cloneRepo(ctx, repo, remoteURL, &cloneOptions{Block: true, Overwrite: true, Partial: partial}); err != nil {
 			return true, err
 		}
 		reposRecloned.Inc()
@@ -176,6 +217,8 @@ func (s *Server) cleanupRepos() {
 	cleanups := []cleanupFn{
 		// Do some sanity checks on the repository.
 		{"maybe remove corrupt", maybeRemoveCorrupt},
+		// Remove repos that belong on other gitservers.
+		{"maybe remove misplaced", maybeRemoveMisplaced},
 		// If git is interrupted it can leave lock files lying around. It does
 		// not clean these up, and instead fails commands.
 		{"remove stale locks", removeStaleLocks},
@@ -232,6 +275,15 @@ func (s *Server) cleanupRepos() {
 	}
 }
 
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 // DiskSizer gets information about disk size and free space.
 type DiskSizer interface {
 	BytesFreeOnDisk(mountPoint string) (uint64, error)
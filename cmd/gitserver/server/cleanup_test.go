@@ -2,9 +2,12 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"os/exec"
 	"path"
@@ -16,6 +19,10 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/httpcli"
 )
 
 const (
@@ -624,3 +631,77 @@ func TestJitterDuration(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestCleanupMisplaced(t *testing.T) {
+	root, err := ioutil.TempDir("", "gitserver-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	addrs := []string{"gitserver-0", "gitserver-1", "gitserver-2"}
+	client := &gitserver.Client{
+		Addrs:             func(context.Context) []string { return addrs },
+		ReplicationFactor: 2,
+		HTTPClient: httpcli.DoerFunc(func(r *http.Request) (*http.Response, error) {
+			var req protocol.IsRepoClonedRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				return nil, err
+			}
+			// Only repo-cloned-elsewhere is cloned on the other gitservers.
+			status := http.StatusNotFound
+			if strings.HasPrefix(string(req.Repo), "repo-cloned-elsewhere") {
+				status = http.StatusOK
+			}
+			return &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}),
+	}
+
+	// Find repo names that gitserver-0 is and is not a replica of.
+	name := func(prefix string, replica bool) string {
+		for i := 0; ; i++ {
+			name := fmt.Sprintf("%s-%d", prefix, i)
+			isReplica := false
+			for _, addr := range client.AddrsForRepo(context.Background(), api.RepoName(name)) {
+				isReplica = isReplica || addr == "gitserver-0"
+			}
+			if isReplica == replica {
+				return name
+			}
+		}
+	}
+	repoMine := path.Join(root, name("repo-mine", true), ".git")
+	repoClonedElsewhere := path.Join(root, name("repo-cloned-elsewhere", false), ".git")
+	repoNotClonedElsewhere := path.Join(root, name("repo-not-cloned-elsewhere", false), ".git")
+	for _, path := range []string{repoMine, repoClonedElsewhere, repoNotClonedElsewhere} {
+		cmd := exec.Command("git", "--bare", "init", path)
+		if err := cmd.Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &Server{ReposDir: root, Hostname: "gitserver-0", GitServerClient: client}
+	s.Handler() // Handler as a side-effect sets up Server
+	s.cleanupRepos()
+
+	if _, err := os.Stat(repoMine); err != nil {
+		t.Error("expected repo-mine not to be removed")
+	}
+	if _, err := os.Stat(repoClonedElsewhere); !os.IsNotExist(err) {
+		t.Error("expected repo-cloned-elsewhere to be removed")
+	}
+	if _, err := os.Stat(repoNotClonedElsewhere); err != nil {
+		t.Error("expected repo-not-cloned-elsewhere not to be removed until a replica has cloned it")
+	}
+
+	// Nothing is removed if this gitserver is not in the list of addresses.
+	if err := exec.Command("git", "--bare", "init", repoClonedElsewhere).Run(); err != nil {
+		t.Fatal(err)
+	}
+	s = &Server{ReposDir: root, Hostname: "gitserver-3", GitServerClient: client}
+	s.Handler()
+	s.cleanupRepos()
+	if _, err := os.Stat(repoClonedElsewhere); err != nil {
+		t.Error("expected repo-cloned-elsewhere not to be removed by an unknown gitserver")
+	}
+}
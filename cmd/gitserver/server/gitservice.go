@@ -0,0 +1,126 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+// handleGitService serves the repos over the read-only smart HTTP protocol
+// of git, so that gitservers can copy repos from each other when they are
+// rebalanced. The URL of a repo is http://gitserver/git/${name}.
+//
+// Only git-upload-pack (fetch and clone) is supported, and only for the
+// other gitservers, since it bypasses the permissions of repos.
+func (s *Server) handleGitService(w http.ResponseWriter, r *http.Request) {
+	if !s.isPeer(r.Context(), r.RemoteAddr) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/git/")
+
+	var name string
+	var advertise bool
+	switch {
+	case r.Method == "GET" && strings.HasSuffix(path, "/info/refs"):
+		if service := r.URL.Query().Get("service"); service != "git-upload-pack" {
+			http.Error(w, fmt.Sprintf("unsupported service %q", service), http.StatusForbidden)
+			return
+		}
+		name = strings.TrimSuffix(path, "/info/refs")
+		advertise = true
+	case r.Method == "POST" && strings.HasSuffix(path, "/git-upload-pack"):
+		name = strings.TrimSuffix(path, "/git-upload-pack")
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	repo := api.RepoName(strings.TrimSuffix(name, "/.git"))
+	dir := s.dir(repo)
+	if !strings.HasPrefix(string(dir), filepath.Clean(s.ReposDir)+string(filepath.Separator)) || !repoCloned(dir) {
+		http.Error(w, "repository not found", http.StatusNotFound)
+		return
+	}
+
+	args := []string{"upload-pack", "--stateless-rpc"}
+	if advertise {
+		args = append(args, "--advertise-refs")
+	}
+	cmd := exec.CommandContext(r.Context(), "git", append(args, string(dir))...)
+	cmd.Stdout = w
+
+	if advertise {
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, pktLine("# service=git-upload-pack\n")+"0000")
+	} else {
+		body := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer gr.Close()
+			body = gr
+		}
+		cmd.Stdin = body
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if _, err := runCommand(r.Context(), cmd); err != nil {
+		log15.Error("git upload-pack failed", "repo", repo, "error", err)
+	}
+}
+
+// pktLine returns s in the pkt-line format of the git protocol: prefixed
+// with its length, including the prefix, as 4 hexadecimal digits.
+func pktLine(s string) string {
+	return fmt.Sprintf("%04x%s", len(s)+4, s)
+}
+
+// isPeer reports whether remoteAddr, the address that a request came from,
+// is the address of one of the gitservers. The addresses are resolved for
+// every request, but gitservers only request repos from each other when
+// they are rebalanced.
+func (s *Server) isPeer(ctx context.Context, remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, addr := range s.gitServerClient().Addrs(ctx) {
+		peerHost, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			peerHost = addr
+		}
+		peerIPs, err := net.DefaultResolver.LookupIPAddr(ctx, peerHost)
+		if err != nil {
+			log15.Warn("failed to resolve gitserver address", "addr", addr, "error", err)
+			continue
+		}
+		for _, peerIP := range peerIPs {
+			if peerIP.IP.Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,6 +2,8 @@ package server
 
 import (
 	"sync"
+
+	"github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
 )
 
 // RepositoryLocker provides locks for doing operations to a repository
@@ -16,11 +18,14 @@ import (
 // The main use of RepositoryLocker is to prevent concurrent clones. However,
 // it is also used during maintenance tasks such as recloning/migrating/etc.
 type RepositoryLocker struct {
-	// mu protects status
+	// mu protects status and progress
 	mu sync.Mutex
 	// status tracks directories that are locked. The value is the status. If
 	// a directory is in status, the directory is locked.
 	status map[GitDir]string
+	// progress is the structured progress of the clones of locked
+	// directories, if they report any.
+	progress map[GitDir]protocol.CloneProgress
 }
 
 // TryAcquire acquires the lock for dir. If it is already held, ok is false
@@ -56,6 +61,27 @@ func (rl *RepositoryLocker) Status(dir GitDir) (status string, locked bool) {
 	return
 }
 
+// Progress returns the structured progress of the clone of the locked
+// directory dir. If dir is not locked or reported no progress, ok is false.
+func (rl *RepositoryLocker) Progress(dir GitDir) (progress protocol.CloneProgress, ok bool) {
+	rl.mu.Lock()
+	progress, ok = rl.progress[dir]
+	rl.mu.Unlock()
+	return
+}
+
+// AllProgress returns the structured progress of the clones of all locked
+// directories that reported progress.
+func (rl *RepositoryLocker) AllProgress() map[GitDir]protocol.CloneProgress {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	all := make(map[GitDir]protocol.CloneProgress, len(rl.progress))
+	for dir, progress := range rl.progress {
+		all[dir] = progress
+	}
+	return all
+}
+
 // RepositoryLock is returned by RepositoryLocker.TryAcquire. It allows
 // updating the status of a directory lock, as well as releasing the lock.
 type RepositoryLock struct {
@@ -77,12 +103,26 @@ func (l *RepositoryLock) SetStatus(status string) {
 	l.locker.mu.Unlock()
 }
 
+// SetProgress updates the structured progress for the lock. If the lock has
+// been released, this is a noop.
+func (l *RepositoryLock) SetProgress(progress protocol.CloneProgress) {
+	l.locker.mu.Lock()
+	if !l.done {
+		if l.locker.progress == nil {
+			l.locker.progress = make(map[GitDir]protocol.CloneProgress)
+		}
+		l.locker.progress[l.dir] = progress
+	}
+	l.locker.mu.Unlock()
+}
+
 // Release releases the lock.
 func (l *RepositoryLock) Release() {
 	l.locker.mu.Lock()
 	// Prevent double release
 	if !l.done {
 		delete(l.locker.status, l.dir)
+		delete(l.locker.progress, l.dir)
 		l.done = true
 	}
 	l.locker.mu.Unlock()
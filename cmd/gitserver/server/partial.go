@@ -0,0 +1,370 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/lazyregexp"
+)
+
+// blobSizeLimitRe matches the blob size limits that git accepts in
+// --filter=blob:limit=<n>, such as 512, 100k or 1m.
+var blobSizeLimitRe = lazyregexp.New(`^[0-9]+[kmg]?$`)
+
+// minPartialCloneGitVersion is the oldest git that partial clones work
+// with. Commands run with GIT_NO_LAZY_FETCH (git 2.44) so that they fail
+// instead of fetching missing blobs one at a time, and missing blobs are
+// prefetched with git fetch --stdin --no-write-fetch-head (git 2.29).
+var minPartialCloneGitVersion = [3]int{2, 44, 0}
+
+// gitVersionRe matches the version in the output of git version, such as
+// "git version 2.39.5" or "git version 2.24.1.windows.2".
+var gitVersionRe = lazyregexp.New(`^git version (\d+)\.(\d+)(?:\.(\d+))?`)
+
+// parseGitVersion returns the major, minor and patch version in the output
+// of git version.
+func parseGitVersion(out string) ([3]int, error) {
+	var version [3]int
+	m := gitVersionRe.FindStringSubmatch(strings.TrimSpace(out))
+	if m == nil {
+		return version, fmt.Errorf("unexpected git version output %q", out)
+	}
+	for i, part := range m[1:] {
+		if part != "" {
+			version[i], _ = strconv.Atoi(part)
+		}
+	}
+	return version, nil
+}
+
+// versionLess reports whether the version a is older than b.
+func versionLess(a, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// CheckPartialCloneSupport returns an error if the installed git is too old
+// for partial clones.
+func CheckPartialCloneSupport(ctx context.Context) error {
+	out, err := exec.CommandContext(ctx, "git", "version").Output()
+	if err != nil {
+		return errors.Wrap(err, "failed to get git version")
+	}
+	version, err := parseGitVersion(string(out))
+	if err != nil {
+		return err
+	}
+	if versionLess(version, minPartialCloneGitVersion) {
+		return fmt.Errorf("git %d.%d.%d is older than %d.%d.%d", version[0], version[1], version[2], minPartialCloneGitVersion[0], minPartialCloneGitVersion[1], minPartialCloneGitVersion[2])
+	}
+	return nil
+}
+
+// supportedCloneOptions returns the options that repos configured with opts
+// are cloned with. If partial clones are disabled, repos are cloned with all
+// their blobs, and only the depth of opts applies.
+func (s *Server) supportedCloneOptions(opts *protocol.CloneOptions) *protocol.CloneOptions {
+	if opts == nil || opts.BlobSizeLimit == "" || !s.DisablePartialClones {
+		return opts
+	}
+	if opts.Depth == 0 {
+		return nil
+	}
+	return &protocol.CloneOptions{Depth: opts.Depth}
+}
+
+// validateCloneOptions returns an error if opts cannot be passed to git.
+func validateCloneOptions(opts *protocol.CloneOptions) error {
+	if opts == nil {
+		return nil
+	}
+	if opts.BlobSizeLimit != "" && !blobSizeLimitRe.MatchString(opts.BlobSizeLimit) {
+		return fmt.Errorf("invalid blob size limit %q", opts.BlobSizeLimit)
+	}
+	if opts.Depth < 0 {
+		return fmt.Errorf("invalid depth %d", opts.Depth)
+	}
+	return nil
+}
+
+// cloneOptionsArgs returns the arguments to git clone and git fetch that
+// apply opts.
+func cloneOptionsArgs(opts *protocol.CloneOptions) []string {
+	if opts == nil {
+		return nil
+	}
+	var args []string
+	if opts.BlobSizeLimit != "" {
+		args = append(args, "--filter=blob:limit="+opts.BlobSizeLimit)
+	}
+	if opts.Depth > 0 {
+		args = append(args, "--depth="+strconv.Itoa(opts.Depth))
+	}
+	return args
+}
+
+// saveCloneOptions persists the options that the repo at dir was cloned
+// with, so that later fetches keep it partial or shallow.
+func saveCloneOptions(dir GitDir, opts *protocol.CloneOptions) error {
+	if opts == nil {
+		if err := os.Remove(dir.Path("sg_cloneoptions")); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dir.Path("sg_cloneoptions"), b, 0600)
+}
+
+// loadCloneOptions returns the options persisted by saveCloneOptions, or nil
+// if the repo at dir is a full clone.
+func loadCloneOptions(dir GitDir) (*protocol.CloneOptions, error) {
+	b, err := ioutil.ReadFile(dir.Path("sg_cloneoptions"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var opts protocol.CloneOptions
+	if err := json.Unmarshal(b, &opts); err != nil {
+		return nil, err
+	}
+	return &opts, nil
+}
+
+// sameCloneOptions reports whether a and b clone a repo the same way.
+func sameCloneOptions(a, b *protocol.CloneOptions) bool {
+	var zero protocol.CloneOptions
+	if a == nil {
+		a = &zero
+	}
+	if b == nil {
+		b = &zero
+	}
+	return *a == *b
+}
+
+// lazyFetchCommands are the git commands that may fetch the blobs missing
+// from a partial clone from the code host. Other commands fail instead of
+// fetching the blobs one at a time, which is very slow for commands that
+// read many of them, such as git log -p.
+var lazyFetchCommands = map[string]bool{
+	"archive":  true,
+	"cat-file": true,
+	// A diff reads the blobs of the files that changed, which are few
+	// compared to the blobs read by git log -p.
+	"diff": true,
+	// git ls-tree --long reads the sizes of the blobs it lists.
+	"ls-tree": true,
+	"show":    true,
+}
+
+// historyCommands are the git commands whose output is wrong when the
+// history of the repo is truncated. git log is truncated at the depth of the
+// clone too, but it only lists the commits that the repo has, so it is
+// allowed unless it shows their changes (see logShowsChanges).
+var historyCommands = map[string]bool{
+	"blame": true,
+}
+
+// errTruncatedHistory is returned by history commands on shallow clones.
+var errTruncatedHistory = errors.New("the history of this repository is truncated (shallow clone), so this command is unavailable")
+
+// errMissingBlobs is returned by commands that read too many of the blobs
+// missing from a partial clone.
+var errMissingBlobs = errors.New("the large files of this repository are not cloned (partial clone), so this command is unavailable")
+
+// logChangesFlags are the flags of git log that make it show the changes of
+// commits, which are read from the blobs of the commit and its parent.
+var logChangesFlags = []string{
+	"-p", "-u", "--patch", "-U", "--unified", "--stat", "--numstat", "--shortstat",
+	"--dirstat", "--word-diff", "--cc", "-S", "-G", "-L", "--follow",
+}
+
+// logShowsChanges reports whether git log with the arguments args shows the
+// changes of the commits it lists. On a shallow clone the oldest commit has
+// no parents, so its changes are shown as adding every file of the repo.
+func logShowsChanges(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		for _, flag := range logChangesFlags {
+			// Short flags may be followed by their value, such as -U3 or
+			// -Sfoo, and long flags by =value.
+			if arg == flag || (len(flag) == 2 && strings.HasPrefix(arg, flag)) || strings.HasPrefix(arg, flag+"=") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// configurePartialCommand prepares cmd, a git command with the arguments
+// args, to run in a repo cloned with opts. It returns errTruncatedHistory if
+// the command needs history that the repo does not have, and errMissingBlobs
+// if it needs many of the blobs that the repo does not have.
+func configurePartialCommand(cmd *exec.Cmd, args []string, opts *protocol.CloneOptions) error {
+	if opts == nil || len(args) == 0 {
+		return nil
+	}
+	showsChanges := args[0] == "log" && logShowsChanges(args[1:])
+	if opts.Depth > 0 && (historyCommands[args[0]] || showsChanges) {
+		return errTruncatedHistory
+	}
+	if opts.BlobSizeLimit == "" {
+		return nil
+	}
+	if showsChanges {
+		return errMissingBlobs
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	if lazyFetchCommands[args[0]] {
+		configureRemoteGitCommand(cmd, tlsExternal().(*tlsConfig))
+	} else {
+		cmd.Env = append(cmd.Env, "GIT_NO_LAZY_FETCH=1")
+	}
+	return nil
+}
+
+// prefetchMissingBlobs fetches the blobs under paths of treeish that are
+// missing from the partial clone at dir in a single request, rather than
+// letting git archive fetch them one at a time. If paths is empty, the
+// missing blobs of the whole of treeish are fetched.
+func prefetchMissingBlobs(ctx context.Context, dir GitDir, treeish string, paths []string) error {
+	// rev-list prints the missing objects prefixed with "?" instead of
+	// fetching them. The paths are read from stdin, since there may be too
+	// many for the command line.
+	cmd := exec.CommandContext(ctx, "git", "rev-list", "--objects", "--missing=print", "--no-walk", "--stdin")
+	cmd.Dir = string(dir)
+	cmd.Env = append(os.Environ(), "GIT_NO_LAZY_FETCH=1")
+	cmd.Stdin = strings.NewReader(treeish + "\n--\n" + strings.Join(paths, "\n") + "\n")
+	out, err := cmd.Output()
+	if err != nil {
+		return errors.Wrap(wrapCmdError(cmd, err), "failed to list missing blobs")
+	}
+	var missing bytes.Buffer
+	scan := bufio.NewScanner(bytes.NewReader(out))
+	for scan.Scan() {
+		if oid := strings.TrimPrefix(scan.Text(), "?"); oid != scan.Text() {
+			missing.WriteString(oid)
+			missing.WriteByte('\n')
+		}
+	}
+	if missing.Len() == 0 {
+		return nil
+	}
+
+	cmd = exec.CommandContext(ctx, "git", "-c", "fetch.negotiationAlgorithm=noop", "fetch", "origin", "--no-tags", "--no-write-fetch-head", "--recurse-submodules=no", "--filter=blob:none", "--stdin")
+	cmd.Dir = string(dir)
+	cmd.Stdin = &missing
+	if output, err := runWithRemoteOpts(ctx, cmd, nil); err != nil {
+		return errors.Wrapf(err, "failed to fetch missing blobs. Output: %s", string(output))
+	}
+	log15.Debug("fetched missing blobs", "repo", dir, "treeish", treeish)
+	return nil
+}
+
+// lsTreeListsSizes reports whether args are the arguments of a git ls-tree
+// that lists the sizes of blobs, which git reads from the blobs.
+func lsTreeListsSizes(args []string) bool {
+	if len(args) == 0 || args[0] != "ls-tree" {
+		return false
+	}
+	for _, arg := range args[1:] {
+		if arg == "--" {
+			break
+		}
+		if arg == "--long" || arg == "-l" {
+			return true
+		}
+	}
+	return false
+}
+
+// prefetchListedBlobs fetches the blobs that git ls-tree with the arguments
+// args lists and that are missing from the partial clone at dir in a single
+// request, rather than letting git ls-tree --long fetch them one at a time to
+// read their sizes.
+func prefetchListedBlobs(ctx context.Context, dir GitDir, args []string) error {
+	// List the same entries without their sizes, which does not read the
+	// blobs.
+	var treeish string
+	listArgs := []string{"ls-tree", "-z", "--format=%(objecttype) %(path)"}
+	for i, arg := range args[1:] {
+		if arg == "--" {
+			listArgs = append(listArgs, args[1+i:]...)
+			break
+		}
+		if arg == "--long" || arg == "-l" {
+			continue
+		}
+		if treeish == "" && !strings.HasPrefix(arg, "-") {
+			treeish = arg
+		}
+		listArgs = append(listArgs, arg)
+	}
+	cmd := exec.CommandContext(ctx, "git", listArgs...)
+	cmd.Dir = string(dir)
+	cmd.Env = append(os.Environ(), "GIT_NO_LAZY_FETCH=1")
+	out, err := cmd.Output()
+	if err != nil {
+		return errors.Wrap(wrapCmdError(cmd, err), "failed to list blobs")
+	}
+	var paths []string
+	for _, entry := range strings.Split(string(out), "\x00") {
+		if path := strings.TrimPrefix(entry, "blob "); path != entry {
+			paths = append(paths, ":(literal)"+path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	return prefetchMissingBlobs(ctx, dir, treeish, paths)
+}
+
+// recloneIfCloneOptionsChanged starts recloning the repo of req in the
+// background if req asks for different clone options than the ones it was
+// cloned with. It reports whether the reclone started.
+func (s *Server) recloneIfCloneOptionsChanged(ctx context.Context, req *protocol.RepoUpdateRequest) bool {
+	// Requests without a URL do not come from the code host configuration.
+	if req.URL == "" {
+		return false
+	}
+	current, err := loadCloneOptions(s.dir(req.Repo))
+	if err != nil {
+		log15.Warn("failed to load clone options", "repo", req.Repo, "error", err)
+		return false
+	}
+	if sameCloneOptions(current, s.supportedCloneOptions(req.CloneOptions)) {
+		return false
+	}
+
+	log15.Info("clone options changed, recloning repo", "repo", req.Repo)
+	if _, err := s.cloneRepo(ctx, req.Repo, req.URL, &cloneOptions{Overwrite: true, Partial: req.CloneOptions}); err != nil {
+		log15.Warn("error recloning repo", "repo", req.Repo, "err", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/mutablelimiter"
+)
+
+func TestCloneOptionsArgs(t *testing.T) {
+	tests := []struct {
+		opts    *protocol.CloneOptions
+		want    []string
+		wantErr bool
+	}{
+		{opts: nil, want: nil},
+		{opts: &protocol.CloneOptions{BlobSizeLimit: "1m"}, want: []string{"--filter=blob:limit=1m"}},
+		{opts: &protocol.CloneOptions{BlobSizeLimit: "512", Depth: 10}, want: []string{"--filter=blob:limit=512", "--depth=10"}},
+		{opts: &protocol.CloneOptions{BlobSizeLimit: "1m --upload-pack=x"}, wantErr: true},
+		{opts: &protocol.CloneOptions{Depth: -1}, wantErr: true},
+	}
+	for _, test := range tests {
+		if err := validateCloneOptions(test.opts); (err != nil) != test.wantErr {
+			t.Errorf("validateCloneOptions(%+v) = %v, want error %v", test.opts, err, test.wantErr)
+			continue
+		}
+		if test.wantErr {
+			continue
+		}
+		if got := cloneOptionsArgs(test.opts); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("cloneOptionsArgs(%+v) = %q, want %q", test.opts, got, test.want)
+		}
+	}
+}
+
+func TestConfigurePartialCommand(t *testing.T) {
+	hasNoLazyFetch := func(cmd *exec.Cmd) bool {
+		for _, e := range cmd.Env {
+			if e == "GIT_NO_LAZY_FETCH=1" {
+				return true
+			}
+		}
+		return false
+	}
+	partial := &protocol.CloneOptions{BlobSizeLimit: "1m", Depth: 1}
+
+	cmd := exec.Command("git", "show", "HEAD:big.txt")
+	if err := configurePartialCommand(cmd, cmd.Args[1:], partial); err != nil || hasNoLazyFetch(cmd) {
+		t.Errorf("expected git show to fetch missing blobs, got error %v", err)
+	}
+	cmd = exec.Command("git", "diff", "HEAD~1", "HEAD")
+	if err := configurePartialCommand(cmd, cmd.Args[1:], partial); err != nil || hasNoLazyFetch(cmd) {
+		t.Errorf("expected git diff to fetch missing blobs, got error %v", err)
+	}
+	cmd = exec.Command("git", "log", "--format=%H", "--", "-p")
+	if err := configurePartialCommand(cmd, cmd.Args[1:], partial); err != nil || !hasNoLazyFetch(cmd) {
+		t.Errorf("expected git log not to fetch missing blobs, got error %v", err)
+	}
+	cmd = exec.Command("git", "log", "-U3")
+	if err := configurePartialCommand(cmd, cmd.Args[1:], partial); err != errTruncatedHistory {
+		t.Errorf("got error %v for git log -U3, want %v", err, errTruncatedHistory)
+	}
+	cmd = exec.Command("git", "log", "--stat=80")
+	if err := configurePartialCommand(cmd, cmd.Args[1:], &protocol.CloneOptions{BlobSizeLimit: "1m"}); err != errMissingBlobs {
+		t.Errorf("got error %v for git log --stat=80, want %v", err, errMissingBlobs)
+	}
+	cmd = exec.Command("git", "blame", "HEAD", "--", "big.txt")
+	if err := configurePartialCommand(cmd, cmd.Args[1:], partial); err != errTruncatedHistory {
+		t.Errorf("got error %v for git blame, want %v", err, errTruncatedHistory)
+	}
+	if err := configurePartialCommand(cmd, cmd.Args[1:], nil); err != nil || cmd.Env != nil {
+		t.Errorf("expected a full clone to leave git blame alone, got error %v", err)
+	}
+}
+
+func TestParseGitVersion(t *testing.T) {
+	for out, want := range map[string][3]int{
+		"git version 2.39.5\n":         {2, 39, 5},
+		"git version 2.44.0":           {2, 44, 0},
+		"git version 2.24.1.windows.2": {2, 24, 1},
+		"git version 3.0":              {3, 0, 0},
+	} {
+		got, err := parseGitVersion(out)
+		if err != nil {
+			t.Errorf("%q: %v", out, err)
+		} else if got != want {
+			t.Errorf("%q: got %v, want %v", out, got, want)
+		}
+	}
+	if _, err := parseGitVersion("hub version 2.14.2"); err == nil {
+		t.Error("expected an error for unexpected output")
+	}
+
+	if !versionLess([3]int{2, 39, 5}, minPartialCloneGitVersion) {
+		t.Error("expected git 2.39.5 to be too old for partial clones")
+	}
+	if versionLess([3]int{2, 44, 0}, minPartialCloneGitVersion) || versionLess([3]int{3, 0, 0}, minPartialCloneGitVersion) {
+		t.Error("expected git 2.44.0 and 3.0.0 to support partial clones")
+	}
+}
+
+func TestSupportedCloneOptions(t *testing.T) {
+	partial := &protocol.CloneOptions{BlobSizeLimit: "1m", Depth: 1}
+	s := &Server{}
+	if got := s.supportedCloneOptions(partial); got != partial {
+		t.Errorf("got %+v, want the options unchanged", got)
+	}
+
+	s.DisablePartialClones = true
+	if got := s.supportedCloneOptions(partial); got == nil || *got != (protocol.CloneOptions{Depth: 1}) {
+		t.Errorf("got %+v, want only the depth", got)
+	}
+	if got := s.supportedCloneOptions(&protocol.CloneOptions{BlobSizeLimit: "1m"}); got != nil {
+		t.Errorf("got %+v, want a full clone", got)
+	}
+}
+
+func TestPartialClone(t *testing.T) {
+	remote, cleanup1 := tmpDir(t)
+	defer cleanup1()
+	git := func(dir string, arg ...string) string {
+		t.Helper()
+		c := exec.Command("git", arg...)
+		c.Dir = dir
+		c.Env = append(os.Environ(),
+			"GIT_COMMITTER_NAME=a",
+			"GIT_COMMITTER_EMAIL=a@a.com",
+			"GIT_AUTHOR_NAME=a",
+			"GIT_AUTHOR_EMAIL=a@a.com",
+		)
+		b, err := c.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s failed: %s\n%s", strings.Join(arg, " "), err, b)
+		}
+		return strings.TrimSpace(string(b))
+	}
+	commit := func(name string, size int) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(remote, name), []byte(strings.Repeat("x", size)), 0600); err != nil {
+			t.Fatal(err)
+		}
+		git(remote, "add", name)
+		git(remote, "commit", "-m", name)
+	}
+	git(remote, "init", ".")
+	git(remote, "config", "uploadpack.allowFilter", "true")
+	git(remote, "config", "uploadpack.allowAnySHA1InWant", "true")
+	commit("small.txt", 10)
+	commit("big.txt", 4096)
+	bigBlob := git(remote, "rev-parse", "HEAD:big.txt")
+
+	reposDir, cleanup2 := tmpDir(t)
+	defer cleanup2()
+	s := &Server{
+		ReposDir:         reposDir,
+		ctx:              context.Background(),
+		locker:           &RepositoryLocker{},
+		cloneLimiter:     mutablelimiter.New(1),
+		cloneableLimiter: mutablelimiter.New(1),
+	}
+
+	const repo = "example.com/foo/bar"
+	url := "file://" + remote
+	partial := &protocol.CloneOptions{BlobSizeLimit: "1k", Depth: 1}
+	if _, err := s.cloneRepo(context.Background(), repo, url, &cloneOptions{Block: true, Partial: partial}); err != nil {
+		t.Fatal(err)
+	}
+	dir := s.dir(repo)
+	isMissing := func(oid string) bool {
+		t.Helper()
+		c := exec.Command("git", "cat-file", "-e", oid)
+		c.Dir = string(dir)
+		c.Env = append(os.Environ(), "GIT_NO_LAZY_FETCH=1")
+		return c.Run() != nil
+	}
+
+	if got, err := loadCloneOptions(dir); err != nil || !reflect.DeepEqual(got, partial) {
+		t.Fatalf("got clone options %+v, %v, want %+v", got, err, partial)
+	}
+	if _, err := os.Stat(dir.Path("shallow")); err != nil {
+		t.Errorf("expected a shallow clone: %s", err)
+	}
+	if !isMissing(bigBlob) {
+		t.Fatal("expected the big blob to be missing from the partial clone")
+	}
+
+	// Archives fetch the missing blobs in one go.
+	if err := prefetchMissingBlobs(context.Background(), dir, "HEAD", []string{"big.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if isMissing(bigBlob) {
+		t.Error("expected the big blob to be fetched")
+	}
+
+	// Fetches keep the clone partial and shallow.
+	commit("bigger.txt", 8192)
+	wantCommit := git(remote, "rev-parse", "HEAD")
+	if err := s.doRepoUpdate2(repo, url); err != nil {
+		t.Fatal(err)
+	}
+	if got := git(string(dir), "rev-parse", "HEAD"); got != wantCommit {
+		t.Errorf("got commit %s after fetching, want %s", got, wantCommit)
+	}
+	if !isMissing(git(remote, "rev-parse", "HEAD:bigger.txt")) {
+		t.Error("expected the fetched big blob to be missing")
+	}
+	if got := git(string(dir), "rev-list", "--count", "HEAD"); got != "1" {
+		t.Errorf("got %s commits after fetching, want 1", got)
+	}
+
+	// Directory listings read the sizes of the missing blobs, which are
+	// fetched in one go.
+	args := []string{"ls-tree", "--long", "--full-name", "-z", wantCommit}
+	lsTree := exec.Command("git", args...)
+	lsTree.Dir = string(dir)
+	if err := configurePartialCommand(lsTree, args, partial); err != nil {
+		t.Fatal(err)
+	}
+	if !lsTreeListsSizes(args) {
+		t.Fatal("expected git ls-tree --long to list sizes")
+	}
+	if err := prefetchListedBlobs(context.Background(), dir, args); err != nil {
+		t.Fatal(err)
+	}
+	if isMissing(git(remote, "rev-parse", "HEAD:bigger.txt")) {
+		t.Error("expected the listed big blob to be fetched")
+	}
+	out, err := lsTree.Output()
+	if err != nil {
+		t.Fatalf("git ls-tree --long failed: %s", err)
+	}
+	if !strings.Contains(string(out), " 8192\tbigger.txt\x00") {
+		t.Errorf("got %q, want the size of bigger.txt", out)
+	}
+}
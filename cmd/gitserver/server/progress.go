@@ -0,0 +1,138 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/lazyregexp"
+)
+
+// cloneProgressRe matches the progress lines of git, such as
+//
+//   remote: Counting objects:  45% (9/20)
+//   Receiving objects:  37% (7/19), 1.23 MiB | 2.50 MiB/s
+//   Resolving deltas: 100% (6/6), done.
+var cloneProgressRe = lazyregexp.New(`^(?:remote: )?([A-Za-z ]+):\s+(\d+)% \((\d+)/(\d+)\)(?:, ([\d.]+) (bytes|[KMGT]iB)(?: \| ([\d.]+) (bytes|[KMGT]iB)/s)?)?`)
+
+// clonePhases maps the names of the progress lines of git to the phases of a
+// clone.
+var clonePhases = map[string]string{
+	"Counting objects":    protocol.ClonePhaseCounting,
+	"Enumerating objects": protocol.ClonePhaseCounting,
+	"Compressing objects": protocol.ClonePhaseCompressing,
+	"Receiving objects":   protocol.ClonePhaseReceiving,
+	"Resolving deltas":    protocol.ClonePhaseResolving,
+}
+
+// cloneProgressTracker tracks the progress of a clone from the progress
+// output of git. It is not safe for concurrent use.
+type cloneProgressTracker struct {
+	progress protocol.CloneProgress
+}
+
+func newCloneProgressTracker(now time.Time) *cloneProgressTracker {
+	return &cloneProgressTracker{progress: protocol.CloneProgress{
+		Phase:          protocol.ClonePhaseStarting,
+		StartedAt:      now,
+		PhaseStartedAt: now,
+		UpdatedAt:      now,
+	}}
+}
+
+// update updates the progress from a line of the progress output of git. It
+// returns false if the line does not report progress.
+func (t *cloneProgressTracker) update(line string, now time.Time) bool {
+	m := cloneProgressRe.FindStringSubmatch(line)
+	if m == nil {
+		return false
+	}
+	phase, ok := clonePhases[m[1]]
+	if !ok {
+		return false
+	}
+
+	p := &t.progress
+	if phase != p.Phase {
+		p.Phase = phase
+		p.PhaseStartedAt = now
+	}
+	p.Percent, _ = strconv.Atoi(m[2])
+	p.Objects, _ = strconv.ParseInt(m[3], 10, 64)
+	p.TotalObjects, _ = strconv.ParseInt(m[4], 10, 64)
+	if m[5] != "" {
+		p.ReceivedBytes = parseProgressSize(m[5], m[6])
+	}
+	if m[7] != "" {
+		p.BytesPerSecond = parseProgressSize(m[7], m[8])
+	}
+	p.UpdatedAt = now
+
+	// Assume that the rest of the phase goes as fast as it went so far.
+	p.ETA = 0
+	if p.Objects > 0 && p.Objects < p.TotalObjects {
+		elapsed := now.Sub(p.PhaseStartedAt)
+		p.ETA = time.Duration(float64(elapsed) * float64(p.TotalObjects-p.Objects) / float64(p.Objects)).Round(time.Second)
+	}
+	return true
+}
+
+// done marks the clone as done.
+func (t *cloneProgressTracker) done(now time.Time) {
+	p := &t.progress
+	p.Phase = protocol.ClonePhaseDone
+	p.Percent = 100
+	p.PhaseStartedAt = now
+	p.UpdatedAt = now
+	p.ETA = 0
+}
+
+// parseProgressSize parses a size in the progress output of git, such as
+// "1.23" "MiB", as a number of bytes.
+func parseProgressSize(value, unit string) int64 {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	switch unit {
+	case "KiB":
+		f *= 1 << 10
+	case "MiB":
+		f *= 1 << 20
+	case "GiB":
+		f *= 1 << 30
+	case "TiB":
+		f *= 1 << 40
+	}
+	return int64(f)
+}
+
+// saveCloneProgress persists the final progress of the clone that produced
+// the repo at dir, so that it can be reported after the clone.
+func saveCloneProgress(dir GitDir, progress protocol.CloneProgress) error {
+	b, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dir.Path("sg_cloneprogress"), b, 0600)
+}
+
+// loadCloneProgress returns the progress persisted by saveCloneProgress, or
+// nil if there is none.
+func loadCloneProgress(dir GitDir) (*protocol.CloneProgress, error) {
+	b, err := ioutil.ReadFile(dir.Path("sg_cloneprogress"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var progress protocol.CloneProgress
+	if err := json.Unmarshal(b, &progress); err != nil {
+		return nil, err
+	}
+	return &progress, nil
+}
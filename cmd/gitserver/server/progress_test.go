@@ -0,0 +1,124 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
+)
+
+func TestCloneProgressTracker(t *testing.T) {
+	start := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	tracker := newCloneProgressTracker(start)
+
+	if tracker.update("Cloning into bare repository 'foo'...", start) {
+		t.Error("expected a line without progress not to update the progress")
+	}
+
+	tracker.update("remote: Counting objects:  45% (9/20)", start.Add(time.Second))
+	if got, want := tracker.progress.Phase, protocol.ClonePhaseCounting; got != want {
+		t.Errorf("got phase %q, want %q", got, want)
+	}
+
+	// The ETA is extrapolated from the time spent in the phase so far.
+	receivingStart := start.Add(2 * time.Second)
+	tracker.update("Receiving objects:   0% (0/400)", receivingStart)
+	tracker.update("Receiving objects:  25% (100/400), 1.50 MiB | 512.00 KiB/s", receivingStart.Add(10*time.Second))
+	want := protocol.CloneProgress{
+		Phase:          protocol.ClonePhaseReceiving,
+		Percent:        25,
+		Objects:        100,
+		TotalObjects:   400,
+		ReceivedBytes:  3 << 19,
+		BytesPerSecond: 512 << 10,
+		StartedAt:      start,
+		PhaseStartedAt: receivingStart,
+		UpdatedAt:      receivingStart.Add(10 * time.Second),
+		ETA:            30 * time.Second,
+	}
+	if !reflect.DeepEqual(tracker.progress, want) {
+		t.Errorf("got progress %+v, want %+v", tracker.progress, want)
+	}
+
+	tracker.update("Resolving deltas: 100% (6/6), done.", start.Add(time.Minute))
+	if tracker.progress.Phase != protocol.ClonePhaseResolving || tracker.progress.ETA != 0 {
+		t.Errorf("got phase %q and ETA %s, want %q and 0", tracker.progress.Phase, tracker.progress.ETA, protocol.ClonePhaseResolving)
+	}
+
+	tracker.done(start.Add(2 * time.Minute))
+	if tracker.progress.Phase != protocol.ClonePhaseDone || tracker.progress.Percent != 100 {
+		t.Errorf("got phase %q at %d%%, want %q at 100%%", tracker.progress.Phase, tracker.progress.Percent, protocol.ClonePhaseDone)
+	}
+}
+
+func TestParseProgressSize(t *testing.T) {
+	tests := []struct {
+		value, unit string
+		want        int64
+	}{
+		{"512", "bytes", 512},
+		{"1.50", "KiB", 1536},
+		{"2.00", "MiB", 2 << 20},
+		{"1.00", "GiB", 1 << 30},
+		{"x", "MiB", 0},
+	}
+	for _, test := range tests {
+		if got := parseProgressSize(test.value, test.unit); got != test.want {
+			t.Errorf("parseProgressSize(%q, %q) = %d, want %d", test.value, test.unit, got, test.want)
+		}
+	}
+}
+
+func TestSaveCloneProgress(t *testing.T) {
+	dir, cleanup := tmpDir(t)
+	defer cleanup()
+
+	got, err := loadCloneProgress(GitDir(dir))
+	if err != nil || got != nil {
+		t.Fatalf("got %+v, %v before saving, want nil, nil", got, err)
+	}
+
+	want := protocol.CloneProgress{
+		Phase:     protocol.ClonePhaseDone,
+		Percent:   100,
+		StartedAt: time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC),
+	}
+	if err := saveCloneProgress(GitDir(dir), want); err != nil {
+		t.Fatal(err)
+	}
+	got, err = loadCloneProgress(GitDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+}
+
+func TestRepositoryLocker_Progress(t *testing.T) {
+	var locker RepositoryLocker
+	dir := GitDir("foo/.git")
+	lock, ok := locker.TryAcquire(dir, "cloning")
+	if !ok {
+		t.Fatal("expected to acquire the lock")
+	}
+	if _, ok := locker.Progress(dir); ok {
+		t.Error("expected no progress before it is reported")
+	}
+
+	want := protocol.CloneProgress{Phase: protocol.ClonePhaseReceiving, Percent: 50}
+	lock.SetProgress(want)
+	if got, ok := locker.Progress(dir); !ok || got != want {
+		t.Errorf("got progress %+v, %v, want %+v, true", got, ok, want)
+	}
+	if got := locker.AllProgress(); !reflect.DeepEqual(got, map[GitDir]protocol.CloneProgress{dir: want}) {
+		t.Errorf("got all progress %+v", got)
+	}
+
+	lock.Release()
+	lock.SetProgress(want)
+	if _, ok := locker.Progress(dir); ok {
+		t.Error("expected no progress after the lock is released")
+	}
+}
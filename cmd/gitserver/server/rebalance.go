@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/inconshreveable/log15"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+)
+
+func init() {
+	prometheus.MustRegister(reposRebalanced)
+}
+
+var reposRebalanced = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "src",
+	Subsystem: "gitserver",
+	Name:      "repos_rebalanced",
+	Help:      "number of repos copied to the gitservers they were moved to",
+})
+
+// gitServerClient returns the client used to reach the other gitservers.
+func (s *Server) gitServerClient() *gitserver.Client {
+	if s.GitServerClient != nil {
+		return s.GitServerClient
+	}
+	return gitserver.DefaultClient
+}
+
+// isReplicated reports whether this gitserver reconciles the placement of
+// repos with the other gitservers. It has to know its own address and be in
+// the list of addresses, otherwise every repo would look misplaced.
+func (s *Server) isReplicated(ctx context.Context, client *gitserver.Client) bool {
+	return s.Hostname != "" && containsString(client.Addrs(ctx), s.Hostname)
+}
+
+// peerCloneAddr returns the address of another gitserver that has repo, or
+// "" if there is none. Repos are copied from there rather than cloned from
+// the code host again, for example when they are moved to a gitserver that
+// was added. peer is the gitserver that asked for the copy, if any, which
+// is tried first.
+func (s *Server) peerCloneAddr(ctx context.Context, repo api.RepoName, peer string) string {
+	if s.Hostname == "" {
+		return ""
+	}
+	client := s.gitServerClient()
+	if !s.isReplicated(ctx, client) {
+		return ""
+	}
+	addrs := client.PeersForRepo(ctx, repo)
+	if peer != "" {
+		addrs = append([]string{peer}, addrs...)
+	}
+	for _, addr := range addrs {
+		if addr == s.Hostname {
+			continue
+		}
+		if cloned, err := client.IsRepoClonedOn(ctx, addr, repo); err == nil && cloned {
+			return addr
+		}
+	}
+	return ""
+}
+
+// peerCloneURL returns the URL of repo on the gitserver at addr, see
+// handleGitService.
+func peerCloneURL(addr string, repo api.RepoName) string {
+	return "http://" + addr + "/git/" + string(repo)
+}
+
+// Rebalance copies the repos that this gitserver is no longer a replica of
+// to their replicas, for example after gitservers were added or removed. The
+// replicas copy them from this gitserver with git, see handleGitService.
+// Until they have them, clients read the repos from this gitserver, and
+// afterwards the janitor removes them from it. This keeps the repos available
+// while gitservers are added.
+//
+// A gitserver that was removed from the list of addresses copies all its
+// repos to their replicas, so that it can be shut down once it is done.
+func (s *Server) Rebalance() {
+	if s.Hostname == "" {
+		return
+	}
+	ctx, cancel := s.serverContext()
+	defer cancel()
+
+	client := s.gitServerClient()
+	if !s.isReplicated(ctx, client) {
+		log15.Info("rebalance: this gitserver is not in the list of gitserver addresses, copying all repos to their replicas", "addr", s.Hostname)
+	}
+
+	err := bestEffortWalk(s.ReposDir, func(dir string, fi os.FileInfo) error {
+		if s.ignorePath(dir) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Look for $GIT_DIR
+		if !fi.IsDir() || fi.Name() != ".git" {
+			return nil
+		}
+
+		if err := s.rebalanceRepo(ctx, client, GitDir(dir)); err != nil {
+			log15.Error("failed to rebalance repo", "repo", dir, "error", err)
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		log15.Error("rebalance: error iterating over repositories", "error", err)
+	}
+}
+
+// rebalanceRepo asks the replicas of the repo at dir that do not have it to
+// copy it, if this gitserver is not one of them.
+func (s *Server) rebalanceRepo(ctx context.Context, client *gitserver.Client, dir GitDir) error {
+	repo := s.name(dir)
+	replicas := client.AddrsForRepo(ctx, repo)
+	if containsString(replicas, s.Hostname) {
+		return nil
+	}
+
+	// The replicas use the remote URL of our copy for their future fetches.
+	url, err := repoRemoteURL(ctx, dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to determine Git remote URL")
+	}
+	if url == "" {
+		return errors.New("failed to determine Git remote URL")
+	}
+	partial, err := loadCloneOptions(dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to load clone options")
+	}
+
+	for _, addr := range replicas {
+		cloned, err := client.IsRepoClonedOn(ctx, addr, repo)
+		if err != nil {
+			return err
+		}
+		if cloned {
+			continue
+		}
+
+		log15.Info("copying repo to replica", "repo", repo, "replica", addr)
+		resp, err := client.RequestRepoUpdateOn(ctx, addr, gitserver.Repo{Name: repo, URL: url, CloneOptions: partial}, s.Hostname)
+		if err != nil {
+			return errors.Wrapf(err, "failed to copy repo to %s", addr)
+		}
+		if resp.Error != "" {
+			return errors.Errorf("failed to copy repo to %s: %s", addr, resp.Error)
+		}
+		reposRebalanced.Inc()
+	}
+	return nil
+}
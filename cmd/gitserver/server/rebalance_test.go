@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+)
+
+func TestRebalance(t *testing.T) {
+	remote, cleanup := tmpDir(t)
+	defer cleanup()
+
+	git := func(dir string, arg ...string) string {
+		t.Helper()
+		c := exec.Command("git", arg...)
+		c.Dir = dir
+		c.Env = append(os.Environ(),
+			"GIT_COMMITTER_NAME=a",
+			"GIT_COMMITTER_EMAIL=a@a.com",
+			"GIT_AUTHOR_NAME=a",
+			"GIT_AUTHOR_EMAIL=a@a.com",
+		)
+		b, err := c.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s failed: %s\n%s", strings.Join(arg, " "), err, b)
+		}
+		return strings.TrimSpace(string(b))
+	}
+	git(remote, "init", ".")
+	git(remote, "commit", "--allow-empty", "-m", "hello")
+	wantCommit := git(remote, "rev-parse", "HEAD")
+
+	// Two gitservers that know each other's addresses.
+	client := &gitserver.Client{HTTPClient: http.DefaultClient, ReplicationFactor: 1}
+	var servers []*Server
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		reposDir, cleanup := tmpDir(t)
+		defer cleanup()
+		s := &Server{ReposDir: reposDir, GitServerClient: client}
+		ts := httptest.NewServer(s.Handler())
+		defer ts.Close()
+		s.Hostname = strings.TrimPrefix(ts.URL, "http://")
+		servers = append(servers, s)
+		addrs = append(addrs, s.Hostname)
+	}
+	client.Addrs = func(context.Context) []string { return addrs }
+	oldServer, newServer := servers[0], servers[1]
+
+	// Clone a repo that belongs on the new gitserver on the old one, as if
+	// the new gitserver was just added.
+	var repo api.RepoName
+	for i := 0; ; i++ {
+		repo = api.RepoName(fmt.Sprintf("example.com/repo-%d", i))
+		if client.AddrForRepo(context.Background(), repo) == newServer.Hostname {
+			break
+		}
+	}
+	if _, err := oldServer.cloneRepo(context.Background(), repo, remote, &cloneOptions{Block: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new gitserver copies the repo from the old one rather than from the
+	// code host.
+	if err := os.RemoveAll(remote); err != nil {
+		t.Fatal(err)
+	}
+
+	revParse := func() string {
+		t.Helper()
+		cmd := client.Command("git", "rev-parse", "HEAD")
+		cmd.Repo = gitserver.Repo{Name: repo}
+		out, err := cmd.Output(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+
+	// Until the new gitserver has the repo, reads are handed off to the old
+	// one.
+	if got := revParse(); got != wantCommit {
+		t.Fatalf("got commit %q before rebalancing, want %q", got, wantCommit)
+	}
+	if repoCloned(newServer.dir(repo)) {
+		t.Fatal("expected the new gitserver not to clone the repo for a read")
+	}
+
+	oldServer.Rebalance()
+
+	if !repoCloned(newServer.dir(repo)) {
+		t.Fatal("expected the repo to be copied to the new gitserver")
+	}
+	if got := git(string(newServer.dir(repo)), "config", "remote.origin.url"); got != remote {
+		t.Errorf("got remote URL %q, want the remote URL of the old gitserver %q", got, remote)
+	}
+
+	// The janitor of the old gitserver removes its copy now that the new
+	// gitserver has the repo.
+	oldServer.cleanupRepos()
+	if repoCloned(oldServer.dir(repo)) {
+		t.Error("expected the repo to be removed from the old gitserver")
+	}
+	if got := revParse(); got != wantCommit {
+		t.Fatalf("got commit %q after rebalancing, want %q", got, wantCommit)
+	}
+}
+
+func TestRebalance_removed(t *testing.T) {
+	remote, cleanup := tmpDir(t)
+	defer cleanup()
+	for _, args := range [][]string{{"init", "."}, {"-c", "user.name=a", "-c", "user.email=a@a.com", "commit", "--allow-empty", "-m", "hello"}} {
+		c := exec.Command("git", args...)
+		c.Dir = remote
+		if out, err := c.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %s\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	// The removed gitserver is not in the list of addresses anymore.
+	client := &gitserver.Client{HTTPClient: http.DefaultClient, ReplicationFactor: 1}
+	var servers []*Server
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		reposDir, cleanup := tmpDir(t)
+		defer cleanup()
+		s := &Server{ReposDir: reposDir, GitServerClient: client}
+		ts := httptest.NewServer(s.Handler())
+		defer ts.Close()
+		s.Hostname = strings.TrimPrefix(ts.URL, "http://")
+		servers = append(servers, s)
+		addrs = append(addrs, s.Hostname)
+	}
+	removedServer, server := servers[0], servers[1]
+	client.Addrs = func(context.Context) []string { return addrs }
+
+	repo := api.RepoName("example.com/repo")
+	if _, err := removedServer.cloneRepo(context.Background(), repo, remote, &cloneOptions{Block: true}); err != nil {
+		t.Fatal(err)
+	}
+	addrs = addrs[1:]
+
+	// The remaining gitserver copies the repo from the removed one rather than
+	// from the code host.
+	if err := os.RemoveAll(remote); err != nil {
+		t.Fatal(err)
+	}
+	removedServer.Rebalance()
+	if !repoCloned(server.dir(repo)) {
+		t.Fatal("expected the repo to be copied from the removed gitserver")
+	}
+}
+
+func TestServer_isPeer(t *testing.T) {
+	s := &Server{GitServerClient: &gitserver.Client{
+		Addrs: func(context.Context) []string { return []string{"127.0.0.1:3178", "10.0.0.2:3178"} },
+	}}
+	for remoteAddr, want := range map[string]bool{
+		"127.0.0.1:50000": true,
+		"10.0.0.2:50000":  true,
+		"10.0.0.3:50000":  false,
+		"invalid":         false,
+	} {
+		if got := s.isPeer(context.Background(), remoteAddr); got != want {
+			t.Errorf("%s: got isPeer %v, want %v", remoteAddr, got, want)
+		}
+	}
+
+	// Other clients cannot fetch repos.
+	req := httptest.NewRequest("GET", "/git/example.com/repo/info/refs?service=git-upload-pack", nil)
+	req.RemoteAddr = "10.0.0.3:50000"
+	w := httptest.NewRecorder()
+	s.handleGitService(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
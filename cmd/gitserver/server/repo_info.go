@@ -61,9 +61,36 @@ func (s *Server) repoCloneProgress(repo api.RepoName) (*protocol.RepoCloneProgre
 		resp.CloneInProgress = true
 		resp.CloneProgress = "This will never finish cloning"
 	}
+	if progress, ok := s.locker.Progress(dir); ok {
+		resp.Progress = &progress
+	} else if resp.Cloned {
+		progress, err := loadCloneProgress(dir)
+		if err != nil {
+			log15.Warn("error loading clone progress", "repo", repo, "err", err)
+		}
+		resp.Progress = progress
+	}
 	return &resp, nil
 }
 
+// handleListCloneProgress returns the progress of all the clones that are
+// running.
+func (s *Server) handleListCloneProgress(w http.ResponseWriter, r *http.Request) {
+	all := s.locker.AllProgress()
+	resp := protocol.ListCloneProgressResponse{
+		Results: make(map[api.RepoName]*protocol.CloneProgress, len(all)),
+	}
+	for dir, progress := range all {
+		progress := progress
+		resp.Results[s.name(dir)] = &progress
+	}
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 func (s *Server) handleRepoInfo(w http.ResponseWriter, r *http.Request) {
 	var req protocol.RepoInfoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -121,7 +148,7 @@ func (s *Server) handleRepoDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.deleteRepo(req.Repo); err != nil {
+	if err := s.deleteRepo(r.Context(), req.Repo); err != nil {
 		log15.Error("failed to delete repository", "repo", req.Repo, "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -129,6 +156,11 @@ func (s *Server) handleRepoDelete(w http.ResponseWriter, r *http.Request) {
 	log15.Info("deleted repository", "repo", req.Repo)
 }
 
-func (s *Server) deleteRepo(repo api.RepoName) error {
-	return s.removeRepoDirectory(s.dir(repo))
+func (s *Server) deleteRepo(ctx context.Context, repo api.RepoName) error {
+	if err := s.removeRepoDirectory(s.dir(repo)); err != nil {
+		return err
+	}
+	// The repo was deleted rather than moved to another gitserver, so its
+	// backup is not needed anymore.
+	return s.deleteBackup(ctx, repo)
 }
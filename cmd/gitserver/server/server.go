@@ -33,10 +33,12 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/conf"
 	"github.com/sourcegraph/sourcegraph/internal/env"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
 	"github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/honey"
 	"github.com/sourcegraph/sourcegraph/internal/lazyregexp"
 	"github.com/sourcegraph/sourcegraph/internal/mutablelimiter"
+	"github.com/sourcegraph/sourcegraph/internal/objectstore"
 	"github.com/sourcegraph/sourcegraph/internal/repotrackutil"
 	"github.com/sourcegraph/sourcegraph/internal/trace"
 	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
@@ -116,6 +118,32 @@ type Server struct {
 	// DiskSizer tells how much disk is free and how large the disk is.
 	DiskSizer DiskSizer
 
+	// Hostname is the address of this gitserver in the list of gitserver
+	// addresses. If it is set, the janitor removes the repositories that
+	// this gitserver is not a replica of (see gitserver.Client.AddrsForRepo).
+	Hostname string
+
+	// GitServerClient is used by the janitor to find the replicas of a
+	// repository. It defaults to gitserver.DefaultClient.
+	GitServerClient *gitserver.Client
+
+	// BundleStore stores backups of the repositories as git bundles (see
+	// BackupRepos). Repositories are restored from their latest backup when
+	// they are cloned. If it is nil, there are no backups.
+	BundleStore objectstore.ObjectStore
+
+	// BundleMaxAge is the age after which backups are deleted from
+	// BundleStore. Backups are rewritten more often than that, so only the
+	// backups of repositories that were removed from every gitserver expire.
+	// Zero keeps backups until their repository is deleted.
+	BundleMaxAge time.Duration
+
+	// DisablePartialClones makes gitserver clone repos with all their blobs,
+	// even if they are configured with a blob size limit, because the
+	// installed git is too old for partial clones (see
+	// CheckPartialCloneSupport). Shallow clones still apply.
+	DisablePartialClones bool
+
 	// skipCloneForTests is set by tests to avoid clones.
 	skipCloneForTests bool
 
@@ -138,6 +166,10 @@ type Server struct {
 
 	repoUpdateLocksMu sync.Mutex // protects the map below and also updates to locks.once
 	repoUpdateLocks   map[api.RepoName]*locks
+
+	// copySources maps the repos being copied from other gitservers to the
+	// addresses of these gitservers.
+	copySources sync.Map
 }
 
 type locks struct {
@@ -231,10 +263,13 @@ func (s *Server) Handler() http.Handler {
 	mux.HandleFunc("/is-repo-cloned", s.handleIsRepoCloned)
 	mux.HandleFunc("/repos", s.handleRepoInfo)
 	mux.HandleFunc("/repo-clone-progress", s.handleRepoCloneProgress)
+	mux.HandleFunc("/list-clone-progress", s.handleListCloneProgress)
 	mux.HandleFunc("/delete", s.handleRepoDelete)
 	mux.HandleFunc("/repo-update", s.handleRepoUpdate)
 	mux.HandleFunc("/getGitolitePhabricatorMetadata", s.handleGetGitolitePhabricatorMetadata)
 	mux.HandleFunc("/create-commit-from-patch", s.handleCreateCommitFromPatch)
+	mux.HandleFunc("/git/", s.handleGitService)
+	mux.HandleFunc("/repo-backup", s.handleRepoBackup)
 	mux.HandleFunc("/ping", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
@@ -404,11 +439,13 @@ func (s *Server) handleRepoUpdate(w http.ResponseWriter, r *http.Request) {
 		// optimistically, we assume that our cloning attempt might
 		// succeed.
 		resp.CloneInProgress = true
-		_, err := s.cloneRepo(ctx, req.Repo, req.URL, &cloneOptions{Block: true})
+		_, err := s.cloneRepo(ctx, req.Repo, req.URL, &cloneOptions{Block: true, Partial: req.CloneOptions, Peer: req.Peer})
 		if err != nil {
 			log15.Warn("error cloning repo", "repo", req.Repo, "err", err)
 			resp.Error = err.Error()
 		}
+	} else if s.recloneIfCloneOptionsChanged(ctx, &req) {
+		resp.CloneInProgress = true
 	} else {
 		resp.Cloned = true
 		var statusErr, updateErr error
@@ -497,6 +534,16 @@ func (s *Server) handleArchive(w http.ResponseWriter, r *http.Request) {
 	req.Args = append(req.Args, treeish, "--")
 	req.Args = append(req.Args, paths...)
 
+	// Fetch the blobs missing from a partial clone in one go, rather than
+	// letting git archive fetch them one at a time.
+	if dir := s.dir(protocol.NormalizeRepo(req.Repo)); repoCloned(dir) {
+		if partial, err := loadCloneOptions(dir); err == nil && partial != nil && partial.BlobSizeLimit != "" && !s.DisablePartialClones {
+			if err := prefetchMissingBlobs(r.Context(), dir, treeish, paths); err != nil {
+				log15.Warn("failed to prefetch missing blobs, fetching them lazily", "repo", repo, "error", err)
+			}
+		}
+	}
+
 	s.exec(w, r, req)
 }
 
@@ -612,6 +659,9 @@ func (s *Server) exec(w http.ResponseWriter, r *http.Request, req *protocol.Exec
 	cloneProgress, cloneInProgress := s.locker.Status(dir)
 	if cloneInProgress {
 		status = "clone-in-progress"
+		if peer, ok := s.copySources.Load(req.Repo); ok {
+			w.Header().Set(protocol.HandoffPeerHeader, peer.(string))
+		}
 		w.WriteHeader(http.StatusNotFound)
 		_ = json.NewEncoder(w).Encode(&protocol.NotFoundPayload{
 			CloneInProgress: true,
@@ -620,13 +670,15 @@ func (s *Server) exec(w http.ResponseWriter, r *http.Request, req *protocol.Exec
 		return
 	}
 	if !repoCloned(dir) {
-		if req.URL == "" {
+		// Do not clone repos for handoff requests, the client reads them
+		// from a gitserver that has them.
+		if req.URL == "" || r.Header.Get(protocol.HandoffHeader) != "" {
 			status = "repo-not-found"
 			w.WriteHeader(http.StatusNotFound)
 			_ = json.NewEncoder(w).Encode(&protocol.NotFoundPayload{CloneInProgress: false})
 			return
 		}
-		cloneProgress, err := s.cloneRepo(ctx, req.Repo, req.URL, nil)
+		cloneProgress, err := s.cloneRepo(ctx, req.Repo, req.URL, &cloneOptions{Partial: req.CloneOptions})
 		if err != nil {
 			log15.Debug("error cloning repo", "repo", req.Repo, "err", err)
 			status = "repo-not-found"
@@ -635,6 +687,9 @@ func (s *Server) exec(w http.ResponseWriter, r *http.Request, req *protocol.Exec
 			return
 		}
 		status = "clone-in-progress"
+		if peer, ok := s.copySources.Load(req.Repo); ok {
+			w.Header().Set(protocol.HandoffPeerHeader, peer.(string))
+		}
 		w.WriteHeader(http.StatusNotFound)
 		_ = json.NewEncoder(w).Encode(&protocol.NotFoundPayload{
 			CloneInProgress: true,
@@ -678,7 +733,22 @@ func (s *Server) exec(w http.ResponseWriter, r *http.Request, req *protocol.Exec
 	cmd.Stdout = stdoutW
 	cmd.Stderr = stderrW
 
-	exitStatus, execErr = runCommand(ctx, cmd)
+	partial, err := loadCloneOptions(dir)
+	if err != nil {
+		log15.Warn("failed to load clone options", "repo", req.Repo, "error", err)
+	}
+	if execErr = configurePartialCommand(cmd, req.Args, partial); execErr != nil {
+		exitStatus = 1
+	} else {
+		// Fetch the blobs missing from a partial clone whose sizes git
+		// ls-tree --long lists in one go, like for archives.
+		if partial != nil && partial.BlobSizeLimit != "" && !s.DisablePartialClones && lsTreeListsSizes(req.Args) {
+			if err := prefetchListedBlobs(ctx, dir, req.Args); err != nil {
+				log15.Warn("failed to prefetch missing blobs, fetching them lazily", "repo", req.Repo, "error", err)
+			}
+		}
+		exitStatus, execErr = runCommand(ctx, cmd)
+	}
 
 	status = strconv.Itoa(exitStatus)
 	stdoutN = stdoutW.n
@@ -725,6 +795,13 @@ type cloneOptions struct {
 
 	// Overwrite will overwrite the existing clone.
 	Overwrite bool
+
+	// Partial, if set, makes the clone partial or shallow. It is kept for
+	// the later fetches of the repo.
+	Partial *protocol.CloneOptions
+
+	// Peer, if set, is the address of a gitserver to copy the repo from.
+	Peer string
 }
 
 // cloneRepo issues a git clone command for the given repo. It is
@@ -735,6 +812,15 @@ func (s *Server) cloneRepo(ctx context.Context, repo api.RepoName, url string, o
 	}
 	redactor := newURLRedactor(url)
 
+	var partial *protocol.CloneOptions
+	var peer string
+	if opts != nil {
+		partial, peer = s.supportedCloneOptions(opts.Partial), opts.Peer
+	}
+	if err := validateCloneOptions(partial); err != nil {
+		return "", errors.Wrapf(err, "error cloning repo: repo %s", repo)
+	}
+
 	dir := s.dir(repo)
 
 	// PERF: Before doing the network request to check if isCloneable, lets
@@ -753,7 +839,20 @@ func (s *Server) cloneRepo(ctx context.Context, repo api.RepoName, url string, o
 		return "", err // err will be a context error
 	}
 	defer cancel()
-	if err := s.isCloneable(ctx, url); err != nil {
+
+	// Copy the repo from another gitserver that has it, rather than cloning
+	// it from the code host again. Partial clones need the code host to
+	// fetch their missing blobs, so they are always cloned from it.
+	remoteURL := url
+	if partial == nil {
+		peer = s.peerCloneAddr(ctx, repo, peer)
+	} else {
+		peer = ""
+	}
+	if peer != "" {
+		remoteURL = peerCloneURL(peer, repo)
+	}
+	if err := s.isCloneable(ctx, remoteURL); err != nil {
 		return "", fmt.Errorf("error cloning repo: repo %s not cloneable: %s", repo, redactor.redact(err.Error()))
 	}
 
@@ -775,8 +874,18 @@ func (s *Server) cloneRepo(ctx context.Context, repo api.RepoName, url string, o
 	// We clone to a temporary location first to avoid having incomplete
 	// clones in the repo tree. This also avoids leaving behind corrupt clones
 	// if the clone is interrupted.
+	if peer != "" {
+		// Clients read the repo from the peer until it is copied.
+		s.copySources.Store(repo, peer)
+	}
 	doClone := func(ctx context.Context) error {
 		defer lock.Release()
+		if peer != "" {
+			defer s.copySources.Delete(repo)
+		}
+
+		cloneStart := time.Now()
+		lock.SetProgress(newCloneProgressTracker(cloneStart).progress)
 
 		ctx, cancel1, err := s.acquireCloneLimiter(ctx)
 		if err != nil {
@@ -808,29 +917,55 @@ func (s *Server) cloneRepo(ctx context.Context, repo api.RepoName, url string, o
 		tmpPath = filepath.Join(tmpPath, ".git")
 		tmp := GitDir(tmpPath)
 
-		var cmd *exec.Cmd
-		if useRefspecOverrides() {
-			cmd, err = refspecOverridesCloneCmd(ctx, url, tmpPath)
-			if err != nil {
-				return err
+		// Seed the clone from the latest backup of the repo, if there is one,
+		// so that only the changes since are fetched from the code host.
+		restored := false
+		if remoteURL == url && partial == nil && s.BundleStore != nil {
+			lock.SetStatus("restoring from backup")
+			if restored, err = s.restoreBundle(ctx, repo, url, tmpPath); err != nil {
+				log15.Warn("failed to restore repo from backup, cloning it instead", "repo", repo, "error", redactor.redact(err.Error()))
+				if err := os.RemoveAll(tmpPath); err != nil {
+					return err
+				}
 			}
-		} else {
-			cmd = exec.CommandContext(ctx, "git", "clone", "--mirror", "--progress", url, tmpPath)
 		}
-		// see issue #7322: skip LFS content in repositories with Git LFS configured
-		cmd.Env = append(os.Environ(), "GIT_LFS_SKIP_SMUDGE=1")
-		log15.Info("cloning repo", "repo", repo, "tmp", tmpPath, "dst", dstPath)
 
-		pr, pw := io.Pipe()
-		defer pw.Close()
-		go readCloneProgress(redactor, lock, pr)
+		if !restored {
+			var cmd *exec.Cmd
+			if useRefspecOverrides() {
+				cmd, err = refspecOverridesCloneCmd(ctx, remoteURL, tmpPath)
+				if err != nil {
+					return err
+				}
+			} else {
+				args := append([]string{"clone", "--mirror", "--progress"}, cloneOptionsArgs(partial)...)
+				cmd = exec.CommandContext(ctx, "git", append(args, remoteURL, tmpPath)...)
+			}
+			// see issue #7322: skip LFS content in repositories with Git LFS configured
+			cmd.Env = append(os.Environ(), "GIT_LFS_SKIP_SMUDGE=1")
+			log15.Info("cloning repo", "repo", repo, "tmp", tmpPath, "dst", dstPath)
+
+			pr, pw := io.Pipe()
+			defer pw.Close()
+			go readCloneProgress(redactor, lock, newCloneProgressTracker(cloneStart), pr)
 
-		if output, err := runWithRemoteOpts(ctx, cmd, pw); err != nil {
-			return errors.Wrapf(err, "clone failed. Output: %s", string(output))
+			if output, err := runWithRemoteOpts(ctx, cmd, pw); err != nil {
+				return errors.Wrapf(err, "clone failed. Output: %s", string(output))
+			}
 		}
 
 		removeBadRefs(ctx, tmp)
 
+		// A copy from another gitserver fetches from the code host from now
+		// on.
+		if remoteURL != url {
+			cmd := exec.CommandContext(ctx, "git", "remote", "set-url", "origin", "--", url)
+			cmd.Dir = tmpPath
+			if _, err := runCommand(ctx, cmd); err != nil {
+				return errors.Wrap(err, "failed to set remote URL")
+			}
+		}
+
 		// Update the last-changed stamp.
 		if err := setLastChanged(tmp); err != nil {
 			return errors.Wrapf(err, "failed to update last changed time")
@@ -841,6 +976,21 @@ func (s *Server) cloneRepo(ctx context.Context, repo api.RepoName, url string, o
 			return err
 		}
 
+		if err := saveCloneOptions(tmp, partial); err != nil {
+			return errors.Wrap(err, "failed to save clone options")
+		}
+
+		// Keep the final progress of the clone, so that it can be reported
+		// with the repo.
+		final := newCloneProgressTracker(cloneStart)
+		if progress, ok := s.locker.Progress(dir); ok {
+			final.progress = progress
+		}
+		final.done(time.Now())
+		if err := saveCloneProgress(tmp, final.progress); err != nil {
+			log15.Warn("failed to save clone progress", "repo", repo, "error", err)
+		}
+
 		if overwrite {
 			// remove the current repo by putting it into our temporary directory
 			err := renameAndSync(dstPath, filepath.Join(filepath.Dir(tmpPath), "old"))
@@ -883,12 +1033,15 @@ func (s *Server) cloneRepo(ctx context.Context, repo api.RepoName, url string, o
 }
 
 // readCloneProgress scans the reader and saves the most recent line of output
-// as the lock status.
-func readCloneProgress(redactor *urlRedactor, lock *RepositoryLock, pr io.Reader) {
+// as the lock status, and the progress that it reports as the lock progress.
+func readCloneProgress(redactor *urlRedactor, lock *RepositoryLock, tracker *cloneProgressTracker, pr io.Reader) {
 	scan := bufio.NewScanner(pr)
 	scan.Split(scanCRLF)
 	for scan.Scan() {
 		progress := scan.Text()
+		if tracker.update(progress, time.Now()) {
+			lock.SetProgress(tracker.progress)
+		}
 
 		// 🚨 SECURITY: The output could include the clone url with may contain a sensitive token.
 		// Redact the full url and any found HTTP credentials to be safe.
@@ -1255,6 +1408,20 @@ func computeRefHash(dir GitDir) ([]byte, error) {
 	return hash, nil
 }
 
+// fetchCmd returns the command to fetch the changes of a repo cloned with
+// the options partial from url, and whether to configure the remote options
+// when running it.
+func fetchCmd(ctx context.Context, url string, partial *protocol.CloneOptions) (cmd *exec.Cmd, configRemoteOpts bool) {
+	if customCmd := customFetchCmd(ctx, url); customCmd != nil {
+		return customCmd, false
+	}
+	if useRefspecOverrides() {
+		return refspecOverridesFetchCmd(ctx, url), true
+	}
+	args := append([]string{"fetch", "--prune"}, cloneOptionsArgs(partial)...)
+	return exec.CommandContext(ctx, "git", append(args, url, "+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*", "+refs/pull/*:refs/pull/*", "+refs/sourcegraph/*:refs/sourcegraph/*")...), true
+}
+
 func (s *Server) doRepoUpdate2(repo api.RepoName, url string) error {
 	// background context.
 	ctx, cancel1 := s.serverContext()
@@ -1303,16 +1470,12 @@ func (s *Server) doRepoUpdate2(repo api.RepoName, url string) error {
 		}
 	}
 
-	configRemoteOpts := true
-	var cmd *exec.Cmd
-	if customCmd := customFetchCmd(ctx, url); customCmd != nil {
-		cmd = customCmd
-		configRemoteOpts = false
-	} else if useRefspecOverrides() {
-		cmd = refspecOverridesFetchCmd(ctx, url)
-	} else {
-		cmd = exec.CommandContext(ctx, "git", "fetch", "--prune", url, "+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*", "+refs/pull/*:refs/pull/*", "+refs/sourcegraph/*:refs/sourcegraph/*")
+	partial, err := loadCloneOptions(dir)
+	if err != nil {
+		log15.Warn("Failed to load clone options", "repo", repo, "error", err)
 	}
+
+	cmd, configRemoteOpts := fetchCmd(ctx, url, partial)
 	cmd.Dir = string(dir)
 
 	// drop temporary pack files after a fetch. this function won't
@@ -49,6 +49,23 @@ type RewriteSpecification struct {
 
 	// A directory prefix to exclude (e.g., vendor)
 	DirectoryExclude string
+
+	// IsRegExp if true will treat MatchTemplate as a Go regular expression
+	// and RewriteTemplate as its replacement, in which $1 or ${name} expand
+	// to the submatches (see regexp.Regexp.Expand). The files are rewritten
+	// by the replacer itself instead of comby.
+	IsRegExp bool
+
+	// IncludePatterns is a list of regexes that the paths of the files to
+	// rewrite need to match. It is only supported if IsRegExp is true.
+	//
+	// The patterns are ANDed together; a file's path must match all patterns
+	// for it to be kept.
+	IncludePatterns []string
+
+	// ExcludePattern is an optional regex that the paths of the files to
+	// rewrite must not match. It is only supported if IsRegExp is true.
+	ExcludePattern string
 }
 
 // GitserverRepo returns the repository information necessary to perform gitserver requests.
@@ -0,0 +1,123 @@
+package replace
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// diffContextLines is the number of unchanged lines around the changes of a
+// hunk, as in the diffs of comby.
+const diffContextLines = 3
+
+// diffLine is a line of a diff. Its text includes the newline, unless it is
+// the last line of a file without a trailing newline.
+type diffLine struct {
+	op   diffmatchpatch.Operation
+	text string
+}
+
+// unifiedDiff returns the changes from a to b of the file at path as a
+// unified diff, in the same format as the diffs of comby: the filenames are
+// not prefixed, and the diff does not end with a newline. It returns "" if a
+// and b are equal.
+func unifiedDiff(path, a, b string) string {
+	lines := diffLines(a, b)
+
+	var hunks []string
+	for i := 0; i < len(lines); {
+		if lines[i].op == diffmatchpatch.DiffEqual {
+			i++
+			continue
+		}
+
+		// The hunk starts with the context before the change and ends when
+		// the next change is too far away to share context.
+		start := i - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(lines) && j-end <= 2*diffContextLines; j++ {
+			if lines[j].op != diffmatchpatch.DiffEqual {
+				end = j + 1
+			}
+		}
+		i = end
+		end += diffContextLines
+		if end > len(lines) {
+			end = len(lines)
+		}
+		hunks = append(hunks, formatHunk(lines, start, end))
+	}
+	if len(hunks) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(fmt.Sprintf("--- %s\n+++ %s\n%s", path, path, strings.Join(hunks, "")), "\n")
+}
+
+// diffLines returns the lines of a and b, marked as deleted from a, inserted
+// in b or equal.
+func diffLines(a, b string) []diffLine {
+	dmp := diffmatchpatch.New()
+	runesA, runesB, lineArray := dmp.DiffLinesToRunes(a, b)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMainRunes(runesA, runesB, false), lineArray)
+
+	var lines []diffLine
+	for _, d := range diffs {
+		for _, text := range strings.SplitAfter(d.Text, "\n") {
+			if text != "" {
+				lines = append(lines, diffLine{op: d.Type, text: text})
+			}
+		}
+	}
+	return lines
+}
+
+// formatHunk formats lines[start:end] as a hunk.
+func formatHunk(lines []diffLine, start, end int) string {
+	// Count the lines of a and b before the hunk.
+	var linesA, linesB int
+	for _, line := range lines[:start] {
+		if line.op != diffmatchpatch.DiffInsert {
+			linesA++
+		}
+		if line.op != diffmatchpatch.DiffDelete {
+			linesB++
+		}
+	}
+
+	var body strings.Builder
+	var lenA, lenB int
+	for _, line := range lines[start:end] {
+		switch line.op {
+		case diffmatchpatch.DiffEqual:
+			body.WriteByte(' ')
+			lenA++
+			lenB++
+		case diffmatchpatch.DiffDelete:
+			body.WriteByte('-')
+			lenA++
+		case diffmatchpatch.DiffInsert:
+			body.WriteByte('+')
+			lenB++
+		}
+		body.WriteString(line.text)
+		if !strings.HasSuffix(line.text, "\n") {
+			body.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+
+	return fmt.Sprintf("@@ -%s +%s @@\n%s", hunkRange(linesA, lenA), hunkRange(linesB, lenB), body.String())
+}
+
+// hunkRange formats the range of lines of a hunk in one of the files, given
+// the number of lines before the hunk and in the hunk. An empty range starts
+// at the line before it.
+func hunkRange(before, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	return fmt.Sprintf("%d,%d", before+1, n)
+}
@@ -0,0 +1,67 @@
+package replace
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(n int, changed map[int]string) string {
+		var b strings.Builder
+		for i := 1; i <= n; i++ {
+			if s, ok := changed[i]; ok {
+				b.WriteString(s)
+				continue
+			}
+			b.WriteString(string(rune('a'+i-1)) + "\n")
+		}
+		return b.String()
+	}
+
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "equal",
+			a:    lines(3, nil),
+			b:    lines(3, nil),
+			want: "",
+		},
+		{
+			name: "separate hunks",
+			a:    lines(20, nil),
+			b:    lines(20, map[int]string{2: "B\n", 19: "S\n"}),
+			want: "--- f\n+++ f\n" +
+				"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+				"@@ -16,5 +16,5 @@\n p\n q\n r\n-s\n+S\n t",
+		},
+		{
+			name: "merged hunks",
+			a:    lines(12, nil),
+			b:    lines(12, map[int]string{2: "B\n", 9: "I\n"}),
+			want: "--- f\n+++ f\n" +
+				"@@ -1,12 +1,12 @@\n a\n-b\n+B\n c\n d\n e\n f\n g\n h\n-i\n+I\n j\n k\n l",
+		},
+		{
+			name: "insertion and deletion",
+			a:    lines(2, nil),
+			b:    "x\n" + lines(2, map[int]string{2: ""}),
+			want: "--- f\n+++ f\n@@ -1,2 +1,2 @@\n+x\n a\n-b",
+		},
+		{
+			name: "empty file",
+			a:    "",
+			b:    "a",
+			want: "--- f\n+++ f\n@@ -0,0 +1,1 @@\n+a\n\\ No newline at end of file",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := unifiedDiff("f", test.a, test.b); got != test.want {
+				t.Errorf("got diff\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
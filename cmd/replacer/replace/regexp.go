@@ -0,0 +1,104 @@
+package replace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/cmd/replacer/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/pathmatch"
+	"github.com/sourcegraph/sourcegraph/internal/store"
+)
+
+// regexpRewriter rewrites files with a Go regular expression. Unlike comby,
+// it runs in the replacer process.
+type regexpRewriter struct {
+	re          *regexp.Regexp
+	replacement []byte
+
+	fileExtension    string
+	directoryExclude string
+	matchPath        pathmatch.PathMatcher
+}
+
+// rewriteResult is a rewritten file, in the JSON lines format of comby.
+type rewriteResult struct {
+	URI  string `json:"uri"`
+	Diff string `json:"diff"`
+}
+
+func compileRegexpRewriter(spec *protocol.RewriteSpecification) (*regexpRewriter, error) {
+	re, err := regexp.Compile(spec.MatchTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid MatchTemplate")
+	}
+	matchPath, err := pathmatch.CompilePathPatterns(spec.IncludePatterns, spec.ExcludePattern, pathmatch.CompileOptions{
+		RegExp:        true,
+		CaseSensitive: true,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid IncludePatterns or ExcludePattern")
+	}
+	return &regexpRewriter{
+		re:               re,
+		replacement:      []byte(spec.RewriteTemplate),
+		fileExtension:    spec.FileExtension,
+		directoryExclude: strings.Trim(spec.DirectoryExclude, "/"),
+		matchPath:        matchPath,
+	}, nil
+}
+
+// matchFile reports whether the file at path should be rewritten.
+func (rw *regexpRewriter) matchFile(path string) bool {
+	if rw.fileExtension != "" && !strings.HasSuffix(path, rw.fileExtension) {
+		return false
+	}
+	if rw.directoryExclude != "" && strings.HasPrefix(path, rw.directoryExclude+"/") {
+		return false
+	}
+	return rw.matchPath.MatchPath(path)
+}
+
+// rewrite rewrites the files of zf and writes a JSON line with the diff of
+// each changed file to w. Binary files are skipped.
+func (rw *regexpRewriter) rewrite(ctx context.Context, zf *store.ZipFile, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for i := range zf.Files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		f := &zf.Files[i]
+		if !rw.matchFile(f.Name) {
+			continue
+		}
+		data := zf.DataFor(f)
+		if isBinary(data) || !rw.re.Match(data) {
+			continue
+		}
+
+		rewritten := rw.re.ReplaceAll(data, rw.replacement)
+		diff := unifiedDiff(f.Name, string(data), string(rewritten))
+		if diff == "" {
+			continue
+		}
+		if err := enc.Encode(rewriteResult{URI: f.Name, Diff: diff}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isBinary reports whether data looks like the contents of a binary file,
+// using the same heuristic as git: it contains a NUL byte in its first 8000
+// bytes.
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
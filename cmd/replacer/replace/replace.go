@@ -12,6 +12,7 @@
 // * Pass the zip file path to external replacer tool(s) after validating
 // * Read tool stdout and write it out on the HTTP connection
 // * Input from stdout is expected to use JSON lines format, but the format isn't checked here: line-buffering is done on the frontend
+// * Regular expression rewrites (IsRegExp) are done in process, and are written in the same JSON lines format as comby
 
 package replace
 
@@ -214,6 +215,17 @@ func (s *Service) replace(ctx context.Context, p *protocol.Request, w http.Respo
 	w.Header().Set("Transfer-Encoding", "chunked")
 	w.WriteHeader(http.StatusOK)
 
+	if p.IsRegExp {
+		rw, err := compileRegexpRewriter(&p.RewriteSpecification)
+		if err != nil {
+			return false, err
+		}
+		if err := rw.rewrite(ctx, zf, w); err != nil {
+			return false, errors.Wrap(err, "failed to rewrite files")
+		}
+		return false, nil
+	}
+
 	t := &ExternalTool{
 		Name:       "comby",
 		BinaryPath: "comby",
@@ -261,6 +273,13 @@ func validateParams(p *protocol.Request) error {
 	if p.RewriteSpecification.MatchTemplate == "" {
 		return errors.New("MatchTemplate must be non-empty")
 	}
+	if p.RewriteSpecification.IsRegExp {
+		if _, err := compileRegexpRewriter(&p.RewriteSpecification); err != nil {
+			return err
+		}
+	} else if len(p.RewriteSpecification.IncludePatterns) > 0 || p.RewriteSpecification.ExcludePattern != "" {
+		return errors.New("IncludePatterns and ExcludePattern are only supported if IsRegExp is true")
+	}
 	return nil
 }
 
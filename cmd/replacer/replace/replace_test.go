@@ -8,6 +8,8 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -89,6 +91,97 @@ func main() {
 	}
 }
 
+func TestReplace_regexp(t *testing.T) {
+	files := map[string]string{
+		"README.md": "# Hello World\n\nHello world example in go\n",
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("Hello foo")
+	fmt.Println("Hello bar")
+}
+`,
+		"vendor/lib.go": `package lib
+
+func init() { println("Hello foo") }`,
+		"bin": "Hello foo\x00",
+	}
+
+	cases := []struct {
+		arg  protocol.RewriteSpecification
+		want string
+	}{
+		{protocol.RewriteSpecification{
+			MatchTemplate:   `Hello (\w+)`,
+			RewriteTemplate: "Goodbye ${1}!",
+			IsRegExp:        true,
+			IncludePatterns: []string{`\.go$`},
+		}, `
+{"uri":"main.go","diff":"--- main.go\n+++ main.go\n@@ -3,6 +3,6 @@\n import \"fmt\"\n \n func main() {\n-\tfmt.Println(\"Hello foo\")\n-\tfmt.Println(\"Hello bar\")\n+\tfmt.Println(\"Goodbye foo!\")\n+\tfmt.Println(\"Goodbye bar!\")\n }"}
+{"uri":"vendor/lib.go","diff":"--- vendor/lib.go\n+++ vendor/lib.go\n@@ -1,3 +1,3 @@\n package lib\n \n-func init() { println(\"Hello foo\") }\n\\ No newline at end of file\n+func init() { println(\"Goodbye foo!\") }\n\\ No newline at end of file"}
+`},
+		{protocol.RewriteSpecification{
+			MatchTemplate:   `(?m)^# (.*)$`,
+			RewriteTemplate: "$1\n===",
+			IsRegExp:        true,
+			ExcludePattern:  `\.go$`,
+		}, `
+{"uri":"README.md","diff":"--- README.md\n+++ README.md\n@@ -1,3 +1,4 @@\n-# Hello World\n+Hello World\n+===\n \n Hello world example in go"}
+`},
+		{protocol.RewriteSpecification{
+			MatchTemplate:    `foo`,
+			RewriteTemplate:  "baz",
+			IsRegExp:         true,
+			FileExtension:    ".go",
+			DirectoryExclude: "vendor",
+		}, `
+{"uri":"main.go","diff":"--- main.go\n+++ main.go\n@@ -3,6 +3,6 @@\n import \"fmt\"\n \n func main() {\n-\tfmt.Println(\"Hello foo\")\n+\tfmt.Println(\"Hello baz\")\n \tfmt.Println(\"Hello bar\")\n }"}
+`},
+	}
+
+	store, cleanup, err := testutil.NewStore(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	ts := httptest.NewServer(&replace.Service{Store: store})
+	defer ts.Close()
+
+	for _, test := range cases {
+		req := protocol.Request{
+			Repo:                 "foo",
+			URL:                  "u",
+			Commit:               "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+			RewriteSpecification: test.arg,
+			FetchTimeout:         "5000ms",
+		}
+		got, err := doReplace(ts.URL, &req)
+		if err != nil {
+			t.Errorf("%v failed: %s", test.arg, err)
+			continue
+		}
+
+		// Files are rewritten in the order of the archive.
+		got = sortLines(got)
+		want := sortLines(test.want[1:])
+		if got != want {
+			d, err := testutil.Diff(want, got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Errorf("%v unexpected response:\n%s", test.arg, d)
+		}
+	}
+}
+
+func sortLines(s string) string {
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
 func TestReplace_badrequest(t *testing.T) {
 	cases := []protocol.Request{
 		{
@@ -97,6 +190,24 @@ func TestReplace_badrequest(t *testing.T) {
 			Commit: "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
 			// No MatchTemplate
 		},
+		{
+			Repo:   "foo",
+			URL:    "u",
+			Commit: "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+			RewriteSpecification: protocol.RewriteSpecification{
+				MatchTemplate: "(",
+				IsRegExp:      true,
+			},
+		},
+		{
+			Repo:   "foo",
+			URL:    "u",
+			Commit: "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+			RewriteSpecification: protocol.RewriteSpecification{
+				MatchTemplate:   "foo",
+				IncludePatterns: []string{`\.go$`},
+			},
+		},
 	}
 
 	store, cleanup, err := testutil.NewStore(nil)
@@ -120,13 +231,17 @@ func TestReplace_badrequest(t *testing.T) {
 
 func doReplace(u string, p *protocol.Request) (string, error) {
 	form := url.Values{
-		"Repo":            []string{string(p.Repo)},
-		"URL":             []string{string(p.URL)},
-		"Commit":          []string{string(p.Commit)},
-		"FetchTimeout":    []string{p.FetchTimeout},
-		"MatchTemplate":   []string{p.RewriteSpecification.MatchTemplate},
-		"RewriteTemplate": []string{p.RewriteSpecification.RewriteTemplate},
-		"FileExtension":   []string{p.RewriteSpecification.FileExtension},
+		"Repo":             []string{string(p.Repo)},
+		"URL":              []string{string(p.URL)},
+		"Commit":           []string{string(p.Commit)},
+		"FetchTimeout":     []string{p.FetchTimeout},
+		"MatchTemplate":    []string{p.RewriteSpecification.MatchTemplate},
+		"RewriteTemplate":  []string{p.RewriteSpecification.RewriteTemplate},
+		"FileExtension":    []string{p.RewriteSpecification.FileExtension},
+		"DirectoryExclude": []string{p.RewriteSpecification.DirectoryExclude},
+		"IsRegExp":         []string{strconv.FormatBool(p.RewriteSpecification.IsRegExp)},
+		"IncludePatterns":  p.RewriteSpecification.IncludePatterns,
+		"ExcludePattern":   []string{p.RewriteSpecification.ExcludePattern},
 	}
 	resp, err := http.PostForm(u, form)
 	if err != nil {
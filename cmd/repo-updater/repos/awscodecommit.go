@@ -30,7 +30,8 @@ type AWSCodeCommitSource struct {
 	awsRegion    endpoints.Region
 	client       *awscodecommit.Client
 
-	exclude excludeFunc
+	exclude      excludeFunc
+	cloneOptions cloneOptionsFunc
 }
 
 // NewAWSCodeCommitSource returns a new AWSCodeCommitSource from the given external service.
@@ -82,12 +83,22 @@ func newAWSCodeCommitSource(svc *ExternalService, c *schema.AWSCodeCommitConnect
 		return nil, err
 	}
 
+	var cb cloneOptionsBuilder
+	for _, o := range c.CloneOptions {
+		cb.Add(o.Pattern, o.BlobSizeLimit, o.Depth)
+	}
+	cloneOptions, err := cb.Build()
+	if err != nil {
+		return nil, err
+	}
+
 	s := &AWSCodeCommitSource{
-		svc:       svc,
-		config:    c,
-		awsConfig: awsConfig,
-		exclude:   exclude,
-		client:    awscodecommit.NewClient(awsConfig),
+		svc:          svc,
+		config:       c,
+		awsConfig:    awsConfig,
+		exclude:      exclude,
+		cloneOptions: cloneOptions,
+		client:       awscodecommit.NewClient(awsConfig),
 	}
 
 	var ok bool
@@ -119,15 +130,18 @@ func (s *AWSCodeCommitSource) makeRepo(r *awscodecommit.Repository) (*Repo, erro
 	cloneURL := s.authenticatedRemoteURL(r)
 	serviceID := awscodecommit.ServiceID(s.awsPartition, s.awsRegion, r.AccountID)
 
+	name := string(reposource.AWSRepoName(s.config.RepositoryPathPattern, r.Name))
+
 	return &Repo{
-		Name:         string(reposource.AWSRepoName(s.config.RepositoryPathPattern, r.Name)),
+		Name:         name,
 		URI:          string(reposource.AWSRepoName("", r.Name)),
 		ExternalRepo: awscodecommit.ExternalRepoSpec(r, serviceID),
 		Description:  r.Description,
 		Sources: map[string]*SourceInfo{
 			urn: {
-				ID:       urn,
-				CloneURL: cloneURL,
+				ID:           urn,
+				CloneURL:     cloneURL,
+				CloneOptions: s.cloneOptions(name),
 			},
 		},
 		Metadata: r,
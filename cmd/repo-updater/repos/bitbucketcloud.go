@@ -20,10 +20,11 @@ import (
 // A BitbucketCloudSource yields repositories from a single BitbucketCloud connection configured
 // in Sourcegraph via the external services configuration.
 type BitbucketCloudSource struct {
-	svc     *ExternalService
-	config  *schema.BitbucketCloudConnection
-	exclude excludeFunc
-	client  *bitbucketcloud.Client
+	svc          *ExternalService
+	config       *schema.BitbucketCloudConnection
+	exclude      excludeFunc
+	cloneOptions cloneOptionsFunc
+	client       *bitbucketcloud.Client
 }
 
 // NewBitbucketCloudSource returns a new BitbucketCloudSource from the given external service.
@@ -65,15 +66,25 @@ func newBitbucketCloudSource(svc *ExternalService, c *schema.BitbucketCloudConne
 		return nil, err
 	}
 
+	var cb cloneOptionsBuilder
+	for _, o := range c.CloneOptions {
+		cb.Add(o.Pattern, o.BlobSizeLimit, o.Depth)
+	}
+	cloneOptions, err := cb.Build()
+	if err != nil {
+		return nil, err
+	}
+
 	client := bitbucketcloud.NewClient(apiURL, cli)
 	client.Username = c.Username
 	client.AppPassword = c.AppPassword
 
 	return &BitbucketCloudSource{
-		svc:     svc,
-		config:  c,
-		exclude: exclude,
-		client:  client,
+		svc:          svc,
+		config:       c,
+		exclude:      exclude,
+		cloneOptions: cloneOptions,
+		client:       client,
 	}, nil
 }
 
@@ -97,12 +108,13 @@ func (s BitbucketCloudSource) makeRepo(r *bitbucketcloud.Repo) *Repo {
 	host = extsvc.NormalizeBaseURL(host)
 
 	urn := s.svc.URN()
+	name := string(reposource.BitbucketCloudRepoName(
+		s.config.RepositoryPathPattern,
+		host.Hostname(),
+		r.FullName,
+	))
 	return &Repo{
-		Name: string(reposource.BitbucketCloudRepoName(
-			s.config.RepositoryPathPattern,
-			host.Hostname(),
-			r.FullName,
-		)),
+		Name: name,
 		URI: string(reposource.BitbucketCloudRepoName(
 			"",
 			host.Hostname(),
@@ -118,8 +130,9 @@ func (s BitbucketCloudSource) makeRepo(r *bitbucketcloud.Repo) *Repo {
 		Private:     r.IsPrivate,
 		Sources: map[string]*SourceInfo{
 			urn: {
-				ID:       urn,
-				CloneURL: s.authenticatedRemoteURL(r),
+				ID:           urn,
+				CloneURL:     s.authenticatedRemoteURL(r),
+				CloneOptions: s.cloneOptions(name),
 			},
 		},
 		Metadata: r,
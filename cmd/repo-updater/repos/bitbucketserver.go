@@ -24,10 +24,11 @@ import (
 // A BitbucketServerSource yields repositories from a single BitbucketServer connection configured
 // in Sourcegraph via the external services configuration.
 type BitbucketServerSource struct {
-	svc     *ExternalService
-	config  *schema.BitbucketServerConnection
-	exclude excludeFunc
-	client  *bitbucketserver.Client
+	svc          *ExternalService
+	config       *schema.BitbucketServerConnection
+	exclude      excludeFunc
+	cloneOptions cloneOptionsFunc
+	client       *bitbucketserver.Client
 
 	// rateLimiter should be used to limit requests made to the external service
 	rateLimiter *rate.Limiter
@@ -72,17 +73,27 @@ func newBitbucketServerSource(svc *ExternalService, c *schema.BitbucketServerCon
 		return nil, err
 	}
 
+	var cb cloneOptionsBuilder
+	for _, o := range c.CloneOptions {
+		cb.Add(o.Pattern, o.BlobSizeLimit, o.Depth)
+	}
+	cloneOptions, err := cb.Build()
+	if err != nil {
+		return nil, err
+	}
+
 	client, err := bitbucketserver.NewClient(c, cli)
 	if err != nil {
 		return nil, err
 	}
 
 	return &BitbucketServerSource{
-		svc:         svc,
-		config:      c,
-		exclude:     exclude,
-		client:      client,
-		rateLimiter: rl,
+		svc:          svc,
+		config:       c,
+		exclude:      exclude,
+		cloneOptions: cloneOptions,
+		client:       client,
+		rateLimiter:  rl,
 	}, nil
 }
 
@@ -297,14 +308,15 @@ func (s BitbucketServerSource) makeRepo(repo *bitbucketserver.Repo, isArchived b
 	}
 
 	urn := s.svc.URN()
+	name := string(reposource.BitbucketServerRepoName(
+		s.config.RepositoryPathPattern,
+		host.Hostname(),
+		project,
+		repo.Slug,
+	))
 
 	return &Repo{
-		Name: string(reposource.BitbucketServerRepoName(
-			s.config.RepositoryPathPattern,
-			host.Hostname(),
-			project,
-			repo.Slug,
-		)),
+		Name: name,
 		URI: string(reposource.BitbucketServerRepoName(
 			"",
 			host.Hostname(),
@@ -322,8 +334,9 @@ func (s BitbucketServerSource) makeRepo(repo *bitbucketserver.Repo, isArchived b
 		Private:     !repo.Public,
 		Sources: map[string]*SourceInfo{
 			urn: {
-				ID:       urn,
-				CloneURL: cloneURL,
+				ID:           urn,
+				CloneURL:     cloneURL,
+				CloneOptions: s.cloneOptions(name),
 			},
 		},
 		Metadata: repo,
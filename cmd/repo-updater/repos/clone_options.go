@@ -0,0 +1,51 @@
+package repos
+
+import (
+	"regexp"
+
+	gitserverprotocol "github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
+)
+
+// cloneOptionsFunc takes a repository name and returns the options for
+// cloning it, or nil to clone the whole repository.
+type cloneOptionsFunc func(string) *gitserverprotocol.CloneOptions
+
+// cloneOptionsBuilder builds a cloneOptionsFunc from the cloneOptions of a
+// code host connection.
+type cloneOptionsBuilder struct {
+	patterns []*regexp.Regexp
+	options  []*gitserverprotocol.CloneOptions
+
+	err error
+}
+
+// Add makes the repositories whose names match the regex pattern, and no
+// earlier pattern, cloned with the given blob size limit and depth.
+func (b *cloneOptionsBuilder) Add(pattern, blobSizeLimit string, depth int) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		b.err = err
+		return
+	}
+	b.patterns = append(b.patterns, re)
+	b.options = append(b.options, &gitserverprotocol.CloneOptions{
+		BlobSizeLimit: blobSizeLimit,
+		Depth:         depth,
+	})
+}
+
+// Build returns a cloneOptionsFunc based on the added patterns. If any of
+// the patterns failed to compile, the error is returned.
+func (b *cloneOptionsBuilder) Build() (cloneOptionsFunc, error) {
+	return func(name string) *gitserverprotocol.CloneOptions {
+		for i, re := range b.patterns {
+			if re.MatchString(name) {
+				if opts := b.options[i]; opts.BlobSizeLimit != "" || opts.Depth > 0 {
+					return opts
+				}
+				return nil
+			}
+		}
+		return nil
+	}, b.err
+}
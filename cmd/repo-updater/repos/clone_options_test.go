@@ -0,0 +1,51 @@
+package repos
+
+import (
+	"reflect"
+	"testing"
+
+	gitserverprotocol "github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
+)
+
+func TestCloneOptionsBuilder(t *testing.T) {
+	var b cloneOptionsBuilder
+	b.Add(`^github\.com/foo/huge$`, "1m", 0)
+	b.Add(`^github\.com/foo/skip$`, "", 0)
+	b.Add(`^github\.com/foo/`, "", 100)
+	cloneOptions, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]*gitserverprotocol.CloneOptions{
+		"github.com/foo/huge":  {BlobSizeLimit: "1m"},
+		"github.com/foo/skip":  nil,
+		"github.com/foo/other": {Depth: 100},
+		"github.com/bar/baz":   nil,
+	} {
+		if got := cloneOptions(name); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got clone options %+v, want %+v", name, got, want)
+		}
+	}
+
+	b.Add("(", "1m", 0)
+	if _, err := b.Build(); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestRepo_CloneOptions(t *testing.T) {
+	opts := &gitserverprotocol.CloneOptions{Depth: 1}
+	r := &Repo{Sources: map[string]*SourceInfo{
+		"extsvc:github:2": {ID: "extsvc:github:2", CloneOptions: &gitserverprotocol.CloneOptions{Depth: 2}},
+		"extsvc:github:1": {ID: "extsvc:github:1", CloneOptions: opts},
+		"extsvc:gitlab:3": {ID: "extsvc:gitlab:3"},
+	}}
+	if got := r.CloneOptions(); got != opts {
+		t.Errorf("got clone options %+v, want %+v", got, opts)
+	}
+
+	if got := (&Repo{}).CloneOptions(); got != nil {
+		t.Errorf("got clone options %+v for a repo without sources, want nil", got)
+	}
+}
@@ -29,6 +29,7 @@ type GithubSource struct {
 	svc             *ExternalService
 	config          *schema.GitHubConnection
 	exclude         excludeFunc
+	cloneOptions    cloneOptionsFunc
 	excludeArchived bool
 	excludeForks    bool
 	githubDotCom    bool
@@ -112,10 +113,20 @@ func newGithubSource(svc *ExternalService, c *schema.GitHubConnection, cf *httpc
 		return nil, err
 	}
 
+	var cb cloneOptionsBuilder
+	for _, o := range c.CloneOptions {
+		cb.Add(o.Pattern, o.BlobSizeLimit, o.Depth)
+	}
+	cloneOptions, err := cb.Build()
+	if err != nil {
+		return nil, err
+	}
+
 	return &GithubSource{
 		svc:              svc,
 		config:           c,
 		exclude:          exclude,
+		cloneOptions:     cloneOptions,
 		excludeArchived:  excludeArchived,
 		excludeForks:     excludeForks,
 		baseURL:          baseURL,
@@ -295,12 +306,13 @@ func (s GithubSource) GetRepo(ctx context.Context, nameWithOwner string) (*Repo,
 
 func (s GithubSource) makeRepo(r *github.Repository) *Repo {
 	urn := s.svc.URN()
+	name := string(reposource.GitHubRepoName(
+		s.config.RepositoryPathPattern,
+		s.originalHostname,
+		r.NameWithOwner,
+	))
 	return &Repo{
-		Name: string(reposource.GitHubRepoName(
-			s.config.RepositoryPathPattern,
-			s.originalHostname,
-			r.NameWithOwner,
-		)),
+		Name: name,
 		URI: string(reposource.GitHubRepoName(
 			"",
 			s.originalHostname,
@@ -313,8 +325,9 @@ func (s GithubSource) makeRepo(r *github.Repository) *Repo {
 		Private:      r.IsPrivate,
 		Sources: map[string]*SourceInfo{
 			urn: {
-				ID:       urn,
-				CloneURL: s.authenticatedRemoteURL(r),
+				ID:           urn,
+				CloneURL:     s.authenticatedRemoteURL(r),
+				CloneOptions: s.cloneOptions(name),
 			},
 		},
 		Metadata: r,
@@ -25,9 +25,10 @@ type GitoliteSource struct {
 	conn *schema.GitoliteConnection
 	// We ask gitserver to talk to gitolite because it holds the ssh keys
 	// required for authentication.
-	cli       *gitserver.Client
-	blacklist *regexp.Regexp
-	exclude   excludeFunc
+	cli          *gitserver.Client
+	blacklist    *regexp.Regexp
+	exclude      excludeFunc
+	cloneOptions cloneOptionsFunc
 }
 
 // NewGitoliteSource returns a new GitoliteSource from the given external service.
@@ -63,12 +64,22 @@ func NewGitoliteSource(svc *ExternalService, cf *httpcli.Factory) (*GitoliteSour
 		return nil, err
 	}
 
+	var cb cloneOptionsBuilder
+	for _, o := range c.CloneOptions {
+		cb.Add(o.Pattern, o.BlobSizeLimit, o.Depth)
+	}
+	cloneOptions, err := cb.Build()
+	if err != nil {
+		return nil, err
+	}
+
 	return &GitoliteSource{
-		svc:       svc,
-		conn:      &c,
-		cli:       gitserver.NewClient(hc),
-		blacklist: blacklist,
-		exclude:   exclude,
+		svc:          svc,
+		conn:         &c,
+		cli:          gitserver.NewClient(hc),
+		blacklist:    blacklist,
+		exclude:      exclude,
+		cloneOptions: cloneOptions,
 	}, nil
 }
 
@@ -109,8 +120,9 @@ func (s GitoliteSource) makeRepo(repo *gitolite.Repo) *Repo {
 		ExternalRepo: gitolite.ExternalRepoSpec(repo, gitolite.ServiceID(s.conn.Host)),
 		Sources: map[string]*SourceInfo{
 			urn: {
-				ID:       urn,
-				CloneURL: repo.URL,
+				ID:           urn,
+				CloneURL:     repo.URL,
+				CloneOptions: s.cloneOptions(name),
 			},
 		},
 		Metadata: repo,
@@ -19,9 +19,10 @@ import (
 // A OtherSource yields repositories from a single Other connection configured
 // in Sourcegraph via the external services configuration.
 type OtherSource struct {
-	svc    *ExternalService
-	conn   *schema.OtherExternalServiceConnection
-	client httpcli.Doer
+	svc          *ExternalService
+	conn         *schema.OtherExternalServiceConnection
+	cloneOptions cloneOptionsFunc
+	client       httpcli.Doer
 }
 
 // NewOtherSource returns a new OtherSource from the given external service.
@@ -40,7 +41,16 @@ func NewOtherSource(svc *ExternalService, cf *httpcli.Factory) (*OtherSource, er
 		return nil, err
 	}
 
-	return &OtherSource{svc: svc, conn: &c, client: cli}, nil
+	var cb cloneOptionsBuilder
+	for _, o := range c.CloneOptions {
+		cb.Add(o.Pattern, o.BlobSizeLimit, o.Depth)
+	}
+	cloneOptions, err := cb.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return &OtherSource{svc: svc, conn: &c, cloneOptions: cloneOptions, client: cli}, nil
 }
 
 // ListRepos returns all Other repositories accessible to all connections configured
@@ -135,8 +145,9 @@ func (s OtherSource) otherRepoFromCloneURL(urn string, u *url.URL) (*Repo, error
 		},
 		Sources: map[string]*SourceInfo{
 			urn: {
-				ID:       urn,
-				CloneURL: repoURL,
+				ID:           urn,
+				CloneURL:     repoURL,
+				CloneOptions: s.cloneOptions(string(repoName)),
 			},
 		},
 	}, nil
@@ -196,6 +207,7 @@ func (s OtherSource) srcExpose(ctx context.Context) ([]*Repo, error) {
 		if r.Name == "" {
 			r.Name = r.URI
 		}
+		r.Sources[urn].CloneOptions = s.cloneOptions(r.Name)
 	}
 
 	return data.Items, nil
@@ -18,9 +18,10 @@ import (
 // A PhabricatorSource yields repositories from a single Phabricator connection configured
 // in Sourcegraph via the external services configuration.
 type PhabricatorSource struct {
-	svc  *ExternalService
-	conn *schema.PhabricatorConnection
-	cf   *httpcli.Factory
+	svc          *ExternalService
+	conn         *schema.PhabricatorConnection
+	cloneOptions cloneOptionsFunc
+	cf           *httpcli.Factory
 
 	mu  sync.Mutex
 	cli *phabricator.Client
@@ -32,7 +33,17 @@ func NewPhabricatorSource(svc *ExternalService, cf *httpcli.Factory) (*Phabricat
 	if err := jsonc.Unmarshal(svc.Config, &c); err != nil {
 		return nil, errors.Wrapf(err, "external service id=%d config error", svc.ID)
 	}
-	return &PhabricatorSource{svc: svc, conn: &c, cf: cf}, nil
+
+	var cb cloneOptionsBuilder
+	for _, o := range c.CloneOptions {
+		cb.Add(o.Pattern, o.BlobSizeLimit, o.Depth)
+	}
+	cloneOptions, err := cb.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return &PhabricatorSource{svc: svc, conn: &c, cloneOptions: cloneOptions, cf: cf}, nil
 }
 
 // ListRepos returns all Phabricator repositories accessible to all connections configured
@@ -152,6 +163,7 @@ func (s *PhabricatorSource) makeRepo(repo *phabricator.Repo) (*Repo, error) {
 				// an external URI that's mirrored or observed, etc.
 				// This must be figured out when starting to integrate the new Syncer with this
 				// source.
+				CloneOptions: s.cloneOptions(name),
 			},
 		},
 		Metadata: repo,
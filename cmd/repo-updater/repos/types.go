@@ -22,6 +22,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/extsvc/github"
 	"github.com/sourcegraph/sourcegraph/internal/extsvc/gitlab"
 	"github.com/sourcegraph/sourcegraph/internal/extsvc/gitolite"
+	gitserverprotocol "github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/jsonc"
 	"github.com/sourcegraph/sourcegraph/schema"
 	"github.com/xeipuuv/gojsonschema"
@@ -574,6 +575,9 @@ type Repo struct {
 type SourceInfo struct {
 	ID       string
 	CloneURL string
+	// CloneOptions are the options for cloning the repo that the source
+	// configures, if any.
+	CloneOptions *gitserverprotocol.CloneOptions `json:",omitempty"`
 }
 
 // ExternalServiceID returns the ID of the external service this
@@ -603,6 +607,23 @@ func (r *Repo) CloneURLs() []string {
 	return urls
 }
 
+// CloneOptions returns the options for cloning this repo, or nil if none of
+// its sources configure any. If several sources configure options, the ones
+// of the source with the smallest ID win.
+func (r *Repo) CloneOptions() *gitserverprotocol.CloneOptions {
+	ids := make([]string, 0, len(r.Sources))
+	for id, src := range r.Sources {
+		if src != nil && src.CloneOptions != nil {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+	return r.Sources[ids[0]].CloneOptions
+}
+
 // ExternalServiceIDs returns the IDs of the external services this
 // repo belongs to.
 func (r *Repo) ExternalServiceIDs() []int64 {
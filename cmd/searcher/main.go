@@ -21,6 +21,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/debugserver"
 	"github.com/sourcegraph/sourcegraph/internal/env"
 	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/objectstore"
 	"github.com/sourcegraph/sourcegraph/internal/store"
 	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
 	"github.com/sourcegraph/sourcegraph/internal/tracer"
@@ -28,6 +29,9 @@ import (
 
 var cacheDir = env.Get("CACHE_DIR", "/tmp", "directory to store cached archives.")
 var cacheSizeMB = env.Get("SEARCHER_CACHE_SIZE_MB", "100000", "maximum size of the on disk cache in megabytes")
+var objectStoreURL = env.Get("SEARCHER_OBJECT_STORE_URL", "", "URL of an object store shared by all searchers to cache archives in, such as s3://bucket/prefix, s3://bucket?endpoint=http://minio:9000 or file:///shared/dir")
+var objectStoreMaxAge = env.Get("SEARCHER_OBJECT_STORE_MAX_AGE", "168h", "maximum age of the archives in the object store")
+var objectStoreSizeMB = env.Get("SEARCHER_OBJECT_STORE_SIZE_MB", "500000", "maximum size of the archives in the object store in megabytes")
 
 const port = "3181"
 
@@ -56,6 +60,23 @@ func main() {
 		},
 		Log: log15.Root(),
 	}
+	if objectStoreURL != "" {
+		objectStore, err := objectstore.NewObjectStore(objectStoreURL, ".zip")
+		if err != nil {
+			log.Fatalf("invalid SEARCHER_OBJECT_STORE_URL: %s", err)
+		}
+		maxAge, err := time.ParseDuration(objectStoreMaxAge)
+		if err != nil {
+			log.Fatalf("invalid duration %q for SEARCHER_OBJECT_STORE_MAX_AGE: %s", objectStoreMaxAge, err)
+		}
+		sizeMB, err := strconv.ParseInt(objectStoreSizeMB, 10, 64)
+		if err != nil {
+			log.Fatalf("invalid int %q for SEARCHER_OBJECT_STORE_SIZE_MB: %s", objectStoreSizeMB, err)
+		}
+		service.Store.ObjectStore = objectStore
+		service.Store.ObjectStoreMaxAge = maxAge
+		service.Store.ObjectStoreMaxSizeBytes = sizeMB * 1000 * 1000
+	}
 	service.Store.SetMaxConcurrentFetchTar(10)
 	service.Store.Start()
 	handler := ot.Middleware(service)
@@ -2,6 +2,7 @@
 package protocol
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -54,6 +55,12 @@ type PatternInfo struct {
 	// is true, otherwise a fixed string. eg "route variable"
 	Pattern string
 
+	// PatternExpression, if set, is a boolean expression of regular
+	// expressions that the content of a file must satisfy for the file to
+	// match. Pattern is then the union of the non-negated leaves of the
+	// expression and is only used to find line matches.
+	PatternExpression *PatternNode
+
 	// IsRegExp if true will treat the Pattern as a regular expression.
 	IsRegExp bool
 
@@ -92,6 +99,10 @@ type PatternInfo struct {
 	// FileMatchLimit limits the number of files with matches that are returned.
 	FileMatchLimit int
 
+	// ContextLines is the number of lines before and after each line match
+	// that are returned in its ContextBefore and ContextAfter.
+	ContextLines int
+
 	// PatternMatchesPath is whether the pattern should be matched against the content
 	// of files.
 	PatternMatchesContent bool
@@ -109,6 +120,9 @@ type PatternInfo struct {
 
 func (p *PatternInfo) String() string {
 	args := []string{fmt.Sprintf("%q", p.Pattern)}
+	if p.PatternExpression != nil {
+		args = append(args, fmt.Sprintf("expr:%s", p.PatternExpression))
+	}
 	if p.IsRegExp {
 		args = append(args, "re")
 	}
@@ -134,6 +148,9 @@ func (p *PatternInfo) String() string {
 	if p.FileMatchLimit > 0 {
 		args = append(args, fmt.Sprintf("filematchlimit:%d", p.FileMatchLimit))
 	}
+	if p.ContextLines > 0 {
+		args = append(args, fmt.Sprintf("context:%d", p.ContextLines))
+	}
 	for _, lang := range p.Languages {
 		args = append(args, fmt.Sprintf("lang:%s", lang))
 	}
@@ -155,6 +172,45 @@ func (p *PatternInfo) String() string {
 	return fmt.Sprintf("PatternInfo{%s}", strings.Join(args, ","))
 }
 
+// PatternNode is a node of a boolean expression over regular expression
+// patterns. Keep it in sync with internal/search.PatternNode.
+type PatternNode struct {
+	// Op is one of "and", "or" or "not" for operator nodes. It is empty for
+	// leaf nodes.
+	Op string `json:",omitempty"`
+
+	// Pattern is the regular expression of a leaf node.
+	Pattern string `json:",omitempty"`
+
+	// Operands are the children of an operator node.
+	Operands []*PatternNode `json:",omitempty"`
+}
+
+// UnmarshalText decodes the JSON encoding of a PatternNode. It allows a
+// PatternNode to be sent as a form value.
+func (n *PatternNode) UnmarshalText(text []byte) error {
+	return json.Unmarshal(text, n)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Without it, encoding/json would
+// use UnmarshalText and reject JSON objects.
+func (n *PatternNode) UnmarshalJSON(data []byte) error {
+	// patternNode has no methods, so this does not recurse.
+	type patternNode PatternNode
+	return json.Unmarshal(data, (*patternNode)(n))
+}
+
+func (n *PatternNode) String() string {
+	if n.Op == "" {
+		return fmt.Sprintf("%q", n.Pattern)
+	}
+	operands := make([]string, 0, len(n.Operands))
+	for _, operand := range n.Operands {
+		operands = append(operands, operand.String())
+	}
+	return fmt.Sprintf("(%s %s)", n.Op, strings.Join(operands, " "))
+}
+
 // Response represents the response from a Search request.
 type Response struct {
 	Matches []FileMatch
@@ -175,6 +231,12 @@ type FileMatch struct {
 
 	// LimitHit is true if LineMatches may not include all LineMatches.
 	LimitHit bool
+
+	// MultilineMatches are the matches of a pattern that can match a
+	// newline, such as "foo\nbar" or "(?s)foo.*bar", with the range of each
+	// match. They are only set for such patterns. LineMatches contains the
+	// lines of the same matches.
+	MultilineMatches []MultilineMatch `json:",omitempty"`
 }
 
 // LineMatch is the struct used by vscode to receive search results for a line.
@@ -193,4 +255,35 @@ type LineMatch struct {
 
 	// LimitHit is true if OffsetAndLengths may not include all OffsetAndLengths.
 	LimitHit bool
+
+	// ContextBefore and ContextAfter are the lines before and after the
+	// matched line, up to PatternInfo.ContextLines of each. They are only set
+	// if ContextLines is positive.
+	ContextBefore []string `json:",omitempty"`
+	ContextAfter  []string `json:",omitempty"`
+}
+
+// MultilineMatch is a match that may span several lines.
+type MultilineMatch struct {
+	// Preview is the lines of the match, from the first line of the match to
+	// its last line. It does not include the newline at the end of the last
+	// line.
+	Preview string
+
+	// Start is the location of the first character of the match.
+	Start Location
+
+	// End is the location just after the last character of the match. A
+	// match that ends with a newline ends at column 0 of the next line.
+	End Location
+}
+
+// Location is a position in a file.
+type Location struct {
+	// Line is the 0-based line number.
+	Line int
+
+	// Column is the 0-based offset in the line, measured in characters (not
+	// bytes).
+	Column int
 }
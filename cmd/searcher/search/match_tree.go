@@ -0,0 +1,99 @@
+package search
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+)
+
+// matchTree is a boolean expression of regexps. It is compiled from
+// protocol.PatternInfo.PatternExpression and decides whether a file matches,
+// so that an expression like (foo and bar) is evaluated in a single pass over
+// each file.
+type matchTree interface {
+	// match reports whether buf satisfies the expression. buf must already
+	// be lowercased if the search ignores case.
+	match(buf []byte) bool
+}
+
+type regexpMatchTree struct {
+	re *regexp.Regexp
+}
+
+func (t *regexpMatchTree) match(buf []byte) bool {
+	return t.re.Match(buf)
+}
+
+type andMatchTree []matchTree
+
+func (t andMatchTree) match(buf []byte) bool {
+	for _, child := range t {
+		if !child.match(buf) {
+			return false
+		}
+	}
+	return true
+}
+
+type orMatchTree []matchTree
+
+func (t orMatchTree) match(buf []byte) bool {
+	for _, child := range t {
+		if child.match(buf) {
+			return true
+		}
+	}
+	return false
+}
+
+type notMatchTree struct {
+	child matchTree
+}
+
+func (t *notMatchTree) match(buf []byte) bool {
+	return !t.child.match(buf)
+}
+
+// compileMatchTree compiles node into a matchTree. Leaves are transformed in
+// the same way as p.Pattern, so that they agree with the line matches found
+// by readerGrep.re.
+func compileMatchTree(p *protocol.PatternInfo, node *protocol.PatternNode) (matchTree, error) {
+	switch node.Op {
+	case "":
+		expr, err := transformPattern(p, node.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		return &regexpMatchTree{re: re}, nil
+
+	case "and", "or":
+		children := make([]matchTree, 0, len(node.Operands))
+		for _, operand := range node.Operands {
+			child, err := compileMatchTree(p, operand)
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, child)
+		}
+		if node.Op == "and" {
+			return andMatchTree(children), nil
+		}
+		return orMatchTree(children), nil
+
+	case "not":
+		if len(node.Operands) != 1 {
+			return nil, errors.Errorf("not expression must have exactly one operand, got %d", len(node.Operands))
+		}
+		child, err := compileMatchTree(p, node.Operands[0])
+		if err != nil {
+			return nil, err
+		}
+		return &notMatchTree{child: child}, nil
+	}
+	return nil, errors.Errorf("unknown pattern expression operator %q", node.Op)
+}
@@ -61,6 +61,18 @@ type readerGrep struct {
 	// re. It is the output of the longestLiteral function. It is only set if
 	// the regex has an empty LiteralPrefix.
 	literalSubstring []byte
+
+	// expr, if non-nil, is a boolean expression of regexps which the content
+	// of a file must satisfy before re is used to find its line matches.
+	expr matchTree
+
+	// multiline is true if re can match a newline, in which case Find also
+	// returns the range of each match.
+	multiline bool
+
+	// contextLines is the number of lines before and after each line match
+	// that Find returns with it.
+	contextLines int
 }
 
 // compile returns a readerGrep for matching p.
@@ -68,50 +80,41 @@ func compile(p *protocol.PatternInfo) (*readerGrep, error) {
 	var (
 		re               *regexp.Regexp
 		literalSubstring []byte
+		multiline        bool
 	)
 	if p.Pattern != "" {
-		expr := p.Pattern
-		if !p.IsRegExp {
-			expr = regexp.QuoteMeta(expr)
-		}
-		if p.IsWordMatch {
-			expr = `\b` + expr + `\b`
-		}
-		if p.IsRegExp {
-			// We don't do the search line by line, therefore we want the
-			// regex engine to consider newlines for anchors (^$).
-			expr = "(?m:" + expr + ")"
+		expr, err := transformPattern(p, p.Pattern)
+		if err != nil {
+			return nil, err
 		}
-		if !p.IsCaseSensitive {
-			// We don't just use (?i) because regexp library doesn't seem
-			// to contain good optimizations for case insensitive
-			// search. Instead we lowercase the input and pattern.
-			re, err := syntax.Parse(expr, syntax.Perl)
-			if err != nil {
-				return nil, err
-			}
-			lowerRegexpASCII(re)
-			expr = re.String()
+		re, err = regexp.Compile(expr)
+		if err != nil {
+			return nil, err
 		}
 
-		var err error
-		re, err = regexp.Compile(expr)
+		ast, err := syntax.Parse(expr, syntax.Perl)
 		if err != nil {
 			return nil, err
 		}
+		ast = ast.Simplify()
+		multiline = canMatchNewline(ast)
 
 		// Only use literalSubstring optimization if the regex engine doesn't
 		// have a prefix to use.
 		if pre, _ := re.LiteralPrefix(); pre == "" {
-			ast, err := syntax.Parse(expr, syntax.Perl)
-			if err != nil {
-				return nil, err
-			}
-			ast = ast.Simplify()
 			literalSubstring = []byte(longestLiteral(ast))
 		}
 	}
 
+	var expr matchTree
+	if p.PatternExpression != nil {
+		var err error
+		expr, err = compileMatchTree(p, p.PatternExpression)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	pathOptions := pathmatch.CompileOptions{
 		RegExp:        p.PathPatternsAreRegExps,
 		CaseSensitive: p.PathPatternsAreCaseSensitive,
@@ -126,9 +129,41 @@ func compile(p *protocol.PatternInfo) (*readerGrep, error) {
 		ignoreCase:       !p.IsCaseSensitive,
 		matchPath:        matchPath,
 		literalSubstring: literalSubstring,
+		expr:             expr,
+		multiline:        multiline,
+		contextLines:     p.ContextLines,
 	}, nil
 }
 
+// transformPattern returns the regular expression used to search for pattern
+// with the options in p.
+func transformPattern(p *protocol.PatternInfo, pattern string) (string, error) {
+	expr := pattern
+	if !p.IsRegExp {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if p.IsWordMatch {
+		expr = `\b` + expr + `\b`
+	}
+	if p.IsRegExp {
+		// We don't do the search line by line, therefore we want the
+		// regex engine to consider newlines for anchors (^$).
+		expr = "(?m:" + expr + ")"
+	}
+	if !p.IsCaseSensitive {
+		// We don't just use (?i) because regexp library doesn't seem
+		// to contain good optimizations for case insensitive
+		// search. Instead we lowercase the input and pattern.
+		re, err := syntax.Parse(expr, syntax.Perl)
+		if err != nil {
+			return "", err
+		}
+		lowerRegexpASCII(re)
+		expr = re.String()
+	}
+	return expr, nil
+}
+
 // Copy returns a copied version of rg that is safe to use from another
 // goroutine.
 func (rg *readerGrep) Copy() *readerGrep {
@@ -137,6 +172,9 @@ func (rg *readerGrep) Copy() *readerGrep {
 		ignoreCase:       rg.ignoreCase,
 		matchPath:        rg.matchPath,
 		literalSubstring: rg.literalSubstring,
+		expr:             rg.expr,
+		multiline:        rg.multiline,
+		contextLines:     rg.contextLines,
 	}
 }
 
@@ -149,13 +187,17 @@ func (rg *readerGrep) matchString(s string) bool {
 	if rg.ignoreCase {
 		s = strings.ToLower(s)
 	}
+	if rg.expr != nil {
+		return rg.expr.match([]byte(s))
+	}
 	return rg.re.MatchString(s)
 }
 
-// Find returns a LineMatch for each line that matches rg in reader.
+// Find returns a LineMatch for each line that matches rg in reader. If rg can
+// match a newline, it also returns a MultilineMatch for each match.
 // LimitHit is true if some matches may not have been included in the result.
 // NOTE: This is not safe to use concurrently.
-func (rg *readerGrep) Find(zf *store.ZipFile, f *store.SrcFile) (matches []protocol.LineMatch, limitHit bool, err error) {
+func (rg *readerGrep) Find(zf *store.ZipFile, f *store.SrcFile) (matches []protocol.LineMatch, multilineMatches []protocol.MultilineMatch, limitHit bool, err error) {
 	// fileMatchBuf is what we run match on, fileBuf is the original
 	// data (for Preview).
 	fileBuf := zf.DataFor(f)
@@ -182,7 +224,10 @@ func (rg *readerGrep) Find(zf *store.ZipFile, f *store.SrcFile) (matches []proto
 	// per-line. Additionally if we have a non-empty literalSubstring, we use
 	// that to prune out files since doing bytes.Index is very fast.
 	if !bytes.Contains(fileMatchBuf, rg.literalSubstring) {
-		return nil, false, nil
+		return nil, nil, false, nil
+	}
+	if rg.expr != nil && !rg.expr.match(fileMatchBuf) {
+		return nil, nil, false, nil
 	}
 
 	locs := rg.re.FindAllIndex(fileMatchBuf, maxLineMatches+1)
@@ -217,14 +262,84 @@ func (rg *readerGrep) Find(zf *store.ZipFile, f *store.SrcFile) (matches []proto
 		lastMatchIndex = matchIndex
 		lastLineNumber = lineNumber
 		matches = appendMatches(matches, fileBuf[lineStart:lineEnd], fileMatchBuf[lineStart:lineEnd], lineNumber, start-lineStart, end-lineStart)
-
 		if len(matches) > maxLineMatches {
+			// The multiline match of a match whose line matches are
+			// truncated is dropped too, so that both describe the same
+			// matches.
 			matches = matches[:maxLineMatches]
 			limitHit = true
 			break
 		}
+		if rg.multiline {
+			multilineMatches = append(multilineMatches, newMultilineMatch(fileBuf, lineNumber, lineStart, start, end))
+		}
+	}
+	if rg.contextLines > 0 {
+		addContextLines(matches, fileBuf, rg.contextLines)
+	}
+	return matches, multilineMatches, limitHit, nil
+}
+
+// addContextLines sets the n lines before and after each of matches, which
+// are line matches of fileBuf.
+func addContextLines(matches []protocol.LineMatch, fileBuf []byte, n int) {
+	if len(matches) == 0 {
+		return
+	}
+	// A trailing newline ends the last line rather than starting an empty
+	// one.
+	lines := strings.Split(strings.TrimSuffix(string(fileBuf), "\n"), "\n")
+	for i := range matches {
+		lineNumber := matches[i].LineNumber
+		if lineNumber >= len(lines) {
+			continue
+		}
+		start := lineNumber - n
+		if start < 0 {
+			start = 0
+		}
+		end := lineNumber + 1 + n
+		if end > len(lines) {
+			end = len(lines)
+		}
+		matches[i].ContextBefore = lines[start:lineNumber]
+		matches[i].ContextAfter = lines[lineNumber+1 : end]
+	}
+}
+
+// newMultilineMatch returns the MultilineMatch of fileBuf[start:end]. The
+// match starts on the line at index lineStart, whose 0-based line number is
+// lineNumber.
+func newMultilineMatch(fileBuf []byte, lineNumber, lineStart, start, end int) protocol.MultilineMatch {
+	endLineNumber, endLineStart := lineNumber, lineStart
+	if n := bytes.Count(fileBuf[start:end], []byte{'\n'}); n > 0 {
+		endLineNumber += n
+		endLineStart = start + bytes.LastIndexByte(fileBuf[start:end], '\n') + 1
+	}
+
+	// The preview ends at the end of the last line of the match, without its
+	// newline. If the match ends with a newline, that is the end of the match.
+	var previewEnd int
+	if end == endLineStart && endLineNumber > lineNumber {
+		previewEnd = end - 1
+	} else if idx := bytes.IndexByte(fileBuf[end:], '\n'); idx >= 0 {
+		previewEnd = end + idx
+	} else {
+		previewEnd = len(fileBuf)
+	}
+
+	return protocol.MultilineMatch{
+		// Copied for the same reason as LineMatch.Preview in appendMatches.
+		Preview: string(fileBuf[lineStart:previewEnd]),
+		Start: protocol.Location{
+			Line:   lineNumber,
+			Column: utf8.RuneCount(fileBuf[lineStart:start]),
+		},
+		End: protocol.Location{
+			Line:   endLineNumber,
+			Column: utf8.RuneCount(fileBuf[endLineStart:end]),
+		},
 	}
-	return matches, limitHit, nil
 }
 
 func hydrateLineNumbers(fileBuf []byte, lastLineNumber, lastMatchIndex, lineStart int, match []int) (lineNumber, matchIndex int) {
@@ -285,12 +400,13 @@ func appendMatches(matches []protocol.LineMatch, fileBuf []byte, matchLineBuf []
 
 // FindZip is a convenience function to run Find on f.
 func (rg *readerGrep) FindZip(zf *store.ZipFile, f *store.SrcFile) (protocol.FileMatch, error) {
-	lm, limitHit, err := rg.Find(zf, f)
+	lm, mm, limitHit, err := rg.Find(zf, f)
 	return protocol.FileMatch{
-		Path:        f.Name,
-		LineMatches: lm,
-		MatchCount:  len(lm),
-		LimitHit:    limitHit,
+		Path:             f.Name,
+		LineMatches:      lm,
+		MatchCount:       len(lm),
+		LimitHit:         limitHit,
+		MultilineMatches: mm,
 	}, err
 }
 
@@ -584,6 +700,35 @@ func lowerRegexpASCII(re *syntax.Regexp) {
 	}
 }
 
+// canMatchNewline reports whether re can match a newline character, such as
+// "a\nb", "(?s)a.b" or "a\sb".
+func canMatchNewline(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if r == '\n' {
+				return true
+			}
+		}
+		return false
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			if re.Rune[i] <= '\n' && '\n' <= re.Rune[i+1] {
+				return true
+			}
+		}
+		return false
+	case syntax.OpAnyChar:
+		return true
+	}
+	for _, sub := range re.Sub {
+		if canMatchNewline(sub) {
+			return true
+		}
+	}
+	return false
+}
+
 // longestLiteral finds the longest substring that is guaranteed to appear in
 // a match of re.
 //
@@ -10,6 +10,7 @@ import (
 	"regexp/syntax"
 	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"testing/iotest"
 	"testing/quick"
@@ -522,6 +523,109 @@ func TestPathMatches(t *testing.T) {
 	}
 }
 
+func TestMultilineMatches(t *testing.T) {
+	content := "func a() {\n\treturn \"ä\"\n}\n\nfunc b() {}\n"
+	zipData, err := testutil.CreateZip(map[string]string{"a.go": content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf := mockZipFile(t, zipData)
+
+	loc := func(line, column int) protocol.Location { return protocol.Location{Line: line, Column: column} }
+	cases := []struct {
+		pattern string
+		want    []protocol.MultilineMatch
+	}{
+		// Patterns that cannot match a newline have no multiline matches.
+		{pattern: `func \w+`},
+		{pattern: `(?s)\{.*?\}`, want: []protocol.MultilineMatch{
+			{Preview: "func a() {\n\treturn \"ä\"\n}", Start: loc(0, 9), End: loc(2, 1)},
+			{Preview: "func b() {}", Start: loc(4, 9), End: loc(4, 11)},
+		}},
+		{pattern: `"\n}\n`, want: []protocol.MultilineMatch{
+			{Preview: "\treturn \"ä\"\n}", Start: loc(1, 10), End: loc(3, 0)},
+		}},
+		{pattern: `\)\s+\{`, want: []protocol.MultilineMatch{
+			{Preview: "func a() {", Start: loc(0, 7), End: loc(0, 10)},
+			{Preview: "func b() {}", Start: loc(4, 7), End: loc(4, 10)},
+		}},
+	}
+	for _, tc := range cases {
+		rg, err := compile(&protocol.PatternInfo{Pattern: tc.pattern, IsRegExp: true, IsCaseSensitive: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fm, err := rg.FindZip(zf, &zf.Files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fm.LineMatches) == 0 {
+			t.Errorf("%s: no line matches", tc.pattern)
+		}
+		if !reflect.DeepEqual(fm.MultilineMatches, tc.want) {
+			t.Errorf("%s: got multiline matches %+v, want %+v", tc.pattern, fm.MultilineMatches, tc.want)
+		}
+	}
+}
+
+func TestMultilineMatchesLimit(t *testing.T) {
+	// Each match spans two lines, so the line matches of the last match
+	// that starts within the limit are truncated.
+	content := strings.Repeat("foo\nbar\n", maxLineMatches)
+	zipData, err := testutil.CreateZip(map[string]string{"a.txt": content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf := mockZipFile(t, zipData)
+
+	rg, err := compile(&protocol.PatternInfo{Pattern: `foo\nbar`, IsRegExp: true, IsCaseSensitive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm, err := rg.FindZip(zf, &zf.Files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fm.LimitHit {
+		t.Error("expected limitHit")
+	}
+	if got, want := len(fm.LineMatches), maxLineMatches; got != want {
+		t.Errorf("got %d line matches, want %d", got, want)
+	}
+	if got, want := len(fm.MultilineMatches), maxLineMatches/2; got != want {
+		t.Errorf("got %d multiline matches, want %d", got, want)
+	}
+	last := fm.MultilineMatches[len(fm.MultilineMatches)-1]
+	if got, want := last.End.Line, fm.LineMatches[len(fm.LineMatches)-1].LineNumber; got != want {
+		t.Errorf("got last multiline match ending on line %d, want %d", got, want)
+	}
+}
+
+func TestContextLines(t *testing.T) {
+	content := "a\nb\nfoo\nc\nd\ne\nfoo\n"
+	zipData, err := testutil.CreateZip(map[string]string{"a.txt": content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf := mockZipFile(t, zipData)
+
+	rg, err := compile(&protocol.PatternInfo{Pattern: "foo", IsCaseSensitive: true, ContextLines: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm, err := rg.FindZip(zf, &zf.Files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []protocol.LineMatch{
+		{Preview: "foo", LineNumber: 2, OffsetAndLengths: [][2]int{{0, 3}}, ContextBefore: []string{"a", "b"}, ContextAfter: []string{"c", "d"}},
+		{Preview: "foo", LineNumber: 6, OffsetAndLengths: [][2]int{{0, 3}}, ContextBefore: []string{"d", "e"}, ContextAfter: []string{}},
+	}
+	if !reflect.DeepEqual(fm.LineMatches, want) {
+		t.Errorf("got line matches %+v, want %+v", fm.LineMatches, want)
+	}
+}
+
 // githubStore fetches from github and caches across test runs.
 var githubStore = &store.Store{
 	FetchTar: testutil.FetchTarFromGithub,
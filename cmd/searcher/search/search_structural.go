@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/inconshreveable/log15"
@@ -11,6 +12,9 @@ import (
 	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/comby"
+	"github.com/sourcegraph/sourcegraph/internal/inventory"
+	"github.com/sourcegraph/sourcegraph/internal/pathmatch"
+	"github.com/sourcegraph/sourcegraph/internal/store"
 )
 
 // The Sourcegraph frontend and interface only allow LineMatches (matches on a
@@ -90,11 +94,11 @@ func lookupMatcher(language string) string {
 	switch strings.ToLower(language) {
 	case "assembly", "asm":
 		return ".s"
-	case "bash":
+	case "bash", "shell":
 		return ".sh"
 	case "c":
 		return ".c"
-	case "c#, csharp":
+	case "c#", "csharp":
 		return ".cs"
 	case "css":
 		return ".css"
@@ -128,7 +132,7 @@ func lookupMatcher(language string) string {
 		return ".jl"
 	case "kotlin":
 		return ".kt"
-	case "laTeX":
+	case "latex":
 		return ".tex"
 	case "lisp":
 		return ".lisp"
@@ -180,43 +184,149 @@ func languageMetric(matcher string, includePatterns *[]string) string {
 	return "inferred:.generic"
 }
 
-func structuralSearch(ctx context.Context, zipPath, pattern, rule string, languages, includePatterns []string, repo api.RepoName) (matches []protocol.FileMatch, limitHit bool, err error) {
-	log15.Info("structural search", "repo", string(repo))
+// genericMatcher is the comby matcher for files whose language has no
+// matcher.
+const genericMatcher = ".generic"
 
-	// Cap the number of forked processes to limit the size of zip contents being mapped to memory. Resolving #7133 could help to lift this restriction.
-	numWorkers := 4
+// maxStructuralFilePatterns is the maximum number of file patterns passed to
+// a single comby invocation. Larger groups of files are selected by their
+// extensions instead.
+const maxStructuralFilePatterns = 1000
 
-	var matcher string
-	if len(languages) > 0 {
-		// Pick the first language, there is no support for applying
-		// multiple language matchers in a single search query.
-		matcher = lookupMatcher(languages[0])
-		log15.Debug("structural search", "language", languages[0], "matcher", matcher)
+// inferMatcher returns the comby matcher for a file, which is the matcher of
+// the language detected from its name, or the generic matcher.
+func inferMatcher(path string) string {
+	language, _ := inventory.GetLanguageByFilename(path)
+	if matcher := lookupMatcher(language); matcher != "" {
+		return matcher
 	}
+	return genericMatcher
+}
 
-	v := languageMetric(matcher, &includePatterns)
-	requestTotalStructuralSearch.WithLabelValues(v).Inc()
+// matcherGroups partitions the files of the archive that match the include
+// patterns by their matcher.
+func matcherGroups(zf *store.ZipFile, includePatterns []string) (map[string][]string, error) {
+	matchPath, err := pathmatch.CompilePathPatterns(includePatterns, "", pathmatch.CompileOptions{RegExp: true})
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string][]string{}
+	for _, f := range zf.Files {
+		if !matchPath.MatchPath(f.Name) {
+			continue
+		}
+		matcher := inferMatcher(f.Name)
+		groups[matcher] = append(groups[matcher], f.Name)
+	}
+	return groups, nil
+}
 
-	args := comby.Args{
-		Input:         comby.ZipPath(zipPath),
-		Matcher:       matcher,
-		MatchTemplate: pattern,
-		MatchOnly:     true,
-		FilePatterns:  includePatterns,
-		Rule:          rule,
-		NumWorkers:    numWorkers,
+// filePatternBatches returns the comby file patterns that select files, in
+// batches of at most maxStructuralFilePatterns patterns. Comby matches file
+// patterns as suffixes, so the patterns are the paths of the files if there
+// are few of them, and otherwise their extensions (or their names if they
+// have no extension). Either way the patterns may select other files too.
+func filePatternBatches(files []string) [][]string {
+	patterns := files
+	if len(files) > maxStructuralFilePatterns {
+		patterns = nil
+		seen := map[string]bool{}
+		for _, name := range files {
+			pattern := filepath.Ext(name)
+			if pattern == "" {
+				pattern = filepath.Base(name)
+			}
+			if !seen[pattern] {
+				seen[pattern] = true
+				patterns = append(patterns, pattern)
+			}
+		}
+	}
+
+	var batches [][]string
+	for len(patterns) > maxStructuralFilePatterns {
+		batches = append(batches, patterns[:maxStructuralFilePatterns:maxStructuralFilePatterns])
+		patterns = patterns[maxStructuralFilePatterns:]
+	}
+	return append(batches, patterns)
+}
+
+func structuralSearch(ctx context.Context, zipPath string, zf *store.ZipFile, pattern, rule string, languages, includePatterns []string, repo api.RepoName) (matches []protocol.FileMatch, limitHit bool, err error) {
+	log15.Info("structural search", "repo", string(repo))
+
+	if len(languages) == 0 {
+		return structuralSearchByLanguage(ctx, zipPath, zf, pattern, rule, includePatterns)
 	}
 
-	combyMatches, err := comby.Matches(ctx, args)
+	// Pick the first language, there is no support for applying
+	// multiple language matchers in a single search query.
+	matcher := lookupMatcher(languages[0])
+	log15.Debug("structural search", "language", languages[0], "matcher", matcher)
+
+	v := languageMetric(matcher, &includePatterns)
+	requestTotalStructuralSearch.WithLabelValues(v).Inc()
+
+	combyMatches, err := comby.Matches(ctx, combyArgs(zipPath, matcher, pattern, rule, includePatterns))
 	if err != nil {
 		return nil, false, err
 	}
+	return ToFileMatch(combyMatches), false, nil
+}
 
-	matches = ToFileMatch(combyMatches)
+// structuralSearchByLanguage searches each file that matches the include
+// patterns with the matcher of its language. Comby is invoked once per
+// matcher (or per batch of file patterns), with file patterns that select the
+// files of the matcher, and only the matches in those files are kept.
+func structuralSearchByLanguage(ctx context.Context, zipPath string, zf *store.ZipFile, pattern, rule string, includePatterns []string) ([]protocol.FileMatch, bool, error) {
+	groups, err := matcherGroups(zf, includePatterns)
 	if err != nil {
 		return nil, false, err
 	}
-	return matches, false, err
+	matchers := make([]string, 0, len(groups))
+	for matcher := range groups {
+		matchers = append(matchers, matcher)
+	}
+	sort.Strings(matchers)
+
+	var combyMatches []comby.FileMatch
+	for _, matcher := range matchers {
+		files := groups[matcher]
+		inGroup := make(map[string]bool, len(files))
+		for _, name := range files {
+			inGroup[name] = true
+		}
+		requestTotalStructuralSearch.WithLabelValues("inferred:" + matcher).Inc()
+
+		for _, filePatterns := range filePatternBatches(files) {
+			log15.Debug("structural search", "matcher", matcher, "filePatterns", len(filePatterns))
+			groupMatches, err := comby.Matches(ctx, combyArgs(zipPath, matcher, pattern, rule, filePatterns))
+			if err != nil {
+				return nil, false, err
+			}
+			for _, m := range groupMatches {
+				if inGroup[m.URI] {
+					// Do not keep the matches of a file twice if it is
+					// selected by the patterns of several batches.
+					delete(inGroup, m.URI)
+					combyMatches = append(combyMatches, m)
+				}
+			}
+		}
+	}
+	return ToFileMatch(combyMatches), false, nil
+}
+
+func combyArgs(zipPath, matcher, pattern, rule string, filePatterns []string) comby.Args {
+	return comby.Args{
+		Input:         comby.ZipPath(zipPath),
+		Matcher:       matcher,
+		MatchTemplate: pattern,
+		MatchOnly:     true,
+		FilePatterns:  filePatterns,
+		Rule:          rule,
+		// Cap the number of forked processes to limit the size of zip contents being mapped to memory. Resolving #7133 could help to lift this restriction.
+		NumWorkers: 4,
+	}
 }
 
 var requestTotalStructuralSearch = prometheus.NewCounterVec(prometheus.CounterOpts{
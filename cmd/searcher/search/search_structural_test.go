@@ -3,6 +3,7 @@ package search
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"reflect"
 	"sort"
@@ -11,6 +12,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/comby"
+	"github.com/sourcegraph/sourcegraph/internal/store"
 	"github.com/sourcegraph/sourcegraph/internal/testutil"
 )
 
@@ -67,7 +69,7 @@ func foo(go string) {}
 	for _, tt := range cases {
 		t.Run(tt.Name, func(t *testing.T) {
 			p.Languages = tt.Languages
-			matches, _, err := structuralSearch(context.Background(), zf, p.Pattern, p.CombyRule, p.Languages, p.IncludePatterns, "repo_foo")
+			matches, _, err := structuralSearch(context.Background(), zf, mockZipFile(t, zipData), p.Pattern, p.CombyRule, p.Languages, p.IncludePatterns, "repo_foo")
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -119,7 +121,7 @@ func foo(real string) {}
 		Pattern:         pattern,
 		IncludePatterns: includePatterns,
 	}
-	m, _, err := structuralSearch(context.Background(), zf, p.Pattern, p.CombyRule, p.Languages, p.IncludePatterns, "foo")
+	m, _, err := structuralSearch(context.Background(), zf, mockZipFile(t, zipData), p.Pattern, p.CombyRule, p.Languages, p.IncludePatterns, "foo")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -219,7 +221,7 @@ func TestIncludePatterns(t *testing.T) {
 		Pattern:         "",
 		IncludePatterns: includePatterns,
 	}
-	fileMatches, _, err := structuralSearch(context.Background(), zf, p.Pattern, p.CombyRule, p.Languages, p.IncludePatterns, "foo")
+	fileMatches, _, err := structuralSearch(context.Background(), zf, mockZipFile(t, zipData), p.Pattern, p.CombyRule, p.Languages, p.IncludePatterns, "foo")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -260,7 +262,7 @@ func TestRule(t *testing.T) {
 		CombyRule:       `where :[args] == "success"`,
 	}
 
-	got, _, err := structuralSearch(context.Background(), zf, p.Pattern, p.CombyRule, p.Languages, p.IncludePatterns, "repo")
+	got, _, err := structuralSearch(context.Background(), zf, mockZipFile(t, zipData), p.Pattern, p.CombyRule, p.Languages, p.IncludePatterns, "repo")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -414,7 +416,7 @@ func bar() {
 	defer cleanup()
 
 	t.Run("Strutural search match count", func(t *testing.T) {
-		matches, _, err := structuralSearch(context.Background(), zf, p.Pattern, p.CombyRule, p.Languages, p.IncludePatterns, "repo_foo")
+		matches, _, err := structuralSearch(context.Background(), zf, mockZipFile(t, zipData), p.Pattern, p.CombyRule, p.Languages, p.IncludePatterns, "repo_foo")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -427,3 +429,156 @@ func bar() {
 		}
 	})
 }
+
+func mockZipFile(t *testing.T, data []byte) *store.ZipFile {
+	t.Helper()
+	zf, err := store.MockZipFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zf
+}
+
+func TestMatcherGroups(t *testing.T) {
+	zipData, err := testutil.CreateZip(map[string]string{
+		"main.go":         "",
+		"a/b.go":          "",
+		"web/index.ts":    "",
+		"web/index.tsx":   "",
+		"README.md":       "",
+		"Makefile":        "",
+		"scripts/Foo.CS":  "",
+		"scripts/foo.cs":  "",
+		"scripts/bar.sh":  "",
+		"docs/README.md":  "",
+		"no_extension/go": "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf := mockZipFile(t, zipData)
+
+	sortGroups := func(groups map[string][]string) map[string][]string {
+		for _, patterns := range groups {
+			sort.Strings(patterns)
+		}
+		return groups
+	}
+
+	tests := []struct {
+		name            string
+		includePatterns []string
+		want            map[string][]string
+	}{
+		{
+			name: "no include patterns",
+			want: map[string][]string{
+				".go":          {"a/b.go", "main.go"},
+				".ts":          {"web/index.ts", "web/index.tsx"},
+				".cs":          {"scripts/Foo.CS", "scripts/foo.cs"},
+				".sh":          {"scripts/bar.sh"},
+				genericMatcher: {"Makefile", "README.md", "docs/README.md", "no_extension/go"},
+			},
+		},
+		{
+			name:            "file include pattern",
+			includePatterns: []string{`(a/b\.go|index\.tsx|^Makefile)$`},
+			want: map[string][]string{
+				".go":          {"a/b.go"},
+				".ts":          {"web/index.tsx"},
+				genericMatcher: {"Makefile"},
+			},
+		},
+		{
+			name:            "directory include pattern",
+			includePatterns: []string{`^scripts/`},
+			want: map[string][]string{
+				".cs": {"scripts/Foo.CS", "scripts/foo.cs"},
+				".sh": {"scripts/bar.sh"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			groups, err := matcherGroups(zf, test.includePatterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.want, sortGroups(groups)); diff != "" {
+				t.Errorf("matcherGroups mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFilePatternBatches(t *testing.T) {
+	files := []string{"a/b.go", "c.go"}
+	if diff := cmp.Diff([][]string{files}, filePatternBatches(files)); diff != "" {
+		t.Errorf("few files mismatch (-want +got):\n%s", diff)
+	}
+
+	files = nil
+	for i := 0; i <= maxStructuralFilePatterns; i++ {
+		files = append(files, fmt.Sprintf("dir/%d.go", i), fmt.Sprintf("dir/Makefile%d", i))
+	}
+	batches := filePatternBatches(files)
+	if len(batches) != 2 {
+		t.Fatalf("got %d batches, want 2", len(batches))
+	}
+	if got, want := len(batches[0]), maxStructuralFilePatterns; got != want {
+		t.Errorf("got %d patterns in the first batch, want %d", got, want)
+	}
+	if got, want := batches[0][0], ".go"; got != want {
+		t.Errorf("got first pattern %q, want %q", got, want)
+	}
+	if got, want := len(batches[1]), 2; got != want {
+		t.Errorf("got %d patterns in the last batch, want %d", got, want)
+	}
+}
+
+// Tests that structural search uses the matcher of the language of each file
+// when the query does not specify a language.
+func TestStructuralSearchByLanguage(t *testing.T) {
+	// If we are not on CI skip the test.
+	if os.Getenv("CI") == "" {
+		t.Skip("Not on CI, skipping comby-dependent test")
+	}
+
+	input := map[string]string{
+		"main.go": `
+/* foo(go comment) */
+func foo(go string) {}
+`,
+		"main.py": `
+# foo(python comment)
+def foo(python): pass
+`,
+		"notes.txt": `foo(text)`,
+	}
+
+	zipData, err := testutil.CreateZip(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf, cleanup, err := testutil.TempZipFileOnDisk(zipData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	matches, _, err := structuralSearch(context.Background(), zf, mockZipFile(t, zipData), "foo(:[args])", "", nil, nil, "repo_foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, fileMatches := range matches {
+		for _, m := range fileMatches.LineMatches {
+			got = append(got, fileMatches.Path+":"+m.Preview)
+		}
+	}
+	sort.Strings(got)
+	want := []string{"main.go:foo(go string)", "main.py:foo(python)", "notes.txt:foo(text)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got file matches %v, want %v", got, want)
+	}
+}
@@ -180,6 +180,33 @@ main.go:7:}
 `},
 
 		{protocol.PatternInfo{Pattern: "^$", IsRegExp: true}, ``},
+
+		// Pattern expressions are evaluated per file. Pattern is the union
+		// of the non-negated leaves and determines the line matches.
+		{protocol.PatternInfo{Pattern: "hello|import", IsRegExp: true, PatternExpression: &protocol.PatternNode{
+			Op:       "and",
+			Operands: []*protocol.PatternNode{{Pattern: "hello"}, {Pattern: "import"}},
+		}}, `
+main.go:3:import "fmt"
+main.go:6:	fmt.Println("Hello world")
+`},
+		{protocol.PatternInfo{Pattern: "^import|example", IsRegExp: true, PatternExpression: &protocol.PatternNode{
+			Op:       "or",
+			Operands: []*protocol.PatternNode{{Pattern: "^import"}, {Pattern: "example"}},
+		}}, `
+README.md:3:Hello world example in go
+main.go:3:import "fmt"
+`},
+		{protocol.PatternInfo{Pattern: "world", IsRegExp: true, PatternExpression: &protocol.PatternNode{
+			Op: "and",
+			Operands: []*protocol.PatternNode{
+				{Pattern: "world"},
+				{Op: "not", Operands: []*protocol.PatternNode{{Pattern: "fmt"}}},
+			},
+		}}, `
+README.md:1:# Hello World
+README.md:3:Hello world example in go
+`},
 	}
 
 	store, cleanup, err := newStore(files)
@@ -354,6 +381,13 @@ func doSearch(u string, p *protocol.Request) ([]protocol.FileMatch, error) {
 		"IncludePatterns": p.IncludePatterns,
 		"ExcludePattern":  []string{p.ExcludePattern},
 	}
+	if p.PatternExpression != nil {
+		b, err := json.Marshal(p.PatternExpression)
+		if err != nil {
+			return nil, err
+		}
+		form.Set("PatternExpression", string(b))
+	}
 	if p.IsRegExp {
 		form.Set("IsRegExp", "true")
 	}
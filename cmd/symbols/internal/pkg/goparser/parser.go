@@ -0,0 +1,220 @@
+// Package goparser provides a parser of the symbols of Go files that uses
+// go/parser instead of universal-ctags.
+package goparser
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+)
+
+// NewParser returns a parser of Go files. It emits the same kinds of symbols
+// as universal-ctags, except that methods have the kind method instead of
+// func, and the parents and signatures of the symbols are taken from the
+// syntax tree. Unlike a ctags parser, it is safe for concurrent use.
+func NewParser() ctags.Parser {
+	return goParser{}
+}
+
+type goParser struct{}
+
+func (goParser) Close() {}
+
+// Parse returns the top-level declarations of a Go file, the fields and
+// methods of the types it declares, and its package. Files with syntax errors
+// are parsed on a best-effort basis.
+func (goParser) Parse(path string, content []byte) ([]ctags.Entry, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, content, 0)
+	if file == nil {
+		return nil, err
+	}
+
+	p := &fileParser{
+		path:  path,
+		fset:  fset,
+		lines: bytes.Split(content, []byte("\n")),
+		kinds: map[string]string{},
+	}
+
+	pkg := file.Name.Name
+	p.add(file.Name, "package", "", "", "")
+
+	// Methods may be declared before their receiver type, so the kinds of the
+	// types are collected first.
+	for _, decl := range file.Decls {
+		if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.TYPE {
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.TypeSpec)
+				p.kinds[spec.Name.Name] = typeKind(spec)
+			}
+		}
+	}
+
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Name == nil || decl.Name.Name == "_" {
+				continue
+			}
+			signature := p.signature(decl.Type)
+			if receiver := receiverTypeName(decl); receiver != "" {
+				kind, ok := p.kinds[receiver]
+				if !ok {
+					// The receiver type is declared in another file.
+					kind = "type"
+				}
+				p.add(decl.Name, "method", receiver, kind, signature)
+			} else {
+				p.add(decl.Name, "func", pkg, "package", signature)
+			}
+
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					kind := p.kinds[spec.Name.Name]
+					p.add(spec.Name, kind, pkg, "package", "")
+					p.addMembers(spec.Name.Name, kind, spec.Type)
+
+				case *ast.ValueSpec:
+					kind := "var"
+					if decl.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, name := range spec.Names {
+						p.add(name, kind, pkg, "package", "")
+					}
+				}
+			}
+		}
+	}
+
+	return p.entries, nil
+}
+
+// fileParser collects the entries of a file.
+type fileParser struct {
+	path  string
+	fset  *token.FileSet
+	lines [][]byte
+
+	// kinds are the kinds of the types declared in the file, by name.
+	kinds map[string]string
+
+	entries []ctags.Entry
+}
+
+func (p *fileParser) add(name *ast.Ident, kind, parent, parentKind, signature string) {
+	if name.Name == "_" {
+		return
+	}
+	line := p.fset.Position(name.Pos()).Line
+	p.entries = append(p.entries, ctags.Entry{
+		Name:       name.Name,
+		Path:       p.path,
+		Line:       line,
+		Kind:       kind,
+		Language:   "Go",
+		Parent:     parent,
+		ParentKind: parentKind,
+		Pattern:    p.pattern(line),
+		Signature:  signature,
+	})
+}
+
+// addMembers adds the fields of a struct type or the methods of an interface
+// type.
+func (p *fileParser) addMembers(typeName, typeKind string, typ ast.Expr) {
+	switch typ := typ.(type) {
+	case *ast.StructType:
+		for _, field := range typ.Fields.List {
+			if len(field.Names) == 0 {
+				if name := embeddedTypeName(field.Type); name != nil {
+					p.add(name, "anonMember", typeName, typeKind, "")
+				}
+				continue
+			}
+			for _, name := range field.Names {
+				p.add(name, "member", typeName, typeKind, "")
+			}
+		}
+
+	case *ast.InterfaceType:
+		for _, method := range typ.Methods.List {
+			funcType, ok := method.Type.(*ast.FuncType)
+			if !ok {
+				// An embedded interface.
+				continue
+			}
+			for _, name := range method.Names {
+				p.add(name, "methodSpec", typeName, typeKind, p.signature(funcType))
+			}
+		}
+	}
+}
+
+// signature returns the parameters and results of a function, as in
+// "(a, b int) error".
+func (p *fileParser) signature(typ *ast.FuncType) string {
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, p.fset, &ast.FuncType{Params: typ.Params, Results: typ.Results})
+	// The printed type starts with "func".
+	return strings.TrimPrefix(buf.String(), "func")
+}
+
+// pattern returns the ctags search pattern of the line.
+func (p *fileParser) pattern(line int) string {
+	if line < 1 || line > len(p.lines) {
+		return ""
+	}
+	text := strings.TrimSuffix(string(p.lines[line-1]), "\r")
+	text = strings.NewReplacer(`\`, `\\`, `/`, `\/`).Replace(text)
+	return "/^" + text + "$/"
+}
+
+// typeKind returns the ctags kind of a type declaration.
+func typeKind(spec *ast.TypeSpec) string {
+	switch spec.Type.(type) {
+	case *ast.StructType:
+		return "struct"
+	case *ast.InterfaceType:
+		return "interface"
+	}
+	return "type"
+}
+
+// receiverTypeName returns the name of the receiver type of a method, or ""
+// if decl is a function.
+func receiverTypeName(decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return ""
+	}
+	typ := decl.Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if ident, ok := typ.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// embeddedTypeName returns the name of an embedded field, which is the name of
+// its type without the package qualifier.
+func embeddedTypeName(typ ast.Expr) *ast.Ident {
+	switch typ := typ.(type) {
+	case *ast.Ident:
+		return typ
+	case *ast.StarExpr:
+		return embeddedTypeName(typ.X)
+	case *ast.SelectorExpr:
+		return typ.Sel
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package goparser
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+)
+
+func TestParser(t *testing.T) {
+	src := `package foo
+
+import "io"
+
+const A, _ = 1, 2
+
+var b = "b"
+
+type C struct {
+	d, E int
+	io.Reader
+	*F
+}
+
+func (c *C) Read(p []byte) (n int, err error) { return 0, nil }
+
+type F interface {
+	io.Closer
+	G(x, y string) error
+}
+
+func h() {
+	var local int
+	_ = local
+}
+
+func (x X) I() {}
+`
+	got, err := NewParser().Parse("a/foo.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := func(line int, name, kind, parent, parentKind, signature, pattern string) ctags.Entry {
+		return ctags.Entry{
+			Name:       name,
+			Path:       "a/foo.go",
+			Line:       line,
+			Kind:       kind,
+			Language:   "Go",
+			Parent:     parent,
+			ParentKind: parentKind,
+			Signature:  signature,
+			Pattern:    "/^" + pattern + "$/",
+		}
+	}
+	want := []ctags.Entry{
+		entry(1, "foo", "package", "", "", "", "package foo"),
+		entry(5, "A", "const", "foo", "package", "", "const A, _ = 1, 2"),
+		entry(7, "b", "var", "foo", "package", "", `var b = "b"`),
+		entry(9, "C", "struct", "foo", "package", "", "type C struct {"),
+		entry(10, "d", "member", "C", "struct", "", "\td, E int"),
+		entry(10, "E", "member", "C", "struct", "", "\td, E int"),
+		entry(11, "Reader", "anonMember", "C", "struct", "", "\tio.Reader"),
+		entry(12, "F", "anonMember", "C", "struct", "", "\t*F"),
+		entry(15, "Read", "method", "C", "struct", "(p []byte) (n int, err error)", "func (c *C) Read(p []byte) (n int, err error) { return 0, nil }"),
+		entry(17, "F", "interface", "foo", "package", "", "type F interface {"),
+		entry(19, "G", "methodSpec", "F", "interface", "(x, y string) error", "\tG(x, y string) error"),
+		entry(22, "h", "func", "foo", "package", "()", "func h() {"),
+		entry(27, "I", "method", "X", "type", "()", "func (x X) I() {}"),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestParser_syntaxError(t *testing.T) {
+	got, err := NewParser().Parse("a.go", []byte("package a\n\nfunc A() {}\n\nfunc {"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range got {
+		names = append(names, e.Name)
+	}
+	if want := []string{"a", "A"}; !cmp.Equal(want, names) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+}
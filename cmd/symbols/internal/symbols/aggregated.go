@@ -0,0 +1,566 @@
+package symbols
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/jmoiron/sqlx"
+	"github.com/keegancsmith/sqlf"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
+)
+
+// aggregatedIndexQueueSize is the maximum number of repositories waiting to
+// be added to the aggregated index. Repositories that do not fit in the queue
+// are added when they are searched again.
+const aggregatedIndexQueueSize = 1000
+
+// aggregatedSearchBatchSize is the number of repositories searched with one
+// query of the aggregated index. It keeps the number of query parameters below
+// the limit of SQLite.
+const aggregatedSearchBatchSize = 500
+
+// aggregatedEvictBatchSize is the number of least recently searched
+// repositories removed at a time from an aggregated index that is too large.
+const aggregatedEvictBatchSize = 10
+
+// aggregatedColumns are the columns of the symbols table of the aggregated
+// index, except repo, which are also the columns of the symbols table of a
+// repository database.
+const aggregatedColumns = "name, namelowercase, path, pathlowercase, line, kind, language, parent, parentkind, signature, pattern, exported, filelimited"
+
+// aggregatedIndex is a database with the symbols of many repositories, each at
+// a single commit and parsed with a single parser configuration. It serves a symbol search of many repositories with one
+// query per batch of repositories, instead of opening the database of each
+// repository.
+//
+// A repository is added to the index in the background the first time it is
+// searched, by parsing its symbols at the searched commit, or by copying them
+// from the database of the repository if it is cached. It is replaced when it
+// is searched at another commit, or after the parsers of ParserConfig
+// change. The least recently searched repositories are
+// removed when the index is larger than MaxAggregatedIndexSizeBytes.
+type aggregatedIndex struct {
+	db *sqlx.DB
+
+	// queue is the repositories waiting to be added to the index.
+	queue chan protocol.RepoCommit
+
+	mu       sync.Mutex
+	queued   map[protocol.RepoCommit]struct{} // repositories in queue
+	searched map[api.RepoName]time.Time       // repositories searched since the last eviction
+}
+
+// aggregatedSymbolInDB is a row of the symbols table of the aggregated index.
+type aggregatedSymbolInDB struct {
+	Repo string
+	symbolInDB
+}
+
+// openAggregatedIndex opens the aggregated index, creating it if needed, and
+// starts adding the queued repositories to it.
+func (s *Service) openAggregatedIndex() (*aggregatedIndex, error) {
+	s.aggregatedOnce.Do(func() {
+		if err := os.MkdirAll(s.Path, 0700); err != nil {
+			s.aggregatedErr = err
+			return
+		}
+		// The index is in Path but it is not a diskcache item. Its
+		// repositories are evicted separately, see evict.
+		path := filepath.Join(s.Path, fmt.Sprintf("aggregated-%d.db", symbolsDBVersion))
+		db, err := sqlx.Open("sqlite3_with_pcre", path+"?_journal_mode=WAL&_busy_timeout=10000")
+		if err != nil {
+			s.aggregatedErr = err
+			return
+		}
+		if err := createAggregatedTables(db); err != nil {
+			db.Close()
+			s.aggregatedErr = err
+			return
+		}
+		s.aggregated = &aggregatedIndex{
+			db:       db,
+			queue:    make(chan protocol.RepoCommit, aggregatedIndexQueueSize),
+			queued:   map[protocol.RepoCommit]struct{}{},
+			searched: map[api.RepoName]time.Time{},
+		}
+		go s.addQueuedToAggregatedIndex()
+	})
+	return s.aggregated, s.aggregatedErr
+}
+
+// createAggregatedTables creates the tables of the aggregated index. The
+// symbols table has the columns of the symbols table of a repository database,
+// and the repository of each symbol. parsers is the key of the parser
+// configuration the symbols of a repository were parsed with. lastsearched is the Unix time in
+// nanoseconds at which a repository was last searched, which is used to evict
+// repositories.
+func createAggregatedTables(db *sqlx.DB) error {
+	for _, q := range []string{
+		`CREATE TABLE IF NOT EXISTS repos (
+			repo VARCHAR(4096) PRIMARY KEY,
+			commitid VARCHAR(40) NOT NULL,
+			parsers VARCHAR(4096) NOT NULL,
+			lastsearched INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS symbols (
+			repo VARCHAR(4096) NOT NULL,
+			name VARCHAR(256) NOT NULL,
+			namelowercase VARCHAR(256) NOT NULL,
+			path VARCHAR(4096) NOT NULL,
+			pathlowercase VARCHAR(4096) NOT NULL,
+			line INT NOT NULL,
+			kind VARCHAR(255) NOT NULL,
+			language VARCHAR(255) NOT NULL,
+			parent VARCHAR(255) NOT NULL,
+			parentkind VARCHAR(255) NOT NULL,
+			signature VARCHAR(255) NOT NULL,
+			pattern VARCHAR(255) NOT NULL,
+			exported BOOLEAN NOT NULL,
+			filelimited BOOLEAN NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS lastsearched_index ON repos(lastsearched);`,
+		`CREATE INDEX IF NOT EXISTS repo_index ON symbols(repo);`,
+		`CREATE INDEX IF NOT EXISTS name_index ON symbols(name);`,
+		`CREATE INDEX IF NOT EXISTS namelowercase_index ON symbols(namelowercase);`,
+		`CREATE INDEX IF NOT EXISTS kind_index ON symbols(kind COLLATE NOCASE);`,
+		`CREATE INDEX IF NOT EXISTS parent_index ON symbols(parent COLLATE NOCASE);`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) handleSearchAggregated(w http.ResponseWriter, r *http.Request) {
+	var args protocol.AggregatedSearchArgs
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.searchAggregated(r.Context(), args)
+	if err != nil {
+		if err == context.Canceled && r.Context().Err() == context.Canceled {
+			return // client went away
+		}
+		log15.Error("Aggregated symbol search failed", "repos", len(args.Repos), "args", args.Args, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// searchAggregated searches the repositories of args that are in the
+// aggregated index at the requested commit, and queues the others to be added
+// to the index.
+func (s *Service) searchAggregated(ctx context.Context, args protocol.AggregatedSearchArgs) (result *protocol.AggregatedSearchResult, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	span, ctx := ot.StartSpanFromContext(ctx, "searchAggregated")
+	span.SetTag("repos", len(args.Repos))
+	span.SetTag("query", args.Args.Query)
+	span.SetTag("first", args.Args.First)
+	defer func() {
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(otlog.Error(err))
+		}
+		span.Finish()
+	}()
+
+	index, err := s.openAggregatedIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	if args.Args.First < 0 || args.Args.First > maxFirst {
+		args.Args.First = maxFirst
+	}
+
+	// A transaction reads a consistent snapshot of the index, so that the
+	// symbols of a repository are from the commit read from the repos table.
+	tx, err := index.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result = &protocol.AggregatedSearchResult{}
+	parsers := s.currentParserConfig()
+	var found []protocol.RepoCommit
+	for start := 0; start < len(args.Repos); start += aggregatedSearchBatchSize {
+		batch := args.Repos[start:min(start+aggregatedSearchBatchSize, len(args.Repos))]
+		present, err := index.present(tx, batch, parsers)
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range batch {
+			if present[repo] {
+				found = append(found, repo)
+			} else {
+				result.Missing = append(result.Missing, repo)
+				index.enqueue(repo)
+			}
+		}
+	}
+	index.touch(found)
+
+	// The limit is shared fairly by the repositories: each batch gets its
+	// share of the remaining symbols, and within a batch the symbols are
+	// interleaved by repository, so that a repository with many matching
+	// symbols does not crowd out the others.
+	symbolsByRepo := map[api.RepoName][]protocol.Symbol{}
+	conditions := symbolConditions(args.Args)
+	remaining := args.Args.First
+	for start := 0; start < len(found) && remaining > 0; start += aggregatedSearchBatchSize {
+		batch := found[start:min(start+aggregatedSearchBatchSize, len(found))]
+		repoNames := make([]*sqlf.Query, 0, len(batch))
+		for _, repo := range batch {
+			repoNames = append(repoNames, sqlf.Sprintf("%s", string(repo.Repo)))
+		}
+		// Rounding up the share leaves nothing for the last batches only if
+		// there are more repositories than symbols to return.
+		limit := (remaining*len(batch) + len(found) - start - 1) / (len(found) - start)
+
+		batchConditions := append([]*sqlf.Query{sqlf.Sprintf("repo IN (%s)", sqlf.Join(repoNames, ","))}, conditions...)
+		q := sqlf.Sprintf(
+			"SELECT repo, "+aggregatedColumns+" FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY repo) AS rank FROM symbols WHERE %s) ORDER BY rank LIMIT %s",
+			sqlf.Join(batchConditions, "AND"), limit,
+		)
+		var symbolsInDB []aggregatedSymbolInDB
+		if err := tx.Select(&symbolsInDB, q.Query(sqlf.PostgresBindVar), q.Args()...); err != nil {
+			return nil, err
+		}
+		for _, symbolInDB := range symbolsInDB {
+			repo := api.RepoName(symbolInDB.Repo)
+			symbolsByRepo[repo] = append(symbolsByRepo[repo], symbolInDBToSymbol(symbolInDB.symbolInDB))
+		}
+		remaining -= len(symbolsInDB)
+	}
+
+	for _, repo := range found {
+		if symbols := symbolsByRepo[repo.Repo]; len(symbols) > 0 {
+			result.Symbols = append(result.Symbols, protocol.RepoSymbols{RepoCommit: repo, Symbols: symbols})
+		}
+	}
+	span.SetTag("missing", len(result.Missing))
+	return result, nil
+}
+
+// present returns which repositories of repos are in the index at the
+// requested commit, parsed with the parsers.
+func (a *aggregatedIndex) present(tx *sqlx.Tx, repos []protocol.RepoCommit, parsers parserConfig) (map[protocol.RepoCommit]bool, error) {
+	repoNames := make([]*sqlf.Query, 0, len(repos))
+	for _, repo := range repos {
+		repoNames = append(repoNames, sqlf.Sprintf("%s", string(repo.Repo)))
+	}
+	q := sqlf.Sprintf("SELECT repo, commitid FROM repos WHERE parsers = %s AND repo IN (%s)", parsers.key(), sqlf.Join(repoNames, ","))
+	var rows []struct {
+		Repo     string
+		CommitID string
+	}
+	if err := tx.Select(&rows, q.Query(sqlf.PostgresBindVar), q.Args()...); err != nil {
+		return nil, err
+	}
+	present := make(map[protocol.RepoCommit]bool, len(rows))
+	for _, row := range rows {
+		present[protocol.RepoCommit{Repo: api.RepoName(row.Repo), CommitID: api.CommitID(row.CommitID)}] = true
+	}
+	return present, nil
+}
+
+// touch records that repos were searched. The times are written to the index
+// by evict.
+func (a *aggregatedIndex) touch(repos []protocol.RepoCommit) {
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, repo := range repos {
+		a.searched[repo.Repo] = now
+	}
+}
+
+// enqueue queues repo to be added to the index, unless it is already queued
+// or the queue is full.
+func (a *aggregatedIndex) enqueue(repo protocol.RepoCommit) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.queued[repo]; ok {
+		return
+	}
+	select {
+	case a.queue <- repo:
+		a.queued[repo] = struct{}{}
+		aggregatedIndexQueueLength.Inc()
+	default:
+	}
+}
+
+// addQueuedToAggregatedIndex adds the queued repositories to the aggregated
+// index, one at a time, and evicts repositories when the index is too large.
+// It does not return.
+func (s *Service) addQueuedToAggregatedIndex() {
+	index := s.aggregated
+	for repo := range index.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Minute)
+		err := s.addToAggregatedIndex(ctx, repo)
+		if err != nil {
+			log15.Error("Failed to add repository to the aggregated symbols index.", "repo", repo.Repo, "commitID", repo.CommitID, "error", err)
+			aggregatedIndexFailed.Inc()
+		}
+		if err := index.evict(ctx, s.MaxAggregatedIndexSizeBytes); err != nil {
+			log15.Error("Failed to evict repositories from the aggregated symbols index.", "error", err)
+		}
+		cancel()
+
+		index.mu.Lock()
+		delete(index.queued, repo)
+		aggregatedIndexQueueLength.Dec()
+		index.mu.Unlock()
+	}
+}
+
+// addToAggregatedIndex adds the symbols of repo at the commit to the index,
+// replacing the symbols of any other commit. The symbols are copied from the
+// database of the repository if it is cached, and parsed otherwise. The
+// database of the repository is not created.
+func (s *Service) addToAggregatedIndex(ctx context.Context, repo protocol.RepoCommit) error {
+	parsers := s.currentParserConfig()
+	f, err := s.cache.OpenIfExists(symbolsDBKey(repo.Repo, repo.CommitID, parsers))
+	switch {
+	case err == nil:
+		defer f.File.Close()
+		err = s.copyToAggregatedIndex(ctx, repo, parsers, f.File.Name())
+	case os.IsNotExist(err):
+		err = s.parseToAggregatedIndex(ctx, repo, parsers)
+	}
+	if err != nil {
+		return err
+	}
+
+	aggregatedIndexUpdates.Inc()
+	return nil
+}
+
+// copyToAggregatedIndex copies the symbols of repo from the repository
+// database dbFile, which was parsed with the parsers.
+func (s *Service) copyToAggregatedIndex(ctx context.Context, repo protocol.RepoCommit, parsers parserConfig, dbFile string) error {
+	// The repository database must be attached to the connection that copies
+	// from it.
+	conn, err := s.aggregated.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS repo_symbols`, dbFile); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `DETACH DATABASE repo_symbols`); err != nil {
+			log15.Warn("Failed to detach repository symbols database.", "error", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM symbols WHERE repo = ?`, string(repo.Repo)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO symbols (repo, `+aggregatedColumns+`) SELECT ?, `+aggregatedColumns+` FROM repo_symbols.symbols`, string(repo.Repo)); err != nil {
+		return err
+	}
+	if err := setAggregatedRepo(ctx, tx, repo, parsers); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// parseToAggregatedIndex parses the symbols of repo with the parsers and
+// writes them to the index.
+func (s *Service) parseToAggregatedIndex(ctx context.Context, repo protocol.RepoCommit, parsers parserConfig) error {
+	tx, err := s.aggregated.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM symbols WHERE repo = ?`, string(repo.Repo)); err != nil {
+		return err
+	}
+	insertStatement, err := tx.PrepareNamed(
+		"INSERT INTO symbols (repo, " + aggregatedColumns + ") VALUES " +
+			"(:repo, :name, :namelowercase, :path, :pathlowercase, :line, :kind, :language, :parent, :parentkind, :signature, :pattern, :exported, :filelimited)")
+	if err != nil {
+		return err
+	}
+	err = s.parseUncached(ctx, repo.Repo, repo.CommitID, nil, parsers, func(symbol protocol.Symbol) error {
+		symbolInDBValue := aggregatedSymbolInDB{Repo: string(repo.Repo), symbolInDB: symbolToSymbolInDB(symbol)}
+		_, err := insertStatement.Exec(&symbolInDBValue)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := setAggregatedRepo(ctx, tx, repo, parsers); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setAggregatedRepo records that the index has the symbols of repo parsed
+// with the parsers. The repository was just searched.
+func setAggregatedRepo(ctx context.Context, tx interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}, repo protocol.RepoCommit, parsers parserConfig) error {
+	_, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO repos (repo, commitid, parsers, lastsearched) VALUES (?, ?, ?, ?)`, string(repo.Repo), string(repo.CommitID), parsers.key(), time.Now().UnixNano())
+	return err
+}
+
+// evict writes the times at which repositories were searched to the index,
+// and removes the least recently searched repositories while the index is
+// larger than maxSize bytes. There is no limit if maxSize is 0.
+func (a *aggregatedIndex) evict(ctx context.Context, maxSize int64) error {
+	a.mu.Lock()
+	searched := a.searched
+	a.searched = map[api.RepoName]time.Time{}
+	a.mu.Unlock()
+
+	if len(searched) > 0 {
+		tx, err := a.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		for repo, t := range searched {
+			if _, err := tx.ExecContext(ctx, `UPDATE repos SET lastsearched = ? WHERE repo = ?`, t.UnixNano(), string(repo)); err != nil {
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	if maxSize <= 0 {
+		return nil
+	}
+	for {
+		size, err := a.size(ctx)
+		if err != nil {
+			return err
+		}
+		if size <= maxSize {
+			return nil
+		}
+
+		var repos []string
+		if err := a.db.SelectContext(ctx, &repos, `SELECT repo FROM repos ORDER BY lastsearched LIMIT ?`, aggregatedEvictBatchSize); err != nil {
+			return err
+		}
+		if len(repos) == 0 {
+			return nil
+		}
+		tx, err := a.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		for _, repo := range repos {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM symbols WHERE repo = ?`, repo); err != nil {
+				tx.Rollback()
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM repos WHERE repo = ?`, repo); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		aggregatedIndexEvictions.Add(float64(len(repos)))
+	}
+}
+
+// size returns the size in bytes of the pages of the index that are in use.
+// The pages of deleted symbols are reused instead of shrinking the file.
+func (a *aggregatedIndex) size(ctx context.Context) (int64, error) {
+	var pageCount, freelistCount, pageSize int64
+	for _, pragma := range []struct {
+		name  string
+		value *int64
+	}{
+		{"page_count", &pageCount},
+		{"freelist_count", &freelistCount},
+		{"page_size", &pageSize},
+	} {
+		if err := a.db.GetContext(ctx, pragma.value, "PRAGMA "+pragma.name); err != nil {
+			return 0, err
+		}
+	}
+	return (pageCount - freelistCount) * pageSize, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+var (
+	aggregatedIndexQueueLength = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "symbols",
+		Subsystem: "aggregated",
+		Name:      "queue_length",
+		Help:      "The number of repositories waiting to be added to the aggregated index.",
+	})
+	aggregatedIndexUpdates = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "aggregated",
+		Name:      "updates",
+		Help:      "The total number of repositories added to the aggregated index.",
+	})
+	aggregatedIndexFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "aggregated",
+		Name:      "update_failed",
+		Help:      "The total number of repositories that failed to be added to the aggregated index.",
+	})
+	aggregatedIndexEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "symbols",
+		Subsystem: "aggregated",
+		Name:      "evictions",
+		Help:      "The total number of repositories removed from the aggregated index because it was too large.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(aggregatedIndexQueueLength)
+	prometheus.MustRegister(aggregatedIndexUpdates)
+	prometheus.MustRegister(aggregatedIndexFailed)
+	prometheus.MustRegister(aggregatedIndexEvictions)
+}
@@ -0,0 +1,204 @@
+package symbols
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/diskcache"
+	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
+)
+
+// maxAncestors is the number of ancestor commits that are checked for a cached
+// symbols database.
+const maxAncestors = 100
+
+// maxIncrementalPaths is the maximum number of changed paths for which the
+// symbols are updated incrementally. The changed paths are sent to gitserver
+// in a single archive request, and parsing all the symbols is about as fast
+// for large changes anyway.
+const maxIncrementalPaths = 1000
+
+// Changes are the paths that changed between two commits.
+type Changes struct {
+	Added    []string
+	Modified []string
+	Deleted  []string
+}
+
+// ParseGitDiffNameStatus parses the output of
+// `git diff -z --name-status --no-renames`, in which renamed files are
+// reported as deleted and added.
+func ParseGitDiffNameStatus(output []byte) (Changes, error) {
+	var changes Changes
+	output = bytes.TrimSuffix(output, []byte{0})
+	if len(output) == 0 {
+		return changes, nil
+	}
+
+	fields := bytes.Split(output, []byte{0})
+	for i := 0; i < len(fields); i += 2 {
+		status := string(fields[i])
+		if status == "" {
+			return Changes{}, fmt.Errorf("empty status in git diff output at field %d", i)
+		}
+		if i+1 >= len(fields) {
+			return Changes{}, fmt.Errorf("missing path for status %q in git diff output", status)
+		}
+		path := string(fields[i+1])
+
+		switch status[0] {
+		case 'A':
+			changes.Added = append(changes.Added, path)
+		case 'M', 'T':
+			changes.Modified = append(changes.Modified, path)
+		case 'D':
+			changes.Deleted = append(changes.Deleted, path)
+		default:
+			return Changes{}, fmt.Errorf("unexpected status %q in git diff output", status)
+		}
+	}
+	return changes, nil
+}
+
+// writeSymbolsIncrementally writes the symbols of repo@commit to the blank
+// database file `dbFile` by copying the database of the nearest ancestor
+// commit in the cache, and parsing only the paths that changed since that
+// commit. It returns false if there is no such ancestor or too many paths
+// changed, in which case all the symbols need to be parsed.
+func (s *Service) writeSymbolsIncrementally(ctx context.Context, dbFile string, repoName api.RepoName, commitID api.CommitID, parsers parserConfig) (ok bool, err error) {
+	if s.ListAncestors == nil || s.GitDiff == nil || s.FetchTarPaths == nil {
+		return false, nil
+	}
+
+	span, ctx := ot.StartSpanFromContext(ctx, "writeSymbolsIncrementally")
+	defer func() {
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(otlog.Error(err))
+		}
+		span.Finish()
+	}()
+	span.SetTag("repo", string(repoName))
+	span.SetTag("commit", string(commitID))
+
+	ancestor, ancestorDBFile, err := s.findCachedAncestor(ctx, repoName, commitID, parsers)
+	if err != nil || ancestorDBFile == nil {
+		return false, err
+	}
+	defer ancestorDBFile.Close()
+	span.SetTag("ancestor", string(ancestor))
+
+	changes, err := s.GitDiff(ctx, repoName, ancestor, commitID)
+	if err != nil {
+		return false, err
+	}
+	changed := append(append([]string{}, changes.Added...), changes.Modified...)
+	span.SetTag("changed", len(changed))
+	span.SetTag("deleted", len(changes.Deleted))
+	if len(changed)+len(changes.Deleted) > maxIncrementalPaths {
+		return false, nil
+	}
+
+	if err := copyDBFile(dbFile, ancestorDBFile); err != nil {
+		return false, err
+	}
+
+	db, err := sqlx.Open("sqlite3_with_pcre", dbFile)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	// The transaction holds a connection open until it ends, so it must be
+	// rolled back before the database is closed when the update fails.
+	defer tx.Rollback()
+
+	for _, path := range append(changed, changes.Deleted...) {
+		if _, err := tx.Exec(`DELETE FROM symbols WHERE path = ?`, path); err != nil {
+			return false, err
+		}
+	}
+
+	if len(changed) > 0 {
+		insertStatement, err := prepareInsertSymbol(tx)
+		if err != nil {
+			return false, err
+		}
+
+		err = s.parseUncached(ctx, repoName, commitID, changed, parsers, func(symbol protocol.Symbol) error {
+			symbolInDBValue := symbolToSymbolInDB(symbol)
+			_, err := insertStatement.Exec(&symbolInDBValue)
+			return err
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	incrementalUpdates.Inc()
+	return true, nil
+}
+
+// findCachedAncestor returns the nearest ancestor of commitID whose symbols
+// database parsed with the parsers is in the cache, and the database file.
+// The file is nil if no ancestor is cached.
+func (s *Service) findCachedAncestor(ctx context.Context, repoName api.RepoName, commitID api.CommitID, parsers parserConfig) (api.CommitID, *diskcache.File, error) {
+	ancestors, err := s.ListAncestors(ctx, repoName, commitID, maxAncestors)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, ancestor := range ancestors {
+		if ancestor == commitID {
+			continue
+		}
+		f, err := s.cache.OpenIfExists(symbolsDBKey(repoName, ancestor, parsers))
+		if err == nil {
+			return ancestor, f, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", nil, err
+		}
+	}
+	return "", nil, nil
+}
+
+// copyDBFile overwrites the database file `dbFile` with the contents of src.
+func copyDBFile(dbFile string, src io.Reader) error {
+	dst, err := os.OpenFile(dbFile, os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if err1 := dst.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+var incrementalUpdates = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "symbols",
+	Subsystem: "store",
+	Name:      "incremental_updates",
+	Help:      "The total number of symbols databases updated from the database of an ancestor commit.",
+})
+
+func init() {
+	prometheus.MustRegister(incrementalUpdates)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 
@@ -16,6 +17,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/symbols/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
+	"github.com/src-d/enry/v2"
 	nettrace "golang.org/x/net/trace"
 )
 
@@ -37,7 +39,10 @@ func (s *Service) startParsers() error {
 	return nil
 }
 
-func (s *Service) parseUncached(ctx context.Context, repo api.RepoName, commitID api.CommitID, callback func(symbol protocol.Symbol) error) (err error) {
+// parseUncached parses the symbols of the repository at commitID with the
+// parsers and calls callback for each symbol. If paths is non-nil, only the
+// specified paths are parsed.
+func (s *Service) parseUncached(ctx context.Context, repo api.RepoName, commitID api.CommitID, paths []string, parsers parserConfig, callback func(symbol protocol.Symbol) error) (err error) {
 	span, ctx := ot.StartSpanFromContext(ctx, "parseUncached")
 	defer func() {
 		if err != nil {
@@ -51,6 +56,9 @@ func (s *Service) parseUncached(ctx context.Context, repo api.RepoName, commitID
 
 	tr := nettrace.New("parseUncached", string(repo))
 	tr.LazyPrintf("commitID: %s", commitID)
+	if paths != nil {
+		tr.LazyPrintf("paths: %d", len(paths))
+	}
 
 	totalSymbols := 0
 	defer func() {
@@ -63,7 +71,7 @@ func (s *Service) parseUncached(ctx context.Context, repo api.RepoName, commitID
 	}()
 
 	tr.LazyPrintf("fetch")
-	parseRequests, errChan, err := s.fetchRepositoryArchive(ctx, repo, commitID)
+	parseRequests, errChan, err := s.fetchRepositoryArchive(ctx, repo, commitID, paths)
 	tr.LazyPrintf("fetch (returned chans)")
 	if err != nil {
 		return err
@@ -96,7 +104,7 @@ func (s *Service) parseUncached(ctx context.Context, repo api.RepoName, commitID
 				wg.Done()
 				<-sem
 			}()
-			entries, parseErr := s.parse(ctx, req)
+			entries, parseErr := s.parse(ctx, req, parsers)
 			if parseErr != nil && parseErr != context.Canceled && parseErr != context.DeadlineExceeded {
 				log15.Error("Error parsing symbols.", "repo", repo, "commitID", commitID, "path", req.path, "dataSize", len(req.data), "error", parseErr)
 			}
@@ -123,8 +131,15 @@ func (s *Service) parseUncached(ctx context.Context, repo api.RepoName, commitID
 	return <-errChan
 }
 
-// parse gets a parser from the pool and uses it to satisfy the parse request.
-func (s *Service) parse(ctx context.Context, req parseRequest) (entries []ctags.Entry, err error) {
+// parse gets a parser from the pool and uses it to satisfy the parse request,
+// unless an alternative parser is configured for the language of the file.
+func (s *Service) parse(ctx context.Context, req parseRequest, parsers parserConfig) (entries []ctags.Entry, err error) {
+	if parser := s.alternativeParser(parsers, req.path); parser != nil {
+		parsing.Inc()
+		defer parsing.Dec()
+		return parser.Parse(req.path, req.data)
+	}
+
 	parseQueueSize.Inc()
 
 	select {
@@ -171,10 +186,75 @@ func (s *Service) parse(ctx context.Context, req parseRequest) (entries []ctags.
 		}()
 		parsing.Inc()
 		defer parsing.Dec()
-		return parser.Parse(req.path, req.data)
+		entries, err = parser.Parse(req.path, req.data)
+		return setGoMethodKinds(entries), err
 	}
 }
 
+// setGoMethodKinds sets the kind of Go methods to method. Universal-ctags
+// emits them with the kind func like functions, with their receiver type
+// instead of their package as parent, so they would not be found by
+// symbolkind:method.
+func setGoMethodKinds(entries []ctags.Entry) []ctags.Entry {
+	for i, e := range entries {
+		if e.Language == "Go" && e.Kind == "func" && e.Parent != "" && e.ParentKind != "package" {
+			entries[i].Kind = "method"
+		}
+	}
+	return entries
+}
+
+// parserConfig are the names of the alternative parsers to use instead of the
+// parsers of NewParser, by language.
+type parserConfig map[string]string
+
+// currentParserConfig returns the alternative parsers that ParserConfig
+// currently selects, ignoring the names of parsers that do not exist.
+func (s *Service) currentParserConfig() parserConfig {
+	if s.ParserConfig == nil {
+		return nil
+	}
+	var parsers parserConfig
+	for language, name := range s.ParserConfig() {
+		if _, ok := s.AlternativeParsers[name]; !ok {
+			continue
+		}
+		if parsers == nil {
+			parsers = parserConfig{}
+		}
+		parsers[language] = name
+	}
+	return parsers
+}
+
+// key returns a suffix for the cache keys of symbols databases parsed with
+// the parsers, so that changing the parser of a language invalidates them. It
+// is empty if no alternative parsers are used.
+func (c parserConfig) key() string {
+	if len(c) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(c))
+	for language, name := range c {
+		pairs = append(pairs, language+"="+name)
+	}
+	sort.Strings(pairs)
+	return "-" + strings.Join(pairs, ",")
+}
+
+// alternativeParser returns the alternative parser for the language of the
+// file at path, or nil if the parsers of NewParser should be used.
+func (s *Service) alternativeParser(parsers parserConfig, path string) ctags.Parser {
+	if len(parsers) == 0 {
+		return nil
+	}
+	language, _ := enry.GetLanguageByExtension(path)
+	if name, ok := parsers[language]; ok {
+		return s.AlternativeParsers[name]
+	}
+	return nil
+}
+
 func entryToSymbol(e ctags.Entry) protocol.Symbol {
 	return protocol.Symbol{
 		Name:        e.Name,
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 	"regexp/syntax"
 	"strings"
 	"time"
@@ -24,6 +25,9 @@ import (
 // maxFileSize is the limit on file size in bytes. Only files smaller than this are processed.
 const maxFileSize = 1 << 19 // 512KB
 
+// maxFirst is the maximum number of symbols returned by a search.
+const maxFirst = 500
+
 func (s *Service) handleSearch(w http.ResponseWriter, r *http.Request) {
 	var args protocol.SearchArgs
 	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
@@ -95,10 +99,11 @@ func (s *Service) search(ctx context.Context, args protocol.SearchArgs) (result
 
 // getDBFile returns the path to the sqlite3 database for the repo@commit
 // specified in `args`. If the database doesn't already exist in the disk cache,
-// it will create a new one and write all the symbols into it.
+// it will create a new one and write the symbols into it.
 func (s *Service) getDBFile(ctx context.Context, args protocol.SearchArgs) (string, error) {
-	diskcacheFile, err := s.cache.OpenWithPath(ctx, fmt.Sprintf("%d-%s@%s", symbolsDBVersion, args.Repo, args.CommitID), func(fetcherCtx context.Context, tempDBFile string) error {
-		err := s.writeAllSymbolsToNewDB(fetcherCtx, tempDBFile, args.Repo, args.CommitID)
+	parsers := s.currentParserConfig()
+	diskcacheFile, err := s.cache.OpenWithPath(ctx, symbolsDBKey(args.Repo, args.CommitID, parsers), func(fetcherCtx context.Context, tempDBFile string) error {
+		err := s.writeSymbolsToNewDB(fetcherCtx, tempDBFile, args.Repo, args.CommitID, parsers)
 		if err != nil {
 			if err == context.Canceled {
 				log15.Error("Unable to parse repository symbols within the context", "repo", args.Repo, "commit", args.CommitID, "query", args.Query)
@@ -143,11 +148,37 @@ func filterSymbols(ctx context.Context, db *sqlx.DB, args protocol.SearchArgs) (
 		span.Finish()
 	}()
 
-	const maxFirst = 500
 	if args.First < 0 || args.First > maxFirst {
 		args.First = maxFirst
 	}
 
+	conditions := symbolConditions(args)
+
+	var sqlQuery *sqlf.Query
+	if len(conditions) == 0 {
+		sqlQuery = sqlf.Sprintf("SELECT * FROM symbols LIMIT %s", args.First)
+	} else {
+		sqlQuery = sqlf.Sprintf("SELECT * FROM symbols WHERE %s LIMIT %s", sqlf.Join(conditions, "AND"), args.First)
+	}
+
+	var symbolsInDB []symbolInDB
+	err = db.Select(&symbolsInDB, sqlQuery.Query(sqlf.PostgresBindVar), sqlQuery.Args()...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, symbolInDB := range symbolsInDB {
+		res = append(res, symbolInDBToSymbol(symbolInDB))
+	}
+
+	span.SetTag("hits", len(res))
+	return res, nil
+}
+
+// symbolConditions returns the conditions on the symbols table for the
+// query, include and exclude patterns, and the kind, parent and exported
+// filters of args.
+func symbolConditions(args protocol.SearchArgs) []*sqlf.Query {
 	makeCondition := func(column string, regex string) []*sqlf.Query {
 		conditions := []*sqlf.Query{}
 
@@ -190,36 +221,43 @@ func filterSymbols(ctx context.Context, db *sqlx.DB, args protocol.SearchArgs) (
 	}
 	conditions = append(conditions, negateAll(makeCondition("path", args.ExcludePattern))...)
 
-	var sqlQuery *sqlf.Query
-	if len(conditions) == 0 {
-		sqlQuery = sqlf.Sprintf("SELECT * FROM symbols LIMIT %s", args.First)
-	} else {
-		sqlQuery = sqlf.Sprintf("SELECT * FROM symbols WHERE %s LIMIT %s", sqlf.Join(conditions, "AND"), args.First)
+	// The kind and parent columns have case insensitive indexes, which are
+	// only used by case insensitive comparisons.
+	kinds := func(kinds []string) *sqlf.Query {
+		qs := make([]*sqlf.Query, 0, len(kinds))
+		for _, kind := range kinds {
+			qs = append(qs, sqlf.Sprintf("%s", kind))
+		}
+		return sqlf.Join(qs, ",")
 	}
-
-	var symbolsInDB []symbolInDB
-	err = db.Select(&symbolsInDB, sqlQuery.Query(sqlf.PostgresBindVar), sqlQuery.Args()...)
-	if err != nil {
-		return nil, err
+	if len(args.Kinds) > 0 {
+		conditions = append(conditions, sqlf.Sprintf("kind COLLATE NOCASE IN (%s)", kinds(args.Kinds)))
 	}
-
-	for _, symbolInDB := range symbolsInDB {
-		res = append(res, symbolInDBToSymbol(symbolInDB))
+	if len(args.ExcludeKinds) > 0 {
+		conditions = append(conditions, sqlf.Sprintf("kind COLLATE NOCASE NOT IN (%s)", kinds(args.ExcludeKinds)))
+	}
+	if args.Parent != "" {
+		conditions = append(conditions, sqlf.Sprintf("parent COLLATE NOCASE = %s", args.Parent))
+		if args.IsCaseSensitive {
+			conditions = append(conditions, sqlf.Sprintf("parent = %s", args.Parent))
+		}
+	}
+	if args.Exported != nil {
+		conditions = append(conditions, sqlf.Sprintf("exported = %s", *args.Exported))
 	}
 
-	span.SetTag("hits", len(res))
-	return res, nil
+	return conditions
 }
 
 // The version of the symbols database schema. This is included in the database
 // filenames to prevent a newer version of the symbols service from attempting
 // to read from a database created by an older (and likely incompatible) symbols
 // service. Increment this when you change the database schema.
-const symbolsDBVersion = 3
+const symbolsDBVersion = 5
 
-// symbolInDB is the same as `protocol.Symbol`, but with two additional columns:
-// namelowercase and pathlowercase, which enable indexed case insensitive
-// queries.
+// symbolInDB is the same as `protocol.Symbol`, but with three additional
+// columns: namelowercase and pathlowercase, which enable indexed case
+// insensitive queries, and exported.
 type symbolInDB struct {
 	Name          string
 	NameLowercase string // derived from `Name`
@@ -232,6 +270,7 @@ type symbolInDB struct {
 	ParentKind    string
 	Signature     string
 	Pattern       string
+	Exported      bool // derived from `Name` and `Language`
 
 	FileLimited bool
 }
@@ -249,6 +288,7 @@ func symbolToSymbolInDB(symbol protocol.Symbol) symbolInDB {
 		ParentKind:    symbol.ParentKind,
 		Signature:     symbol.Signature,
 		Pattern:       symbol.Pattern,
+		Exported:      symbol.Exported(),
 
 		FileLimited: symbol.FileLimited,
 	}
@@ -270,9 +310,37 @@ func symbolInDBToSymbol(symbolInDB symbolInDB) protocol.Symbol {
 	}
 }
 
+// symbolsDBKey returns the disk cache key of the symbols database of
+// repo@commitID parsed with the parsers.
+func symbolsDBKey(repo api.RepoName, commitID api.CommitID, parsers parserConfig) string {
+	return fmt.Sprintf("%d-%s@%s", symbolsDBVersion, repo, commitID) + parsers.key()
+}
+
+// writeSymbolsToNewDB writes the symbols of repo@commit to the blank database
+// file `dbFile`. It updates the database of the nearest cached ancestor commit
+// if possible, and parses all the symbols otherwise.
+func (s *Service) writeSymbolsToNewDB(ctx context.Context, dbFile string, repoName api.RepoName, commitID api.CommitID, parsers parserConfig) error {
+	ok, err := s.writeSymbolsIncrementally(ctx, dbFile, repoName, commitID, parsers)
+	if err == nil && ok {
+		return nil
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		log15.Warn("Unable to update symbols incrementally, parsing all symbols.", "repo", repoName, "commit", commitID, "error", err)
+		// The database may have been partially written. It is closed by
+		// writeSymbolsIncrementally, so it can be truncated.
+		if err := os.Truncate(dbFile, 0); err != nil {
+			return err
+		}
+	}
+	return s.writeAllSymbolsToNewDB(ctx, dbFile, repoName, commitID, parsers)
+}
+
 // writeAllSymbolsToNewDB fetches the repo@commit from gitserver, parses all the
 // symbols, and writes them to the blank database file `dbFile`.
-func (s *Service) writeAllSymbolsToNewDB(ctx context.Context, dbFile string, repoName api.RepoName, commitID api.CommitID) error {
+func (s *Service) writeAllSymbolsToNewDB(ctx context.Context, dbFile string, repoName api.RepoName, commitID api.CommitID, parsers parserConfig) error {
 	db, err := sqlx.Open("sqlite3_with_pcre", dbFile)
 	if err != nil {
 		return err
@@ -285,10 +353,38 @@ func (s *Service) writeAllSymbolsToNewDB(ctx context.Context, dbFile string, rep
 		return err
 	}
 
+	if err := createSymbolsTable(tx); err != nil {
+		return err
+	}
+
+	insertStatement, err := prepareInsertSymbol(tx)
+	if err != nil {
+		return err
+	}
+
+	err = s.parseUncached(ctx, repoName, commitID, nil, parsers, func(symbol protocol.Symbol) error {
+		symbolInDBValue := symbolToSymbolInDB(symbol)
+		_, err := insertStatement.Exec(&symbolInDBValue)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// createSymbolsTable creates the symbols table and its indexes.
+func createSymbolsTable(tx *sqlx.Tx) error {
 	// The column names are the lowercase version of fields in `symbolInDB`
 	// because sqlx lowercases struct fields by default. See
 	// http://jmoiron.github.io/sqlx/#query
-	_, err = tx.Exec(
+	_, err := tx.Exec(
 		`CREATE TABLE IF NOT EXISTS symbols (
 			name VARCHAR(256) NOT NULL,
 			namelowercase VARCHAR(256) NOT NULL,
@@ -301,6 +397,7 @@ func (s *Service) writeAllSymbolsToNewDB(ctx context.Context, dbFile string, rep
 			parentkind VARCHAR(255) NOT NULL,
 			signature VARCHAR(255) NOT NULL,
 			pattern VARCHAR(255) NOT NULL,
+			exported BOOLEAN NOT NULL,
 			filelimited BOOLEAN NOT NULL
 		)`)
 	if err != nil {
@@ -328,28 +425,30 @@ func (s *Service) writeAllSymbolsToNewDB(ctx context.Context, dbFile string, rep
 		return err
 	}
 
-	insertStatement, err := tx.PrepareNamed(
-		fmt.Sprintf(
-			"INSERT INTO symbols %s VALUES %s",
-			"( name,  namelowercase,  path,  pathlowercase,  line,  kind,  language,  parent,  parentkind,  signature,  pattern,  filelimited)",
-			"(:name, :namelowercase, :path, :pathlowercase, :line, :kind, :language, :parent, :parentkind, :signature, :pattern, :filelimited)"))
+	// Kinds and parents are compared case insensitively, see symbolConditions.
+	_, err = tx.Exec(`CREATE INDEX kind_index ON symbols(kind COLLATE NOCASE);`)
 	if err != nil {
 		return err
 	}
 
-	err = s.parseUncached(ctx, repoName, commitID, func(symbol protocol.Symbol) error {
-		symbolInDBValue := symbolToSymbolInDB(symbol)
-		_, err := insertStatement.Exec(&symbolInDBValue)
-		return err
-	})
+	_, err = tx.Exec(`CREATE INDEX parent_index ON symbols(parent COLLATE NOCASE);`)
 	if err != nil {
 		return err
 	}
 
-	err = tx.Commit()
+	_, err = tx.Exec(`CREATE INDEX exported_index ON symbols(exported);`)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// prepareInsertSymbol returns a statement which inserts a symbolInDB.
+func prepareInsertSymbol(tx *sqlx.Tx) (*sqlx.NamedStmt, error) {
+	return tx.PrepareNamed(
+		fmt.Sprintf(
+			"INSERT INTO symbols %s VALUES %s",
+			"( name,  namelowercase,  path,  pathlowercase,  line,  kind,  language,  parent,  parentkind,  signature,  pattern,  exported,  filelimited)",
+			"(:name, :namelowercase, :path, :pathlowercase, :line, :kind, :language, :parent, :parentkind, :signature, :pattern, :exported, :filelimited)"))
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -22,12 +23,40 @@ type Service struct {
 	// determine if the error is a bad request (eg invalid repo).
 	FetchTar func(context.Context, gitserver.Repo, api.CommitID) (io.ReadCloser, error)
 
+	// FetchTarPaths is like FetchTar, but the archive only contains the
+	// specified paths. It is used to parse the files that changed since an
+	// ancestor commit (optional).
+	FetchTarPaths func(context.Context, gitserver.Repo, api.CommitID, []string) (io.ReadCloser, error)
+
+	// ListAncestors returns up to n commits that are reachable from commit,
+	// nearest first. The commit itself may be included (optional).
+	ListAncestors func(ctx context.Context, repo api.RepoName, commit api.CommitID, n int) ([]api.CommitID, error)
+
+	// GitDiff returns the paths that changed between two commits (optional).
+	//
+	// If ListAncestors, GitDiff and FetchTarPaths are set, the symbols of a
+	// commit are computed incrementally from the symbols of the nearest
+	// ancestor commit in the cache.
+	GitDiff func(ctx context.Context, repo api.RepoName, commitA, commitB api.CommitID) (Changes, error)
+
 	// MaxConcurrentFetchTar is the maximum number of concurrent calls allowed
-	// to FetchTar. It defaults to 15.
+	// to FetchTar and FetchTarPaths. It defaults to 15.
 	MaxConcurrentFetchTar int
 
+	// NewParser returns a new parser for the parser pool, which is used for
+	// all languages without an alternative parser.
 	NewParser func() (ctags.Parser, error)
 
+	// AlternativeParsers are parsers by name that can be used instead of the
+	// parsers of NewParser for some languages. They must be safe for
+	// concurrent use (optional).
+	AlternativeParsers map[string]ctags.Parser
+
+	// ParserConfig returns the names of the alternative parsers to use by
+	// language, such as {"Go": "go"} (optional). Languages are named like
+	// the languages of github.com/src-d/enry.
+	ParserConfig func() map[string]string
+
 	// NumParserProcesses is the maximum number of ctags parser child processes to run.
 	NumParserProcesses int
 
@@ -40,6 +69,11 @@ type Service struct {
 	// MaxCacheSizeBytes.
 	MaxCacheSizeBytes int64
 
+	// MaxAggregatedIndexSizeBytes is the maximum size of the aggregated
+	// index in bytes. When it is larger, the least recently searched
+	// repositories are removed from it. There is no limit if it is 0.
+	MaxAggregatedIndexSizeBytes int64
+
 	// cache is the disk backed cache.
 	cache *diskcache.Store
 
@@ -49,6 +83,12 @@ type Service struct {
 
 	// pool of ctags parser child processes
 	parsers chan ctags.Parser
+
+	// aggregated is the aggregated index, which is opened on the first
+	// aggregated search.
+	aggregated     *aggregatedIndex
+	aggregatedErr  error
+	aggregatedOnce sync.Once
 }
 
 // Start must be called before any requests are handled.
@@ -81,6 +121,7 @@ func (s *Service) Handler() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/search", s.handleSearch)
+	mux.HandleFunc("/search-aggregated", s.handleSearchAggregated)
 	mux.HandleFunc("/healthz", s.handleHealthCheck)
 
 	return mux
@@ -4,14 +4,19 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"io/ioutil"
 	"net/http/httptest"
 	"os"
 	"reflect"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/goparser"
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/gitserver"
 	"github.com/sourcegraph/sourcegraph/internal/search"
@@ -178,3 +183,550 @@ func (m mockParser) Parse(name string, content []byte) ([]ctags.Entry, error) {
 }
 
 func (mockParser) Close() {}
+
+func TestService_incremental(t *testing.T) {
+	sqliteutil.MustRegisterSqlite3WithPcre()
+
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { os.RemoveAll(tmpDir) }()
+
+	files := map[api.CommitID]map[string]string{
+		"a": {"a.js": "x", "b.js": "y", "c.js": "z"},
+		"b": {"a.js": "w", "c.js": "z", "d.js": "v"},
+	}
+	var fetchedPaths []string
+	service := Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			if commit != "a" {
+				t.Errorf("unexpected fetch of all files of commit %s", commit)
+			}
+			return createTar(files[commit])
+		},
+		FetchTarPaths: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID, paths []string) (io.ReadCloser, error) {
+			fetchedPaths = paths
+			subset := map[string]string{}
+			for _, path := range paths {
+				subset[path] = files[commit][path]
+			}
+			return createTar(subset)
+		},
+		ListAncestors: func(ctx context.Context, repo api.RepoName, commit api.CommitID, n int) ([]api.CommitID, error) {
+			if commit == "b" {
+				return []api.CommitID{"b", "a"}, nil
+			}
+			return []api.CommitID{commit}, nil
+		},
+		GitDiff: func(ctx context.Context, repo api.RepoName, commitA, commitB api.CommitID) (Changes, error) {
+			if commitA != "a" || commitB != "b" {
+				t.Errorf("unexpected diff %s..%s", commitA, commitB)
+			}
+			return Changes{Added: []string{"d.js"}, Modified: []string{"a.js"}, Deleted: []string{"b.js"}}, nil
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return contentParser{}, nil
+		},
+		Path: tmpDir,
+	}
+	if err := service.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(commit api.CommitID) []protocol.Symbol {
+		result, err := service.search(context.Background(), protocol.SearchArgs{Repo: "r", CommitID: commit, First: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Slice(result.Symbols, func(i, j int) bool { return result.Symbols[i].Path < result.Symbols[j].Path })
+		return result.Symbols
+	}
+
+	want := []protocol.Symbol{{Name: "x", Path: "a.js"}, {Name: "y", Path: "b.js"}, {Name: "z", Path: "c.js"}}
+	if got := search("a"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	want = []protocol.Symbol{{Name: "w", Path: "a.js"}, {Name: "z", Path: "c.js"}, {Name: "v", Path: "d.js"}}
+	if got := search("b"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if want := []string{"d.js", "a.js"}; !reflect.DeepEqual(fetchedPaths, want) {
+		t.Errorf("got fetched paths %v, want %v", fetchedPaths, want)
+	}
+}
+
+func TestService_incrementalFallback(t *testing.T) {
+	sqliteutil.MustRegisterSqlite3WithPcre()
+
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { os.RemoveAll(tmpDir) }()
+
+	files := map[api.CommitID]map[string]string{
+		"a": {"a.js": "x", "b.js": "y"},
+		"b": {"a.js": "w", "c.js": "v"},
+	}
+	service := Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(files[commit])
+		},
+		FetchTarPaths: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID, paths []string) (io.ReadCloser, error) {
+			return nil, errors.New("archive failed")
+		},
+		ListAncestors: func(ctx context.Context, repo api.RepoName, commit api.CommitID, n int) ([]api.CommitID, error) {
+			return []api.CommitID{"b", "a"}, nil
+		},
+		GitDiff: func(ctx context.Context, repo api.RepoName, commitA, commitB api.CommitID) (Changes, error) {
+			return Changes{Added: []string{"c.js"}, Modified: []string{"a.js"}, Deleted: []string{"b.js"}}, nil
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return contentParser{}, nil
+		},
+		Path: tmpDir,
+	}
+	if err := service.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.search(context.Background(), protocol.SearchArgs{Repo: "r", CommitID: "a", First: 10}); err != nil {
+		t.Fatal(err)
+	}
+	// The incremental update of b fails after the symbols of the deleted and
+	// changed paths were removed, so all the symbols of b are parsed instead.
+	result, err := service.search(context.Background(), protocol.SearchArgs{Repo: "r", CommitID: "b", First: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(result.Symbols, func(i, j int) bool { return result.Symbols[i].Path < result.Symbols[j].Path })
+	want := []protocol.Symbol{{Name: "w", Path: "a.js"}, {Name: "v", Path: "c.js"}}
+	if !reflect.DeepEqual(result.Symbols, want) {
+		t.Errorf("got %+v, want %+v", result.Symbols, want)
+	}
+}
+
+func TestParseGitDiffNameStatus(t *testing.T) {
+	output := "M\x00a.go\x00A\x00b.go\x00D\x00c.go\x00T\x00h\x00"
+	got, err := ParseGitDiffNameStatus([]byte(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Changes{
+		Added:    []string{"b.go"},
+		Modified: []string{"a.go", "h"},
+		Deleted:  []string{"c.go"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if _, err := ParseGitDiffNameStatus([]byte("M\x00a.go\x00D\x00")); err == nil {
+		t.Error("expected an error for a status without a path")
+	}
+	if _, err := ParseGitDiffNameStatus([]byte("R100\x00a.go\x00b.go\x00")); err == nil {
+		t.Error("expected an error for a rename, which --no-renames does not report")
+	}
+}
+
+// contentParser returns a symbol for the content of each file.
+type contentParser struct{}
+
+func (contentParser) Parse(name string, content []byte) ([]ctags.Entry, error) {
+	return []ctags.Entry{{Name: string(content), Path: name}}, nil
+}
+
+func (contentParser) Close() {}
+
+func TestService_aggregated(t *testing.T) {
+	sqliteutil.MustRegisterSqlite3WithPcre()
+
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { os.RemoveAll(tmpDir) }()
+
+	files := map[string]map[string]string{
+		"r1@a": {"a.go": "foo", "b.js": "foobar"},
+		"r2@a": {"c.go": "bar"},
+		"r2@b": {"c.go": "foobaz"},
+	}
+	service := Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(files[string(repo.Name)+"@"+string(commit)])
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return contentParser{}, nil
+		},
+		Path: tmpDir,
+	}
+	if err := service.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// search waits until none of the repositories are missing from the
+	// aggregated index.
+	search := func(args protocol.AggregatedSearchArgs) *protocol.AggregatedSearchResult {
+		for i := 0; ; i++ {
+			result, err := service.searchAggregated(context.Background(), args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Missing) == 0 {
+				return result
+			}
+			if i == 100 {
+				t.Fatalf("repositories are still missing from the aggregated index: %v", result.Missing)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	r1a := protocol.RepoCommit{Repo: "r1", CommitID: "a"}
+	r2a := protocol.RepoCommit{Repo: "r2", CommitID: "a"}
+	r2b := protocol.RepoCommit{Repo: "r2", CommitID: "b"}
+
+	result, err := service.searchAggregated(context.Background(), protocol.AggregatedSearchArgs{Repos: []protocol.RepoCommit{r1a, r2a}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []protocol.RepoCommit{r1a, r2a}; !reflect.DeepEqual(result.Missing, want) {
+		t.Errorf("got missing %v, want %v", result.Missing, want)
+	}
+
+	got := search(protocol.AggregatedSearchArgs{
+		Repos: []protocol.RepoCommit{r1a, r2a},
+		Args:  protocol.SearchArgs{Query: "^foo", ExcludePattern: `\.js$`, First: 10},
+	})
+	want := []protocol.RepoSymbols{{RepoCommit: r1a, Symbols: []protocol.Symbol{{Name: "foo", Path: "a.go"}}}}
+	if !reflect.DeepEqual(got.Symbols, want) {
+		t.Errorf("got %+v, want %+v", got.Symbols, want)
+	}
+
+	// Searching r2 at another commit replaces its symbols.
+	got = search(protocol.AggregatedSearchArgs{
+		Repos: []protocol.RepoCommit{r1a, r2b},
+		Args:  protocol.SearchArgs{Query: "^foo", IncludePatterns: []string{`\.go$`}, First: 10},
+	})
+	want = []protocol.RepoSymbols{
+		{RepoCommit: r1a, Symbols: []protocol.Symbol{{Name: "foo", Path: "a.go"}}},
+		{RepoCommit: r2b, Symbols: []protocol.Symbol{{Name: "foobaz", Path: "c.go"}}},
+	}
+	if !reflect.DeepEqual(got.Symbols, want) {
+		t.Errorf("got %+v, want %+v", got.Symbols, want)
+	}
+}
+
+func TestService_aggregatedLimitAndEviction(t *testing.T) {
+	sqliteutil.MustRegisterSqlite3WithPcre()
+
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { os.RemoveAll(tmpDir) }()
+
+	files := map[api.RepoName]map[string]string{
+		"r1": {"a.go": "foo1", "b.go": "foo2", "c.go": "foo3"},
+		"r2": {"d.go": "foo4"},
+	}
+	service := Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(files[repo.Name])
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return contentParser{}, nil
+		},
+		Path: tmpDir,
+	}
+	if err := service.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	r1 := protocol.RepoCommit{Repo: "r1", CommitID: "a"}
+	r2 := protocol.RepoCommit{Repo: "r2", CommitID: "a"}
+	search := func(repos ...protocol.RepoCommit) *protocol.AggregatedSearchResult {
+		for i := 0; ; i++ {
+			result, err := service.searchAggregated(context.Background(), protocol.AggregatedSearchArgs{
+				Repos: repos,
+				Args:  protocol.SearchArgs{Query: "^foo", First: 2},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Missing) == 0 {
+				return result
+			}
+			if i == 100 {
+				t.Fatalf("repositories are still missing from the aggregated index: %v", result.Missing)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	// r1 has more matching symbols than the limit, but r2 still gets its
+	// share.
+	result := search(r1, r2)
+	var counts []int
+	for _, repo := range result.Symbols {
+		counts = append(counts, len(repo.Symbols))
+	}
+	if want := []int{1, 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("got symbol counts %v, want %v", counts, want)
+	}
+
+	// The symbols are parsed into the aggregated index without creating the
+	// database of the repository.
+	if _, err := service.cache.OpenIfExists(symbolsDBKey("r1", "a", nil)); !os.IsNotExist(err) {
+		t.Errorf("got error %v opening the repository database, want it not to exist", err)
+	}
+
+	index := service.aggregated
+	time.Sleep(10 * time.Millisecond)
+	search(r2)
+	ctx := context.Background()
+	if err := index.evict(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	var repos []string
+	if err := index.db.Select(&repos, `SELECT repo FROM repos ORDER BY lastsearched, repo`); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"r1", "r2"}; !reflect.DeepEqual(repos, want) {
+		t.Errorf("got repositories %v by last search, want %v", repos, want)
+	}
+
+	size, err := index.size(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := index.evict(ctx, size); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.evict(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := index.db.Get(&count, `SELECT COUNT(*) FROM symbols`); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("got %d symbols after evicting all repositories, want 0", count)
+	}
+}
+
+func TestService_alternativeParsers(t *testing.T) {
+	sqliteutil.MustRegisterSqlite3WithPcre()
+
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { os.RemoveAll(tmpDir) }()
+
+	files := map[string]string{"a.go": "x", "b.js": "y"}
+	config := map[string]string{"Go": "go", "JavaScript": "missing"}
+	service := Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(files)
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return contentParser{}, nil
+		},
+		AlternativeParsers: map[string]ctags.Parser{"go": prefixParser("go:")},
+		ParserConfig:       func() map[string]string { return config },
+		Path:               tmpDir,
+	}
+	if err := service.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func() []protocol.Symbol {
+		result, err := service.search(context.Background(), protocol.SearchArgs{Repo: "r", CommitID: "c", First: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Slice(result.Symbols, func(i, j int) bool { return result.Symbols[i].Path < result.Symbols[j].Path })
+		return result.Symbols
+	}
+
+	want := []protocol.Symbol{{Name: "go:x", Path: "a.go"}, {Name: "y", Path: "b.js"}}
+	if got := search(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Changing the configuration parses the symbols again.
+	config = nil
+	want = []protocol.Symbol{{Name: "x", Path: "a.go"}, {Name: "y", Path: "b.js"}}
+	if got := search(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestService_aggregatedAlternativeParsers(t *testing.T) {
+	sqliteutil.MustRegisterSqlite3WithPcre()
+
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { os.RemoveAll(tmpDir) }()
+
+	var (
+		mu     sync.Mutex
+		config = map[string]string{"Go": "go"}
+	)
+	service := Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(map[string]string{"a.go": "x"})
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return contentParser{}, nil
+		},
+		AlternativeParsers: map[string]ctags.Parser{"go": prefixParser("go:")},
+		ParserConfig: func() map[string]string {
+			mu.Lock()
+			defer mu.Unlock()
+			return config
+		},
+		Path: tmpDir,
+	}
+	if err := service.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := protocol.RepoCommit{Repo: "r", CommitID: "c"}
+	search := func() []protocol.Symbol {
+		for i := 0; ; i++ {
+			result, err := service.searchAggregated(context.Background(), protocol.AggregatedSearchArgs{
+				Repos: []protocol.RepoCommit{repo},
+				Args:  protocol.SearchArgs{First: 10},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Missing) == 0 {
+				if len(result.Symbols) != 1 {
+					t.Fatalf("got symbols %+v, want symbols of one repository", result.Symbols)
+				}
+				return result.Symbols[0].Symbols
+			}
+			if i == 100 {
+				t.Fatalf("repository is still missing from the aggregated index")
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	want := []protocol.Symbol{{Name: "go:x", Path: "a.go"}}
+	if got := search(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Changing the configuration parses the symbols again.
+	mu.Lock()
+	config = nil
+	mu.Unlock()
+	want = []protocol.Symbol{{Name: "x", Path: "a.go"}}
+	if got := search(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// prefixParser returns a symbol for the content of each file, prefixed with
+// the parser.
+type prefixParser string
+
+func (p prefixParser) Parse(name string, content []byte) ([]ctags.Entry, error) {
+	return []ctags.Entry{{Name: string(p) + string(content), Path: name}}, nil
+}
+
+func (prefixParser) Close() {}
+
+func TestService_filters(t *testing.T) {
+	sqliteutil.MustRegisterSqlite3WithPcre()
+
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { os.RemoveAll(tmpDir) }()
+
+	files := map[string]string{"a.go": `package a
+
+type Server struct{ conns int }
+
+func (s *Server) HandleA() {}
+
+func (s *Server) handleB() {}
+
+func HandleC() {}
+`}
+	service := Service{
+		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+			return createTar(files)
+		},
+		NewParser: func() (ctags.Parser, error) {
+			return goparser.NewParser(), nil
+		},
+		Path: tmpDir,
+	}
+	if err := service.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	yes, no := true, false
+	tests := map[string]struct {
+		args protocol.SearchArgs
+		want []string
+	}{
+		"kind": {
+			args: protocol.SearchArgs{Kinds: []string{"FUNC"}},
+			want: []string{"HandleC"},
+		},
+		"method": {
+			// symbolkind:method symbolparent:Server ^Handle
+			args: protocol.SearchArgs{Query: "^Handle", Kinds: []string{"method", "methodspec"}, Parent: "Server"},
+			want: []string{"HandleA", "handleB"},
+		},
+		"excludekind": {
+			args: protocol.SearchArgs{ExcludeKinds: []string{"func", "method", "package"}},
+			want: []string{"Server", "conns"},
+		},
+		"parent": {
+			args: protocol.SearchArgs{Query: "^handle", Parent: "server"},
+			want: []string{"HandleA", "handleB"},
+		},
+		"casesensitiveparent": {
+			args: protocol.SearchArgs{Parent: "server", IsCaseSensitive: true},
+		},
+		"exported": {
+			args: protocol.SearchArgs{Kinds: []string{"method"}, Parent: "Server", Exported: &yes},
+			want: []string{"HandleA"},
+		},
+		"unexported": {
+			args: protocol.SearchArgs{Exported: &no},
+			want: []string{"a", "conns", "handleB"},
+		},
+	}
+	for label, test := range tests {
+		t.Run(label, func(t *testing.T) {
+			args := test.args
+			args.Repo, args.CommitID, args.First = "r", "c", 10
+			result, err := service.search(context.Background(), args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, symbol := range result.Symbols {
+				got = append(got, symbol.Name)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
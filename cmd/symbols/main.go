@@ -13,14 +13,17 @@ import (
 	"os/signal"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/inconshreveable/log15"
 	"github.com/pkg/errors"
 
 	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/ctags"
+	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/pkg/goparser"
 	"github.com/sourcegraph/sourcegraph/cmd/symbols/internal/symbols"
 	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/conf"
 	"github.com/sourcegraph/sourcegraph/internal/debugserver"
 	"github.com/sourcegraph/sourcegraph/internal/env"
 	"github.com/sourcegraph/sourcegraph/internal/gitserver"
@@ -35,6 +38,7 @@ func main() {
 	var (
 		cacheDir       = env.Get("CACHE_DIR", "/tmp/symbols-cache", "directory to store cached symbols")
 		cacheSizeMB    = env.Get("SYMBOLS_CACHE_SIZE_MB", "100000", "maximum size of the disk cache in megabytes")
+		aggregatedMB   = env.Get("SYMBOLS_AGGREGATED_INDEX_SIZE_MB", "10000", "maximum size of the aggregated symbols index in megabytes")
 		ctagsProcesses = env.Get("CTAGS_PROCESSES", strconv.Itoa(runtime.GOMAXPROCS(0)), "number of ctags child processes to run")
 	)
 
@@ -51,6 +55,11 @@ func main() {
 		FetchTar: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
 			return gitserver.DefaultClient.Archive(ctx, repo, gitserver.ArchiveOptions{Treeish: string(commit), Format: "tar"})
 		},
+		FetchTarPaths: func(ctx context.Context, repo gitserver.Repo, commit api.CommitID, paths []string) (io.ReadCloser, error) {
+			return gitserver.DefaultClient.Archive(ctx, repo, gitserver.ArchiveOptions{Treeish: string(commit), Format: "tar", Paths: paths})
+		},
+		ListAncestors: listAncestors,
+		GitDiff:       gitDiff,
 		NewParser: func() (ctags.Parser, error) {
 			parser, err := ctags.NewParser(ctags.GetCommand())
 			if err != nil {
@@ -58,6 +67,12 @@ func main() {
 			}
 			return parser, nil
 		},
+		AlternativeParsers: map[string]ctags.Parser{
+			"go": goparser.NewParser(),
+		},
+		ParserConfig: func() map[string]string {
+			return conf.Get().SearchSymbolsParsers
+		},
 		Path: cacheDir,
 	}
 	if mb, err := strconv.ParseInt(cacheSizeMB, 10, 64); err != nil {
@@ -65,6 +80,11 @@ func main() {
 	} else {
 		service.MaxCacheSizeBytes = mb * 1000 * 1000
 	}
+	if mb, err := strconv.ParseInt(aggregatedMB, 10, 64); err != nil {
+		log.Fatalf("Invalid SYMBOLS_AGGREGATED_INDEX_SIZE_MB: %s", err)
+	} else {
+		service.MaxAggregatedIndexSizeBytes = mb * 1000 * 1000
+	}
 	var err error
 	service.NumParserProcesses, err = strconv.Atoi(ctagsProcesses)
 	if err != nil {
@@ -90,6 +110,34 @@ func main() {
 	}
 }
 
+// listAncestors returns up to n commits reachable from commit, nearest first.
+func listAncestors(ctx context.Context, repo api.RepoName, commit api.CommitID, n int) ([]api.CommitID, error) {
+	cmd := gitserver.DefaultClient.Command("git", "rev-list", "--max-count="+strconv.Itoa(n), string(commit), "--")
+	cmd.Repo = gitserver.Repo{Name: repo}
+	out, err := cmd.Output(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, fmt.Sprintf("git command %v failed (output: %q)", cmd.Args, out))
+	}
+	var commits []api.CommitID
+	for _, line := range strings.Fields(string(out)) {
+		commits = append(commits, api.CommitID(line))
+	}
+	return commits, nil
+}
+
+// gitDiff returns the paths that changed between commitA and commitB. Renamed
+// files are reported as deleted and added, which is how the symbols of a
+// file are updated anyway.
+func gitDiff(ctx context.Context, repo api.RepoName, commitA, commitB api.CommitID) (symbols.Changes, error) {
+	cmd := gitserver.DefaultClient.Command("git", "diff", "-z", "--name-status", "--no-renames", string(commitA), string(commitB), "--")
+	cmd.Repo = gitserver.Repo{Name: repo}
+	out, err := cmd.Output(ctx)
+	if err != nil {
+		return symbols.Changes{}, errors.WithMessage(err, fmt.Sprintf("git command %v failed (output: %q)", cmd.Args, out))
+	}
+	return symbols.ParseGitDiffNameStatus(out)
+}
+
 func shutdownOnSIGINT(s *http.Server) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
@@ -281,6 +281,13 @@ func BrandName() string {
 	return branding.BrandName
 }
 
+// SymbolsAggregatedIndexEnabled returns true if symbol searches of
+// repositories that are not served by indexed search use the aggregated index
+// of the symbols service.
+func SymbolsAggregatedIndexEnabled() bool {
+	return Get().SearchSymbolsAggregatedIndex
+}
+
 // SearchSymbolsParallelism returns 20, or the site config
 // "debug.search.symbolsParallelism" value if configured.
 func SearchSymbolsParallelism() int {
@@ -9,10 +9,12 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -22,12 +24,14 @@ import (
 	"github.com/inconshreveable/log15"
 	"github.com/neelance/parallel"
 	"github.com/opentracing-contrib/go-stdlib/nethttp"
+	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	otlog "github.com/opentracing/opentracing-go/log"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/conf"
+	"github.com/sourcegraph/sourcegraph/internal/env"
 	"github.com/sourcegraph/sourcegraph/internal/extsvc/gitolite"
 	"github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/httpcli"
@@ -38,6 +42,8 @@ import (
 
 var requestMeter = metrics.NewRequestMeter("gitserver", "Total number of requests sent to gitserver.")
 
+var replicationFactor = env.Get("SRC_GITSERVER_REPLICATION_FACTOR", "1", "number of gitservers that each repository is cloned on. It must be the same for all services.")
+
 // defaultTransport is the default transport used in the default client and the
 // default reverse proxy. ot.Transport will propagate opentracing spans.
 var defaultTransport = &ot.Transport{
@@ -56,12 +62,18 @@ var DefaultClient = NewClient(&http.Client{Transport: defaultTransport})
 // NewClient returns a new gitserver.Client instantiated with default arguments
 // and httpcli.Doer.
 func NewClient(cli httpcli.Doer) *Client {
+	n, err := strconv.Atoi(replicationFactor)
+	if err != nil || n < 1 {
+		log15.Error("invalid SRC_GITSERVER_REPLICATION_FACTOR, using 1", "value", replicationFactor)
+		n = 1
+	}
 	return &Client{
 		Addrs: func(ctx context.Context) []string {
 			return conf.Get().ServiceConnections.GitServers
 		},
-		HTTPClient:  cli,
-		HTTPLimiter: parallel.NewRun(500),
+		ReplicationFactor: n,
+		HTTPClient:        cli,
+		HTTPLimiter:       parallel.NewRun(500),
 		// Use the binary name for UserAgent. This should effectively identify
 		// which service is making the request (excluding requests proxied via the
 		// frontend internal API)
@@ -82,6 +94,10 @@ type Client struct {
 	// concurrent use. It may return different results at different times.
 	Addrs func(ctx context.Context) []string
 
+	// ReplicationFactor is the number of gitservers that each repository is
+	// cloned on, see AddrsForRepo. Values less than 1 are treated as 1.
+	ReplicationFactor int
+
 	// UserAgent is a string identifing who the client is. It will be logged in
 	// the telemetry in gitserver.
 	UserAgent string
@@ -104,9 +120,116 @@ func (c *Client) addrForKey(ctx context.Context, key string) string {
 }
 
 func addrForKey(addrs []string, key string) string {
+	best, bestScore := addrs[0], addrScore(addrs[0], key)
+	for _, addr := range addrs[1:] {
+		if score := addrScore(addr, key); score > bestScore || (score == bestScore && addr < best) {
+			best, bestScore = addr, score
+		}
+	}
+	return best
+}
+
+// addrScore is the rendezvous hashing score of addr for key. A key belongs
+// to the addresses with the highest scores. Unlike taking the hash of the
+// key modulo the number of addresses, adding or removing an address only
+// moves the keys whose highest scoring addresses change, which is about 1/n
+// of the keys for n addresses.
+func addrScore(addr, key string) uint64 {
+	h := md5.New()
+	_, _ = io.WriteString(h, addr)
+	_, _ = h.Write([]byte{0})
+	_, _ = io.WriteString(h, key)
+	return binary.BigEndian.Uint64(h.Sum(nil))
+}
+
+// rankAddrs returns addrs ordered by their score for key, highest first.
+func rankAddrs(addrs []string, key string) []string {
+	ranked := make([]string, len(addrs))
+	copy(ranked, addrs)
+	scores := make(map[string]uint64, len(addrs))
+	for _, addr := range addrs {
+		scores[addr] = addrScore(addr, key)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if si, sj := scores[ranked[i]], scores[ranked[j]]; si != sj {
+			return si > sj
+		}
+		return ranked[i] < ranked[j]
+	})
+	return ranked
+}
+
+// AddrsForRepo returns the addresses of the gitservers that the given repo
+// is cloned on, the primary first. Reads fail over to the other replicas if
+// the primary is unreachable.
+func (c *Client) AddrsForRepo(ctx context.Context, repo api.RepoName) []string {
+	return c.rankedAddrsForRepo(ctx, repo, c.ReplicationFactor)
+}
+
+// rankedAddrsForRepo returns the n highest ranked addresses for repo.
+func (c *Client) rankedAddrsForRepo(ctx context.Context, repo api.RepoName, n int) []string {
+	repo = protocol.NormalizeRepo(repo) // in case the caller didn't already normalize it
+	addrs := c.Addrs(ctx)
+	if len(addrs) == 0 {
+		panic("unexpected state: no gitserver addresses")
+	}
+	return addrsForKey(addrs, string(repo), n)
+}
+
+// PeersForRepo returns the addresses of the gitservers that likely held the
+// given repo before it was moved to its primary: the replicas after the
+// primary, the next ranked gitserver (which held it before the most recently
+// added gitserver took it over), and the gitservers that the modulo hashing
+// of earlier versions placed it on. They are the gitservers to copy the repo
+// from, or to read it from, while its replicas do not have it yet.
+func (c *Client) PeersForRepo(ctx context.Context, repo api.RepoName) []string {
+	n := c.ReplicationFactor
+	if n < 1 {
+		n = 1
+	}
+	repo = protocol.NormalizeRepo(repo) // in case the caller didn't already normalize it
+	addrs := c.Addrs(ctx)
+	if len(addrs) == 0 {
+		panic("unexpected state: no gitserver addresses")
+	}
+
+	ranked := addrsForKey(addrs, string(repo), n+1)
+	peers := ranked[1:]
+	for _, addr := range legacyAddrsForKey(addrs, string(repo), n) {
+		if !containsAddr(ranked, addr) && !containsAddr(peers, addr) {
+			peers = append(peers, addr)
+		}
+	}
+	return peers
+}
+
+// legacyAddrsForKey returns the n addresses that key was placed on before
+// rendezvous hashing: the hash of the key modulo the number of addresses,
+// and the addresses that follow it. Repos stay there until Rebalance copies
+// them to their replicas.
+func legacyAddrsForKey(addrs []string, key string, n int) []string {
+	if n > len(addrs) {
+		n = len(addrs)
+	}
 	sum := md5.Sum([]byte(key))
-	serverIndex := binary.BigEndian.Uint64(sum[:]) % uint64(len(addrs))
-	return addrs[serverIndex]
+	i := int(binary.BigEndian.Uint64(sum[:]) % uint64(len(addrs)))
+	legacy := make([]string, n)
+	for j := range legacy {
+		legacy[j] = addrs[(i+j)%len(addrs)]
+	}
+	return legacy
+}
+
+// addrsForKey returns the n highest ranked addresses for key. The first one
+// is the address of addrForKey.
+func addrsForKey(addrs []string, key string, n int) []string {
+	if n > len(addrs) {
+		n = len(addrs)
+	}
+	if n < 1 {
+		n = 1
+	}
+	return rankAddrs(addrs, key)[:n]
 }
 
 // ArchiveOptions contains options for the Archive func.
@@ -144,6 +267,15 @@ func (a *archiveReader) Close() error {
 // ArchiveURL returns a URL from which an archive of the given Git repository can
 // be downloaded from.
 func (c *Client) ArchiveURL(ctx context.Context, repo Repo, opt ArchiveOptions) *url.URL {
+	return &url.URL{
+		Scheme:   "http",
+		Host:     c.AddrForRepo(ctx, repo.Name),
+		Path:     "/archive",
+		RawQuery: archiveQuery(repo, opt).Encode(),
+	}
+}
+
+func archiveQuery(repo Repo, opt ArchiveOptions) url.Values {
 	q := url.Values{
 		"repo":    {string(repo.Name)},
 		"treeish": {opt.Treeish},
@@ -153,13 +285,7 @@ func (c *Client) ArchiveURL(ctx context.Context, repo Repo, opt ArchiveOptions)
 	for _, path := range opt.Paths {
 		q.Add("path", path)
 	}
-
-	return &url.URL{
-		Scheme:   "http",
-		Host:     c.AddrForRepo(ctx, repo.Name),
-		Path:     "/archive",
-		RawQuery: q.Encode(),
-	}
+	return q
 }
 
 // Archive produces an archive from a Git repository.
@@ -181,8 +307,7 @@ func (c *Client) Archive(ctx context.Context, repo Repo, opt ArchiveOptions) (_
 		return nil, err
 	}
 
-	u := c.ArchiveURL(ctx, repo, opt)
-	resp, err := c.do(ctx, repo.Name, "GET", u.String(), nil)
+	resp, err := c.do(ctx, repo.Name, "GET", "archive?"+archiveQuery(repo, opt).Encode(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -246,6 +371,7 @@ func (c *Cmd) sendExec(ctx context.Context) (_ io.ReadCloser, _ http.Header, err
 	req := &protocol.ExecRequest{
 		Repo:           repoName,
 		URL:            c.Repo.URL,
+		CloneOptions:   c.Repo.CloneOptions,
 		EnsureRevision: c.EnsureRevision,
 		Args:           c.Args[1:],
 	}
@@ -280,8 +406,24 @@ var deadlineExceededCounter = prometheus.NewCounter(prometheus.CounterOpts{
 	Help:      "Times that Client.sendExec() returned context.DeadlineExceeded",
 })
 
+var failoverCounter = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "src",
+	Subsystem: "gitserver",
+	Name:      "client_failover",
+	Help:      "Times that a request failed over to another replica because a gitserver was unreachable",
+})
+
+var handoffCounter = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "src",
+	Subsystem: "gitserver",
+	Name:      "client_handoff",
+	Help:      "Times that a read was served by a previous holder of a repository because its replica did not have it yet",
+})
+
 func init() {
 	prometheus.MustRegister(deadlineExceededCounter)
+	prometheus.MustRegister(failoverCounter)
+	prometheus.MustRegister(handoffCounter)
 }
 
 // Cmd represents a command to be executed remotely.
@@ -303,6 +445,10 @@ type Repo struct {
 	// this field is optional (it will use the last-used Git remote URL). If the repository is not
 	// cloned on the gitserver, the request will fail.
 	URL string
+
+	// CloneOptions are the options for cloning the repository if it is not
+	// cloned on the gitserver. Nil clones the whole repository.
+	CloneOptions *protocol.CloneOptions
 }
 
 // Command creates a new Cmd. Command name must be 'git',
@@ -497,7 +643,7 @@ func (c *Client) ListCloned(ctx context.Context) ([]string, error) {
 			if len(r) > 0 {
 				filtered := r[:0]
 				for _, repo := range r {
-					if addrForKey(addrs, repo) == addr {
+					if containsAddr(addrsForKey(addrs, repo, c.ReplicationFactor), addr) {
 						filtered = append(filtered, repo)
 					}
 				}
@@ -512,7 +658,85 @@ func (c *Client) ListCloned(ctx context.Context) ([]string, error) {
 		}(addr)
 	}
 	wg.Wait()
-	return repos, err
+
+	// Repos are listed by each of their replicas.
+	sort.Strings(repos)
+	deduped := repos[:0]
+	for i, repo := range repos {
+		if i == 0 || repo != repos[i-1] {
+			deduped = append(deduped, repo)
+		}
+	}
+	return deduped, err
+}
+
+// MockListCloneProgress mocks (*Client).ListCloneProgress for tests.
+var MockListCloneProgress func(context.Context) (map[api.RepoName]*protocol.CloneProgress, error)
+
+// ListCloneProgress returns the progress of the clones that are running on
+// all gitservers. A repo that is cloned by several of its replicas at once is
+// reported with the progress of the replica that is furthest behind.
+func (c *Client) ListCloneProgress(ctx context.Context) (map[api.RepoName]*protocol.CloneProgress, error) {
+	if MockListCloneProgress != nil {
+		return MockListCloneProgress(ctx)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		err      error
+		progress = map[api.RepoName]*protocol.CloneProgress{}
+	)
+	for _, addr := range c.Addrs(ctx) {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			r, e := c.doListCloneProgressOne(ctx, addr)
+			mu.Lock()
+			defer mu.Unlock()
+			if e != nil {
+				err = e
+				return
+			}
+			for repo, p := range r.Results {
+				if prev, ok := progress[repo]; !ok || p.ETA > prev.ETA {
+					progress[repo] = p
+				}
+			}
+		}(addr)
+	}
+	wg.Wait()
+	return progress, err
+}
+
+func (c *Client) doListCloneProgressOne(ctx context.Context, addr string) (*protocol.ListCloneProgressResponse, error) {
+	req, err := http.NewRequest("GET", "http://"+addr+"/list-clone-progress", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &url.Error{URL: resp.Request.URL.String(), Op: "ListCloneProgress", Err: fmt.Errorf("ListCloneProgress: http status %d", resp.StatusCode)}
+	}
+
+	var res protocol.ListCloneProgressResponse
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	return &res, err
+}
+
+func containsAddr(addrs []string, addr string) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
 }
 
 // GetGitolitePhabricatorMetadata returns Phabricator metadata for a Gitolite repository fetched via
@@ -561,13 +785,52 @@ func (c *Client) doListOne(ctx context.Context, urlSuffix, addr string) ([]strin
 // Repo updates are not guaranteed to occur. If a repo has been updated
 // recently (within the Since duration specified in the request), the
 // update won't happen.
+//
+// The update is requested from every replica of the repo, so that the
+// secondary replicas are cloned and kept up to date. The response is the one
+// of the primary replica.
 func (c *Client) RequestRepoUpdate(ctx context.Context, repo Repo, since time.Duration) (*protocol.RepoUpdateResponse, error) {
 	req := &protocol.RepoUpdateRequest{
-		Repo:  repo.Name,
-		URL:   repo.URL,
-		Since: since,
+		Repo:         repo.Name,
+		URL:          repo.URL,
+		CloneOptions: repo.CloneOptions,
+		Since:        since,
+	}
+	addrs := c.AddrsForRepo(ctx, repo.Name)
+	infos := make([]*protocol.RepoUpdateResponse, len(addrs))
+	errs := make([]error, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			infos[i], errs[i] = c.requestRepoUpdate(ctx, addr, req)
+		}(i, addr)
+	}
+	wg.Wait()
+	for i, err := range errs[1:] {
+		if err != nil {
+			log15.Warn("failed to update secondary replica", "repo", repo.Name, "addr", addrs[i+1], "error", err)
+		}
 	}
-	resp, err := c.httpPost(ctx, repo.Name, "repo-update", req)
+	return infos[0], errs[0]
+}
+
+// RequestRepoUpdateOn is like RequestRepoUpdate, but only sends the request
+// to the gitserver at addr. It is used to copy repos to their replicas when
+// they are rebalanced: if addr does not have the repo, it copies it from the
+// gitserver at peer rather than cloning it from the code host.
+func (c *Client) RequestRepoUpdateOn(ctx context.Context, addr string, repo Repo, peer string) (*protocol.RepoUpdateResponse, error) {
+	return c.requestRepoUpdate(ctx, addr, &protocol.RepoUpdateRequest{
+		Repo:         repo.Name,
+		URL:          repo.URL,
+		CloneOptions: repo.CloneOptions,
+		Peer:         peer,
+	})
+}
+
+func (c *Client) requestRepoUpdate(ctx context.Context, addr string, req *protocol.RepoUpdateRequest) (*protocol.RepoUpdateResponse, error) {
+	resp, err := c.httpPost(ctx, req.Repo, "http://"+addr+"/repo-update", req)
 	if err != nil {
 		return nil, err
 	}
@@ -643,10 +906,16 @@ func (e *RepoNotCloneableErr) Error() string {
 }
 
 func (c *Client) IsRepoCloned(ctx context.Context, repo api.RepoName) (bool, error) {
+	return c.IsRepoClonedOn(ctx, c.AddrForRepo(ctx, repo), repo)
+}
+
+// IsRepoClonedOn reports whether the repository is cloned on the gitserver
+// at addr.
+func (c *Client) IsRepoClonedOn(ctx context.Context, addr string, repo api.RepoName) (bool, error) {
 	req := &protocol.IsRepoClonedRequest{
 		Repo: repo,
 	}
-	resp, err := c.httpPost(ctx, repo, "is-repo-cloned", req)
+	resp, err := c.httpPost(ctx, repo, "http://"+addr+"/is-repo-cloned", req)
 	if err != nil {
 		return false, err
 	}
@@ -806,12 +1075,22 @@ func (c *Client) RepoInfo(ctx context.Context, repos ...api.RepoName) (*protocol
 	return &res, err.ErrorOrNil()
 }
 
-// Remove removes the repository clone from gitserver.
+// Remove removes the repository clone from every gitserver it is cloned on.
 func (c *Client) Remove(ctx context.Context, repo api.RepoName) error {
+	var err *multierror.Error
+	for _, addr := range c.AddrsForRepo(ctx, repo) {
+		if e := c.remove(ctx, addr, repo); e != nil {
+			err = multierror.Append(err, e)
+		}
+	}
+	return err.ErrorOrNil()
+}
+
+func (c *Client) remove(ctx context.Context, addr string, repo api.RepoName) error {
 	req := &protocol.RepoDeleteRequest{
 		Repo: repo,
 	}
-	resp, err := c.httpPost(ctx, repo, "delete", req)
+	resp, err := c.httpPost(ctx, repo, "http://"+addr+"/delete", req)
 	if err != nil {
 		return err
 	}
@@ -824,12 +1103,39 @@ func (c *Client) Remove(ctx context.Context, repo api.RepoName) error {
 	return nil
 }
 
+// BackupRepo backs up the repository to the bundle store of gitserver now,
+// rather than waiting for the next periodic backup.
+func (c *Client) BackupRepo(ctx context.Context, repo api.RepoName) error {
+	req := &protocol.RepoBackupRequest{
+		Repo: repo,
+	}
+	resp, err := c.httpPost(ctx, repo, "repo-backup", req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// best-effort inclusion of body in error message
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 200))
+		return &url.Error{URL: resp.Request.URL.String(), Op: "RepoBackup", Err: fmt.Errorf("RepoBackup: http status %d: %s", resp.StatusCode, string(body))}
+	}
+	return nil
+}
+
 func (c *Client) httpPost(ctx context.Context, repo api.RepoName, op string, payload interface{}) (resp *http.Response, err error) {
 	return c.do(ctx, repo, "POST", op, payload)
 }
 
+// failoverOps are the read operations that are retried on the next replica of
+// a repository if a gitserver is unreachable.
+var failoverOps = map[string]bool{
+	"exec":    true,
+	"archive": true,
+}
+
 // do performs a request to a gitserver, sharding based on the given
-// repo name (the repo name is otherwise not used).
+// repo name (the repo name is otherwise not used). If op is a URL rather than
+// an operation, it is requested as is.
 func (c *Client) do(ctx context.Context, repo api.RepoName, method, op string, payload interface{}) (resp *http.Response, err error) {
 	span, ctx := ot.StartSpanFromContext(ctx, "Client.do")
 	defer func() {
@@ -846,16 +1152,81 @@ func (c *Client) do(ctx context.Context, repo api.RepoName, method, op string, p
 		return nil, err
 	}
 
-	uri := op
-	if !strings.HasPrefix(op, "http") {
-		uri = "http://" + c.AddrForRepo(ctx, repo) + "/" + op
+	if strings.HasPrefix(op, "http") {
+		return c.doURI(ctx, span, method, op, reqBody, nil)
 	}
 
+	addrs := c.AddrsForRepo(ctx, repo)
+	failover := failoverOps[strings.SplitN(op, "?", 2)[0]]
+	if !failover {
+		addrs = addrs[:1]
+	}
+	var addr string
+	for i := range addrs {
+		addr = addrs[i]
+		resp, err = c.doURI(ctx, span, method, "http://"+addr+"/"+op, reqBody, nil)
+		if err == nil || i == len(addrs)-1 || !isUnreachable(err) || ctx.Err() != nil {
+			break
+		}
+		failoverCounter.Inc()
+		span.LogKV("event", "failover", "addr", addr, "err", err.Error())
+	}
+	if !failover || err != nil || resp.StatusCode != http.StatusNotFound {
+		return resp, err
+	}
+
+	// The replica does not have the repo (yet). If gitservers were added or
+	// removed, the repo is still on the gitservers that held it before until
+	// it has been copied to its new replicas, so we read it from them in the
+	// meantime. A replica that is copying the repo tells us where from.
+	peers := c.PeersForRepo(ctx, repo)
+	if peer := resp.Header.Get(protocol.HandoffPeerHeader); peer != "" {
+		peers = append([]string{peer}, peers...)
+	}
+	header := http.Header{protocol.HandoffHeader: []string{"1"}}
+	tried := map[string]bool{addr: true}
+	for _, peer := range peers {
+		if tried[peer] {
+			continue
+		}
+		tried[peer] = true
+		peerResp, err := c.doURI(ctx, span, method, "http://"+peer+"/"+op, reqBody, header)
+		if err != nil {
+			span.LogKV("event", "handoff failed", "addr", peer, "err", err.Error())
+			continue
+		}
+		if peerResp.StatusCode == http.StatusNotFound {
+			peerResp.Body.Close()
+			continue
+		}
+		resp.Body.Close()
+		handoffCounter.Inc()
+		span.LogKV("event", "handoff", "addr", peer)
+		return peerResp, nil
+	}
+	return resp, nil
+}
+
+// isUnreachable reports whether err is an error to connect to a gitserver,
+// in which case the request was not received.
+func isUnreachable(err error) bool {
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+	e, ok := err.(*net.OpError)
+	return ok && e.Op == "dial"
+}
+
+func (c *Client) doURI(ctx context.Context, span opentracing.Span, method, uri string, reqBody []byte, header http.Header) (*http.Response, error) {
 	req, err := http.NewRequest(method, uri, bytes.NewReader(reqBody))
 	if err != nil {
 		return nil, err
 	}
 
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", c.UserAgent)
 	req = req.WithContext(ctx)
@@ -4,9 +4,12 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"crypto/md5"
 	"encoding/base64"
+	"encoding/binary"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -14,6 +17,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"sort"
+	"sync"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -22,6 +26,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/cmd/gitserver/server"
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/httpcli"
 )
 
@@ -33,11 +38,11 @@ func TestClient_ListCloned(t *testing.T) {
 			switch r.URL.String() {
 			case "http://gitserver-0/list?cloned":
 				return &http.Response{
-					Body: ioutil.NopCloser(bytes.NewBufferString(`["repo0-a", "repo0-b"]`)),
+					Body: ioutil.NopCloser(bytes.NewBufferString(`["repo0-c", "repo0-b"]`)),
 				}, nil
 			case "http://gitserver-1/list?cloned":
 				return &http.Response{
-					Body: ioutil.NopCloser(bytes.NewBufferString(`["repo1-a", "repo1-b"]`)),
+					Body: ioutil.NopCloser(bytes.NewBufferString(`["repo1-b", "repo1-e"]`)),
 				}, nil
 			default:
 				return nil, fmt.Errorf("unexpected url: %s", r.URL.String())
@@ -45,7 +50,7 @@ func TestClient_ListCloned(t *testing.T) {
 		}),
 	}
 
-	want := []string{"repo0-a", "repo1-a", "repo1-b"}
+	want := []string{"repo0-c", "repo1-b", "repo1-e"}
 	got, err := cli.ListCloned(context.Background())
 	if err != nil {
 		t.Fatal(err)
@@ -240,3 +245,244 @@ func createSimpleGitRepo(t *testing.T, root string) string {
 
 	return dir
 }
+
+func TestClient_AddrsForRepo(t *testing.T) {
+	addrs := []string{"gitserver-0", "gitserver-1", "gitserver-2"}
+	for _, n := range []int{0, 1, 2, 3, 4} {
+		cli := &gitserver.Client{
+			Addrs:             func(context.Context) []string { return addrs },
+			ReplicationFactor: n,
+		}
+		for _, repo := range []api.RepoName{"github.com/a/b", "github.com/c/d", "github.com/e/f"} {
+			got := cli.AddrsForRepo(context.Background(), repo)
+			want := n
+			if want < 1 {
+				want = 1
+			} else if want > len(addrs) {
+				want = len(addrs)
+			}
+			if len(got) != want {
+				t.Fatalf("replication factor %d: got %d addrs %v, want %d", n, len(got), got, want)
+			}
+			if got[0] != cli.AddrForRepo(context.Background(), repo) {
+				t.Errorf("replication factor %d: got primary %s, want %s", n, got[0], cli.AddrForRepo(context.Background(), repo))
+			}
+			seen := map[string]bool{}
+			for _, addr := range got {
+				if seen[addr] {
+					t.Errorf("replication factor %d: duplicate addr %s in %v", n, addr, got)
+				}
+				seen[addr] = true
+			}
+		}
+	}
+}
+
+func TestClient_failover(t *testing.T) {
+	addrs := []string{"gitserver-0", "gitserver-1"}
+	repo := api.RepoName("github.com/a/b")
+
+	var mu sync.Mutex
+	var requested []string
+	cli := &gitserver.Client{
+		Addrs:             func(context.Context) []string { return addrs },
+		ReplicationFactor: 2,
+	}
+	primary := cli.AddrForRepo(context.Background(), repo)
+	cli.HTTPClient = httpcli.DoerFunc(func(r *http.Request) (*http.Response, error) {
+		mu.Lock()
+		requested = append(requested, r.URL.Host+r.URL.Path)
+		mu.Unlock()
+		if r.URL.Host == primary {
+			return nil, &url.Error{Op: r.Method, URL: r.URL.String(), Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+		}
+		header := http.Header{}
+		header.Set("X-Exec-Exit-Status", "0")
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewBufferString("ok")),
+			Trailer:    header,
+		}, nil
+	})
+	secondary := cli.AddrsForRepo(context.Background(), repo)[1]
+
+	// Reads fail over to the secondary.
+	cmd := cli.Command("git", "rev-parse", "HEAD")
+	cmd.Repo = gitserver.Repo{Name: repo}
+	out, err := cmd.Output(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "ok" {
+		t.Errorf("got output %q, want %q", out, "ok")
+	}
+	rc, err := cli.Archive(context.Background(), gitserver.Repo{Name: repo}, gitserver.ArchiveOptions{Treeish: "HEAD", Format: "tar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+
+	// Other requests are not retried.
+	if _, err := cli.RepoInfo(context.Background(), repo); err == nil {
+		t.Error("expected RepoInfo to fail when the primary is unreachable")
+	}
+
+	want := []string{
+		primary + "/exec", secondary + "/exec",
+		primary + "/archive", secondary + "/archive",
+		primary + "/repos",
+	}
+	if !cmp.Equal(want, requested) {
+		t.Errorf("mismatch for requests (-want +got):\n%s", cmp.Diff(want, requested))
+	}
+}
+
+func TestClient_AddrForRepo_rebalance(t *testing.T) {
+	addrs := []string{"gitserver-0", "gitserver-1", "gitserver-2"}
+	before := &gitserver.Client{Addrs: func(context.Context) []string { return addrs }}
+	after := &gitserver.Client{Addrs: func(context.Context) []string { return append(addrs, "gitserver-3") }}
+
+	const n = 1000
+	moved := 0
+	for i := 0; i < n; i++ {
+		repo := api.RepoName(fmt.Sprintf("github.com/foo/repo-%d", i))
+		oldAddr, newAddr := before.AddrForRepo(context.Background(), repo), after.AddrForRepo(context.Background(), repo)
+		if oldAddr == newAddr {
+			continue
+		}
+		moved++
+		// Repos only move to the added gitserver, and clients find them on
+		// the gitserver that held them before.
+		if newAddr != "gitserver-3" {
+			t.Fatalf("%s moved from %s to %s, want it to only move to gitserver-3", repo, oldAddr, newAddr)
+		}
+		if peers := after.PeersForRepo(context.Background(), repo); len(peers) == 0 || peers[0] != oldAddr {
+			t.Fatalf("%s: got peers %v, want %s first", repo, peers, oldAddr)
+		}
+	}
+	// About a quarter of the repos move to the added gitserver.
+	if moved < n/8 || moved > n/2 {
+		t.Errorf("%d of %d repos moved, want about %d", moved, n, n/4)
+	}
+}
+
+func TestClient_PeersForRepo_legacy(t *testing.T) {
+	addrs := []string{"gitserver-0", "gitserver-1", "gitserver-2", "gitserver-3"}
+	cli := &gitserver.Client{Addrs: func(context.Context) []string { return addrs }}
+
+	for i := 0; i < 100; i++ {
+		repo := api.RepoName(fmt.Sprintf("github.com/foo/repo-%d", i))
+
+		// The gitserver that the modulo hashing of earlier versions placed
+		// the repo on.
+		sum := md5.Sum([]byte(repo))
+		legacy := addrs[binary.BigEndian.Uint64(sum[:])%uint64(len(addrs))]
+
+		primary := cli.AddrForRepo(context.Background(), repo)
+		peers := cli.PeersForRepo(context.Background(), repo)
+		if legacy != primary && !containsString(peers, legacy) {
+			t.Fatalf("%s: got peers %v, want them to include the legacy gitserver %s", repo, peers, legacy)
+		}
+		if containsString(peers, primary) {
+			t.Fatalf("%s: got peers %v, want them not to include the primary %s", repo, peers, primary)
+		}
+	}
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestClient_handoff(t *testing.T) {
+	addrs := []string{"gitserver-0", "gitserver-1"}
+	repo := api.RepoName("github.com/a/b")
+
+	var requested []string
+	cli := &gitserver.Client{Addrs: func(context.Context) []string { return addrs }}
+	primary := cli.AddrForRepo(context.Background(), repo)
+	peer := cli.PeersForRepo(context.Background(), repo)[0]
+	cli.HTTPClient = httpcli.DoerFunc(func(r *http.Request) (*http.Response, error) {
+		requested = append(requested, r.URL.Host+r.URL.Path)
+		if r.URL.Host == primary {
+			if r.Header.Get(protocol.HandoffHeader) != "" {
+				t.Errorf("unexpected handoff header in the request to the primary")
+			}
+			return &http.Response{
+				StatusCode: http.StatusNotFound,
+				Body:       ioutil.NopCloser(bytes.NewBufferString(`{"cloneInProgress":true}`)),
+				Request:    r,
+			}, nil
+		}
+		if r.Header.Get(protocol.HandoffHeader) == "" {
+			t.Errorf("missing handoff header in the request to the peer")
+		}
+		header := http.Header{}
+		header.Set("X-Exec-Exit-Status", "0")
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewBufferString("ok")),
+			Trailer:    header,
+		}, nil
+	})
+
+	// Reads of a repo that the primary does not have yet are handed off to
+	// the gitserver that held it before.
+	cmd := cli.Command("git", "rev-parse", "HEAD")
+	cmd.Repo = gitserver.Repo{Name: repo}
+	out, err := cmd.Output(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "ok" {
+		t.Errorf("got output %q, want %q", out, "ok")
+	}
+
+	// Other requests are not handed off.
+	if _, err := cli.RepoInfo(context.Background(), repo); err == nil {
+		t.Error("expected RepoInfo to fail when the primary does not have the repo")
+	}
+
+	want := []string{primary + "/exec", peer + "/exec", primary + "/repos"}
+	if !cmp.Equal(want, requested) {
+		t.Errorf("mismatch for requests (-want +got):\n%s", cmp.Diff(want, requested))
+	}
+}
+
+func TestClient_RequestRepoUpdate_replicated(t *testing.T) {
+	addrs := []string{"gitserver-0", "gitserver-1", "gitserver-2"}
+	var mu sync.Mutex
+	updated := map[string]bool{}
+	cli := &gitserver.Client{
+		Addrs:             func(context.Context) []string { return addrs },
+		ReplicationFactor: 2,
+		HTTPClient: httpcli.DoerFunc(func(r *http.Request) (*http.Response, error) {
+			if r.URL.Path != "/repo-update" {
+				return nil, fmt.Errorf("unexpected url: %s", r.URL)
+			}
+			mu.Lock()
+			updated[r.URL.Host] = true
+			mu.Unlock()
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewBufferString(`{}`)),
+			}, nil
+		}),
+	}
+
+	repo := api.RepoName("github.com/a/b")
+	if _, err := cli.RequestRepoUpdate(context.Background(), gitserver.Repo{Name: repo}, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{}
+	for _, addr := range cli.AddrsForRepo(context.Background(), repo) {
+		want[addr] = true
+	}
+	if !cmp.Equal(want, updated) {
+		t.Errorf("mismatch for updated replicas (-want +got):\n%s", cmp.Diff(want, updated))
+	}
+}
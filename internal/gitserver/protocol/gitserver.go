@@ -6,6 +6,17 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/api"
 )
 
+// HandoffHeader is set on the requests that a client sends to the previous
+// holders of a repository while its new replicas are still copying it, see
+// gitserver.Client.PeersForRepo. A gitserver that does not have the
+// repository responds with not found instead of cloning it.
+const HandoffHeader = "X-Sourcegraph-Gitserver-Handoff"
+
+// HandoffPeerHeader is set on the not found responses of a gitserver that is
+// copying the repository from another gitserver, to the address of that
+// gitserver. Clients read the repository from there in the meantime.
+const HandoffPeerHeader = "X-Sourcegraph-Gitserver-Handoff-Peer"
+
 // ExecRequest is a request to execute a command inside a git repository.
 //
 // Note that this request is deserialized by both gitserver and the frontend's
@@ -19,6 +30,10 @@ type ExecRequest struct {
 	// cloned on the gitserver, the request will fail.
 	URL string `json:"url,omitempty"`
 
+	// CloneOptions are the options for cloning the repository if it is not
+	// cloned on the gitserver.
+	CloneOptions *CloneOptions `json:"cloneOptions,omitempty"`
+
 	EnsureRevision string      `json:"ensureRevision"`
 	Args           []string    `json:"args"`
 	Opt            *RemoteOpts `json:"opt"`
@@ -43,11 +58,26 @@ type HTTPSConfig struct {
 	Pass string `json:"pass"` // the password provided to the remote
 }
 
+// CloneOptions are options for cloning very large repositories. The zero
+// value clones the whole repository.
+type CloneOptions struct {
+	// BlobSizeLimit makes the clone a partial clone without the blobs larger
+	// than it, such as "1m" (git clone --filter=blob:limit=...). The missing
+	// blobs are fetched from the remote when they are read.
+	BlobSizeLimit string `json:"blobSizeLimit,omitempty"`
+
+	// Depth makes the clone a shallow clone of the most recent commits of
+	// the history, up to this depth (git clone --depth).
+	Depth int `json:"depth,omitempty"`
+}
+
 // RepoUpdateRequest is a request to update the contents of a given repo, or clone it if it doesn't exist.
 type RepoUpdateRequest struct {
-	Repo  api.RepoName  `json:"repo"`  // identifying URL for repo
-	URL   string        `json:"url"`   // repo's remote URL
-	Since time.Duration `json:"since"` // debounce interval for queries, used only with request-repo-update
+	Repo         api.RepoName  `json:"repo"`                   // identifying URL for repo
+	URL          string        `json:"url"`                    // repo's remote URL
+	CloneOptions *CloneOptions `json:"cloneOptions,omitempty"` // options for cloning the repo if it doesn't exist
+	Since        time.Duration `json:"since"`                  // debounce interval for queries, used only with request-repo-update
+	Peer         string        `json:"peer,omitempty"`         // address of a gitserver to copy the repo from if it doesn't exist
 }
 
 // RepoUpdateResponse returns meta information of the repo enqueued for
@@ -96,6 +126,13 @@ type IsRepoClonedRequest struct {
 	Repo api.RepoName
 }
 
+// RepoBackupRequest is a request to back up a repository to the bundle store
+// of gitserver.
+type RepoBackupRequest struct {
+	// Repo is the repository to back up.
+	Repo api.RepoName
+}
+
 // RepoDeleteRequest is a request to delete a repository clone on gitserver
 type RepoDeleteRequest struct {
 	// Repo is the repository to delete.
@@ -142,6 +179,62 @@ type RepoCloneProgress struct {
 	CloneInProgress bool   // whether the repository is currently being cloned
 	CloneProgress   string // a progress message from the running clone command.
 	Cloned          bool   // whether the repository has been cloned successfully
+
+	// Progress is the structured progress of the running clone, or of the
+	// clone that produced the repository if it is cloned. It is nil if it is
+	// not known.
+	Progress *CloneProgress `json:",omitempty"`
+}
+
+// The phases of a clone, in order.
+const (
+	ClonePhaseStarting    = "starting"
+	ClonePhaseCounting    = "counting"
+	ClonePhaseCompressing = "compressing"
+	ClonePhaseReceiving   = "receiving"
+	ClonePhaseResolving   = "resolving"
+	ClonePhaseDone        = "done"
+)
+
+// CloneProgress is the progress of a clone, parsed from the progress output
+// of git.
+type CloneProgress struct {
+	// Phase is the current phase of the clone, one of the ClonePhase
+	// constants.
+	Phase string
+
+	// Percent is the progress of the current phase, from 0 to 100.
+	Percent int
+
+	// Objects is the number of objects processed in the current phase, out
+	// of TotalObjects.
+	Objects      int64
+	TotalObjects int64
+
+	// ReceivedBytes is the number of bytes received so far, and
+	// BytesPerSecond the rate at which they are received. They are only
+	// known once objects are received.
+	ReceivedBytes  int64
+	BytesPerSecond int64
+
+	// StartedAt is when the clone started, and PhaseStartedAt when the
+	// current phase started.
+	StartedAt      time.Time
+	PhaseStartedAt time.Time
+
+	// UpdatedAt is when git last reported progress.
+	UpdatedAt time.Time
+
+	// ETA estimates the time until the current phase is done from its
+	// progress so far. It is 0 if there is no estimate yet. Receiving
+	// objects is usually the longest phase.
+	ETA time.Duration
+}
+
+// ListCloneProgressResponse is the response to a request for the progress
+// of all the clones that are running on gitserver.
+type ListCloneProgressResponse struct {
+	Results map[api.RepoName]*CloneProgress
 }
 
 // RepoCloneProgressResponse is the response to a repository clone progress request
@@ -0,0 +1,214 @@
+// Package objectstore provides blob stores that are shared by all the replicas
+// of a service, in a directory or in an S3 compatible object storage service.
+package objectstore
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrObjectNotFound is returned by ObjectStore.Get if there is no object
+// with the key.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore is a blob store shared by all the replicas of a service.
+// Searcher uses it as a second-tier cache of zip archives, and gitserver
+// stores backups of repos in it. Keys consist of lowercase hexadecimal
+// characters.
+type ObjectStore interface {
+	// Get returns a reader of the object with key. It returns
+	// ErrObjectNotFound if there is none.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Put stores the content of r as the object with key, replacing any
+	// existing object with key. The object must not be visible to Get until
+	// it is complete.
+	Put(ctx context.Context, key string, r io.ReadSeeker) error
+
+	// List returns all the objects in the store.
+	List(ctx context.Context) ([]ObjectInfo, error)
+
+	// Delete deletes the object with key. It does not return an error if
+	// there is none.
+	Delete(ctx context.Context, key string) error
+}
+
+// ObjectInfo describes an object of an ObjectStore.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// NewObjectStore returns the ObjectStore at rawurl, which is either
+//
+//   s3://bucket/prefix?endpoint=http://minio:9000&region=us-east-1
+//
+// for an S3 compatible object storage service (the prefix and the query are
+// optional, credentials are read from the standard AWS environment
+// variables), or
+//
+//   file:///path/to/dir
+//
+// for a directory that is shared by the replicas, such as a network file
+// system. ext is the file extension of the objects, such as ".zip".
+func NewObjectStore(rawurl, ext string) (ObjectStore, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid object store URL")
+	}
+	switch u.Scheme {
+	case "s3":
+		if u.Host == "" {
+			return nil, errors.Errorf("invalid object store URL %q: missing bucket", rawurl)
+		}
+		q := u.Query()
+		return NewS3ObjectStore(S3Options{
+			Bucket:   u.Host,
+			Prefix:   strings.Trim(u.Path, "/"),
+			Endpoint: q.Get("endpoint"),
+			Region:   q.Get("region"),
+			Ext:      ext,
+		})
+	case "file":
+		if u.Path == "" {
+			return nil, errors.Errorf("invalid object store URL %q: missing path", rawurl)
+		}
+		return &DirObjectStore{Dir: u.Path, Ext: ext}, nil
+	default:
+		return nil, errors.Errorf("invalid object store URL %q: unsupported scheme, expected s3 or file", rawurl)
+	}
+}
+
+// DirObjectStore is an ObjectStore backed by a directory.
+type DirObjectStore struct {
+	// Dir is the directory of the objects. It is created if it does not
+	// exist.
+	Dir string
+
+	// Ext is the file extension of the objects. It defaults to ".zip".
+	Ext string
+}
+
+func (s *DirObjectStore) path(key string) string {
+	return filepath.Join(s.Dir, key+objectExt(s.Ext))
+}
+
+func objectExt(ext string) string {
+	if ext == "" {
+		return ".zip"
+	}
+	return ext
+}
+
+func (s *DirObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+	return f, err
+}
+
+func (s *DirObjectStore) Put(ctx context.Context, key string, r io.ReadSeeker) (err error) {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it, so that concurrent calls to
+	// Get never see a partial object.
+	f, err := ioutil.TempFile(s.Dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+	_, err = io.Copy(f, r)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path(key))
+}
+
+func (s *DirObjectStore) List(ctx context.Context) ([]ObjectInfo, error) {
+	fis, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ext := objectExt(s.Ext)
+	var objects []ObjectInfo
+	for _, fi := range fis {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ext) {
+			continue
+		}
+		objects = append(objects, ObjectInfo{
+			Key:          strings.TrimSuffix(fi.Name(), ext),
+			Size:         fi.Size(),
+			LastModified: fi.ModTime(),
+		})
+	}
+	return objects, nil
+}
+
+func (s *DirObjectStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// ObjectEvictStats is information gathered during EvictObjects.
+type ObjectEvictStats struct {
+	// Size is the total size of the objects after eviction.
+	Size int64
+
+	// Evicted is the number of objects that were deleted.
+	Evicted int
+}
+
+// EvictObjects deletes the objects of s that were last modified more than
+// maxAge ago, and then the oldest objects until the total size of the
+// objects is at most maxSizeBytes. A zero maxAge or maxSizeBytes disables
+// the respective limit.
+func EvictObjects(ctx context.Context, s ObjectStore, maxAge time.Duration, maxSizeBytes int64) (stats ObjectEvictStats, err error) {
+	objects, err := s.List(ctx)
+	if err != nil {
+		return stats, err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].LastModified.Before(objects[j].LastModified) })
+
+	for _, o := range objects {
+		stats.Size += o.Size
+	}
+	for _, o := range objects {
+		expired := maxAge > 0 && time.Since(o.LastModified) > maxAge
+		overSize := maxSizeBytes > 0 && stats.Size > maxSizeBytes
+		if !expired && !overSize {
+			break
+		}
+		if err := s.Delete(ctx, o.Key); err != nil {
+			return stats, errors.Wrapf(err, "failed to delete object %s", o.Key)
+		}
+		stats.Size -= o.Size
+		stats.Evicted++
+	}
+	return stats, nil
+}
@@ -0,0 +1,239 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDirObjectStore(t *testing.T) {
+	d, err := ioutil.TempDir("", "objectstore_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	testObjectStore(t, &DirObjectStore{Dir: filepath.Join(d, "objects")})
+}
+
+func TestS3ObjectStore(t *testing.T) {
+	ts := httptest.NewServer(newFakeS3("bucket"))
+	defer ts.Close()
+
+	for k, v := range map[string]string{"AWS_ACCESS_KEY_ID": "id", "AWS_SECRET_ACCESS_KEY": "secret"} {
+		old, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		if ok {
+			defer os.Setenv(k, old)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+
+	s, err := NewObjectStore("s3://bucket/archives?endpoint="+ts.URL, ".zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testObjectStore(t, s)
+}
+
+// testObjectStore tests the ObjectStore s, which must be empty.
+func testObjectStore(t *testing.T, s ObjectStore) {
+	ctx := context.Background()
+
+	if _, err := s.Get(ctx, "a"); err != ErrObjectNotFound {
+		t.Fatalf("got error %v, want ErrObjectNotFound", err)
+	}
+	if objects, err := s.List(ctx); err != nil || len(objects) != 0 {
+		t.Fatalf("got objects %v and error %v, want none", objects, err)
+	}
+
+	for key, data := range map[string]string{"a": "aaa", "b": "bb"} {
+		if err := s.Put(ctx, key, strings.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rc, err := s.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "aaa" {
+		t.Errorf("got %q, want %q", data, "aaa")
+	}
+
+	objects, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, o := range objects {
+		got = append(got, o.Key)
+		if o.LastModified.IsZero() {
+			t.Errorf("%s: got zero LastModified", o.Key)
+		}
+		if want := map[string]int64{"a": 3, "b": 2}[o.Key]; o.Size != want {
+			t.Errorf("%s: got size %d, want %d", o.Key, o.Size, want)
+		}
+	}
+	sort.Strings(got)
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got keys %v, want %v", got, want)
+	}
+
+	if err := s.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "a"); err != nil {
+		t.Fatal("expected deleting a missing object to succeed:", err)
+	}
+	if _, err := s.Get(ctx, "a"); err != ErrObjectNotFound {
+		t.Fatalf("got error %v, want ErrObjectNotFound", err)
+	}
+}
+
+func TestEvictObjects(t *testing.T) {
+	d, err := ioutil.TempDir("", "objectstore_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	s := &DirObjectStore{Dir: d}
+
+	ctx := context.Background()
+	now := time.Now()
+	for key, age := range map[string]time.Duration{"a": 3 * time.Hour, "b": 2 * time.Hour, "c": time.Hour, "d": 0} {
+		if err := s.Put(ctx, key, strings.NewReader("0123456789")); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(-age)
+		if err := os.Chtimes(s.path(key), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a is too old, and then b is the oldest object over the size limit.
+	stats, err := EvictObjects(ctx, s, 150*time.Minute, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ObjectEvictStats{Size: 20, Evicted: 2}); stats != want {
+		t.Errorf("got stats %+v, want %+v", stats, want)
+	}
+	objects, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, o := range objects {
+		got = append(got, o.Key)
+	}
+	sort.Strings(got)
+	if want := []string{"c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got keys %v, want %v", got, want)
+	}
+}
+
+// fakeS3 is a minimal S3 compatible HTTP server for the requests of
+// S3ObjectStore, with path-style addressing. It does not verify request
+// signatures.
+type fakeS3 struct {
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	mtimes  map[string]time.Time
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{bucket: bucket, objects: map[string][]byte{}, mtimes: map[string]time.Time{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		bucket, key = path[:i], path[i+1:]
+	}
+	if bucket != f.bucket {
+		f.writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch {
+	case r.Method == "GET" && key == "" && r.URL.Query().Get("list-type") == "2":
+		type contents struct {
+			Key          string
+			LastModified string
+			Size         int
+		}
+		result := struct {
+			XMLName     xml.Name `xml:"ListBucketResult"`
+			Name        string
+			Prefix      string
+			IsTruncated bool
+			Contents    []contents
+		}{Name: f.bucket, Prefix: r.URL.Query().Get("prefix")}
+		for k, data := range f.objects {
+			if strings.HasPrefix(k, result.Prefix) {
+				result.Contents = append(result.Contents, contents{Key: k, LastModified: f.mtimes[k].UTC().Format(time.RFC3339), Size: len(data)})
+			}
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		_ = xml.NewEncoder(w).Encode(result)
+
+	case r.Method == "GET":
+		data, ok := f.objects[key]
+		if !ok {
+			f.writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		_, _ = w.Write(data)
+
+	case r.Method == "PUT":
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		f.objects[key] = buf.Bytes()
+		f.mtimes[key] = time.Now()
+
+	case r.Method == "DELETE":
+		delete(f.objects, key)
+		delete(f.mtimes, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		f.writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (f *fakeS3) writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: code})
+}
@@ -0,0 +1,140 @@
+package objectstore
+
+import (
+	"context"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/aws/external"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pkg/errors"
+)
+
+// S3Options are the options of an S3ObjectStore.
+type S3Options struct {
+	// Bucket is the name of the bucket of the objects.
+	Bucket string
+
+	// Prefix is prepended to the keys of the objects, separated by a slash
+	// (optional).
+	Prefix string
+
+	// Endpoint is the URL of an S3 compatible service, such as MinIO, to use
+	// instead of AWS (optional). Objects are then addressed by path instead
+	// of by virtual host, which these services usually require.
+	Endpoint string
+
+	// Region is the region of the bucket. It defaults to the region of the
+	// AWS environment variables or shared configuration, or us-east-1.
+	Region string
+
+	// Ext is the file extension of the objects. It defaults to ".zip".
+	Ext string
+}
+
+// S3ObjectStore is an ObjectStore backed by an S3 bucket.
+type S3ObjectStore struct {
+	client *s3.Client
+	bucket string
+	prefix string
+	ext    string
+}
+
+// NewS3ObjectStore returns an S3ObjectStore with the given options. The
+// credentials are read from the standard AWS environment variables and
+// shared configuration files.
+func NewS3ObjectStore(opts S3Options) (*S3ObjectStore, error) {
+	cfg, err := external.LoadDefaultAWSConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load AWS configuration")
+	}
+	if opts.Region != "" {
+		cfg.Region = opts.Region
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if opts.Endpoint != "" {
+		cfg.EndpointResolver = aws.ResolveWithEndpointURL(opts.Endpoint)
+	}
+
+	client := s3.New(cfg)
+	client.ForcePathStyle = opts.Endpoint != ""
+
+	prefix := strings.Trim(opts.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3ObjectStore{client: client, bucket: opts.Bucket, prefix: prefix, ext: objectExt(opts.Ext)}, nil
+}
+
+func (s *S3ObjectStore) objectKey(key string) string {
+	return s.prefix + key + s.ext
+}
+
+func (s *S3ObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.objectKey(key)),
+	}).Send(ctx)
+	if err != nil {
+		if e, ok := err.(awserr.Error); ok && e.Code() == s3.ErrCodeNoSuchKey {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Put uploads the content of r in a single request. S3 only makes an object
+// visible once its upload is complete.
+func (s *S3ObjectStore) Put(ctx context.Context, key string, r io.ReadSeeker) error {
+	contentType := mime.TypeByExtension(s.ext)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	_, err := s.client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.objectKey(key)),
+		Body:        r,
+		ContentType: aws.String(contentType),
+	}).Send(ctx)
+	return err
+}
+
+func (s *S3ObjectStore) List(ctx context.Context) ([]ObjectInfo, error) {
+	p := s3.NewListObjectsV2Paginator(s.client.ListObjectsV2Request(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	}))
+
+	var objects []ObjectInfo
+	for p.Next(ctx) {
+		for _, o := range p.CurrentPage().Contents {
+			name := strings.TrimPrefix(aws.StringValue(o.Key), s.prefix)
+			// Skip the objects of other prefixes that share this one, such as
+			// "a/b/c.zip" with the prefix "a/".
+			if path.Dir(name) != "." || !strings.HasSuffix(name, s.ext) {
+				continue
+			}
+			objects = append(objects, ObjectInfo{
+				Key:          strings.TrimSuffix(name, s.ext),
+				Size:         aws.Int64Value(o.Size),
+				LastModified: aws.TimeValue(o.LastModified),
+			})
+		}
+	}
+	return objects, p.Err()
+}
+
+func (s *S3ObjectStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObjectRequest(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.objectKey(key)),
+	}).Send(ctx)
+	return err
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/sourcegraph/sourcegraph/internal/api"
+	gitserverprotocol "github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
 )
 
 type RepoUpdateSchedulerInfoArgs struct {
@@ -128,6 +129,10 @@ func (r *RepoInfo) String() string {
 // VCSInfo describes how to access an external repository's Git data (to clone or update it).
 type VCSInfo struct {
 	URL string // the Git remote URL
+
+	// CloneOptions are the options for cloning the repository, or nil to
+	// clone the whole repository.
+	CloneOptions *gitserverprotocol.CloneOptions `json:",omitempty"`
 }
 
 // RepoLinks contains URLs and URL patterns for objects in this repository.
@@ -0,0 +1,126 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Operators of a PatternNode.
+const (
+	PatternOpAnd = "and"
+	PatternOpOr  = "or"
+	PatternOpNot = "not"
+)
+
+// PatternNode is a node of a boolean expression over regular expression
+// patterns, such as (foo and (bar or baz)). An expression is evaluated per
+// file: a file matches if its content satisfies the expression. Keep it in
+// sync with cmd/searcher/protocol.PatternNode.
+type PatternNode struct {
+	// Op is one of PatternOpAnd, PatternOpOr or PatternOpNot for operator
+	// nodes. It is empty for leaf nodes.
+	Op string `json:",omitempty"`
+
+	// Pattern is the regular expression of a leaf node.
+	Pattern string `json:",omitempty"`
+
+	// Operands are the children of an operator node. A PatternOpNot node has
+	// exactly one operand.
+	Operands []*PatternNode `json:",omitempty"`
+}
+
+// Patterns returns the patterns of all leaves that are not negated. These are
+// the patterns that produce the line matches of a file.
+func (n *PatternNode) Patterns() []string {
+	var patterns []string
+	var visit func(*PatternNode)
+	visit = func(n *PatternNode) {
+		switch n.Op {
+		case "":
+			patterns = append(patterns, n.Pattern)
+		case PatternOpNot:
+			// Negated patterns never match a line of a matching file.
+		default:
+			for _, operand := range n.Operands {
+				visit(operand)
+			}
+		}
+	}
+	visit(n)
+	return patterns
+}
+
+// Leaves returns the patterns of all leaves, including negated ones.
+func (n *PatternNode) Leaves() []string {
+	if n.Op == "" {
+		return []string{n.Pattern}
+	}
+	var patterns []string
+	for _, operand := range n.Operands {
+		patterns = append(patterns, operand.Leaves()...)
+	}
+	return patterns
+}
+
+// Matcher returns a function that reports whether a string, such as a
+// repository name, satisfies the expression.
+func (n *PatternNode) Matcher(isCaseSensitive bool) (func(string) bool, error) {
+	if n.Op == "" {
+		pattern := n.Pattern
+		if !isCaseSensitive {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+
+	operands := make([]func(string) bool, 0, len(n.Operands))
+	for _, operand := range n.Operands {
+		match, err := operand.Matcher(isCaseSensitive)
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, match)
+	}
+	switch n.Op {
+	case PatternOpAnd:
+		return func(s string) bool {
+			for _, match := range operands {
+				if !match(s) {
+					return false
+				}
+			}
+			return true
+		}, nil
+	case PatternOpOr:
+		return func(s string) bool {
+			for _, match := range operands {
+				if match(s) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case PatternOpNot:
+		if len(operands) != 1 {
+			return nil, fmt.Errorf("not expression must have exactly one operand, got %d", len(operands))
+		}
+		return func(s string) bool { return !operands[0](s) }, nil
+	}
+	return nil, fmt.Errorf("unknown pattern expression operator %q", n.Op)
+}
+
+func (n *PatternNode) String() string {
+	if n.Op == "" {
+		return fmt.Sprintf("%q", n.Pattern)
+	}
+	operands := make([]string, 0, len(n.Operands))
+	for _, operand := range n.Operands {
+		operands = append(operands, operand.String())
+	}
+	return fmt.Sprintf("(%s %s)", n.Op, strings.Join(operands, " "))
+}
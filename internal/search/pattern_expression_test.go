@@ -0,0 +1,34 @@
+package search
+
+import "testing"
+
+func TestPatternNode_Matcher(t *testing.T) {
+	expr := &PatternNode{
+		Op: PatternOpAnd,
+		Operands: []*PatternNode{
+			{Pattern: "^github"},
+			{Op: PatternOpOr, Operands: []*PatternNode{{Pattern: "foo"}, {Pattern: "bar"}}},
+			{Op: PatternOpNot, Operands: []*PatternNode{{Pattern: "test"}}},
+		},
+	}
+	tests := []struct {
+		name          string
+		caseSensitive bool
+		want          bool
+	}{
+		{name: "github.com/a/foo", want: true},
+		{name: "github.com/a/BAR", want: true},
+		{name: "github.com/a/BAR", caseSensitive: true, want: false},
+		{name: "github.com/a/foo-test", want: false},
+		{name: "gitlab.com/a/foo", want: false},
+	}
+	for _, test := range tests {
+		match, err := expr.Matcher(test.caseSensitive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := match(test.name); got != test.want {
+			t.Errorf("match(%q) with case sensitivity %v = %v, want %v", test.name, test.caseSensitive, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// MaxContextLines is the maximum value of a context: field.
+const MaxContextLines = 10
+
+// contextFlag is the lowercased field name of -C:N, which is an alias of
+// context:N after the flag of grep. Unlike other fields, the leading - does
+// not negate it.
+const contextFlag = "c"
+
+// ParseContextLines parses and validates the value of a context: field, the
+// number of lines before and after each matching line that search results
+// include. Valid values are 0 to MaxContextLines.
+func ParseContextLines(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || n > MaxContextLines {
+		return 0, fmt.Errorf("invalid context: value %q, expected a number of lines from 0 to %d", value, MaxContextLines)
+	}
+	return n, nil
+}
+
+// ContextLines returns the parsed context: value of q. It returns 0 if q does
+// not contain a valid one.
+func ContextLines(q QueryInfo) int {
+	value, _ := q.StringValue(FieldContext)
+	n, _ := ParseContextLines(value)
+	return n
+}
@@ -0,0 +1,55 @@
+package query
+
+import "testing"
+
+func TestParseContextLines(t *testing.T) {
+	cases := []struct {
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{input: "0", want: 0},
+		{input: "3", want: 3},
+		{input: "10", want: 10},
+		{input: "11", wantErr: true},
+		{input: "-1", wantErr: true},
+		{input: "three", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			got, err := ParseContextLines(c.input)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("got error %v, want error %v", err, c.wantErr)
+			}
+			if got != c.want {
+				t.Errorf("got %d, want %d", got, c.want)
+			}
+		})
+	}
+}
+
+func TestContextLines(t *testing.T) {
+	for input, want := range map[string]int{
+		"foo":           0,
+		"foo context:2": 2,
+		"context:0 foo": 0,
+		"-C:3 foo":      3,
+		"foo c:1":       1,
+	} {
+		q, err := ParseAndCheck(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ContextLines(q); got != want {
+			t.Errorf("%s: got %d, want %d", input, got, want)
+		}
+
+		q, err = ProcessAndOr(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ContextLines(q); got != want {
+			t.Errorf("%s: got %d with the and/or parser, want %d", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package query
+
+import "strings"
+
+// Diagnostic is a problem with a query, at the range of the input it applies
+// to.
+type Diagnostic struct {
+	Range   Range
+	Message string
+}
+
+// Diagnose parses and validates an and/or query like ProcessAndOr. Instead of
+// stopping at the first error, it returns a diagnostic for each parameter that
+// is not valid. If the query does not parse, the parse tree is nil and the
+// diagnostic ranges from the position at which parsing failed to the end of
+// the input.
+func Diagnose(in string) ([]Node, []Diagnostic) {
+	nodes, pos, err := parseAndOr(in)
+	if err != nil {
+		return nil, []Diagnostic{{Range: Range{Start: pos, End: len(in)}, Message: err.Error()}}
+	}
+
+	var diagnostics []Diagnostic
+	if err := validateNot(in, nodes); err != nil {
+		diagnostics = append(diagnostics, Diagnostic{Range: *err.(*ValidationError).Range, Message: err.Error()})
+	}
+	seen := map[string]struct{}{}
+	Visit(nodes, func(node Node) {
+		parameter, ok := node.(Parameter)
+		if !ok {
+			return
+		}
+		// Like LowercaseFieldNames and SubstituteContextFlag, which drop
+		// ranges.
+		field, negated := strings.ToLower(parameter.Field), parameter.Negated
+		if field == contextFlag {
+			field, negated = FieldContext, false
+		}
+		if err := validateField(field, parameter.Value, negated, seen); err != nil {
+			diagnostics = append(diagnostics, Diagnostic{Range: parameter.Range, Message: err.Error()})
+		}
+		seen[field] = struct{}{}
+	})
+	return nodes, diagnostics
+}
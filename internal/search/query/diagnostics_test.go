@@ -0,0 +1,75 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiagnose(t *testing.T) {
+	cases := []struct {
+		input string
+		want  []Diagnostic
+	}{
+		{
+			input: "repo:foo a and b",
+		},
+		{
+			input: "case:yes count:x a or case:no",
+			want: []Diagnostic{
+				{Range: Range{Start: 9, End: 16}, Message: "field count has value x, x is not a number"},
+				{Range: Range{Start: 22, End: 29}, Message: `field "case" may not be used more than once`},
+			},
+		},
+		{
+			input: "a and not",
+			want: []Diagnostic{
+				{Range: Range{Start: 6, End: 9}, Message: "expected operand after not"},
+			},
+		},
+		{
+			input: "repo:x not a",
+			want: []Diagnostic{
+				{Range: Range{Start: 7, End: 12}, Message: `"not a" must be an operand of an and-expression together with a search pattern that is not negated, as in foo and not bar`},
+			},
+		},
+		{
+			input: "foo -C:3",
+		},
+		{
+			input: "foo and bar -C:3",
+		},
+		{
+			input: "foo -C:x context:1",
+			want: []Diagnostic{
+				{Range: Range{Start: 4, End: 8}, Message: `invalid context: value "x", expected a number of lines from 0 to 10`},
+				{Range: Range{Start: 9, End: 18}, Message: `field "context" may not be used more than once`},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			_, got := Diagnose(c.input)
+			if diff := cmp.Diff(c.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestParseAndOr_Range(t *testing.T) {
+	nodes, err := ParseAndOr(`-file:a\ b "c d" e(f)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Range
+	Visit(nodes, func(node Node) {
+		if p, ok := node.(Parameter); ok {
+			got = append(got, p.Range)
+		}
+	})
+	want := []Range{{Start: 0, End: 10}, {Start: 11, End: 16}, {Start: 17, End: 21}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -1,6 +1,7 @@
 package query
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -10,6 +11,7 @@ import (
 	"unicode/utf8"
 
 	"github.com/sourcegraph/sourcegraph/internal/lazyregexp"
+	"github.com/sourcegraph/sourcegraph/internal/search/query/syntax"
 )
 
 type ExpectedOperand struct {
@@ -26,7 +28,13 @@ Parser implements a parser for the following grammar:
 OrTerm     → AndTerm { OR AndTerm }
 AndTerm    → Term { AND Term }
 Term       → (OrTerm) | Parameters
-Parameters → Parameter { " " Parameter }
+Parameters → Element { " " Element }
+Element    → NOT NotTerm | Parameter
+NotTerm    → NOT NotTerm | (OrTerm) | Parameter
+
+NOT negates the single parameter or parenthesized group that follows it, so
+it binds tighter than AND and OR: "foo not bar baz" is the same as "foo and
+(not bar) and baz".
 */
 
 type Node interface {
@@ -44,6 +52,14 @@ type Parameter struct {
 	Value   string `json:"value"`   // The sourcegraph part in repo:sourcegraph.
 	Negated bool   `json:"negated"` // True if the - prefix exists, as in -repo:sourcegraph.
 	Quoted  bool   `json:"quoted"`  // True if the parsed value was quoted.
+	Range   Range  `json:"-"`       // The range of the parameter in the input, as in [0, 15) for repo:sourcegraph.
+}
+
+// Range is the range of bytes [Start, End) of a node in the input string of
+// ParseAndOr. Nodes that are created by mappers have an empty range.
+type Range struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
 }
 
 type operatorKind int
@@ -52,12 +68,15 @@ const (
 	Or operatorKind = iota
 	And
 	Concat
+	Not
 )
 
-// Operator is a nonterminal node of kind Kind with child nodes Operands.
+// Operator is a nonterminal node of kind Kind with child nodes Operands. An
+// operator of kind Not has exactly one operand.
 type Operator struct {
 	Kind     operatorKind
 	Operands []Node
+	Range    Range // The range of a parsed not-expression in the input, including the not keyword.
 }
 
 func (node Parameter) String() string {
@@ -86,6 +105,8 @@ func (node Operator) String() string {
 		kind = "and"
 	case Concat:
 		kind = "concat"
+	case Not:
+		kind = "not"
 	}
 
 	return fmt.Sprintf("(%s %s)", kind, strings.Join(result, " "))
@@ -97,6 +118,7 @@ type keyword string
 const (
 	AND    keyword = "and"
 	OR     keyword = "or"
+	NOT    keyword = "not"
 	LPAREN keyword = "("
 	RPAREN keyword = ")"
 	SQUOTE keyword = "'"
@@ -207,6 +229,20 @@ func (p *parser) matchKeyword(keyword keyword) bool {
 	return strings.ToLower(v) == string(keyword)
 }
 
+// matchNot is like matchKeyword for the NOT keyword, except that NOT may also
+// start the input or a group, and be followed by a group, as in (not (foo)).
+func (p *parser) matchNot() bool {
+	if p.pos > 0 && !isSpace(p.buf[p.pos-1:p.pos]) && p.buf[p.pos-1] != '(' {
+		return false
+	}
+	v, err := p.peek(len(string(NOT)))
+	if err != nil || strings.ToLower(v) != string(NOT) {
+		return false
+	}
+	after := p.pos + len(string(NOT))
+	return after == len(p.buf) || isSpace(p.buf[after:after+1]) || p.buf[after] == '('
+}
+
 // skipSpaces advances the input and places the parser position at the next
 // non-space value.
 func (p *parser) skipSpaces() error {
@@ -411,11 +447,11 @@ func (p *parser) ParseSearchPatternHeuristic() (Node, bool) {
 	if !p.heuristic.parensAsPatterns || p.heuristic.allowDanglingParens {
 		return Parameter{Field: "", Value: ""}, false
 	}
+	start := p.pos
 	if value, ok := p.TryParseDelimiter(); ok {
-		return Parameter{Field: "", Value: value}, true
+		return Parameter{Field: "", Value: value, Range: Range{Start: start, End: p.pos}}, true
 	}
 
-	start := p.pos
 	pieces, advance, ok := ScanSearchPatternHeuristic(p.buf[p.pos:])
 	end := start + advance
 	if !ok || len(p.buf[start:end]) == 0 || !isPureSearchPattern(p.buf[start:end]) {
@@ -425,12 +461,15 @@ func (p *parser) ParseSearchPatternHeuristic() (Node, bool) {
 	}
 	// The heuristic succeeds: we can process the string as a pure search pattern.
 	p.pos += advance
+	end = start + len(bytes.TrimRightFunc(p.buf[start:end], unicode.IsSpace))
+	// The pieces of a pattern are not scanned separately, so each piece has
+	// the range of the whole pattern.
 	if len(pieces) == 1 {
-		return Parameter{Field: "", Value: pieces[0]}, true
+		return Parameter{Field: "", Value: pieces[0], Range: Range{Start: start, End: end}}, true
 	}
 	parameters := []Node{}
 	for _, piece := range pieces {
-		parameters = append(parameters, Parameter{Field: "", Value: piece})
+		parameters = append(parameters, Parameter{Field: "", Value: piece, Range: Range{Start: start, End: end}})
 	}
 	return Operator{Kind: Concat, Operands: parameters}, true
 }
@@ -553,14 +592,24 @@ func (p *parser) ParseValue() (string, bool) {
 // starts with '-'. When form (1) does not match, Value corresponds to <string>
 // and Field is the empty string.
 func (p *parser) ParseParameter() Parameter {
+	start := p.pos
 	field, advance := ScanField(p.buf[p.pos:])
 	p.pos += advance
-	value, quoted := p.ParseValue()
+	var value string
+	var quoted bool
+	if n, ok := syntax.ScanPredicate(field, string(p.buf[p.pos:])); ok {
+		// Predicates like repo:has.file(...) may contain whitespace and
+		// parentheses.
+		value = string(p.buf[p.pos : p.pos+n])
+		p.pos += n
+	} else {
+		value, quoted = p.ParseValue()
+	}
 	negated := len(field) > 0 && field[0] == '-'
 	if negated {
 		field = field[1:]
 	}
-	return Parameter{Field: field, Value: value, Negated: negated, Quoted: quoted}
+	return Parameter{Field: field, Value: value, Negated: negated, Quoted: quoted, Range: Range{Start: start, End: p.pos}}
 }
 
 // containsPattern returns true if any descendent of nodes is a search pattern
@@ -573,11 +622,11 @@ func containsPattern(node Node) bool {
 	return result
 }
 
-// returns true if descendent of node contains and/or expressions.
+// returns true if descendent of node contains and/or/not expressions.
 func containsAndOrExpression(nodes []Node) bool {
 	var result bool
 	VisitOperator(nodes, func(kind operatorKind, _ []Node) {
-		if kind == And || kind == Or {
+		if kind == And || kind == Or || kind == Not {
 			result = true
 		}
 	})
@@ -594,8 +643,10 @@ func containsAndOrExpression(nodes []Node) bool {
 // are concatenated in order.
 // (2) Any nonterminal node is concatenated (ordered in the tree) if its
 // descendents contain one or more search patterns.
+// (3) Negated search patterns are not concatenated: "foo not bar" means foo
+// and not bar.
 func partitionParameters(nodes []Node) []Node {
-	var patterns, unorderedParams []Node
+	var patterns, negatedPatterns, unorderedParams []Node
 	for _, n := range nodes {
 		switch v := n.(type) {
 		case Parameter:
@@ -605,7 +656,9 @@ func partitionParameters(nodes []Node) []Node {
 				unorderedParams = append(unorderedParams, n)
 			}
 		case Operator:
-			if containsPattern(n) {
+			if v.Kind == Not {
+				negatedPatterns = append(negatedPatterns, n)
+			} else if containsPattern(n) {
 				patterns = append(patterns, n)
 			} else {
 				unorderedParams = append(unorderedParams, n)
@@ -613,10 +666,9 @@ func partitionParameters(nodes []Node) []Node {
 		}
 	}
 	if len(patterns) > 1 {
-		orderedPatterns := newOperator(patterns, Concat)
-		return newOperator(append(unorderedParams, orderedPatterns...), And)
+		patterns = newOperator(patterns, Concat)
 	}
-	return newOperator(append(unorderedParams, patterns...), And)
+	return newOperator(append(append(unorderedParams, patterns...), negatedPatterns...), And)
 }
 
 // parseParameterParameterList scans for consecutive leaf nodes.
@@ -664,6 +716,12 @@ loop:
 		case p.matchKeyword(AND), p.matchKeyword(OR):
 			// Caller advances.
 			break loop
+		case p.matchNot():
+			node, err := p.parseNot()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
 		default:
 			// First try parse a parameter as a search pattern containing parens.
 			if parameter, ok := p.ParseSearchPatternHeuristic(); ok {
@@ -677,6 +735,66 @@ loop:
 	return partitionParameters(nodes), nil
 }
 
+// parseNot parses a not-expression at the current position: the NOT keyword
+// followed by a single parameter, a parenthesized group, or another
+// not-expression. Only search patterns may be negated with NOT. Other
+// parameters are negated with a - prefix, as in -file:foo.
+func (p *parser) parseNot() (Node, error) {
+	start := p.pos
+	_ = p.expect(NOT) // Guaranteed to succeed.
+	if err := p.skipSpaces(); err != nil {
+		return nil, err
+	}
+	if p.done() || p.match(RPAREN) || p.matchKeyword(AND) || p.matchKeyword(OR) {
+		p.pos = start // Report the error at the not keyword.
+		return nil, &ValidationError{Msg: "expected operand after not"}
+	}
+
+	var operand []Node
+	switch {
+	case p.matchNot():
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		operand = []Node{node}
+	case p.match(LPAREN) && !p.heuristic.allowDanglingParens:
+		if pattern, ok := p.ParseSearchPatternHeuristic(); ok {
+			operand = []Node{pattern}
+			break
+		}
+		_ = p.expect(LPAREN) // Guaranteed to succeed.
+		p.balanced++
+		p.unambiguated = true
+		result, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		operand = newOperator(result, And)
+	default:
+		if pattern, ok := p.ParseSearchPatternHeuristic(); ok {
+			operand = []Node{pattern}
+		} else {
+			operand = []Node{p.ParseParameter()}
+		}
+	}
+
+	if param, ok := operand[0].(Parameter); ok && param.Value == "" {
+		p.pos = start
+		return nil, &ValidationError{Msg: "expected operand after not"}
+	}
+	if !isPatternExpression(operand) {
+		p.pos = start
+		return nil, &ValidationError{Msg: "not may only negate search patterns, use a - prefix to exclude other parameters, as in -file:foo"}
+	}
+	end := p.pos
+	for end > start && unicode.IsSpace(rune(p.buf[end-1])) {
+		// The operand may be followed by whitespace that was consumed.
+		end--
+	}
+	return Operator{Kind: Not, Operands: operand, Range: Range{Start: start, End: end}}, nil
+}
+
 // reduce takes lists of left and right nodes and reduces them if possible. For example,
 // (and a (b and c))       => (and a b c)
 // (((a and b) or c) or d) => (or (and a b) c d)
@@ -696,6 +814,10 @@ func reduce(left, right []Node, kind operatorKind) ([]Node, bool) {
 			}
 			return left, true
 		}
+		if operator, ok := left[0].(Operator); ok && operator.Kind == kind && term.Kind == Not {
+			// Reduce left node, as in (and (and a b) (not c)) => (and a b (not c)).
+			return append(operator.Operands, right...), true
+		}
 	case Parameter:
 		if term.Value == "" {
 			// Remove empty string parameter.
@@ -721,11 +843,16 @@ func reduce(left, right []Node, kind operatorKind) ([]Node, bool) {
 }
 
 // newOperator constructs a new node of kind operatorKind with operands nodes,
-// reducing nodes as needed.
+// reducing nodes as needed. A Not operator is never reduced: its operands are
+// and-ed together under a single Not node.
 func newOperator(nodes []Node, kind operatorKind) []Node {
 	if len(nodes) == 0 {
 		return nil
-	} else if len(nodes) == 1 {
+	}
+	if kind == Not {
+		return []Node{Operator{Kind: Not, Operands: newOperator(nodes, And)}}
+	}
+	if len(nodes) == 1 {
 		return nodes
 	}
 
@@ -792,8 +919,15 @@ func tryFallbackParser(in string) ([]Node, error) {
 
 // ParseAndOr a raw input string into a parse tree comprising Nodes.
 func ParseAndOr(in string) ([]Node, error) {
+	nodes, _, err := parseAndOr(in)
+	return nodes, err
+}
+
+// parseAndOr is like ParseAndOr. If parsing fails, it also returns the
+// position in the input at which it failed.
+func parseAndOr(in string) ([]Node, int, error) {
 	if strings.TrimSpace(in) == "" {
-		return nil, nil
+		return nil, 0, nil
 	}
 	parser := &parser{
 		buf:       []byte(in),
@@ -803,15 +937,15 @@ func ParseAndOr(in string) ([]Node, error) {
 	nodes, err := parser.parseOr()
 	if err != nil {
 		if nodes, err := tryFallbackParser(in); err == nil {
-			return nodes, nil
+			return nodes, 0, nil
 		}
-		return nil, err
+		return nil, parser.pos, err
 	}
 	if parser.balanced != 0 {
 		if nodes, err := tryFallbackParser(in); err == nil {
-			return nodes, nil
+			return nodes, 0, nil
 		}
-		return nil, errors.New("unbalanced expression")
+		return nil, parser.pos, errors.New("unbalanced expression")
 	}
 	if !parser.unambiguated {
 		// Hoist or expressions if this query is potential ambiguous.
@@ -819,7 +953,7 @@ func ParseAndOr(in string) ([]Node, error) {
 			nodes = hoistedNodes
 		}
 	}
-	return newOperator(nodes, And), nil
+	return newOperator(nodes, And), 0, nil
 }
 
 // ProcessAndOr query parses and validates an and/or query for a given search type.
@@ -828,7 +962,13 @@ func ProcessAndOr(in string) (QueryInfo, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Not-expressions are validated before the query is mapped, which drops
+	// their ranges.
+	if err := validateNot(in, query); err != nil {
+		return nil, err
+	}
 	query = LowercaseFieldNames(query)
+	query = SubstituteContextFlag(query)
 	err = validate(query)
 	if err != nil {
 		return nil, err
@@ -68,6 +68,26 @@ func Test_ScanParameter(t *testing.T) {
 			Input: `'\''`,
 			Want:  `{"field":"","value":"'","negated":false,"quoted":true}`,
 		},
+		{
+			Name:  "Predicate with whitespace",
+			Input: `repo:has.file(path:go.mod content:"a b") x`,
+			Want:  `{"field":"repo","value":"has.file(path:go.mod content:\"a b\")","negated":false,"quoted":false}`,
+		},
+		{
+			Name:  "Negated predicate of a field alias",
+			Input: `-f:contains(a b) x`,
+			Want:  `{"field":"f","value":"contains(a b)","negated":true,"quoted":false}`,
+		},
+		{
+			Name:  "Value of a field without predicates",
+			Input: `content:foo(a b)`,
+			Want:  `{"field":"content","value":"foo","negated":false,"quoted":false}`,
+		},
+		{
+			Name:  "Unknown predicate",
+			Input: `repo:foo(a b)`,
+			Want:  `{"field":"repo","value":"foo","negated":false,"quoted":false}`,
+		},
 	}
 	for _, tt := range cases {
 		t.Run(tt.Name, func(t *testing.T) {
@@ -635,6 +655,72 @@ func Test_Parse(t *testing.T) {
 			WantGrammar:   `(and "repo:foo bar" ":\\")`,
 			WantHeuristic: Same,
 		},
+		{
+			Name:          "Not",
+			Input:         "a and not b",
+			WantGrammar:   `(and "a" (not "b"))`,
+			WantHeuristic: Same,
+		},
+		{
+			Name:          "Not binds tighter than whitespace",
+			Input:         "a not b c",
+			WantGrammar:   `(and (concat "a" "c") (not "b"))`,
+			WantHeuristic: Same,
+		},
+		{
+			Name:          "Not binds tighter than or",
+			Input:         "a or not b and c",
+			WantGrammar:   `(or "a" (and (not "b") "c"))`,
+			WantHeuristic: Same,
+		},
+		{
+			Name:          "Not group",
+			Input:         "a and not (b or c)",
+			WantGrammar:   `(and "a" (not (or "b" "c")))`,
+			WantHeuristic: Same,
+		},
+		{
+			Name:          "Not inside group",
+			Input:         "(not a) and (b or not c)",
+			WantGrammar:   `(and (not "a") (or "b" (not "c")))`,
+			WantHeuristic: Same,
+		},
+		{
+			Name:          "Not not",
+			Input:         "a and not not b",
+			WantGrammar:   `(and "a" (not (not "b")))`,
+			WantHeuristic: Same,
+		},
+		{
+			Name:          "Not with scope parameters",
+			Input:         "repo:foo a NOT b",
+			WantGrammar:   `(and "repo:foo" "a" (not "b"))`,
+			WantHeuristic: Same,
+		},
+		{
+			Name:          "Not is part of a word",
+			Input:         "nothing and knot",
+			WantGrammar:   `(and "nothing" "knot")`,
+			WantHeuristic: Same,
+		},
+		{
+			Name:          "Dangling not",
+			Input:         "a and not",
+			WantGrammar:   "expected operand after not",
+			WantHeuristic: Same,
+		},
+		{
+			Name:          "Not before and",
+			Input:         "a not and b",
+			WantGrammar:   "expected operand after not",
+			WantHeuristic: Same,
+		},
+		{
+			Name:          "Not applied to a field",
+			Input:         "a not file:b",
+			WantGrammar:   "not may only negate search patterns, use a - prefix to exclude other parameters, as in -file:foo",
+			WantHeuristic: Same,
+		},
 	}
 	for _, tt := range cases {
 		t.Run(tt.Name, func(t *testing.T) {
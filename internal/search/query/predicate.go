@@ -0,0 +1,185 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/sourcegraph/sourcegraph/internal/lazyregexp"
+)
+
+// Predicates are values of repo: and file: which match repositories and files
+// by the contents of files, instead of by name. For example:
+//
+//	repo:has.file(path:go.mod content:github.com/foo/bar)
+//	file:contains(TODO)
+const (
+	PredicateRepoHasFile    = "has.file"    // repositories containing a matching file
+	PredicateFileContains   = "contains"    // files whose content matches
+	PredicateFileHasContent = "has.content" // alias for contains
+)
+
+// FilePredicate is a parsed predicate. Path and Content are the regexps that
+// the path and the content of a file must match. Either may be empty, but not
+// both.
+type FilePredicate struct {
+	Path    string
+	Content string
+}
+
+var predicateRx = lazyregexp.New(`^([a-z]+(?:\.[a-z]+)*)\((.*)\)$`)
+
+// ParsePredicate parses a value of the repo: or file: field. ok is false if
+// value is not a predicate of field, in which case it is a regexp matching
+// the name of repositories or files. err is non-nil if it is a predicate with
+// invalid arguments.
+func ParsePredicate(field, value string) (p FilePredicate, ok bool, err error) {
+	m := predicateRx.FindStringSubmatch(value)
+	if m == nil {
+		return FilePredicate{}, false, nil
+	}
+	name, args := m[1], m[2]
+
+	switch {
+	case field == FieldRepo && name == PredicateRepoHasFile:
+		p, err = parsePredicateArgs(args, "path")
+	case field == FieldFile && (name == PredicateFileContains || name == PredicateFileHasContent):
+		p, err = parsePredicateArgs(args, "content")
+		if err == nil && p.Path != "" {
+			err = fmt.Errorf("path: is not supported, use file:<regexp> to match the path of files")
+		}
+	default:
+		return FilePredicate{}, false, nil
+	}
+	if err == nil && p.Path == "" && p.Content == "" {
+		err = fmt.Errorf("expected a path: or content: argument")
+	}
+	if err != nil {
+		return FilePredicate{}, true, fmt.Errorf("invalid %s:%s(...): %v", field, name, err)
+	}
+	return p, true, nil
+}
+
+// parsePredicateArgs parses whitespace-separated path:<regexp> and
+// content:<regexp> arguments. Values may be quoted. An argument without a
+// name is the argument named defaultArg.
+func parsePredicateArgs(args, defaultArg string) (FilePredicate, error) {
+	var p FilePredicate
+	for _, arg := range splitPredicateArgs(args) {
+		name, value := defaultArg, arg
+		if i := strings.Index(arg, ":"); i >= 0 && (arg[:i] == "path" || arg[:i] == "content") {
+			name, value = arg[:i], arg[i+1:]
+		}
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			if value[0] == '"' {
+				unquoted, err := strconv.Unquote(value)
+				if err != nil {
+					return FilePredicate{}, fmt.Errorf("invalid quoted value %s", value)
+				}
+				value = unquoted
+			} else {
+				value = value[1 : len(value)-1]
+			}
+		}
+		if _, err := regexp.Compile(value); err != nil {
+			return FilePredicate{}, err
+		}
+
+		dst := &p.Path
+		if name == "content" {
+			dst = &p.Content
+		}
+		if *dst != "" {
+			return FilePredicate{}, fmt.Errorf("%s: may only be given once", name)
+		}
+		*dst = value
+	}
+	return p, nil
+}
+
+// splitPredicateArgs splits the arguments of a predicate at whitespace which
+// is not quoted or in parentheses.
+func splitPredicateArgs(args string) []string {
+	var (
+		fields  []string
+		start   = -1
+		depth   = 0
+		quote   rune
+		escaped = false
+	)
+	for i, r := range args {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case unicode.IsSpace(r) && depth == 0:
+			if start >= 0 {
+				fields = append(fields, args[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		fields = append(fields, args[start:])
+	}
+	return fields
+}
+
+// Predicates returns the predicates of field (repo: or file:) in q, and the
+// predicates of the negated field. Values which are not valid predicates are
+// ignored: they are reported by Validate.
+func Predicates(q QueryInfo, field string) (predicates, negatedPredicates []FilePredicate) {
+	values, negatedValues := q.RegexpPatterns(field)
+	for _, value := range values {
+		if p, ok, err := ParsePredicate(field, value); ok && err == nil {
+			predicates = append(predicates, p)
+		}
+	}
+	for _, value := range negatedValues {
+		if p, ok, err := ParsePredicate(field, value); ok && err == nil {
+			negatedPredicates = append(negatedPredicates, p)
+		}
+	}
+	return predicates, negatedPredicates
+}
+
+// OmitPredicates returns the values of field (repo: or file:) which are not
+// predicates, i.e. the regexps matching the names of repositories or files.
+func OmitPredicates(field string, values []string) []string {
+	var patterns []string
+	for _, value := range values {
+		if _, ok, _ := ParsePredicate(field, value); !ok {
+			patterns = append(patterns, value)
+		}
+	}
+	return patterns
+}
+
+// validatePredicate validates value if it is a predicate of field.
+func validatePredicate(field, value string, negated bool) error {
+	_, ok, err := ParsePredicate(field, value)
+	if !ok || err != nil {
+		return err
+	}
+	if negated && field == FieldFile {
+		return fmt.Errorf("file: predicates cannot be negated")
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePredicate(t *testing.T) {
+	tests := []struct {
+		field   string
+		value   string
+		want    FilePredicate
+		wantOK  bool
+		wantErr string
+	}{
+		{field: FieldRepo, value: "has.file(go.mod)", want: FilePredicate{Path: "go.mod"}, wantOK: true},
+		{field: FieldRepo, value: "has.file(path:go.mod content:github.com/foo/bar)", want: FilePredicate{Path: "go.mod", Content: "github.com/foo/bar"}, wantOK: true},
+		{field: FieldRepo, value: `has.file(content:"foo bar")`, want: FilePredicate{Content: "foo bar"}, wantOK: true},
+		{field: FieldRepo, value: `has.file(content:(a|b) c)`, want: FilePredicate{Path: "c", Content: "(a|b)"}, wantOK: true},
+		{field: FieldFile, value: "contains(TODO)", want: FilePredicate{Content: "TODO"}, wantOK: true},
+		{field: FieldFile, value: "has.content(content:TODO)", want: FilePredicate{Content: "TODO"}, wantOK: true},
+		{field: FieldRepo, value: "github.com/foo/bar"},
+		{field: FieldRepo, value: "contains(foo)"},
+		{field: FieldFile, value: "has.file(foo)"},
+		{field: FieldRepo, value: "has.file()", wantOK: true, wantErr: "invalid repo:has.file(...): expected a path: or content: argument"},
+		{field: FieldRepo, value: "has.file(a b)", wantOK: true, wantErr: "invalid repo:has.file(...): path: may only be given once"},
+		{field: FieldRepo, value: "has.file(content:[)", wantOK: true, wantErr: "invalid repo:has.file(...): error parsing regexp: missing closing ]: `[`"},
+		{field: FieldFile, value: "contains(path:a)", wantOK: true, wantErr: "invalid file:contains(...): path: is not supported, use file:<regexp> to match the path of files"},
+	}
+	for _, test := range tests {
+		t.Run(test.field+":"+test.value, func(t *testing.T) {
+			got, ok, err := ParsePredicate(test.field, test.value)
+			if ok != test.wantOK {
+				t.Fatalf("got ok %v, want %v", ok, test.wantOK)
+			}
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPredicates(t *testing.T) {
+	q, err := ParseAndCheck(`repo:foo repo:has.file(path:go.mod content:"github.com/foo/bar v1") -repo:has.file(vendor/) file:\.go$ file:contains(TODO) x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(q, SearchTypeRegex); err != nil {
+		t.Fatal(err)
+	}
+
+	predicates, negated := Predicates(q, FieldRepo)
+	if want := []FilePredicate{{Path: "go.mod", Content: "github.com/foo/bar v1"}}; !reflect.DeepEqual(predicates, want) {
+		t.Errorf("got repo predicates %+v, want %+v", predicates, want)
+	}
+	if want := []FilePredicate{{Path: "vendor/"}}; !reflect.DeepEqual(negated, want) {
+		t.Errorf("got negated repo predicates %+v, want %+v", negated, want)
+	}
+	if predicates, _ := Predicates(q, FieldFile); !reflect.DeepEqual(predicates, []FilePredicate{{Content: "TODO"}}) {
+		t.Errorf("got file predicates %+v", predicates)
+	}
+
+	values, _ := q.RegexpPatterns(FieldRepo)
+	if got, want := OmitPredicates(FieldRepo, values), []string{"foo"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got repo patterns %v, want %v", got, want)
+	}
+}
@@ -26,6 +26,14 @@ const (
 	FieldPatternType        = "patterntype"
 	FieldContent            = "content"
 	FieldVisibility         = "visibility"
+	FieldSelect             = "select"
+	FieldSort               = "sort"
+	FieldContext            = "context"
+
+	// For symbol search only:
+	FieldSymbolKind   = "symbolkind"
+	FieldSymbolParent = "symbolparent"
+	FieldExported     = "exported"
 
 	// For diff and commit search only:
 	FieldBefore    = "before"
@@ -62,10 +70,17 @@ var (
 			FieldPatternType: {Literal: types.StringType, Quoted: types.StringType, Singular: true},
 			FieldContent:     {Literal: types.StringType, Quoted: types.StringType, Singular: true},
 			FieldVisibility:  {Literal: types.StringType, Quoted: types.StringType, Singular: true},
+			FieldSelect:      {Literal: types.StringType, Quoted: types.StringType, Singular: true},
+			FieldSort:        {Literal: types.StringType, Quoted: types.StringType, Singular: true},
+			FieldContext:     {Literal: types.StringType, Quoted: types.StringType, Singular: true},
 
 			FieldRepoHasFile:        regexpNegatableFieldType,
 			FieldRepoHasCommitAfter: {Literal: types.StringType, Quoted: types.StringType, Singular: true},
 
+			FieldSymbolKind:   {Literal: types.StringType, Quoted: types.StringType, Negatable: true},
+			FieldSymbolParent: {Literal: types.StringType, Quoted: types.StringType, Singular: true},
+			FieldExported:     {Literal: types.StringType, Quoted: types.StringType, Singular: true},
+
 			FieldBefore:    stringFieldType,
 			FieldAfter:     stringFieldType,
 			FieldAuthor:    regexpNegatableFieldType,
@@ -111,6 +126,9 @@ func Parse(input string) (syntax.ParseTree, error) {
 	// We want to make query fields case insensitive
 	for _, expr := range parseTree {
 		expr.Field = strings.ToLower(expr.Field)
+		if expr.Field == contextFlag {
+			expr.Field, expr.Not = FieldContext, false
+		}
 	}
 	return parseTree, nil
 }
@@ -156,7 +174,8 @@ func processSearchPattern(q QueryInfo) string {
 }
 
 type ValidationError struct {
-	Msg string
+	Msg   string
+	Range *Range // if non-nil, the range of the input that is not valid
 }
 
 func (e *ValidationError) Error() string {
@@ -166,6 +185,34 @@ func (e *ValidationError) Error() string {
 // Validate validates legal combinations of fields and search patterns of a
 // successfully parsed query.
 func Validate(q QueryInfo, searchType SearchType) error {
+	if value, _ := q.StringValue(FieldSelect); value != "" {
+		if _, err := ParseSelect(value); err != nil {
+			return err
+		}
+	}
+	if value, _ := q.StringValue(FieldSort); value != "" {
+		if _, err := ParseSort(value); err != nil {
+			return err
+		}
+	}
+	if value, _ := q.StringValue(FieldContext); value != "" {
+		if _, err := ParseContextLines(value); err != nil {
+			return err
+		}
+	}
+	for _, field := range []string{FieldRepo, FieldFile} {
+		values, negatedValues := q.RegexpPatterns(field)
+		for _, value := range values {
+			if err := validatePredicate(field, value, false); err != nil {
+				return err
+			}
+		}
+		for _, value := range negatedValues {
+			if err := validatePredicate(field, value, true); err != nil {
+				return err
+			}
+		}
+	}
 	if searchType == SearchTypeStructural {
 		if q.Fields()[FieldCase] != nil {
 			return errors.New(`the parameter "case:" is not valid for structural search, matching is always case-sensitive`)
@@ -214,6 +261,9 @@ func parseAndCheck(conf *types.Config, input string) (*Query, error) {
 	// We want to make query fields case insensitive
 	for _, expr := range parseTree {
 		expr.Field = strings.ToLower(expr.Field)
+		if expr.Field == contextFlag {
+			expr.Field, expr.Not = FieldContext, false
+		}
 	}
 
 	checkedQuery, err := conf.Check(parseTree)
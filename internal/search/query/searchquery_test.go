@@ -163,6 +163,30 @@ func TestQuery_Validate(t *testing.T) {
 			SearchType: SearchTypeStructural,
 			Want:       "",
 		},
+		{
+			Name:       `Invalid select: value`,
+			Query:      `foo select:line`,
+			SearchType: SearchTypeRegex,
+			Want:       `invalid select: value "line", expected one of repo, file, symbol or commit`,
+		},
+		{
+			Name:       `Invalid sort: value`,
+			Query:      `foo sort:stars`,
+			SearchType: SearchTypeRegex,
+			Want:       `invalid sort: value "stars", expected one of relevance, path, repo or recent`,
+		},
+		{
+			Name:       `Invalid context: value`,
+			Query:      `foo context:20`,
+			SearchType: SearchTypeRegex,
+			Want:       `invalid context: value "20", expected a number of lines from 0 to 10`,
+		},
+		{
+			Name:       `Invalid repo: predicate`,
+			Query:      `foo repo:has.file()`,
+			SearchType: SearchTypeRegex,
+			Want:       `invalid repo:has.file(...): expected a path: or content: argument`,
+		},
 	}
 	for _, tt := range cases {
 		t.Run(tt.Name, func(t *testing.T) {
@@ -0,0 +1,87 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Result types that search results can be projected onto with select:.
+const (
+	SelectRepo   = "repo"
+	SelectFile   = "file"
+	SelectSymbol = "symbol"
+	SelectCommit = "commit"
+)
+
+// symbolKinds are the symbol kinds accepted by select:symbol.<kind> and
+// symbolkind:. They are the lowercased values of the SymbolKind GraphQL enum.
+var symbolKinds = map[string]struct{}{
+	"file": {}, "module": {}, "namespace": {}, "package": {}, "class": {},
+	"method": {}, "property": {}, "field": {}, "constructor": {}, "enum": {},
+	"interface": {}, "function": {}, "variable": {}, "constant": {},
+	"string": {}, "number": {}, "boolean": {}, "array": {}, "object": {},
+	"key": {}, "null": {}, "enummember": {}, "struct": {}, "event": {},
+	"operator": {}, "typeparameter": {},
+}
+
+// SelectPath is the parsed value of a select: field. Type is the result type
+// results are projected onto, and Field optionally refines it. For example,
+// select:symbol.function is SelectPath{Type: "symbol", Field: "function"}.
+type SelectPath struct {
+	Type  string
+	Field string
+}
+
+func (p SelectPath) String() string {
+	if p.Field == "" {
+		return p.Type
+	}
+	return p.Type + "." + p.Field
+}
+
+// ParseSelect parses and validates the value of a select: field. Valid values
+// are repo, file, symbol, symbol.<kind> (e.g. symbol.function), commit and
+// commit.author.
+func ParseSelect(value string) (SelectPath, error) {
+	value = strings.ToLower(value)
+	path := SelectPath{Type: value}
+	if i := strings.Index(value, "."); i >= 0 {
+		path = SelectPath{Type: value[:i], Field: value[i+1:]}
+		if path.Field == "" {
+			return SelectPath{}, fmt.Errorf("invalid select: value %q, expected a field after %q", value, path.Type+".")
+		}
+	}
+
+	switch path.Type {
+	case SelectRepo, SelectFile:
+		if path.Field == "" {
+			return path, nil
+		}
+	case SelectSymbol:
+		if _, ok := symbolKinds[path.Field]; ok || path.Field == "" {
+			return path, nil
+		}
+		return SelectPath{}, fmt.Errorf("invalid field %q on select:symbol, expected a symbol kind such as function or class", path.Field)
+	case SelectCommit:
+		if path.Field == "" || path.Field == "author" {
+			return path, nil
+		}
+	default:
+		return SelectPath{}, fmt.Errorf("invalid select: value %q, expected one of repo, file, symbol or commit", value)
+	}
+	return SelectPath{}, fmt.Errorf("invalid field %q on select:%s", path.Field, path.Type)
+}
+
+// Select returns the parsed select: value of q, or nil if q does not contain
+// one. The value must already have been validated.
+func Select(q QueryInfo) *SelectPath {
+	value, _ := q.StringValue(FieldSelect)
+	if value == "" {
+		return nil
+	}
+	path, err := ParseSelect(value)
+	if err != nil {
+		return nil
+	}
+	return &path
+}
@@ -0,0 +1,32 @@
+package query
+
+import "testing"
+
+func TestParseSelect(t *testing.T) {
+	cases := []struct {
+		input   string
+		want    SelectPath
+		wantErr bool
+	}{
+		{input: "repo", want: SelectPath{Type: SelectRepo}},
+		{input: "File", want: SelectPath{Type: SelectFile}},
+		{input: "symbol", want: SelectPath{Type: SelectSymbol}},
+		{input: "symbol.function", want: SelectPath{Type: SelectSymbol, Field: "function"}},
+		{input: "commit.author", want: SelectPath{Type: SelectCommit, Field: "author"}},
+		{input: "repo.name", wantErr: true},
+		{input: "symbol.", wantErr: true},
+		{input: "commit.message", wantErr: true},
+		{input: "line", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			got, err := ParseSelect(c.input)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("got error %v, want error %v", err, c.wantErr)
+			}
+			if got != c.want {
+				t.Errorf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Orders that search results can be sorted in with sort:.
+const (
+	SortRelevance = "relevance"
+	SortPath      = "path"
+	SortRepo      = "repo"
+	SortRecent    = "recent"
+)
+
+// ParseSort parses and validates the value of a sort: field. Valid values are
+// relevance, path, repo and recent.
+func ParseSort(value string) (string, error) {
+	value = strings.ToLower(value)
+	switch value {
+	case SortRelevance, SortPath, SortRepo, SortRecent:
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid sort: value %q, expected one of relevance, path, repo or recent", value)
+}
+
+// Sort returns the parsed sort: value of q. It returns SortRepo, the default
+// order, if q does not contain a valid one.
+func Sort(q QueryInfo) string {
+	value, _ := q.StringValue(FieldSort)
+	order, err := ParseSort(value)
+	if err != nil {
+		return SortRepo
+	}
+	return order
+}
@@ -0,0 +1,44 @@
+package query
+
+import "testing"
+
+func TestParseSort(t *testing.T) {
+	cases := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "relevance", want: SortRelevance},
+		{input: "Path", want: SortPath},
+		{input: "repo", want: SortRepo},
+		{input: "recent", want: SortRecent},
+		{input: "stars", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			got, err := ParseSort(c.input)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("got error %v, want error %v", err, c.wantErr)
+			}
+			if got != c.want {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestSort(t *testing.T) {
+	for input, want := range map[string]string{
+		"foo":                SortRepo,
+		"foo sort:relevance": SortRelevance,
+		"foo sort:RECENT":    SortRecent,
+	} {
+		q, err := ParseAndCheck(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Sort(q); got != want {
+			t.Errorf("%s: got %q, want %q", input, got, want)
+		}
+	}
+}
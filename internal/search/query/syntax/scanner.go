@@ -171,6 +171,15 @@ func scanValue(s *scanner) stateFn {
 	if unicode.IsSpace(r) {
 		return scanDefault
 	}
+	var field string
+	if n := len(s.tokens); n >= 2 && s.tokens[n-2].Type == TokenLiteral {
+		field = s.tokens[n-2].Value
+	}
+	if n, ok := ScanPredicate(field, s.input[s.pos:]); ok {
+		s.pos += n
+		s.emit(TokenLiteral)
+		return scanDefault
+	}
 	if r == '"' || r == '\'' {
 		return scanQuoted
 	}
@@ -275,3 +284,65 @@ func scanSpace(s *scanner) stateFn {
 	s.emit(TokenSep)
 	return scanDefault
 }
+
+// predicateNames are the names of the predicates of each field, including
+// field aliases. Keep in sync with query.ParsePredicate.
+var predicateNames = map[string][]string{
+	"repo": {"has.file"},
+	"r":    {"has.file"},
+	"file": {"contains", "has.content"},
+	"f":    {"contains", "has.content"},
+}
+
+// ScanPredicate returns the length of the predicate of field at the start of
+// input, if any. A predicate is a value like has.file(path:go.mod content:foo):
+// the name of one of the predicates of field followed by arguments in
+// balanced parentheses, which may contain whitespace and quoted strings. It
+// must be followed by whitespace, a closing parenthesis or the end of input.
+// Values of other fields, and other values of field, are not predicates.
+func ScanPredicate(field, input string) (n int, ok bool) {
+	field = strings.TrimPrefix(field, "-")
+	var i int
+	for _, name := range predicateNames[field] {
+		if strings.HasPrefix(input, name+"(") {
+			i = len(name)
+			break
+		}
+	}
+	if i == 0 {
+		return 0, false
+	}
+
+	var (
+		depth   = 0
+		quote   byte
+		escaped = false
+	)
+	for ; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				i++
+				if i < len(input) && input[i] != ')' && !unicode.IsSpace(rune(input[i])) {
+					return 0, false
+				}
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -10,65 +10,71 @@ func TestScanner(t *testing.T) {
 		wantTypes  []TokenType /* + implicit TokenEOF */
 		wantValues []string
 	}{
-		"":                  {wantTypes: []TokenType{}},
-		" ":                 {wantTypes: []TokenType{}},
-		"\n":                {wantTypes: []TokenType{}},
-		"a":                 {wantTypes: []TokenType{TokenLiteral}, wantValues: []string{"a"}},
-		":":                 {wantTypes: []TokenType{TokenColon}, wantValues: []string{":"}},
-		"-":                 {wantTypes: []TokenType{TokenMinus}, wantValues: []string{"-"}},
-		"a:b":               {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenLiteral}, wantValues: []string{"a", ":", "b"}},
-		"a : b":             {wantTypes: []TokenType{TokenLiteral, TokenSep, TokenColon, TokenSep, TokenLiteral}, wantValues: []string{"a", " ", ":", " ", "b"}},
-		"a: b":              {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenSep, TokenLiteral}, wantValues: []string{"a", ":", " ", "b"}},
-		`a:" b"`:            {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenQuoted}, wantValues: []string{"a", ":", `" b"`}},
-		"a :b":              {wantTypes: []TokenType{TokenLiteral, TokenSep, TokenColon, TokenLiteral}, wantValues: []string{"a", " ", ":", "b"}},
-		"-a":                {wantTypes: []TokenType{TokenMinus, TokenLiteral}, wantValues: []string{"-", "a"}},
-		"-a:b":              {wantTypes: []TokenType{TokenMinus, TokenLiteral, TokenColon, TokenLiteral}, wantValues: []string{"-", "a", ":", "b"}},
-		"- a":               {wantTypes: []TokenType{TokenMinus, TokenSep, TokenLiteral}, wantValues: []string{"-", " ", "a"}},
-		"- a:b":             {wantTypes: []TokenType{TokenMinus, TokenSep, TokenLiteral, TokenColon, TokenLiteral}, wantValues: []string{"-", " ", "a", ":", "b"}},
-		"--a":               {wantTypes: []TokenType{TokenMinus, TokenMinus, TokenLiteral}, wantValues: []string{"-", "-", "a"}},
-		"^a":                {wantTypes: []TokenType{TokenLiteral}, wantValues: []string{"^a"}},
-		"^a .b":             {wantTypes: []TokenType{TokenLiteral, TokenSep, TokenLiteral}, wantValues: []string{"^a", " ", ".b"}},
-		"a:b c:d":           {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenLiteral, TokenSep, TokenLiteral, TokenColon, TokenLiteral}, wantValues: []string{"a", ":", "b", " ", "c", ":", "d"}},
-		"a:b:c":             {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenLiteral}, wantValues: []string{"a", ":", "b:c"}},
-		`a:""`:              {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenQuoted}},
-		`a:"b"`:             {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenQuoted}, wantValues: []string{"a", ":", `"b"`}},
-		`a:'b'`:             {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenQuoted}},
-		`a:"b:c"`:           {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenQuoted}},
-		"a:'b:c'":           {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenQuoted}},
-		`a:b"c"`:            {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenLiteral}},
-		`"a"`:               {wantTypes: []TokenType{TokenQuoted}, wantValues: []string{`"a"`}},
-		"'a'":               {wantTypes: []TokenType{TokenQuoted}, wantValues: []string{"'a'"}},
-		`"a\"b"`:            {wantTypes: []TokenType{TokenQuoted}, wantValues: []string{`"a\"b"`}},
-		`"a\\"`:             {wantTypes: []TokenType{TokenQuoted}, wantValues: []string{`"a\\"`}},
-		`'a\'b'`:            {wantTypes: []TokenType{TokenQuoted}, wantValues: []string{`'a\'b'`}},
-		`"\u0033"`:          {wantTypes: []TokenType{TokenQuoted}, wantValues: []string{`"\u0033"`}},
-		`"\x21"`:            {wantTypes: []TokenType{TokenQuoted}, wantValues: []string{`"\x21"`}},
-		`"a`:                {wantTypes: []TokenType{TokenError}},
-		"'a":                {wantTypes: []TokenType{TokenError}},
-		`"a\`:               {wantTypes: []TokenType{TokenError}},
-		`a"`:                {wantTypes: []TokenType{TokenLiteral}, wantValues: []string{`a"`}},
-		"a'":                {wantTypes: []TokenType{TokenLiteral}, wantValues: []string{"a'"}},
-		`"a:b"`:             {wantTypes: []TokenType{TokenQuoted}, wantValues: []string{`"a:b"`}},
-		`a"b`:               {wantTypes: []TokenType{TokenLiteral}, wantValues: []string{`a"b`}},
-		`a:"b`:              {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenError}, wantValues: []string{"a", ":", `unclosed quoted string`}},
-		`a"b"c`:             {wantTypes: []TokenType{TokenLiteral}, wantValues: []string{`a"b"c`}},
-		`a"b:c"d`:           {wantTypes: []TokenType{TokenLiteral}, wantValues: []string{`a"b:c"d`}},
-		"/":                 {wantTypes: []TokenType{TokenPattern}, wantValues: []string{""}},
-		"//":                {wantTypes: []TokenType{TokenPattern}, wantValues: []string{""}},
-		"///":               {wantTypes: []TokenType{TokenPattern, TokenPattern}, wantValues: []string{"", ""}},
-		"/a":                {wantTypes: []TokenType{TokenPattern}, wantValues: []string{"a"}},
-		"-/a":               {wantTypes: []TokenType{TokenMinus, TokenPattern}, wantValues: []string{"-", "a"}},
-		"a:/b":              {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenLiteral}, wantValues: []string{"a", ":", "/b"}},
-		`/a\`:               {wantTypes: []TokenType{TokenError}},
-		`/a\/`:              {wantTypes: []TokenType{TokenPattern}, wantValues: []string{`a\/`}},
-		`/a\\/`:             {wantTypes: []TokenType{TokenPattern}, wantValues: []string{`a\\`}},
-		`/a\/b`:             {wantTypes: []TokenType{TokenPattern}, wantValues: []string{`a\/b`}},
-		"/a/ b":             {wantTypes: []TokenType{TokenPattern, TokenSep, TokenLiteral}, wantValues: []string{"a", " ", "b"}},
-		"a /b/ c":           {wantTypes: []TokenType{TokenLiteral, TokenSep, TokenPattern, TokenSep, TokenLiteral}, wantValues: []string{"a", " ", "b", " ", "c"}},
-		"a /b c":            {wantTypes: []TokenType{TokenLiteral, TokenSep, TokenPattern}, wantValues: []string{"a", " ", "b c"}},
-		"a /b c/":           {wantTypes: []TokenType{TokenLiteral, TokenSep, TokenPattern}, wantValues: []string{"a", " ", "b c"}},
-		`foo\ bar baz`:      {wantTypes: []TokenType{TokenLiteral, TokenSep, TokenLiteral}, wantValues: []string{"foo\\ bar", " ", "baz"}},
-		`\ foo\ bar\ baz\ `: {wantTypes: []TokenType{TokenLiteral}, wantValues: []string{"\\ foo\\ bar\\ baz\\ "}},
+		"":                         {wantTypes: []TokenType{}},
+		" ":                        {wantTypes: []TokenType{}},
+		"\n":                       {wantTypes: []TokenType{}},
+		"a":                        {wantTypes: []TokenType{TokenLiteral}, wantValues: []string{"a"}},
+		":":                        {wantTypes: []TokenType{TokenColon}, wantValues: []string{":"}},
+		"-":                        {wantTypes: []TokenType{TokenMinus}, wantValues: []string{"-"}},
+		"a:b":                      {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenLiteral}, wantValues: []string{"a", ":", "b"}},
+		"a : b":                    {wantTypes: []TokenType{TokenLiteral, TokenSep, TokenColon, TokenSep, TokenLiteral}, wantValues: []string{"a", " ", ":", " ", "b"}},
+		"a: b":                     {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenSep, TokenLiteral}, wantValues: []string{"a", ":", " ", "b"}},
+		`a:" b"`:                   {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenQuoted}, wantValues: []string{"a", ":", `" b"`}},
+		"a :b":                     {wantTypes: []TokenType{TokenLiteral, TokenSep, TokenColon, TokenLiteral}, wantValues: []string{"a", " ", ":", "b"}},
+		"-a":                       {wantTypes: []TokenType{TokenMinus, TokenLiteral}, wantValues: []string{"-", "a"}},
+		"-a:b":                     {wantTypes: []TokenType{TokenMinus, TokenLiteral, TokenColon, TokenLiteral}, wantValues: []string{"-", "a", ":", "b"}},
+		"- a":                      {wantTypes: []TokenType{TokenMinus, TokenSep, TokenLiteral}, wantValues: []string{"-", " ", "a"}},
+		"- a:b":                    {wantTypes: []TokenType{TokenMinus, TokenSep, TokenLiteral, TokenColon, TokenLiteral}, wantValues: []string{"-", " ", "a", ":", "b"}},
+		"--a":                      {wantTypes: []TokenType{TokenMinus, TokenMinus, TokenLiteral}, wantValues: []string{"-", "-", "a"}},
+		"^a":                       {wantTypes: []TokenType{TokenLiteral}, wantValues: []string{"^a"}},
+		"^a .b":                    {wantTypes: []TokenType{TokenLiteral, TokenSep, TokenLiteral}, wantValues: []string{"^a", " ", ".b"}},
+		"a:b c:d":                  {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenLiteral, TokenSep, TokenLiteral, TokenColon, TokenLiteral}, wantValues: []string{"a", ":", "b", " ", "c", ":", "d"}},
+		"a:b:c":                    {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenLiteral}, wantValues: []string{"a", ":", "b:c"}},
+		`a:""`:                     {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenQuoted}},
+		`a:"b"`:                    {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenQuoted}, wantValues: []string{"a", ":", `"b"`}},
+		`a:'b'`:                    {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenQuoted}},
+		`a:"b:c"`:                  {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenQuoted}},
+		"a:'b:c'":                  {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenQuoted}},
+		`a:b"c"`:                   {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenLiteral}},
+		`"a"`:                      {wantTypes: []TokenType{TokenQuoted}, wantValues: []string{`"a"`}},
+		"'a'":                      {wantTypes: []TokenType{TokenQuoted}, wantValues: []string{"'a'"}},
+		`"a\"b"`:                   {wantTypes: []TokenType{TokenQuoted}, wantValues: []string{`"a\"b"`}},
+		`"a\\"`:                    {wantTypes: []TokenType{TokenQuoted}, wantValues: []string{`"a\\"`}},
+		`'a\'b'`:                   {wantTypes: []TokenType{TokenQuoted}, wantValues: []string{`'a\'b'`}},
+		`"\u0033"`:                 {wantTypes: []TokenType{TokenQuoted}, wantValues: []string{`"\u0033"`}},
+		`"\x21"`:                   {wantTypes: []TokenType{TokenQuoted}, wantValues: []string{`"\x21"`}},
+		`"a`:                       {wantTypes: []TokenType{TokenError}},
+		"'a":                       {wantTypes: []TokenType{TokenError}},
+		`"a\`:                      {wantTypes: []TokenType{TokenError}},
+		`a"`:                       {wantTypes: []TokenType{TokenLiteral}, wantValues: []string{`a"`}},
+		"a'":                       {wantTypes: []TokenType{TokenLiteral}, wantValues: []string{"a'"}},
+		`"a:b"`:                    {wantTypes: []TokenType{TokenQuoted}, wantValues: []string{`"a:b"`}},
+		`a"b`:                      {wantTypes: []TokenType{TokenLiteral}, wantValues: []string{`a"b`}},
+		`a:"b`:                     {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenError}, wantValues: []string{"a", ":", `unclosed quoted string`}},
+		`a"b"c`:                    {wantTypes: []TokenType{TokenLiteral}, wantValues: []string{`a"b"c`}},
+		`a"b:c"d`:                  {wantTypes: []TokenType{TokenLiteral}, wantValues: []string{`a"b:c"d`}},
+		"/":                        {wantTypes: []TokenType{TokenPattern}, wantValues: []string{""}},
+		"//":                       {wantTypes: []TokenType{TokenPattern}, wantValues: []string{""}},
+		"///":                      {wantTypes: []TokenType{TokenPattern, TokenPattern}, wantValues: []string{"", ""}},
+		"/a":                       {wantTypes: []TokenType{TokenPattern}, wantValues: []string{"a"}},
+		"-/a":                      {wantTypes: []TokenType{TokenMinus, TokenPattern}, wantValues: []string{"-", "a"}},
+		"a:/b":                     {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenLiteral}, wantValues: []string{"a", ":", "/b"}},
+		`/a\`:                      {wantTypes: []TokenType{TokenError}},
+		`/a\/`:                     {wantTypes: []TokenType{TokenPattern}, wantValues: []string{`a\/`}},
+		`/a\\/`:                    {wantTypes: []TokenType{TokenPattern}, wantValues: []string{`a\\`}},
+		`/a\/b`:                    {wantTypes: []TokenType{TokenPattern}, wantValues: []string{`a\/b`}},
+		"/a/ b":                    {wantTypes: []TokenType{TokenPattern, TokenSep, TokenLiteral}, wantValues: []string{"a", " ", "b"}},
+		"a /b/ c":                  {wantTypes: []TokenType{TokenLiteral, TokenSep, TokenPattern, TokenSep, TokenLiteral}, wantValues: []string{"a", " ", "b", " ", "c"}},
+		"a /b c":                   {wantTypes: []TokenType{TokenLiteral, TokenSep, TokenPattern}, wantValues: []string{"a", " ", "b c"}},
+		"a /b c/":                  {wantTypes: []TokenType{TokenLiteral, TokenSep, TokenPattern}, wantValues: []string{"a", " ", "b c"}},
+		`foo\ bar baz`:             {wantTypes: []TokenType{TokenLiteral, TokenSep, TokenLiteral}, wantValues: []string{"foo\\ bar", " ", "baz"}},
+		`\ foo\ bar\ baz\ `:        {wantTypes: []TokenType{TokenLiteral}, wantValues: []string{"\\ foo\\ bar\\ baz\\ "}},
+		"repo:has.file(d e) f":     {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenLiteral, TokenSep, TokenLiteral}, wantValues: []string{"repo", ":", "has.file(d e)", " ", "f"}},
+		`-f:contains(c:"d )" (e))`: {wantTypes: []TokenType{TokenMinus, TokenLiteral, TokenColon, TokenLiteral}, wantValues: []string{"-", "f", ":", `contains(c:"d )" (e))`}},
+		"file:contains(c d":        {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenLiteral, TokenSep, TokenLiteral}, wantValues: []string{"file", ":", "contains(c", " ", "d"}},
+		"file:contains(c d)e":      {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenLiteral, TokenSep, TokenLiteral}, wantValues: []string{"file", ":", "contains(c", " ", "d)e"}},
+		"a:has.file(c d)":          {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenLiteral, TokenSep, TokenLiteral}, wantValues: []string{"a", ":", "has.file(c", " ", "d)"}},
+		"repo:contains(c d)":       {wantTypes: []TokenType{TokenLiteral, TokenColon, TokenLiteral, TokenSep, TokenLiteral}, wantValues: []string{"repo", ":", "contains(c", " ", "d)"}},
 	}
 	for input, test := range tests {
 		t.Run(input, func(t *testing.T) {
@@ -3,6 +3,7 @@ package query
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 )
 
@@ -27,6 +28,17 @@ func SubstituteAliases(nodes []Node) []Node {
 	})
 }
 
+// SubstituteContextFlag substitutes context: fields for -C: (or C:) fields. It
+// expects lowercased field names.
+func SubstituteContextFlag(nodes []Node) []Node {
+	return MapParameter(nodes, func(field, value string, negated bool) Node {
+		if field == contextFlag {
+			return Parameter{Field: FieldContext, Value: value}
+		}
+		return Parameter{Field: field, Value: value, Negated: negated}
+	})
+}
+
 // LowercaseFieldNames performs strings.ToLower on every field name.
 func LowercaseFieldNames(nodes []Node) []Node {
 	return MapParameter(nodes, func(field, value string, negated bool) Node {
@@ -34,6 +46,17 @@ func LowercaseFieldNames(nodes []Node) []Node {
 	})
 }
 
+// EscapePatterns escapes the regular expression metacharacters of search
+// patterns, so that and/or expressions of a literal search match literally.
+func EscapePatterns(nodes []Node) []Node {
+	return MapParameter(nodes, func(field, value string, negated bool) Node {
+		if field == "" {
+			value = regexp.QuoteMeta(value)
+		}
+		return Parameter{Field: field, Value: value, Negated: negated}
+	})
+}
+
 // Hoist is a heuristic that rewrites simple but possibly ambiguous queries. It
 // changes certain expressions in a way that some consider to be more natural.
 // For example, the following query without parentheses is interpreted as
@@ -58,7 +81,7 @@ func Hoist(nodes []Node) ([]Node, error) {
 	}
 
 	expression, ok := nodes[0].(Operator)
-	if !ok || expression.Kind == Concat {
+	if !ok || expression.Kind == Concat || expression.Kind == Not {
 		return nil, fmt.Errorf("heuristic requires top-level and- or or-expression")
 	}
 
@@ -35,6 +35,26 @@ func Test_LowercaseFieldNames(t *testing.T) {
 	}
 }
 
+func Test_LowercaseFieldNames_Not(t *testing.T) {
+	input := "FILE:foo a and NOT (b or c)"
+	want := `(and "file:foo" "a" (not (or "b" "c")))`
+	query, _ := ParseAndOr(input)
+	got := prettyPrint(LowercaseFieldNames(query))
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func Test_EscapePatterns(t *testing.T) {
+	input := "file:a.go foo.bar and not (x* or y)"
+	want := `(and "file:a.go" "foo\\.bar" (not (or "x\\*" "y")))`
+	query, _ := ParseAndOr(input)
+	got := prettyPrint(EscapePatterns(query))
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
 func Test_Hoist(t *testing.T) {
 	cases := []struct {
 		input      string
@@ -196,6 +196,12 @@ func valueToTypedValue(field, value string, quoted bool) []*types.Value {
 	case FieldRepoHasFile:
 		return []*types.Value{{Regexp: parseRegexpOrPanic(field, value)}}
 
+	case
+		FieldSymbolKind,
+		FieldSymbolParent,
+		FieldExported:
+		return []*types.Value{{String: &value}}
+
 	case
 		FieldRepoHasCommitAfter,
 		FieldBefore, "until",
@@ -29,12 +29,12 @@ func isPatternExpression(nodes []Node) bool {
 	return result
 }
 
-// ContainsAndOrKeyword returns true if this query contains or- or and-
+// ContainsAndOrKeyword returns true if this query contains or-, and- or not-
 // keywords. It is a temporary signal to determine whether we can fallback to
 // the older existing search functionality.
 func ContainsAndOrKeyword(input string) bool {
 	lower := strings.ToLower(input)
-	return strings.Contains(lower, " and ") || strings.Contains(lower, " or ")
+	return strings.Contains(lower, " and ") || strings.Contains(lower, " or ") || strings.Contains(lower, " not ") || strings.HasPrefix(lower, "not ")
 }
 
 // processTopLevel processes the top level of a query. It validates that we can
@@ -50,6 +50,8 @@ func processTopLevel(nodes []Node) ([]Node, error) {
 			return term.Operands, nil
 		} else if term.Kind == Concat {
 			return nodes, nil
+		} else if term.Kind == Not && isPatternExpression([]Node{term}) {
+			return nodes, nil
 		} else {
 			return nil, &UnsupportedError{Msg: "cannot evaluate: unable to partition pure search pattern"}
 		}
@@ -188,6 +190,37 @@ func validateField(field, value string, negated bool, seen map[string]struct{})
 		return nil
 	}
 
+	isValidSelect := func() error {
+		_, err := ParseSelect(value)
+		return err
+	}
+
+	isSymbolKind := func() error {
+		if _, ok := symbolKinds[strings.ToLower(value)]; !ok {
+			return fmt.Errorf("unknown symbol kind: %q, expected a symbol kind such as function or class", value)
+		}
+		return nil
+	}
+
+	isValidSort := func() error {
+		_, err := ParseSort(value)
+		return err
+	}
+
+	isValidContextLines := func() error {
+		_, err := ParseContextLines(value)
+		return err
+	}
+
+	isValidRegexpOrPredicate := func(field string) func() error {
+		return func() error {
+			if _, ok, _ := ParsePredicate(field, value); ok {
+				return validatePredicate(field, value, negated)
+			}
+			return isValidRegexp()
+		}
+	}
+
 	isUnrecognizedField := func() error {
 		return fmt.Errorf("unrecognized field %q", field)
 	}
@@ -210,13 +243,13 @@ func validateField(field, value string, negated bool, seen map[string]struct{})
 		return satisfies(isSingular, isBoolean, isNotNegated)
 	case
 		FieldRepo, "r":
-		return satisfies(isValidRegexp)
+		return satisfies(isValidRegexpOrPredicate(FieldRepo))
 	case
 		FieldRepoGroup, "g":
 		return satisfies(isSingular, isNotNegated)
 	case
 		FieldFile, "f":
-		return satisfies(isValidRegexp)
+		return satisfies(isValidRegexpOrPredicate(FieldFile))
 	case
 		FieldFork,
 		FieldArchived:
@@ -237,6 +270,24 @@ func validateField(field, value string, negated bool, seen map[string]struct{})
 	case
 		FieldRepoHasCommitAfter:
 		return satisfies(isSingular, isNotNegated)
+	case
+		FieldSelect:
+		return satisfies(isSingular, isNotNegated, isValidSelect)
+	case
+		FieldSort:
+		return satisfies(isSingular, isNotNegated, isValidSort)
+	case
+		FieldContext:
+		return satisfies(isSingular, isNotNegated, isValidContextLines)
+	case
+		FieldSymbolKind:
+		return satisfies(isSymbolKind)
+	case
+		FieldSymbolParent:
+		return satisfies(isSingular, isNotNegated)
+	case
+		FieldExported:
+		return satisfies(isSingular, isBoolean, isNotNegated)
 	case
 		FieldBefore, "until",
 		FieldAfter, "since":
@@ -267,6 +318,77 @@ func validateField(field, value string, negated bool, seen map[string]struct{})
 	return nil
 }
 
+// containsPositivePattern returns true if a search pattern in nodes is not
+// negated by a not-expression.
+func containsPositivePattern(nodes []Node) bool {
+	for _, node := range nodes {
+		switch v := node.(type) {
+		case Parameter:
+			if v.Field == "" && v.Value != "" {
+				return true
+			}
+		case Operator:
+			if v.Kind != Not && containsPositivePattern(v.Operands) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// invalidNot returns the first not-expression in nodes that is not an operand
+// of an and-expression which also has a search pattern operand that is not
+// negated. The top-level nodes are and-ed together. A not-expression under an
+// or-expression, like "foo or not bar", or without a positive pattern beside
+// it, like "repo:foo not bar", would match nearly every file.
+func invalidNot(nodes []Node, kind operatorKind) (Operator, bool) {
+	positive := false
+	if kind == And {
+		for _, node := range nodes {
+			if operator, ok := node.(Operator); ok && operator.Kind == Not {
+				continue
+			}
+			if containsPositivePattern([]Node{node}) {
+				positive = true
+				break
+			}
+		}
+	}
+	for _, node := range nodes {
+		operator, ok := node.(Operator)
+		if !ok {
+			continue
+		}
+		if operator.Kind == Not && !positive {
+			return operator, true
+		}
+		if invalid, ok := invalidNot(operator.Operands, operator.Kind); ok {
+			return invalid, true
+		}
+	}
+	return Operator{}, false
+}
+
+// validateNot validates the use of not-expressions in nodes, the parse tree
+// of in. Files without a match cannot be searched for, so a not-expression
+// must restrict the results of a search pattern that is not negated, as in
+// "foo and not bar".
+func validateNot(in string, nodes []Node) error {
+	operator, ok := invalidNot(nodes, And)
+	if !ok {
+		return nil
+	}
+	rng := operator.Range
+	expression := "not"
+	if rng.End > rng.Start && rng.End <= len(in) {
+		expression = in[rng.Start:rng.End]
+	}
+	return &ValidationError{
+		Msg:   fmt.Sprintf("%q must be an operand of an and-expression together with a search pattern that is not negated, as in foo and not bar", expression),
+		Range: &rng,
+	}
+}
+
 func validate(nodes []Node) error {
 	var err error
 	seen := map[string]struct{}{}
@@ -49,6 +49,62 @@ func TestAndOrQuery_Validation(t *testing.T) {
 			input: "count:-1",
 			want:  "field count requires a positive number",
 		},
+		{
+			input: "select:symbol.potato",
+			want:  `invalid field "potato" on select:symbol, expected a symbol kind such as function or class`,
+		},
+		{
+			input: "symbolkind:potato",
+			want:  `unknown symbol kind: "potato", expected a symbol kind such as function or class`,
+		},
+		{
+			input: "symbolparent:a symbolparent:b",
+			want:  `field "symbolparent" may not be used more than once`,
+		},
+		{
+			input: "exported:maybe",
+			want:  `invalid boolean "maybe"`,
+		},
+		{
+			input: "sort:relevance sort:path",
+			want:  `field "sort" may not be used more than once`,
+		},
+		{
+			input: "context:2 context:3",
+			want:  `field "context" may not be used more than once`,
+		},
+		{
+			input: "-context:2 x",
+			want:  `field "context" does not support negation`,
+		},
+		{
+			input: "-file:contains(TODO) x",
+			want:  "file: predicates cannot be negated",
+		},
+		{
+			input: "repo:foo not bar",
+			want:  `"not bar" must be an operand of an and-expression together with a search pattern that is not negated, as in foo and not bar`,
+		},
+		{
+			input: "not a or not b",
+			want:  `"not a" must be an operand of an and-expression together with a search pattern that is not negated, as in foo and not bar`,
+		},
+		{
+			input: "foo or not bar",
+			want:  `"not bar" must be an operand of an and-expression together with a search pattern that is not negated, as in foo and not bar`,
+		},
+		{
+			input: "not bar",
+			want:  `"not bar" must be an operand of an and-expression together with a search pattern that is not negated, as in foo and not bar`,
+		},
+		{
+			input: "foo and (not bar or baz)",
+			want:  `"not bar" must be an operand of an and-expression together with a search pattern that is not negated, as in foo and not bar`,
+		},
+		{
+			input: "foo and not not bar",
+			want:  `"not bar" must be an operand of an and-expression together with a search pattern that is not negated, as in foo and not bar`,
+		},
 	}
 	for _, c := range cases {
 		t.Run("validate and/or query", func(t *testing.T) {
@@ -65,6 +121,20 @@ func TestAndOrQuery_Validation(t *testing.T) {
 	}
 }
 
+func TestAndOrQuery_ValidNot(t *testing.T) {
+	for _, input := range []string{
+		"foo and not bar",
+		"repo:foo foo not bar",
+		"(foo and not bar) or baz",
+		"(foo or baz) and not bar",
+		"foo and not (bar and not baz)",
+	} {
+		if _, err := ProcessAndOr(input); err != nil {
+			t.Errorf("%s: unexpected error: %s", input, err)
+		}
+	}
+}
+
 func TestAndOrQuery_IsCaseSensitive(t *testing.T) {
 	cases := []struct {
 		name  string
@@ -219,6 +289,14 @@ func Test_PartitionSearchPattern(t *testing.T) {
 			input: "repo:foo and (file:bar or file:baz) and x",
 			want:  "cannot evaluate: unable to partition pure search pattern",
 		},
+		{
+			input: "file:foo x not y",
+			want:  `"file:foo" (and "x" (not "y"))`,
+		},
+		{
+			input: "file:foo x and not (y or z)",
+			want:  `"file:foo" (and "x" (not (or "y" "z")))`,
+		},
 	}
 	for _, tt := range cases {
 		t.Run("partition search pattern", func(t *testing.T) {
@@ -253,6 +331,9 @@ func Test_ContainsAndOrKeyword(t *testing.T) {
 	if !ContainsAndOrKeyword("repo:foo AND bar") {
 		t.Errorf("Expected query to contain keyword")
 	}
+	if !ContainsAndOrKeyword("foo not bar") {
+		t.Errorf("Expected query to contain keyword")
+	}
 	if ContainsAndOrKeyword("repo:foo bar") {
 		t.Errorf("Did not expect query to contain keyword")
 	}
@@ -66,6 +66,13 @@ type RepositoryRevisions struct {
 	mu                sync.Mutex
 	indexedHEADCommit api.CommitID
 
+	// indexedBranches are the branches indexed by Zoekt which are searched
+	// for Revs. It is nil unless the repository is configured to index more
+	// than its default branch (see "search.index.branches" in the site
+	// configuration), in which case the search is restricted to these
+	// branches. It is written to by zoektIndexedRepos.
+	indexedBranches []IndexedBranch
+
 	// ListRefs is called to list all Git refs for a repository. It is intended to be mocked by
 	// tests. If nil, git.ListRefs is used.
 	ListRefs func(context.Context, gitserver.Repo) ([]git.Ref, error)
@@ -87,6 +94,33 @@ func (r *RepositoryRevisions) SetIndexedHEADCommit(ihc api.CommitID) {
 	r.indexedHEADCommit = ihc
 }
 
+// IndexedBranches returns the branches indexed by Zoekt which are searched
+// for r. See indexedBranches.
+func (r *RepositoryRevisions) IndexedBranches() []IndexedBranch {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.indexedBranches
+}
+
+func (r *RepositoryRevisions) SetIndexedBranches(branches []IndexedBranch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.indexedBranches = branches
+}
+
+// MaxIndexedBranches is the maximum number of branches of a repository,
+// including its default branch, that Zoekt indexes. If a repository has as
+// many indexed branches, the branches matching a configured glob may not all
+// be indexed.
+const MaxIndexedBranches = 64
+
+// IndexedBranch is a branch of a repository indexed by Zoekt. The default
+// branch is named "HEAD".
+type IndexedBranch struct {
+	Name   string
+	Commit api.CommitID
+}
+
 // ParseRepositoryRevisions parses strings that refer to a repository and 0
 // or more revspecs. The format is:
 //
@@ -106,6 +140,10 @@ func (r *RepositoryRevisions) SetIndexedHEADCommit(ihc api.CommitID) {
 // - 'foo@*bar' refers to the 'foo' repo and all refs matching the glob 'bar/*',
 //   because git interprets the ref glob 'bar' as being 'bar/*' (see `man git-log`
 //   section on the --glob flag)
+// - 'foo@release/*' refers to the 'foo' repo and all branches matching the glob
+//   'release/*', i.e. it is the same as 'foo@*refs/heads/release/*'. Revspecs
+//   containing glob characters are not valid refs, so they are interpreted as
+//   branch globs.
 func ParseRepositoryRevisions(repoAndOptionalRev string) (api.RepoName, []RevisionSpecifier) {
 	i := strings.Index(repoAndOptionalRev, "@")
 	if i == -1 {
@@ -136,10 +174,19 @@ func parseRev(spec string) RevisionSpecifier {
 		return RevisionSpecifier{ExcludeRefGlob: spec[2:]}
 	} else if strings.HasPrefix(spec, "*") {
 		return RevisionSpecifier{RefGlob: spec[1:]}
+	} else if isBranchGlob(spec) {
+		return RevisionSpecifier{RefGlob: "refs/heads/" + spec}
 	}
 	return RevisionSpecifier{RevSpec: spec}
 }
 
+// isBranchGlob reports whether spec is a glob of branch names, such as
+// "release/*". Revspecs which may use glob characters for another purpose,
+// such as "master^{/fix.*bug}", are not.
+func isBranchGlob(spec string) bool {
+	return strings.ContainsAny(spec, "*?[") && !strings.ContainsAny(spec, "^~{}:\\ ")
+}
+
 // GitserverRepo is a convenience function to return the gitserver.Repo for
 // r.Repo. The returned Repo will not have the URL set, only the name.
 func (r *RepositoryRevisions) GitserverRepo() gitserver.Repo {
@@ -19,6 +19,12 @@ func TestParseRepositoryRevisions(t *testing.T) {
 		"repo@rev1:rev2": {repo: "repo", revs: []RevisionSpecifier{{RevSpec: "rev1"}, {RevSpec: "rev2"}}},
 		"repo@:rev1:":    {repo: "repo", revs: []RevisionSpecifier{{RevSpec: "rev1"}}},
 		"repo@*glob":     {repo: "repo", revs: []RevisionSpecifier{{RefGlob: "glob"}}},
+		"repo@release/*": {repo: "repo", revs: []RevisionSpecifier{{RefGlob: "refs/heads/release/*"}}},
+		"repo@v1.[0-9]":  {repo: "repo", revs: []RevisionSpecifier{{RefGlob: "refs/heads/v1.[0-9]"}}},
+		"repo@master^{/fix.*bug}": {
+			repo: "repo",
+			revs: []RevisionSpecifier{{RevSpec: "master^{/fix.*bug}"}},
+		},
 		"repo@rev1:*glob1:^rev2": {
 			repo: "repo",
 			revs: []RevisionSpecifier{{RevSpec: "rev1"}, {RefGlob: "glob1"}, {RevSpec: "^rev2"}},
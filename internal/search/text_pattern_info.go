@@ -15,6 +15,13 @@ func (p *TextPatternInfo) Validate() error {
 			return err
 		}
 	}
+	if p.PatternExpression != nil {
+		for _, expr := range p.PatternExpression.Leaves() {
+			if _, err := syntax.Parse(expr, syntax.Perl); err != nil {
+				return err
+			}
+		}
+	}
 
 	if p.PathPatternsAreRegExps {
 		if p.ExcludePattern != "" {
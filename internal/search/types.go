@@ -64,6 +64,22 @@ type SymbolsParameters struct {
 	// need to match to get included in the result
 	ExcludePattern string
 
+	// Kinds, if non-empty, are the kinds of the symbols to return, such as
+	// "func" or "class". Kinds are compared case insensitively.
+	Kinds []string
+
+	// ExcludeKinds are the kinds of the symbols to not return.
+	ExcludeKinds []string
+
+	// Parent, if set, is the name of the parent of the symbols to return,
+	// such as the type of a method. It is compared case insensitively unless
+	// IsCaseSensitive is true.
+	Parent string
+
+	// Exported, if set, restricts the symbols to exported (true) or unexported
+	// (false) symbols. See protocol.Symbol.Exported.
+	Exported *bool
+
 	// First indicates that only the first n symbols should be returned.
 	First int
 }
@@ -114,6 +130,15 @@ type TextPatternInfo struct {
 	IsCaseSensitive bool
 	FileMatchLimit  int32
 
+	// ContextLines is the number of lines before and after each line match
+	// that are returned with it.
+	ContextLines int32
+
+	// PatternExpression, if set, is a boolean expression of regular
+	// expressions that file content must satisfy. Pattern is then the union
+	// of its non-negated patterns and is only used to find line matches.
+	PatternExpression *PatternNode
+
 	// We do not support IsMultiline
 	// IsMultiline     bool
 	IncludePatterns []string
@@ -133,6 +158,9 @@ type TextPatternInfo struct {
 
 func (p *TextPatternInfo) String() string {
 	args := []string{fmt.Sprintf("%q", p.Pattern)}
+	if p.PatternExpression != nil {
+		args = append(args, fmt.Sprintf("expr:%s", p.PatternExpression))
+	}
 	if p.IsRegExp {
 		args = append(args, "re")
 	}
@@ -158,6 +186,9 @@ func (p *TextPatternInfo) String() string {
 	if p.FileMatchLimit > 0 {
 		args = append(args, fmt.Sprintf("filematchlimit:%d", p.FileMatchLimit))
 	}
+	if p.ContextLines > 0 {
+		args = append(args, fmt.Sprintf("context:%d", p.ContextLines))
+	}
 	for _, lang := range p.Languages {
 		args = append(args, fmt.Sprintf("lang:%s", lang))
 	}
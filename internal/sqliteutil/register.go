@@ -9,6 +9,7 @@ import (
 	"path"
 	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/mattn/go-sqlite3"
 	"github.com/sourcegraph/sourcegraph/internal/env"
@@ -16,14 +17,18 @@ import (
 
 var libSqlite3Pcre = env.Get("LIBSQLITE3_PCRE", "", "path to the libsqlite3-pcre library")
 
+var registerOnce sync.Once
+
 // MustRegisterSqlite3WithPcre registers a sqlite3 driver with PCRE support and
-// panics if it can't.
+// panics if it can't. It is safe to call more than once.
 func MustRegisterSqlite3WithPcre() {
-	if libSqlite3Pcre == "" {
-		env.PrintHelp()
-		log.Fatal("can't find the libsqlite3-pcre library because LIBSQLITE3_PCRE was not set")
-	}
-	sql.Register("sqlite3_with_pcre", &sqlite3.SQLiteDriver{Extensions: []string{libSqlite3Pcre}})
+	registerOnce.Do(func() {
+		if libSqlite3Pcre == "" {
+			env.PrintHelp()
+			log.Fatal("can't find the libsqlite3-pcre library because LIBSQLITE3_PCRE was not set")
+		}
+		sql.Register("sqlite3_with_pcre", &sqlite3.SQLiteDriver{Extensions: []string{libSqlite3Pcre}})
+	})
 }
 
 // SetLocalLibpath sets the path to the LIBSQLITE3_PCRE shared library. This should
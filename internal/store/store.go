@@ -23,6 +23,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/gitserver"
 	"github.com/sourcegraph/sourcegraph/internal/metrics"
 	"github.com/sourcegraph/sourcegraph/internal/mutablelimiter"
+	"github.com/sourcegraph/sourcegraph/internal/objectstore"
 	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
 
 	"github.com/opentracing/opentracing-go/ext"
@@ -65,6 +66,20 @@ type Store struct {
 	// MaxCacheSizeBytes.
 	MaxCacheSizeBytes int64
 
+	// ObjectStore is a cache of archives that is shared with the other
+	// replicas (optional). On a miss of the disk cache, the archive is read
+	// from ObjectStore before it is fetched with FetchTar, and fetched
+	// archives are uploaded to it.
+	ObjectStore objectstore.ObjectStore
+
+	// ObjectStoreMaxAge and ObjectStoreMaxSizeBytes are the limits of the
+	// archives in ObjectStore: archives older than ObjectStoreMaxAge are
+	// evicted, and then the oldest archives until the total size is at most
+	// ObjectStoreMaxSizeBytes. A zero value disables the limit. Since every
+	// replica evicts, they should all use the same limits.
+	ObjectStoreMaxAge       time.Duration
+	ObjectStoreMaxSizeBytes int64
+
 	// once protects Start
 	once sync.Once
 
@@ -108,6 +123,9 @@ func (s *Store) Start() {
 		_ = os.MkdirAll(s.Path, 0700)
 		metrics.MustRegisterDiskMonitor(s.Path)
 		go s.watchAndEvict()
+		if s.ObjectStore != nil {
+			go s.watchAndEvictObjects()
+		}
 	})
 }
 
@@ -151,7 +169,12 @@ func (s *Store) PrepareZip(ctx context.Context, repo gitserver.Repo, commit api.
 		// TODO: consider adding a cache method that doesn't actually bother opening the file,
 		// since we're just going to close it again immediately.
 		bgctx := opentracing.ContextWithSpan(context.Background(), opentracing.SpanFromContext(ctx))
+		fetched := false
 		f, err := s.cache.Open(bgctx, key, func(ctx context.Context) (io.ReadCloser, error) {
+			if rc := s.getObject(ctx, key); rc != nil {
+				return rc, nil
+			}
+			fetched = true
 			return s.fetch(ctx, repo, commit, largeFilePatterns)
 		})
 		var path string
@@ -161,6 +184,13 @@ func (s *Store) PrepareZip(ctx context.Context, repo gitserver.Repo, commit api.
 				f.File.Close()
 			}
 		}
+		if err == nil && fetched && s.ObjectStore != nil {
+			// Open the archive before returning, since it may be evicted
+			// from the disk cache while it is uploaded.
+			if zf, err := os.Open(path); err == nil {
+				go s.putObject(key, zf)
+			}
+		}
 		resC <- result{path, err}
 	}()
 
@@ -176,6 +206,38 @@ func (s *Store) PrepareZip(ctx context.Context, repo gitserver.Repo, commit api.
 	}
 }
 
+// getObject returns a reader of the archive with key in the object store, or
+// nil if there is no object store or it does not have the archive. Errors of
+// the object store are logged rather than returned, since the archive can
+// still be fetched from gitserver.
+func (s *Store) getObject(ctx context.Context, key string) io.ReadCloser {
+	if s.ObjectStore == nil {
+		return nil
+	}
+	rc, err := s.ObjectStore.Get(ctx, key)
+	if err != nil {
+		if err != objectstore.ErrObjectNotFound {
+			log.Printf("failed to get archive %s from object store: %s", key, err)
+		}
+		objectStoreMisses.Inc()
+		return nil
+	}
+	objectStoreHits.Inc()
+	return rc
+}
+
+// putObject uploads the archive zf with key to the object store and closes
+// zf.
+func (s *Store) putObject(key string, zf *os.File) {
+	defer zf.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	if err := s.ObjectStore.Put(ctx, key, zf); err != nil {
+		log.Printf("failed to put archive %s in object store: %s", key, err)
+		objectStorePutFailed.Inc()
+	}
+}
+
 // fetch fetches an archive from the network and stores it on disk. It does
 // not populate the in-memory cache. You should probably be calling
 // prepareZip.
@@ -246,7 +308,7 @@ func (s *Store) fetch(ctx context.Context, repo gitserver.Repo, commit api.Commi
 		}
 		done(err)
 		// CloseWithError is guaranteed to return a nil error
-		_ = pw.CloseWithError(errors.Wrapf(err, "failed to fetch %s@%s", repo, commit))
+		_ = pw.CloseWithError(errors.Wrapf(err, "failed to fetch %s@%s", repo.Name, commit))
 	}()
 
 	return pr, nil
@@ -361,6 +423,24 @@ func (s *Store) watchAndEvict() {
 	}
 }
 
+// watchAndEvictObjects is a loop which periodically evicts archives from the
+// object store.
+func (s *Store) watchAndEvictObjects() {
+	if s.ObjectStoreMaxAge == 0 && s.ObjectStoreMaxSizeBytes == 0 {
+		return
+	}
+
+	for {
+		time.Sleep(10 * time.Minute)
+
+		stats, err := objectstore.EvictObjects(context.Background(), s.ObjectStore, s.ObjectStoreMaxAge, s.ObjectStoreMaxSizeBytes)
+		if err != nil {
+			log.Printf("failed to evict archives from object store: %s", err)
+		}
+		objectStoreEvictions.Add(float64(stats.Evicted))
+	}
+}
+
 // ignoreSizeMax determines whether the max size should be ignored. It uses
 // the glob syntax found here: https://golang.org/pkg/path/filepath/#Match.
 func ignoreSizeMax(name string, patterns []string) bool {
@@ -404,6 +484,30 @@ var (
 		Name:      "fetch_failed",
 		Help:      "The total number of archive fetches that failed.",
 	})
+	objectStoreHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "searcher",
+		Subsystem: "store",
+		Name:      "object_store_hits",
+		Help:      "The total number of archives read from the object store.",
+	})
+	objectStoreMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "searcher",
+		Subsystem: "store",
+		Name:      "object_store_misses",
+		Help:      "The total number of archives not found in the object store.",
+	})
+	objectStorePutFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "searcher",
+		Subsystem: "store",
+		Name:      "object_store_put_failed",
+		Help:      "The total number of archive uploads to the object store that failed.",
+	})
+	objectStoreEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "searcher",
+		Subsystem: "store",
+		Name:      "object_store_evictions",
+		Help:      "The total number of archives evicted from the object store.",
+	})
 )
 
 // temporaryError wraps an error but adds the Temporary method. It does not
@@ -423,4 +527,8 @@ func init() {
 	prometheus.MustRegister(fetching)
 	prometheus.MustRegister(fetchQueueSize)
 	prometheus.MustRegister(fetchFailed)
+	prometheus.MustRegister(objectStoreHits)
+	prometheus.MustRegister(objectStoreMisses)
+	prometheus.MustRegister(objectStorePutFailed)
+	prometheus.MustRegister(objectStoreEvictions)
 }
@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/objectstore"
 )
 
 func TestPrepareZip(t *testing.T) {
@@ -167,3 +169,59 @@ func emptyTar(t *testing.T) io.ReadCloser {
 	}
 	return ioutil.NopCloser(bytes.NewReader(buf.Bytes()))
 }
+
+func TestPrepareZip_objectStore(t *testing.T) {
+	d, err := ioutil.TempDir("", "objectstore_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	objectStore := &objectstore.DirObjectStore{Dir: d}
+
+	var fetchTarCalled int64
+	fetchTar := func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) (io.ReadCloser, error) {
+		atomic.AddInt64(&fetchTarCalled, 1)
+		return emptyTar(t), nil
+	}
+
+	// Two replicas with their own disk caches.
+	s1, cleanup1 := tmpStore(t)
+	defer cleanup1()
+	s2, cleanup2 := tmpStore(t)
+	defer cleanup2()
+	for _, s := range []*Store{s1, s2} {
+		s.FetchTar = fetchTar
+		s.ObjectStore = objectStore
+	}
+
+	repo := gitserver.Repo{Name: "foo"}
+	commit := api.CommitID("deadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+	if _, err := s1.PrepareZip(context.Background(), repo, commit); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the archive to be uploaded in the background.
+	uploaded := false
+	for i := 0; i < 500; i++ {
+		objects, _ := objectStore.List(context.Background())
+		if len(objects) != 0 {
+			uploaded = true
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !uploaded {
+		t.Fatal("timed out waiting for the archive to be uploaded to", d)
+	}
+
+	path, err := s2.PrepareZip(context.Background(), repo, commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&fetchTarCalled); n != 1 {
+		t.Errorf("got %d calls to FetchTar, want 1", n)
+	}
+	if !strings.HasPrefix(path, s2.Path) {
+		t.Errorf("got path %s, want a path in the disk cache of the second store %s", path, s2.Path)
+	}
+}
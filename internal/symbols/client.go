@@ -102,6 +102,83 @@ func (c *Client) Search(ctx context.Context, args search.SymbolsParameters) (res
 	return result, err
 }
 
+// SearchAggregated searches the symbols of repos in the aggregated index of
+// the symbols service. The repositories are searched on the replica of the
+// symbols service that Search would use for them, with one request per
+// replica. The results of the replicas are merged.
+func (c *Client) SearchAggregated(ctx context.Context, repos []protocol.RepoCommit, args search.SymbolsParameters) (result *protocol.AggregatedSearchResult, err error) {
+	span, ctx := ot.StartSpanFromContext(ctx, "symbols.Client.SearchAggregated")
+	defer func() {
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(otlog.Error(err))
+		}
+		span.Finish()
+	}()
+	span.SetTag("Repos", len(repos))
+
+	// Group the repositories by the replica that serves them.
+	reposByURL := map[string][]protocol.RepoCommit{}
+	for _, repo := range repos {
+		url, err := c.url(key{repo: repo.Repo, commitID: repo.CommitID})
+		if err != nil {
+			return nil, err
+		}
+		reposByURL[url] = append(reposByURL[url], repo)
+	}
+	span.SetTag("Replicas", len(reposByURL))
+
+	var (
+		mu  sync.Mutex
+		run = parallel.NewRun(len(reposByURL))
+	)
+	result = &protocol.AggregatedSearchResult{}
+	for _, replicaRepos := range reposByURL {
+		replicaRepos := replicaRepos
+		run.Acquire()
+		go func() {
+			defer run.Release()
+			replicaResult, err := c.searchAggregatedReplica(ctx, replicaRepos, args)
+			if err != nil {
+				run.Error(err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			result.Symbols = append(result.Symbols, replicaResult.Symbols...)
+			result.Missing = append(result.Missing, replicaResult.Missing...)
+		}()
+	}
+	if err := run.Wait(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// searchAggregatedReplica searches repos, which are all served by the same
+// replica of the symbols service.
+func (c *Client) searchAggregatedReplica(ctx context.Context, repos []protocol.RepoCommit, args search.SymbolsParameters) (*protocol.AggregatedSearchResult, error) {
+	payload := protocol.AggregatedSearchArgs{
+		Repos: repos,
+		Args:  protocol.SearchArgs(args),
+	}
+	resp, err := c.httpPost(ctx, "search-aggregated", key{repo: repos[0].Repo, commitID: repos[0].CommitID}, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// best-effort inclusion of body in error message
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 200))
+		return nil, errors.Errorf("Symbol.SearchAggregated http status %d for %d repositories: %s", resp.StatusCode, len(repos), string(body))
+	}
+
+	var result protocol.AggregatedSearchResult
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return &result, err
+}
+
 func (c *Client) httpPost(ctx context.Context, method string, key key, payload interface{}) (resp *http.Response, err error) {
 	span, ctx := ot.StartSpanFromContext(ctx, "symbols.Client.httpPost")
 	defer func() {
@@ -1,6 +1,12 @@
 package protocol
 
-import "github.com/sourcegraph/sourcegraph/internal/api"
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
 
 // SearchArgs are the arguments to perform a search on the symbols service.
 type SearchArgs struct {
@@ -33,6 +39,22 @@ type SearchArgs struct {
 	// need to match to get included in the result
 	ExcludePattern string
 
+	// Kinds, if non-empty, are the kinds of the symbols to return, such as
+	// "func" or "class". Kinds are compared case insensitively.
+	Kinds []string
+
+	// ExcludeKinds are the kinds of the symbols to not return.
+	ExcludeKinds []string
+
+	// Parent, if set, is the name of the parent of the symbols to return,
+	// such as the type of a method. It is compared case insensitively unless
+	// IsCaseSensitive is true.
+	Parent string
+
+	// Exported, if set, restricts the symbols to exported (true) or unexported
+	// (false) symbols. See Symbol.Exported.
+	Exported *bool
+
 	// First indicates that only the first n symbols should be returned.
 	First int
 }
@@ -56,3 +78,50 @@ type Symbol struct {
 
 	FileLimited bool
 }
+
+// Exported reports whether the symbol is visible outside of its package or
+// module, according to the naming conventions of its language: in Go,
+// exported names start with an upper case letter, and in other languages,
+// names that start with an underscore are private.
+func (s Symbol) Exported() bool {
+	r, _ := utf8.DecodeRuneInString(s.Name)
+	if strings.EqualFold(s.Language, "go") {
+		return unicode.IsUpper(r)
+	}
+	return r != '_'
+}
+
+// AggregatedSearchArgs are the arguments to search the symbols of many
+// repositories in the aggregated index of the symbols service.
+type AggregatedSearchArgs struct {
+	// Repos are the repositories to search in, at the commit to search in.
+	Repos []RepoCommit `json:"repos"`
+
+	// Args are the arguments of the search. Args.Repo and Args.CommitID are
+	// ignored, and Args.First limits the number of symbols returned for all
+	// repositories.
+	Args SearchArgs `json:"args"`
+}
+
+// RepoCommit is a repository at a commit.
+type RepoCommit struct {
+	Repo     api.RepoName `json:"repo"`
+	CommitID api.CommitID `json:"commitID"`
+}
+
+// AggregatedSearchResult is the result of a search of the aggregated index.
+type AggregatedSearchResult struct {
+	// Symbols are the matching symbols of each repository that has matches.
+	Symbols []RepoSymbols `json:"symbols"`
+
+	// Missing are the repositories that are not in the aggregated index at
+	// the requested commit. They are added to the index in the background, and
+	// must be searched with a SearchArgs request until then.
+	Missing []RepoCommit `json:"missing"`
+}
+
+// RepoSymbols are the matching symbols of a repository.
+type RepoSymbols struct {
+	RepoCommit
+	Symbols []Symbol `json:"symbols"`
+}
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS search_export_job_repos;
+DROP TABLE IF EXISTS search_export_jobs;
+
+COMMIT;
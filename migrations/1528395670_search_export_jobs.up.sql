@@ -0,0 +1,35 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS search_export_jobs (
+    id bigserial PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    query text NOT NULL,
+    pattern_type text NOT NULL,
+    format text NOT NULL,
+    state text NOT NULL DEFAULT 'queued',
+    failure_message text,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    started_at timestamp with time zone,
+    finished_at timestamp with time zone,
+    heartbeat_at timestamp with time zone,
+    attempt integer NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS search_export_jobs_state ON search_export_jobs(state);
+CREATE INDEX IF NOT EXISTS search_export_jobs_user_id ON search_export_jobs(user_id);
+
+CREATE TABLE IF NOT EXISTS search_export_job_repos (
+    job_id bigint NOT NULL REFERENCES search_export_jobs(id) ON DELETE CASCADE,
+    repo_id integer NOT NULL,
+    repo_name citext NOT NULL,
+    state text NOT NULL DEFAULT 'queued',
+    match_count integer NOT NULL DEFAULT 0,
+    output text NOT NULL DEFAULT '',
+    error text,
+    finished_at timestamp with time zone,
+    PRIMARY KEY (job_id, repo_id)
+);
+
+CREATE INDEX IF NOT EXISTS search_export_job_repos_job_id_state ON search_export_job_repos(job_id, state);
+
+COMMIT;
@@ -106,6 +106,8 @@
 // 1528395668_campaign_description_nullable.up.sql (143B)
 // 1528395669_add_synced_at_to_perms_tables.down.sql (121B)
 // 1528395669_add_synced_at_to_perms_tables.up.sql (143B)
+// 1528395670_search_export_jobs.down.sql (104B)
+// 1528395670_search_export_jobs.up.sql (1.237kB)
 
 package migrations
 
@@ -2294,6 +2296,46 @@ func _1528395669_add_synced_at_to_perms_tablesUpSql() (*asset, error) {
 	return a, nil
 }
 
+var __1528395670_search_export_jobsDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x73\x72\x75\xf7\xf4\xb3\xe6\xe2\x72\x09\xf2\x0f\x50\x08\x71\x74\xf2\x71\x55\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x28\x4e\x4d\x2c\x4a\xce\x88\x4f\xad\x28\xc8\x2f\x2a\x89\xcf\xca\x4f\x8a\x2f\x4a\x2d\xc8\x2f\xb6\x26\x52\x35\x50\x21\x97\xb3\xbf\xaf\xaf\x67\x88\x35\x17\x00\x47\xaa\x5e\x9e\x68\x00\x00\x00")
+
+func _1528395670_search_export_jobsDownSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__1528395670_search_export_jobsDownSql,
+		"1528395670_search_export_jobs.down.sql",
+	)
+}
+
+func _1528395670_search_export_jobsDownSql() (*asset, error) {
+	bytes, err := _1528395670_search_export_jobsDownSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "1528395670_search_export_jobs.down.sql", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0xaa, 0x84, 0xd6, 0xed, 0xfc, 0x16, 0x38, 0xd6, 0x2e, 0x4e, 0x77, 0x9b, 0xbe, 0x1a, 0x7, 0xf8, 0xbf, 0xa, 0x7, 0x78, 0xce, 0xfe, 0xa4, 0x81, 0x76, 0xa3, 0x33, 0xf9, 0x58, 0x4c, 0xf6, 0x38}}
+	return a, nil
+}
+
+var __1528395670_search_export_jobsUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xa4\x93\x41\x6f\x9b\x40\x10\x85\xef\xfc\x8a\xb9\x05\xa4\x1c\x7a\xf7\x89\xe0\x75\x85\x8a\x71\x85\x89\x94\x9c\x56\x0b\x4c\xcd\x46\x81\x25\xb3\xb3\x4a\xd2\x5f\x5f\x99\x35\xae\xd5\x50\x3b\x56\x8e\xab\x37\xf3\xde\x68\xe6\xdb\x3b\xf1\x3d\xcd\x17\x41\x90\x14\x22\x2e\x05\x94\xf1\x5d\x26\x20\x5d\x41\xbe\x29\x41\x3c\xa4\xdb\x72\x0b\x16\x15\xd5\xad\xc4\xb7\xc1\x10\xcb\x27\x53\x59\x08\x03\x00\x00\xdd\x40\xa5\x77\x16\x49\xab\x67\xf8\x59\xa4\xeb\xb8\x78\x84\x1f\xe2\xf1\x76\x54\x9d\x45\x92\xba\x01\xdd\x33\xee\x90\x46\xc7\xfc\x3e\xcb\xa0\x10\x2b\x51\x88\x3c\x11\xdb\xb1\xc6\x86\xba\x89\x60\x93\xc3\x52\x64\xa2\x14\x90\xc4\xdb\x24\x5e\x0a\x6f\xf2\xe2\x90\xde\x81\xf1\x8d\x8f\xfd\x5e\x18\x14\x33\x52\x2f\xf9\x7d\xc0\x39\xfd\x97\xa1\x4e\xf1\x9c\x62\x59\xf1\x3f\x2d\xb0\x14\xab\xf8\x3e\x2b\xe1\xe6\xc5\xa1\xc3\xe6\xe6\xe0\xa1\xf4\xb3\x23\x94\x1d\x5a\xab\x76\xbe\xc7\x2b\x35\xa1\x62\x6c\xe4\x3e\x41\x77\x68\x59\x75\x03\xbc\x6a\x6e\xc7\x27\xfc\x36\x3d\x7e\x34\xef\xcd\x6b\x18\x1d\x67\xa0\x0b\xfd\x87\x11\x74\xaf\x6d\xfb\x99\xca\x16\x15\x71\x85\x8a\x2f\x97\xee\x57\xd7\x0d\xfc\xf1\x32\xd3\xa4\xdf\x82\xe8\x2f\x12\x69\xbe\x14\x0f\x17\x91\x90\x7e\xad\x9b\x7c\x46\x0b\x47\x2d\x5a\x5c\xe9\x38\x01\x34\xef\x79\x50\xa3\x2b\xd9\x95\x84\x83\x99\x00\x7e\x32\xd5\x3e\xa0\xd2\x3b\xdd\xf3\x2c\xa0\x33\xc1\x67\x68\xdd\x7b\xcf\x21\x7f\xa2\xf6\xaa\x43\xa8\xf5\x97\xb8\xec\x14\xd7\xad\xac\x8d\xeb\xcf\xdd\xd0\x87\x1a\xc7\x83\xe3\xff\xd9\x1e\x0c\x91\xc8\xd0\x09\xde\x9f\xa7\xee\xe4\xd7\x43\xe8\xd7\x79\x3b\xad\x21\xba\x9a\x22\x7f\x9c\xf1\x4c\xba\x39\x43\x94\xaf\x3b\xe6\x4d\x78\x05\xc9\x66\xbd\x4e\xcb\x45\xf0\x67\x00\x76\x78\xf1\xb5\xd5\x04\x00\x00")
+
+func _1528395670_search_export_jobsUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__1528395670_search_export_jobsUpSql,
+		"1528395670_search_export_jobs.up.sql",
+	)
+}
+
+func _1528395670_search_export_jobsUpSql() (*asset, error) {
+	bytes, err := _1528395670_search_export_jobsUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "1528395670_search_export_jobs.up.sql", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0x4e, 0x12, 0xd6, 0xaa, 0x92, 0x88, 0x6d, 0x2a, 0x71, 0x69, 0x49, 0xf1, 0x27, 0xdf, 0xe2, 0x8b, 0xcf, 0xa, 0x73, 0xe1, 0x79, 0x3b, 0x23, 0xca, 0x8d, 0xe8, 0x23, 0xcb, 0xa6, 0x3b, 0xc5, 0x9b}}
+	return a, nil
+}
+
 // Asset loads and returns the asset for the given name.
 // It returns an error if the asset could not be found or
 // could not be loaded.
@@ -2491,17 +2533,21 @@ var _bindata = map[string]func() (*asset, error){
 	"1528395668_campaign_description_nullable.up.sql":                         _1528395668_campaign_description_nullableUpSql,
 	"1528395669_add_synced_at_to_perms_tables.down.sql":                       _1528395669_add_synced_at_to_perms_tablesDownSql,
 	"1528395669_add_synced_at_to_perms_tables.up.sql":                         _1528395669_add_synced_at_to_perms_tablesUpSql,
+	"1528395670_search_export_jobs.down.sql":                                  _1528395670_search_export_jobsDownSql,
+	"1528395670_search_export_jobs.up.sql":                                    _1528395670_search_export_jobsUpSql,
 }
 
 // AssetDir returns the file names below a certain
 // directory embedded in the file by go-bindata.
 // For example if you run go-bindata on data/... and data contains the
 // following hierarchy:
-//     data/
-//       foo.txt
-//       img/
-//         a.png
-//         b.png
+//
+//	data/
+//	  foo.txt
+//	  img/
+//	    a.png
+//	    b.png
+//
 // then AssetDir("data") would return []string{"foo.txt", "img"},
 // AssetDir("data/img") would return []string{"a.png", "b.png"},
 // AssetDir("foo.txt") and AssetDir("notexist") would return an error, and
@@ -2640,6 +2686,8 @@ var _bintree = &bintree{nil, map[string]*bintree{
 	"1528395668_campaign_description_nullable.up.sql":                         {_1528395668_campaign_description_nullableUpSql, map[string]*bintree{}},
 	"1528395669_add_synced_at_to_perms_tables.down.sql":                       {_1528395669_add_synced_at_to_perms_tablesDownSql, map[string]*bintree{}},
 	"1528395669_add_synced_at_to_perms_tables.up.sql":                         {_1528395669_add_synced_at_to_perms_tablesUpSql, map[string]*bintree{}},
+	"1528395670_search_export_jobs.down.sql":                                  {_1528395670_search_export_jobsDownSql, map[string]*bintree{}},
+	"1528395670_search_export_jobs.up.sql":                                    {_1528395670_search_export_jobsUpSql, map[string]*bintree{}},
 }}
 
 // RestoreAsset restores an asset under the given directory.
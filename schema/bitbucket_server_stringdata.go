@@ -244,9 +244,40 @@ const BitbucketServerSchemaJSON = `{
           "default": "72h"
         }
       }
+    },
+    "cloneOptions": {
+      "description": "Options for cloning very large repositories as partial or shallow clones. The first entry whose pattern matches the Sourcegraph name of a repository (as generated by repositoryPathPattern) applies to it. A repository that is already cloned is cloned again when its options change.",
+      "type": "array",
+      "items": {
+        "$ref": "#/definitions/CloneOptionsOverride"
+      },
+      "examples": [[{ "pattern": "^github\\.example\\.com/myorg/monorepo$", "blobSizeLimit": "1m", "depth": 1000 }]]
     }
   },
   "definitions": {
+    "CloneOptionsOverride": {
+      "title": "BitbucketServerCloneOptionsOverride",
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["pattern"],
+      "properties": {
+        "pattern": {
+          "description": "Regular expression matched against the Sourcegraph name of a repository.",
+          "type": "string",
+          "format": "regex"
+        },
+        "blobSizeLimit": {
+          "description": "Clone the repository without the blobs larger than this size, such as \"1m\" (git clone --filter=blob:limit=...). The missing blobs are fetched from the code host when they are read, so the code host must support partial clones. Requires git 2.44 or later on gitserver, otherwise the repository is cloned with all its blobs.",
+          "type": "string",
+          "pattern": "^[0-9]+[kmg]?$"
+        },
+        "depth": {
+          "description": "Clone only the most recent commits of the history of the repository, up to this depth (git clone --depth). Features that need the full history, such as blame and the diffs of commits, are unavailable for the repository, and the commit history ends at this depth.",
+          "type": "integer",
+          "minimum": 1
+        }
+      }
+    },
     "UsernameIdentity": {
       "title": "BitbucketServerUsernameIdentity",
       "type": "object",
@@ -8,10 +8,21 @@ import (
 	"fmt"
 )
 
+type AWSCodeCommitCloneOptionsOverride struct {
+	// BlobSizeLimit description: Clone the repository without the blobs larger than this size, such as "1m" (git clone --filter=blob:limit=...). The missing blobs are fetched from the code host when they are read, so the code host must support partial clones. Requires git 2.44 or later on gitserver, otherwise the repository is cloned with all its blobs.
+	BlobSizeLimit string `json:"blobSizeLimit,omitempty"`
+	// Depth description: Clone only the most recent commits of the history of the repository, up to this depth (git clone --depth). Features that need the full history, such as blame and the diffs of commits, are unavailable for the repository, and the commit history ends at this depth.
+	Depth int `json:"depth,omitempty"`
+	// Pattern description: Regular expression matched against the Sourcegraph name of a repository.
+	Pattern string `json:"pattern"`
+}
+
 // AWSCodeCommitConnection description: Configuration for a connection to AWS CodeCommit.
 type AWSCodeCommitConnection struct {
 	// AccessKeyID description: The AWS access key ID to use when listing and updating repositories from AWS CodeCommit. Must have the AWSCodeCommitReadOnly IAM policy.
 	AccessKeyID string `json:"accessKeyID"`
+	// CloneOptions description: Options for cloning very large repositories as partial or shallow clones. The first entry whose pattern matches the Sourcegraph name of a repository (as generated by repositoryPathPattern) applies to it. A repository that is already cloned is cloned again when its options change.
+	CloneOptions []*AWSCodeCommitCloneOptionsOverride `json:"cloneOptions,omitempty"`
 	// Exclude description: A list of repositories to never mirror from AWS CodeCommit.
 	//
 	// Supports excluding by name ({"name": "git-codecommit.us-west-1.amazonaws.com/repo-name"}) or by ARN ({"id": "arn:aws:codecommit:us-west-1:999999999999:name"}).
@@ -111,12 +122,23 @@ func (v *AuthProviders) UnmarshalJSON(data []byte) error {
 	return fmt.Errorf("tagged union type must have a %q property whose value is one of %s", "type", []string{"builtin", "saml", "openidconnect", "http-header", "github", "gitlab"})
 }
 
+type BitbucketCloudCloneOptionsOverride struct {
+	// BlobSizeLimit description: Clone the repository without the blobs larger than this size, such as "1m" (git clone --filter=blob:limit=...). The missing blobs are fetched from the code host when they are read, so the code host must support partial clones. Requires git 2.44 or later on gitserver, otherwise the repository is cloned with all its blobs.
+	BlobSizeLimit string `json:"blobSizeLimit,omitempty"`
+	// Depth description: Clone only the most recent commits of the history of the repository, up to this depth (git clone --depth). Features that need the full history, such as blame and the diffs of commits, are unavailable for the repository, and the commit history ends at this depth.
+	Depth int `json:"depth,omitempty"`
+	// Pattern description: Regular expression matched against the Sourcegraph name of a repository.
+	Pattern string `json:"pattern"`
+}
+
 // BitbucketCloudConnection description: Configuration for a connection to Bitbucket Cloud.
 type BitbucketCloudConnection struct {
 	// ApiURL description: The API URL of Bitbucket Cloud, such as https://api.bitbucket.org. Generally, admin should not modify the value of this option because Bitbucket Cloud is a public hosting platform.
 	ApiURL string `json:"apiURL,omitempty"`
 	// AppPassword description: The app password to use when authenticating to the Bitbucket Cloud. Also set the corresponding "username" field.
 	AppPassword string `json:"appPassword"`
+	// CloneOptions description: Options for cloning very large repositories as partial or shallow clones. The first entry whose pattern matches the Sourcegraph name of a repository (as generated by repositoryPathPattern) applies to it. A repository that is already cloned is cloned again when its options change.
+	CloneOptions []*BitbucketCloudCloneOptionsOverride `json:"cloneOptions,omitempty"`
 	// Exclude description: A list of repositories to never mirror from Bitbucket Cloud. Takes precedence over "teams" configuration.
 	//
 	// Supports excluding by name ({"name": "myorg/myrepo"}) or by UUID ({"uuid": "{fceb73c7-cef6-4abe-956d-e471281126bd}"}).
@@ -168,6 +190,14 @@ type BitbucketServerAuthorization struct {
 	// If set to zero, Sourcegraph will sync a user's entire accessible repository list on every request (NOT recommended).
 	Ttl string `json:"ttl,omitempty"`
 }
+type BitbucketServerCloneOptionsOverride struct {
+	// BlobSizeLimit description: Clone the repository without the blobs larger than this size, such as "1m" (git clone --filter=blob:limit=...). The missing blobs are fetched from the code host when they are read, so the code host must support partial clones. Requires git 2.44 or later on gitserver, otherwise the repository is cloned with all its blobs.
+	BlobSizeLimit string `json:"blobSizeLimit,omitempty"`
+	// Depth description: Clone only the most recent commits of the history of the repository, up to this depth (git clone --depth). Features that need the full history, such as blame and the diffs of commits, are unavailable for the repository, and the commit history ends at this depth.
+	Depth int `json:"depth,omitempty"`
+	// Pattern description: Regular expression matched against the Sourcegraph name of a repository.
+	Pattern string `json:"pattern"`
+}
 
 // BitbucketServerConnection description: Configuration for a connection to Bitbucket Server.
 type BitbucketServerConnection struct {
@@ -175,6 +205,8 @@ type BitbucketServerConnection struct {
 	Authorization *BitbucketServerAuthorization `json:"authorization,omitempty"`
 	// Certificate description: TLS certificate of the Bitbucket Server instance. This is only necessary if the certificate is self-signed or signed by an internal CA. To get the certificate run `openssl s_client -connect HOST:443 -showcerts < /dev/null 2> /dev/null | openssl x509 -outform PEM`. To escape the value into a JSON string, you may want to use a tool like https://json-escape-text.now.sh.
 	Certificate string `json:"certificate,omitempty"`
+	// CloneOptions description: Options for cloning very large repositories as partial or shallow clones. The first entry whose pattern matches the Sourcegraph name of a repository (as generated by repositoryPathPattern) applies to it. A repository that is already cloned is cloned again when its options change.
+	CloneOptions []*BitbucketServerCloneOptionsOverride `json:"cloneOptions,omitempty"`
 	// Exclude description: A list of repositories to never mirror from this Bitbucket Server instance. Takes precedence over "repos" and "repositoryQuery".
 	//
 	// Supports excluding by name ({"name": "projectKey/repositorySlug"}) or by ID ({"id": 42}).
@@ -455,6 +487,14 @@ type GitHubAuthorization struct {
 	// Public repositories are cached once for all users per cache TTL period.
 	Ttl string `json:"ttl,omitempty"`
 }
+type GitHubCloneOptionsOverride struct {
+	// BlobSizeLimit description: Clone the repository without the blobs larger than this size, such as "1m" (git clone --filter=blob:limit=...). The missing blobs are fetched from the code host when they are read, so the code host must support partial clones. Requires git 2.44 or later on gitserver, otherwise the repository is cloned with all its blobs.
+	BlobSizeLimit string `json:"blobSizeLimit,omitempty"`
+	// Depth description: Clone only the most recent commits of the history of the repository, up to this depth (git clone --depth). Features that need the full history, such as blame and the diffs of commits, are unavailable for the repository, and the commit history ends at this depth.
+	Depth int `json:"depth,omitempty"`
+	// Pattern description: Regular expression matched against the Sourcegraph name of a repository.
+	Pattern string `json:"pattern"`
+}
 
 // GitHubConnection description: Configuration for a connection to GitHub or GitHub Enterprise.
 type GitHubConnection struct {
@@ -462,6 +502,8 @@ type GitHubConnection struct {
 	Authorization *GitHubAuthorization `json:"authorization,omitempty"`
 	// Certificate description: TLS certificate of the GitHub Enterprise instance. This is only necessary if the certificate is self-signed or signed by an internal CA. To get the certificate run `openssl s_client -connect HOST:443 -showcerts < /dev/null 2> /dev/null | openssl x509 -outform PEM`. To escape the value into a JSON string, you may want to use a tool like https://json-escape-text.now.sh.
 	Certificate string `json:"certificate,omitempty"`
+	// CloneOptions description: Options for cloning very large repositories as partial or shallow clones. The first entry whose pattern matches the Sourcegraph name of a repository (as generated by repositoryPathPattern) applies to it. A repository that is already cloned is cloned again when its options change.
+	CloneOptions []*GitHubCloneOptionsOverride `json:"cloneOptions,omitempty"`
 	// Exclude description: A list of repositories to never mirror from this GitHub instance. Takes precedence over "orgs", "repos", and "repositoryQuery" configuration.
 	//
 	// Supports excluding by name ({"name": "owner/name"}) or by ID ({"id": "MDEwOlJlcG9zaXRvcnkxMTczMDM0Mg=="}).
@@ -552,6 +594,14 @@ type GitLabAuthorization struct {
 	// Public and internal repositories are cached once for all users per cache TTL period.
 	Ttl string `json:"ttl,omitempty"`
 }
+type GitLabCloneOptionsOverride struct {
+	// BlobSizeLimit description: Clone the repository without the blobs larger than this size, such as "1m" (git clone --filter=blob:limit=...). The missing blobs are fetched from the code host when they are read, so the code host must support partial clones. Requires git 2.44 or later on gitserver, otherwise the repository is cloned with all its blobs.
+	BlobSizeLimit string `json:"blobSizeLimit,omitempty"`
+	// Depth description: Clone only the most recent commits of the history of the repository, up to this depth (git clone --depth). Features that need the full history, such as blame and the diffs of commits, are unavailable for the repository, and the commit history ends at this depth.
+	Depth int `json:"depth,omitempty"`
+	// Pattern description: Regular expression matched against the Sourcegraph name of a repository.
+	Pattern string `json:"pattern"`
+}
 
 // GitLabConnection description: Configuration for a connection to GitLab (GitLab.com or GitLab self-managed).
 type GitLabConnection struct {
@@ -559,6 +609,8 @@ type GitLabConnection struct {
 	Authorization *GitLabAuthorization `json:"authorization,omitempty"`
 	// Certificate description: TLS certificate of the GitLab instance. This is only necessary if the certificate is self-signed or signed by an internal CA. To get the certificate run `openssl s_client -connect HOST:443 -showcerts < /dev/null 2> /dev/null | openssl x509 -outform PEM`. To escape the value into a JSON string, you may want to use a tool like https://json-escape-text.now.sh.
 	Certificate string `json:"certificate,omitempty"`
+	// CloneOptions description: Options for cloning very large repositories as partial or shallow clones. The first entry whose pattern matches the Sourcegraph name of a repository (as generated by repositoryPathPattern) applies to it. A repository that is already cloned is cloned again when its options change.
+	CloneOptions []*GitLabCloneOptionsOverride `json:"cloneOptions,omitempty"`
 	// Exclude description: A list of projects to never mirror from this GitLab instance. Takes precedence over "projects" and "projectQuery" configuration. Supports excluding by name ({"name": "group/name"}) or by ID ({"id": 42}).
 	Exclude []*ExcludedGitLabProject `json:"exclude,omitempty"`
 	// GitURLType description: The type of Git URLs to use for cloning and fetching Git repositories on this GitLab instance.
@@ -610,11 +662,21 @@ type GitLabRateLimit struct {
 	// RequestsPerHour description: Requests per hour permitted. This is an average, calculated per second.
 	RequestsPerHour float64 `json:"requestsPerHour"`
 }
+type GitoliteCloneOptionsOverride struct {
+	// BlobSizeLimit description: Clone the repository without the blobs larger than this size, such as "1m" (git clone --filter=blob:limit=...). The missing blobs are fetched from the code host when they are read, so the code host must support partial clones. Requires git 2.44 or later on gitserver, otherwise the repository is cloned with all its blobs.
+	BlobSizeLimit string `json:"blobSizeLimit,omitempty"`
+	// Depth description: Clone only the most recent commits of the history of the repository, up to this depth (git clone --depth). Features that need the full history, such as blame and the diffs of commits, are unavailable for the repository, and the commit history ends at this depth.
+	Depth int `json:"depth,omitempty"`
+	// Pattern description: Regular expression matched against the Sourcegraph name of a repository.
+	Pattern string `json:"pattern"`
+}
 
 // GitoliteConnection description: Configuration for a connection to Gitolite.
 type GitoliteConnection struct {
 	// Blacklist description: Regular expression to filter repositories from auto-discovery, so they will not get cloned automatically.
 	Blacklist string `json:"blacklist,omitempty"`
+	// CloneOptions description: Options for cloning very large repositories as partial or shallow clones. The first entry whose pattern matches the Sourcegraph name of a repository (as generated by repositoryPathPattern) applies to it. A repository that is already cloned is cloned again when its options change.
+	CloneOptions []*GitoliteCloneOptionsOverride `json:"cloneOptions,omitempty"`
 	// Exclude description: A list of repositories to never mirror from this Gitolite instance. Supports excluding by exact name ({"name": "foo"}).
 	Exclude []*ExcludedGitoliteRepo `json:"exclude,omitempty"`
 	// Host description: Gitolite host that stores the repositories (e.g., git@gitolite.example.com, ssh://git@gitolite.example.com:2222/).
@@ -737,10 +799,20 @@ type OpenIDConnectAuthProvider struct {
 	RequireEmailDomain string `json:"requireEmailDomain,omitempty"`
 	Type               string `json:"type"`
 }
+type OtherExternalServiceCloneOptionsOverride struct {
+	// BlobSizeLimit description: Clone the repository without the blobs larger than this size, such as "1m" (git clone --filter=blob:limit=...). The missing blobs are fetched from the code host when they are read, so the code host must support partial clones. Requires git 2.44 or later on gitserver, otherwise the repository is cloned with all its blobs.
+	BlobSizeLimit string `json:"blobSizeLimit,omitempty"`
+	// Depth description: Clone only the most recent commits of the history of the repository, up to this depth (git clone --depth). Features that need the full history, such as blame and the diffs of commits, are unavailable for the repository, and the commit history ends at this depth.
+	Depth int `json:"depth,omitempty"`
+	// Pattern description: Regular expression matched against the Sourcegraph name of a repository.
+	Pattern string `json:"pattern"`
+}
 
 // OtherExternalServiceConnection description: Configuration for a Connection to Git repositories for which an external service integration isn't yet available.
 type OtherExternalServiceConnection struct {
-	Repos []string `json:"repos"`
+	// CloneOptions description: Options for cloning very large repositories as partial or shallow clones. The first entry whose pattern matches the Sourcegraph name of a repository (as generated by repositoryPathPattern) applies to it. A repository that is already cloned is cloned again when its options change.
+	CloneOptions []*OtherExternalServiceCloneOptionsOverride `json:"cloneOptions,omitempty"`
+	Repos        []string                                    `json:"repos"`
 	// RepositoryPathPattern description: The pattern used to generate the corresponding Sourcegraph repository name for the repositories. In the pattern, the variable "{base}" is replaced with the Git clone base URL host and path, and "{repo}" is replaced with the repository path taken from the `repos` field.
 	//
 	// For example, if your Git clone base URL is https://git.example.com/repos and `repos` contains the value "my/repo", then a repositoryPathPattern of "{base}/{repo}" would mean that a repository at https://git.example.com/repos/my/repo is available on Sourcegraph at https://sourcegraph.example.com/git.example.com/repos/my/repo.
@@ -776,9 +848,19 @@ type Phabricator struct {
 	// Url description: URL of the Phabricator instance that integrates with this Gitolite instance. This should be set
 	Url string `json:"url"`
 }
+type PhabricatorCloneOptionsOverride struct {
+	// BlobSizeLimit description: Clone the repository without the blobs larger than this size, such as "1m" (git clone --filter=blob:limit=...). The missing blobs are fetched from the code host when they are read, so the code host must support partial clones. Requires git 2.44 or later on gitserver, otherwise the repository is cloned with all its blobs.
+	BlobSizeLimit string `json:"blobSizeLimit,omitempty"`
+	// Depth description: Clone only the most recent commits of the history of the repository, up to this depth (git clone --depth). Features that need the full history, such as blame and the diffs of commits, are unavailable for the repository, and the commit history ends at this depth.
+	Depth int `json:"depth,omitempty"`
+	// Pattern description: Regular expression matched against the Sourcegraph name of a repository.
+	Pattern string `json:"pattern"`
+}
 
 // PhabricatorConnection description: Configuration for a connection to Phabricator.
 type PhabricatorConnection struct {
+	// CloneOptions description: Options for cloning very large repositories as partial or shallow clones. The first entry whose pattern matches the Sourcegraph name of a repository (as generated by repositoryPathPattern) applies to it. A repository that is already cloned is cloned again when its options change.
+	CloneOptions []*PhabricatorCloneOptionsOverride `json:"cloneOptions,omitempty"`
 	// Repos description: The list of repositories available on Phabricator.
 	Repos []*Repos `json:"repos,omitempty"`
 	// Token description: API token for the Phabricator instance.
@@ -1035,12 +1117,18 @@ type SiteConfiguration struct {
 	PermissionsUserMapping *PermissionsUserMapping `json:"permissions.userMapping,omitempty"`
 	// RepoListUpdateInterval description: Interval (in minutes) for checking code hosts (such as GitHub, Gitolite, etc.) for new repositories.
 	RepoListUpdateInterval int `json:"repoListUpdateInterval,omitempty"`
+	// SearchIndexBranches description: A map from repository name to a list of additional branches to index, besides the default branch. Branches may be glob patterns such as "release/*". Searches of these branches, such as repo:^github\.com/foo/bar$@release/* or repo:^github\.com/foo/bar$@*refs/heads/release/*, are served by indexed search. Requires a version of indexed search that supports indexing multiple branches. At most 64 branches are indexed per repository. If a repository has more, searches of its glob patterns use unindexed search.
+	SearchIndexBranches map[string][]string `json:"search.index.branches,omitempty"`
 	// SearchIndexEnabled description: Whether indexed search is enabled. If unset Sourcegraph detects the environment to decide if indexed search is enabled. Indexed search is RAM heavy, and is disabled by default in the single docker image. All other environments will have it enabled by default. The size of all your repository working copies is the amount of additional RAM required.
 	SearchIndexEnabled *bool `json:"search.index.enabled,omitempty"`
 	// SearchIndexSymbolsEnabled description: Whether indexed symbol search is enabled. This is contingent on the indexed search configuration, and is true by default for instances with indexed search enabled. Enabling this will cause every repository to re-index, which is a time consuming (several hours) operation. Additionally, it requires more storage and ram to accommodate the added symbols information in the search index.
 	SearchIndexSymbolsEnabled *bool `json:"search.index.symbols.enabled,omitempty"`
 	// SearchLargeFiles description: A list of file glob patterns where matching files will be indexed and searched regardless of their size. The glob pattern syntax can be found here: https://golang.org/pkg/path/filepath/#Match.
 	SearchLargeFiles []string `json:"search.largeFiles,omitempty"`
+	// SearchSymbolsAggregatedIndex description: Whether symbol searches of repositories that are not served by indexed search use the aggregated index of the symbols service. The aggregated index searches all the repositories on a symbols service replica with one query, instead of sending one request per repository. A repository is added to the aggregated index in the background the first time it is searched at a commit, and is searched on its own until then.
+	SearchSymbolsAggregatedIndex bool `json:"search.symbols.aggregatedIndex,omitempty"`
+	// SearchSymbolsParsers description: A map from language name to the parser that extracts the symbols of files in that language, instead of universal-ctags ("ctags"). The "go" parser parses Go files with the Go standard library, and reports the scopes, signatures and parents of symbols more accurately. Changing the parser of a language causes the symbols of repositories to be parsed again.
+	SearchSymbolsParsers map[string]string `json:"search.symbols.parsers,omitempty"`
 	// UpdateChannel description: The channel on which to automatically check for Sourcegraph updates.
 	UpdateChannel string `json:"update.channel,omitempty"`
 	// UseJaeger description: DEPRECATED. Use `"observability.tracing": { "sampling": "all" }`, instead. Enables Jaeger tracing.
@@ -34,6 +34,34 @@ const SiteSchemaJSON = `{
       "!go": { "pointer": true },
       "group": "Search"
     },
+    "search.symbols.aggregatedIndex": {
+      "description": "Whether symbol searches of repositories that are not served by indexed search use the aggregated index of the symbols service. The aggregated index searches all the repositories on a symbols service replica with one query, instead of sending one request per repository. A repository is added to the aggregated index in the background the first time it is searched at a commit, and is searched on its own until then.",
+      "type": "boolean",
+      "default": false,
+      "group": "Search"
+    },
+    "search.symbols.parsers": {
+      "description": "A map from language name to the parser that extracts the symbols of files in that language, instead of universal-ctags (\"ctags\"). The \"go\" parser parses Go files with the Go standard library, and reports the scopes, signatures and parents of symbols more accurately. Changing the parser of a language causes the symbols of repositories to be parsed again.",
+      "type": "object",
+      "additionalProperties": {
+        "type": "string",
+        "enum": ["ctags", "go"]
+      },
+      "group": "Search",
+      "examples": [{ "Go": "go" }]
+    },
+    "search.index.branches": {
+      "description": "A map from repository name to a list of additional branches to index, besides the default branch. Branches may be glob patterns such as \"release/*\". Searches of these branches, such as repo:^github\\.com/foo/bar$@release/* or repo:^github\\.com/foo/bar$@*refs/heads/release/*, are served by indexed search. Requires a version of indexed search that supports indexing multiple branches. At most 64 branches are indexed per repository. If a repository has more, searches of its glob patterns use unindexed search.",
+      "type": "object",
+      "additionalProperties": {
+        "type": "array",
+        "items": {
+          "type": "string"
+        }
+      },
+      "group": "Search",
+      "examples": [{ "github.com/sourcegraph/sourcegraph": ["3.15", "release/*"] }]
+    },
     "search.largeFiles": {
       "description": "A list of file glob patterns where matching files will be indexed and searched regardless of their size. The glob pattern syntax can be found here: https://golang.org/pkg/path/filepath/#Match.",
       "type": "array",